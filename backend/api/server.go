@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"gongChang/config"
 	"gongChang/routes"
 	"github.com/gin-gonic/gin"
@@ -8,9 +9,10 @@ import (
 )
 
 type Server struct {
-	config *config.Config
-	router *gin.Engine
-	db     *gorm.DB
+	config     *config.Config
+	router     *gin.Engine
+	background *routes.Background
+	db         *gorm.DB
 }
 
 func NewServer(cfg *config.Config, db *gorm.DB) *Server {
@@ -25,9 +27,13 @@ func NewServer(cfg *config.Config, db *gorm.DB) *Server {
 }
 
 func (s *Server) setupRoutes() {
-	s.router = routes.SetupRouter(s.db, s.config)
+	s.router, s.background = routes.SetupRouter(s.db, s.config)
 }
 
+// Start 启动后台任务并监听端口，服务退出时停止后台任务
 func (s *Server) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.background.Start(ctx)
 	return s.router.Run(":" + s.config.Server.Port)
 } 
\ No newline at end of file
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"gongChang/config"
+	"gongChang/database"
+	"gongChang/models"
+	"gongChang/services"
+	"gongChang/storage"
+)
+
+// reconcile 检查存储与数据库的一致性：孤立的存储对象、引用数错误的 blob、订单中失效的文件ID
+// 用法（在 backend 目录下）：go run ./cmd/reconcile [-fix]
+// 不带 -fix 时只输出报告，不做任何修改。
+func main() {
+	fix := flag.Bool("fix", false, "删除孤立对象、修正引用数并从订单中移除失效的文件ID")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("加载配置失败: %v", err)
+	}
+	db, err := database.InitDB(cfg)
+	if err != nil {
+		log.Fatalf("连接数据库失败: %v", err)
+	}
+	store, err := storage.NewFromConfig(cfg)
+	if err != nil {
+		log.Fatalf("初始化存储失败: %v", err)
+	}
+
+	fileService := services.NewFileService(db, store, cfg.StorageURLTTL()).WithActor(models.SystemActor)
+	report, err := fileService.ReconcileFiles(*fix)
+	if err != nil {
+		log.Fatalf("对账失败: %v", err)
+	}
+
+	fmt.Printf("孤立对象: %d\n", len(report.OrphanObjects))
+	for _, key := range report.OrphanObjects {
+		fmt.Printf("  %s\n", key)
+	}
+	fmt.Printf("引用数错误的 blob: %d\n", len(report.RefMismatches))
+	for _, m := range report.RefMismatches {
+		fmt.Printf("  %s 记录=%d 实际=%d\n", m.Hash, m.RefCount, m.Actual)
+	}
+	fmt.Printf("存储对象缺失的 blob: %d\n", len(report.MissingBlobs))
+	for _, hash := range report.MissingBlobs {
+		fmt.Printf("  %s\n", hash)
+	}
+	fmt.Printf("订单中失效的文件ID: %d\n", len(report.DanglingOrderFiles))
+	for _, d := range report.DanglingOrderFiles {
+		fmt.Printf("  订单 %d %s: %s\n", d.OrderID, d.Role, d.FileID)
+	}
+	if !*fix && (len(report.OrphanObjects) > 0 || len(report.RefMismatches) > 0 || len(report.DanglingOrderFiles) > 0) {
+		fmt.Println("使用 -fix 执行修复")
+	}
+}
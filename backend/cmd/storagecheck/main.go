@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"gongChang/config"
+	"gongChang/storage"
+)
+
+// storagecheck 对配置的存储后端做一次读写检查，可用于验证 MinIO 等 S3 兼容服务的配置
+// 用法（在 backend 目录下）：go run ./cmd/storagecheck
+func main() {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("加载配置失败: %v", err)
+	}
+	store, err := storage.NewFromConfig(cfg)
+	if err != nil {
+		log.Fatalf("初始化存储失败: %v", err)
+	}
+
+	ctx := context.Background()
+	key := fmt.Sprintf("storagecheck/%d.txt", time.Now().UnixNano())
+	content := []byte("gongchang storage check")
+
+	if err := store.Put(ctx, key, bytes.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+		log.Fatalf("写入失败: %v", err)
+	}
+	defer func() {
+		if err := store.Delete(ctx, key); err != nil {
+			log.Printf("删除失败: %v", err)
+		}
+	}()
+
+	info, err := store.Stat(ctx, key)
+	if err != nil {
+		log.Fatalf("读取元信息失败: %v", err)
+	}
+	fmt.Printf("stat: key=%s size=%d type=%s\n", info.Key, info.Size, info.ContentType)
+
+	r, err := store.Get(ctx, key)
+	if err != nil {
+		log.Fatalf("读取失败: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || !bytes.Equal(data, content) {
+		log.Fatalf("读取内容不一致: %q %v", data, err)
+	}
+
+	url, err := store.PresignGet(ctx, key, time.Minute, storage.PresignOptions{Attachment: true})
+	if err != nil {
+		log.Fatalf("生成签名地址失败: %v", err)
+	}
+	fmt.Printf("presigned: %s\n", url)
+
+	// 本地存储的签名地址由应用服务器提供，只有 S3 兼容存储可以直接请求
+	if cfg.Storage.Driver == "s3" {
+		resp, err := http.Get(url)
+		if err != nil {
+			log.Fatalf("请求签名地址失败: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !bytes.Equal(body, content) {
+			log.Fatalf("签名地址下载失败: %s %s", resp.Status, body)
+		}
+	}
+	fmt.Println("storage check passed")
+}
@@ -5,6 +5,7 @@ import (
 	"gopkg.in/yaml.v3"
 	"io/ioutil"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -28,9 +29,63 @@ type Config struct {
 		DB       int    `yaml:"db"`
 	} `yaml:"redis"`
 	JWT struct {
-		Secret string `yaml:"secret"`
-		Expire int    `yaml:"expire"`
+		Secret        string `yaml:"secret"`
+		AccessExpire  int    `yaml:"access_expire"`  // 访问令牌有效期（分钟）
+		RefreshExpire int    `yaml:"refresh_expire"` // 刷新令牌有效期（小时）
 	} `yaml:"jwt"`
+	Storage struct {
+		Driver    string `yaml:"driver"`     // local 或 s3，默认 local
+		URLExpire int    `yaml:"url_expire"` // 签名下载地址有效期（分钟）
+		Local     struct {
+			Root    string `yaml:"root"`
+			BaseURL string `yaml:"base_url"` // 签名地址的前缀，为空时使用相对地址
+			Secret  string `yaml:"secret"`   // 签名密钥，为空时使用 JWT 密钥
+		} `yaml:"local"`
+		S3 struct {
+			Endpoint  string `yaml:"endpoint"`
+			Region    string `yaml:"region"`
+			Bucket    string `yaml:"bucket"`
+			AccessKey string `yaml:"access_key"`
+			SecretKey string `yaml:"secret_key"`
+			PathStyle bool   `yaml:"path_style"`
+		} `yaml:"s3"`
+	} `yaml:"storage"`
+	Tracking struct {
+		Driver       string `yaml:"driver"`        // fake 或 none，默认 fake（本地模拟）
+		PollInterval int    `yaml:"poll_interval"` // 物流轨迹轮询间隔（分钟）
+	} `yaml:"tracking"`
+}
+
+// AccessTokenTTL 访问令牌有效期，未配置时默认15分钟
+func (c *Config) AccessTokenTTL() time.Duration {
+	if c.JWT.AccessExpire <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(c.JWT.AccessExpire) * time.Minute
+}
+
+// RefreshTokenTTL 刷新令牌有效期，未配置时默认30天
+func (c *Config) RefreshTokenTTL() time.Duration {
+	if c.JWT.RefreshExpire <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return time.Duration(c.JWT.RefreshExpire) * time.Hour
+}
+
+// StorageURLTTL 签名下载地址有效期，未配置时默认60分钟
+func (c *Config) StorageURLTTL() time.Duration {
+	if c.Storage.URLExpire <= 0 {
+		return 60 * time.Minute
+	}
+	return time.Duration(c.Storage.URLExpire) * time.Minute
+}
+
+// TrackingPollInterval 物流轨迹轮询间隔，未配置时默认30分钟
+func (c *Config) TrackingPollInterval() time.Duration {
+	if c.Tracking.PollInterval <= 0 {
+		return 30 * time.Minute
+	}
+	return time.Duration(c.Tracking.PollInterval) * time.Minute
 }
 
 type DatabaseConfig struct {
@@ -58,6 +113,9 @@ func LoadConfig() (*Config, error) {
 
 	// 处理环境变量
 	config.JWT.Secret = getEnvValue(config.JWT.Secret)
+	config.Storage.Local.Secret = getEnvValue(config.Storage.Local.Secret)
+	config.Storage.S3.AccessKey = getEnvValue(config.Storage.S3.AccessKey)
+	config.Storage.S3.SecretKey = getEnvValue(config.Storage.S3.SecretKey)
 	
 	// 处理数据库连接环境变量
 	if host := os.Getenv("DB_HOST"); host != "" {
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"errors"
+	"gongChang/middleware"
+	"gongChang/models"
+	"gongChang/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditController struct {
+	auditService *services.AuditService
+}
+
+func NewAuditController(auditService *services.AuditService) *AuditController {
+	return &AuditController{auditService: auditService}
+}
+
+// ListAuditEvents 查询审计事件
+// @Summary 查询审计事件
+// @Description 设计师可查看自己订单上的事件，工厂可查看自己实体上的事件
+// @Tags 审计
+// @Produce json
+// @Param entity_type query string false "实体类型"
+// @Param entity_id query string false "实体ID"
+// @Param order_id query int false "订单ID"
+// @Param action query string false "动作"
+// @Param actor_id query string false "操作人ID"
+// @Param from query string false "开始时间(RFC3339)"
+// @Param to query string false "结束时间(RFC3339)"
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Success 200 {object} gin.H
+// @Router /api/audit-events [get]
+func (c *AuditController) ListAuditEvents(ctx *gin.Context) {
+	var query models.AuditEventQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	events, total, err := c.auditService.ListEvents(middleware.CurrentActor(ctx), &query)
+	if err != nil {
+		var forbiddenErr *services.ForbiddenError
+		if errors.As(err, &forbiddenErr) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": forbiddenErr.Reason, "code": "forbidden"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"events":    events,
+			"total":     total,
+			"page":      query.Page,
+			"page_size": query.PageSize,
+		},
+	})
+}
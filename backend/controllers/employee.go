@@ -3,6 +3,7 @@ package controllers
 import (
 	"net/http"
 	"strconv"
+	"gongChang/middleware"
 	"gongChang/models"
 	"gongChang/services"
 	"github.com/gin-gonic/gin"
@@ -32,7 +33,7 @@ func (c *EmployeeController) CreateEmployee(ctx *gin.Context) {
 		return
 	}
 
-	employee, err := c.employeeService.CreateEmployee(factoryID, &req)
+	employee, err := c.employeeService.WithActor(middleware.CurrentActor(ctx)).CreateEmployee(factoryID, &req)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -129,7 +130,7 @@ func (c *EmployeeController) UpdateEmployee(ctx *gin.Context) {
 		return
 	}
 
-	employee, err := c.employeeService.UpdateEmployee(factoryID, uint(employeeID), &req)
+	employee, err := c.employeeService.WithActor(middleware.CurrentActor(ctx)).UpdateEmployee(factoryID, uint(employeeID), &req)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -156,7 +157,7 @@ func (c *EmployeeController) DeleteEmployee(ctx *gin.Context) {
 		return
 	}
 
-	err = c.employeeService.DeleteEmployee(factoryID, uint(employeeID))
+	err = c.employeeService.WithActor(middleware.CurrentActor(ctx)).DeleteEmployee(factoryID, uint(employeeID))
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
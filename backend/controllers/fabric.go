@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"errors"
+	"gongChang/middleware"
 	"gongChang/models"
 	"gongChang/services"
 	"net/http"
@@ -35,38 +37,17 @@ func (fc *FabricController) CreateFabric(c *gin.Context) {
 		return
 	}
 
-	// 获取当前用户信息
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
-		return
-	}
-
-	// 获取用户角色
-	userRole, exists := c.Get("user_role")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户角色未找到"})
-		return
-	}
-
-	// 根据用户角色设置相应的ID字段
-	switch userRole.(string) {
-	case "designer":
-		userIDStr := userID.(string)
-		req.DesignerID = userIDStr
-	case "supplier":
-		userIDStr := userID.(string)
-		req.SupplierID = userIDStr
-	case "factory":
-		c.JSON(http.StatusForbidden, gin.H{"error": "工厂账号不允许创建布料"})
-		return
-	default:
-		c.JSON(http.StatusForbidden, gin.H{"error": "用户角色不允许创建布料"})
-		return
+	// 布料归属于创建人，角色已由路由策略限定为设计师或供应商
+	actor := middleware.CurrentActor(c)
+	switch actor.Role {
+	case models.RoleDesigner:
+		req.DesignerID = actor.UserID
+	case models.RoleSupplier:
+		req.SupplierID = actor.UserID
 	}
 
 	// 创建布料
-	fabric, err := fc.fabricService.CreateFabric(&req)
+	fabric, err := fc.fabricService.WithActor(actor).CreateFabric(&req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -126,9 +107,9 @@ func (c *FabricController) UpdateFabric(ctx *gin.Context) {
 		return
 	}
 
-	fabric, err := c.fabricService.UpdateFabric(uint(id), &req)
+	fabric, err := c.fabricService.WithActor(middleware.CurrentActor(ctx)).UpdateFabric(uint(id), &req)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondFabricLedgerError(ctx, err)
 		return
 	}
 
@@ -151,8 +132,8 @@ func (c *FabricController) DeleteFabric(ctx *gin.Context) {
 		return
 	}
 
-	if err := c.fabricService.DeleteFabric(uint(id)); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := c.fabricService.WithActor(middleware.CurrentActor(ctx)).DeleteFabric(uint(id)); err != nil {
+		respondFabricLedgerError(ctx, err)
 		return
 	}
 
@@ -289,7 +270,7 @@ func (c *FabricController) GetFabricsByMaterial(ctx *gin.Context) {
 
 // UpdateFabricStock 更新布料库存
 // @Summary 更新布料库存
-// @Description 更新指定布料的库存数量
+// @Description 按变化量调整指定布料的在库数量，记录为一条盘点调整流水
 // @Tags 布料管理
 // @Accept json
 // @Produce json
@@ -312,14 +293,117 @@ func (c *FabricController) UpdateFabricStock(ctx *gin.Context) {
 		return
 	}
 
-	if err := c.fabricService.UpdateFabricStock(uint(id), req.Quantity); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := c.fabricService.WithActor(middleware.CurrentActor(ctx)).UpdateFabricStock(uint(id), req.Quantity); err != nil {
+		respondFabricLedgerError(ctx, err)
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "Stock updated successfully"})
 }
 
+// GetFabricLedger 获取布料库存流水
+// @Summary 获取布料库存流水
+// @Description 返回布料的库存流水、各订单的预留数量，以及布料库存与流水汇总是否一致
+// @Tags 布料管理
+// @Produce json
+// @Param id path int true "布料ID"
+// @Param order_id query int false "只看某个订单的流水"
+// @Param limit query int false "返回条数，默认 100，最多 500"
+// @Success 200 {object} models.FabricLedgerResponse
+// @Router /api/fabrics/{id}/ledger [get]
+func (c *FabricController) GetFabricLedger(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid fabric ID"})
+		return
+	}
+
+	var orderID *uint
+	if v := ctx.Query("order_id"); v != "" {
+		parsed, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+			return
+		}
+		oid := uint(parsed)
+		orderID = &oid
+	}
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "100"))
+
+	ledger, err := c.fabricService.GetFabricLedger(uint(id), orderID, limit)
+	if err != nil {
+		respondFabricLedgerError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": ledger})
+}
+
+// RecordLedgerEntry 记录布料库存流水
+// @Summary 记录布料库存流水
+// @Description 入库（receipt）、为订单预留（reservation）、释放预留（release）、生产领用（consumption）或盘点调整（adjustment）
+// @Tags 布料管理
+// @Accept json
+// @Produce json
+// @Param id path int true "布料ID"
+// @Param request body models.FabricLedgerRequest true "库存流水"
+// @Success 201 {object} models.FabricLedgerEntry
+// @Router /api/fabrics/{id}/ledger [post]
+func (c *FabricController) RecordLedgerEntry(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid fabric ID"})
+		return
+	}
+
+	var req models.FabricLedgerRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	entry, err := c.fabricService.WithActor(middleware.CurrentActor(ctx)).RecordLedgerEntry(uint(id), &req)
+	if err != nil {
+		respondFabricLedgerError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"success": true, "data": entry})
+}
+
+// GetReplenishment 获取需要补货的布料
+// @Summary 获取需要补货的布料
+// @Description 当前用户名下可用数量不高于再订货点的布料，包含未完成订单的预留数量和建议补货数量
+// @Tags 布料管理
+// @Produce json
+// @Success 200 {object} []models.FabricReplenishment
+// @Router /api/fabrics/replenishment [get]
+func (c *FabricController) GetReplenishment(ctx *gin.Context) {
+	items, err := c.fabricService.ListReplenishment(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": items})
+}
+
+func respondFabricLedgerError(ctx *gin.Context, err error) {
+	var forbiddenErr *services.ForbiddenError
+	switch {
+	case errors.As(err, &forbiddenErr):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": forbiddenErr.Reason, "code": "forbidden"})
+	case errors.Is(err, services.ErrFabricNotFound), errors.Is(err, services.ErrOrderNotFound),
+		errors.Is(err, services.ErrResourceNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInsufficientStock), errors.Is(err, services.ErrFabricReservationExceeded),
+		errors.Is(err, services.ErrFabricStockBelowZero):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrFabricLedgerQuantity), errors.Is(err, services.ErrFabricLedgerOrderRequired),
+		errors.Is(err, services.ErrFabricLedgerTypeInvalid):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 // GetFabricStatistics 获取布料统计信息
 // @Summary 获取布料统计
 // @Description 获取布料的统计信息
@@ -9,12 +9,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gongChang/middleware"
 	"gongChang/models"
 	"gongChang/services"
 )
 
 type FactoryController struct {
-	DB *gorm.DB
+	DB          *gorm.DB
+	FileService *services.FileService
 }
 
 // GetFactoryList 获取工厂列表
@@ -467,7 +469,7 @@ func (fc *FactoryController) BatchUploadPhotos(c *gin.Context) {
 	category := c.PostForm("category")
 
 	// 调用服务层处理批量上传
-	fileService := services.NewFileService(fc.DB, "./uploads")
+	fileService := fc.FileService.WithActor(middleware.CurrentActor(c))
 	response, err := fileService.BatchUploadFactoryPhotos(files, fmt.Sprintf("%d", factory.ID), category)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -539,7 +541,7 @@ func (fc *FactoryController) GetFactoryPhotos(c *gin.Context) {
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
 
 	// 调用服务层获取图片列表
-	fileService := services.NewFileService(fc.DB, "./uploads")
+	fileService := fc.FileService
 	response, err := fileService.GetFactoryPhotos(factoryID, category, page, pageSize)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -604,7 +606,7 @@ func (fc *FactoryController) DeleteFactoryPhoto(c *gin.Context) {
 	}
 
 	// 调用服务层删除图片
-	fileService := services.NewFileService(fc.DB, "./uploads")
+	fileService := fc.FileService.WithActor(middleware.CurrentActor(c))
 	err = fileService.DeleteFactoryPhoto(photoID, factoryID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -681,7 +683,7 @@ func (fc *FactoryController) BatchDeletePhotos(c *gin.Context) {
 	}
 
 	// 调用服务层批量删除图片
-	fileService := services.NewFileService(fc.DB, "./uploads")
+	fileService := fc.FileService.WithActor(middleware.CurrentActor(c))
 	response, err := fileService.BatchDeleteFactoryPhotos(req.PhotoIDs, factoryID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
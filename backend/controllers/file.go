@@ -3,34 +3,28 @@ package controllers
 import (
 	"gongChang/services"
 	"gongChang/config"
+	"gongChang/middleware"
 	"gongChang/models"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
-	"encoding/json"
+	"errors"
 
 	"github.com/gin-gonic/gin"
+	"gongChang/storage"
+	"gorm.io/gorm"
 )
 
 type FileController struct {
 	fileService *services.FileService
-	uploadDir   string
 	config      *config.Config
 }
 
-func NewFileController(fileService *services.FileService, uploadDir string, cfg *config.Config) *FileController {
-	// 确保上传目录存在
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		log.Printf("Failed to create upload directory: %v", err)
-		panic(err)
-	}
-	log.Printf("Upload directory created/verified at: %s", uploadDir)
+func NewFileController(fileService *services.FileService, cfg *config.Config) *FileController {
 	return &FileController{
 		fileService: fileService,
-		uploadDir:   uploadDir,
 		config:      cfg,
 	}
 }
@@ -70,7 +64,7 @@ func (c *FileController) UploadFile(ctx *gin.Context) {
 	}
 
 	// 保存文件
-	fileRecord, err := c.fileService.SaveFile(file, header.Filename, orderID, "")
+	fileRecord, err := c.fileService.WithActor(middleware.CurrentActor(ctx)).SaveFile(file, header.Filename, orderID, "", ctx.GetString("user_id"))
 	if err != nil {
 		log.Printf("Failed to save file: %v", err)
 		if err.Error() == "订单不存在" {
@@ -81,8 +75,11 @@ func (c *FileController) UploadFile(ctx *gin.Context) {
 		return
 	}
 
-	// 构建文件访问URL - 直接访问uploads目录
-	fileURL := fmt.Sprintf("/uploads/%s", fileRecord.Path)
+	// 构建限时有效的签名访问URL
+	fileURL, err := c.fileService.GetDownloadURL(fileRecord, false)
+	if err != nil {
+		log.Printf("Failed to presign file %s: %v", fileRecord.ID, err)
+	}
 	
 	// 返回包含完整URL的响应
 	response := gin.H{
@@ -147,55 +144,81 @@ func (c *FileController) GetFileInfo(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, file)
 }
 
-// DownloadFile 处理文件下载
+// DownloadFile 重定向到文件的签名下载地址，图片可通过 size 参数（thumbnail、medium、webp）获取衍生版本，attachment=1 时以附件下载
 func (c *FileController) DownloadFile(ctx *gin.Context) {
 	fileID := ctx.Param("id")
 	log.Printf("Attempting to download file with ID: %s", fileID)
 
-	filePath, err := c.fileService.GetFilePath(fileID)
-	if err != nil {
-		log.Printf("Failed to get file path for ID %s: %v", fileID, err)
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+	if size := ctx.Query("size"); size != "" && size != "original" {
+		c.serveDerivative(ctx, fileID, size)
 		return
 	}
 
-	// 检查文件是否存在
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		log.Printf("File not found at path: %s", filePath)
+	file, err := c.fileService.GetFileByID(fileID)
+	if err != nil {
+		log.Printf("Failed to find file %s: %v", fileID, err)
 		ctx.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
 		return
 	}
 
-	// 获取文件信息
-	fileInfo, err := os.Stat(filePath)
+	// 重定向到存储后端的签名地址，文件内容不再经过应用服务器
+	url, err := c.fileService.GetDownloadURL(file, ctx.Query("attachment") == "1")
 	if err != nil {
-		log.Printf("Failed to get file info for %s: %v", filePath, err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "无法读取文件信息"})
+		log.Printf("Failed to presign file %s: %v", fileID, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "生成下载地址失败"})
 		return
 	}
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Redirect(http.StatusFound, url)
+}
 
-	// 设置CORS头
-	ctx.Header("Access-Control-Allow-Origin", "*")
-	ctx.Header("Access-Control-Allow-Methods", "GET, OPTIONS")
-	ctx.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
-	ctx.Header("Access-Control-Max-Age", "86400")
+// serveDerivative 重定向到图片衍生版本的签名地址，缺失时即时生成
+func (c *FileController) serveDerivative(ctx *gin.Context, fileID, size string) {
+	derivative, err := c.fileService.GetDerivative(fileID, size)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnknownDerivative), errors.Is(err, services.ErrDerivativeUnsupported):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, storage.ErrNotExist):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		default:
+			log.Printf("Failed to prepare %s derivative for file %s: %v", size, fileID, err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "生成图片失败"})
+		}
+		return
+	}
 
-	// 设置响应头
-	ctx.Header("Content-Description", "File Transfer")
-	ctx.Header("Content-Transfer-Encoding", "binary")
-	ctx.Header("Content-Disposition", fmt.Sprintf("inline; filename=%s", filepath.Base(filePath)))
-	ctx.Header("Content-Type", "application/octet-stream")
-	ctx.Header("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
+	url, err := c.fileService.GetDerivativeURL(derivative)
+	if err != nil {
+		log.Printf("Failed to presign derivative %s: %v", derivative.Path, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "生成下载地址失败"})
+		return
+	}
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Redirect(http.StatusFound, url)
+}
 
-	// 发送文件
-	ctx.File(filePath)
+// derivativeURLs 图片各尺寸的下载地址
+func derivativeURLs(file *models.File) gin.H {
+	if !services.IsRasterFile(file) {
+		return nil
+	}
+	return gin.H{
+		models.DerivativeThumbnail: fmt.Sprintf("/api/files/download/%s?size=%s", file.ID, models.DerivativeThumbnail),
+		models.DerivativeMedium:    fmt.Sprintf("/api/files/download/%s?size=%s", file.ID, models.DerivativeMedium),
+		models.DerivativeWebP:      fmt.Sprintf("/api/files/download/%s?size=%s", file.ID, models.DerivativeWebP),
+	}
 }
 
 // DeleteFile 处理文件删除
 func (c *FileController) DeleteFile(ctx *gin.Context) {
 	fileID := ctx.Param("id")
 
-	if err := c.fileService.DeleteFile(fileID); err != nil {
+	if err := c.fileService.WithActor(middleware.CurrentActor(ctx)).DeleteFile(fileID); err != nil {
+		if errors.Is(err, services.ErrFileInUse) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -213,14 +236,18 @@ func (c *FileController) GetFileDetails(ctx *gin.Context) {
 		return
 	}
 
-	// 构建完整的文件访问URL
-	fileURL := fmt.Sprintf("/uploads/%s", file.Path)
+	// 构建限时有效的签名访问URL
+	fileURL, err := c.fileService.GetDownloadURL(file, false)
+	if err != nil {
+		log.Printf("Failed to presign file %s: %v", file.ID, err)
+	}
 
 	ctx.JSON(http.StatusOK, gin.H{
 		"id":        file.ID,
 		"name":      file.Name,
 		"path":      file.Path,
 		"url":       fileURL,
+		"sizes":     derivativeURLs(file),
 		"order_id":  file.OrderID,
 		"type":      filepath.Ext(file.Name),
 		"created_at": file.CreatedAt,
@@ -248,8 +275,12 @@ func (c *FileController) GetBatchFileDetails(ctx *gin.Context) {
 	// 构建文件详情列表
 	fileDetails := make([]gin.H, 0, len(files))
 	
-	for _, file := range files {
-		fileURL := fmt.Sprintf("/uploads/%s", file.Path)
+	for i := range files {
+		file := &files[i]
+		fileURL, err := c.fileService.GetDownloadURL(file, false)
+		if err != nil {
+			log.Printf("Failed to presign file %s: %v", file.ID, err)
+		}
 		fileDetails = append(fileDetails, gin.H{
 			"id":        file.ID,
 			"name":      file.Name,
@@ -310,7 +341,7 @@ func (c *FileController) AddFileToOrder(ctx *gin.Context) {
 
 	// 保存文件并关联到订单
 	orderIDUint := uint(orderID)
-	fileRecord, err := c.fileService.SaveFile(file, header.Filename, &orderIDUint, req.Type)
+	fileRecord, err := c.fileService.WithActor(middleware.CurrentActor(ctx)).SaveFile(file, header.Filename, &orderIDUint, req.Type, ctx.GetString("user_id"))
 	if err != nil {
 		log.Printf("Failed to save file: %v", err)
 		if err.Error() == "订单不存在" {
@@ -322,63 +353,18 @@ func (c *FileController) AddFileToOrder(ctx *gin.Context) {
 	}
 
 	// 更新订单的文件字段
-	orderService := services.NewOrderService(c.fileService.GetDB())
-	order, err := orderService.GetOrderByID(uint(orderID))
+	updatedOrder, err := c.appendFileToOrder(ctx, uint(orderID), fileRecord.ID, req.Type, req.Description)
 	if err != nil {
-		log.Printf("Failed to get order: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取订单信息失败"})
-		return
-	}
-
-	// 根据文件类型更新订单的相应字段
-	var updateReq models.OrderUpdateRequest
-	
-	// 获取现有文件列表
-	var existingFiles []string
-	switch req.Type {
-	case "image":
-		if order.Images != nil {
-			json.Unmarshal(*order.Images, &existingFiles)
-		}
-		existingFiles = append(existingFiles, fileRecord.ID)
-		updateReq.Images = existingFiles
-	case "attachment":
-		if order.Attachments != nil {
-			json.Unmarshal(*order.Attachments, &existingFiles)
-		}
-		existingFiles = append(existingFiles, fileRecord.ID)
-		updateReq.Attachments = existingFiles
-	case "model":
-		if order.Models != nil {
-			json.Unmarshal(*order.Models, &existingFiles)
-		}
-		existingFiles = append(existingFiles, fileRecord.ID)
-		updateReq.Models = existingFiles
-	case "video":
-		if order.Videos != nil {
-			json.Unmarshal(*order.Videos, &existingFiles)
-		}
-		existingFiles = append(existingFiles, fileRecord.ID)
-		updateReq.Videos = existingFiles
-	}
-
-	// 更新订单
-	if err := orderService.UpdateOrder(uint(orderID), &updateReq); err != nil {
-		log.Printf("Failed to update order: %v", err)
+		log.Printf("Failed to add file %s to order %d: %v", fileRecord.ID, orderID, err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "更新订单失败"})
 		return
 	}
 
-	// 重新获取更新后的订单
-	updatedOrder, err := orderService.GetOrderByID(uint(orderID))
+	// 构建限时有效的签名访问URL
+	fileURL, err := c.fileService.GetDownloadURL(fileRecord, false)
 	if err != nil {
-		log.Printf("Failed to get updated order: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取更新后的订单失败"})
-		return
+		log.Printf("Failed to presign file %s: %v", fileRecord.ID, err)
 	}
-
-	// 构建文件访问URL - 直接访问uploads目录
-	fileURL := fmt.Sprintf("/uploads/%s", fileRecord.Path)
 	
 	// 构建响应
 	fileInfo := &models.FileInfo{
@@ -397,4 +383,9 @@ func (c *FileController) AddFileToOrder(ctx *gin.Context) {
 
 	log.Printf("File successfully added to order: %s", fileRecord.ID)
 	ctx.JSON(http.StatusOK, response)
-}
\ No newline at end of file
+}
+// appendFileToOrder 将文件加入订单对应用途的文件列表，返回更新后的订单
+func (c *FileController) appendFileToOrder(ctx *gin.Context, orderID uint, fileID string, fileType string, caption string) (*models.Order, error) {
+	orderService := services.NewOrderService(c.fileService.GetDB()).WithActor(middleware.CurrentActor(ctx))
+	return orderService.AttachOrderFile(orderID, fileID, models.OrderFileRole(fileType), caption)
+}
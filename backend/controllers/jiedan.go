@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"gongChang/middleware"
 	"gongChang/models"
 	"gongChang/services"
 
@@ -42,22 +45,15 @@ func (c *JiedanController) CreateJiedan(ctx *gin.Context) {
 		return
 	}
 
-	// 验证用户角色
-	userRole := ctx.GetString("user_role")
-	if userRole != "factory" {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "只有工厂用户可以进行接单操作"})
-		return
-	}
-
 	// 验证工厂ID是否与当前用户匹配
 	if req.FactoryID != userID {
 		ctx.JSON(http.StatusForbidden, gin.H{"error": "只能以自己的工厂身份进行接单"})
 		return
 	}
 
-	jiedan, err := c.jiedanService.CreateJiedan(&req)
+	jiedan, err := c.jiedanService.WithActor(middleware.CurrentActor(ctx)).CreateJiedan(&req)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondJiedanError(ctx, err)
 		return
 	}
 
@@ -199,13 +195,13 @@ func (c *JiedanController) GetJiedansByFactoryID(ctx *gin.Context) {
 
 // AcceptJiedan 同意接单
 // @Summary 同意接单
-// @Description 同意接单操作
+// @Description 订单设计师同意接单：指派订单给该工厂、订单停止接单并自动拒绝其他待处理接单；产前样批准后订单进入生产
 // @Tags 接单管理
 // @Accept json
 // @Produce json
 // @Param id path int true "接单记录ID"
-// @Param request body models.AcceptJiedanRequest true "同意接单请求"
-// @Success 200 {object} models.Jiedan
+// @Param request body models.AcceptJiedanRequest false "同意接单请求"
+// @Success 200 {object} models.AcceptJiedanResult
 // @Router /api/jiedan/{id}/accept [post]
 func (c *JiedanController) AcceptJiedan(ctx *gin.Context) {
 	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
@@ -215,18 +211,27 @@ func (c *JiedanController) AcceptJiedan(ctx *gin.Context) {
 	}
 
 	var req models.AcceptJiedanRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	jiedan, err := c.jiedanService.AcceptJiedan(uint(id), &req)
+	// 获取当前用户ID
+	userID := ctx.GetString("user_id")
+	if userID == "" {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	req.AgreeUserID = userID
+
+	result, err := c.jiedanService.WithActor(middleware.CurrentActor(ctx)).AcceptJiedan(uint(id), &req)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondJiedanError(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, jiedan)
+	ctx.JSON(http.StatusOK, result)
 }
 
 // RejectJiedan 拒绝接单
@@ -252,9 +257,9 @@ func (c *JiedanController) RejectJiedan(ctx *gin.Context) {
 		return
 	}
 
-	jiedan, err := c.jiedanService.RejectJiedan(uint(id), &req)
+	jiedan, err := c.jiedanService.WithActor(middleware.CurrentActor(ctx)).RejectJiedan(uint(id), &req)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondJiedanError(ctx, err)
 		return
 	}
 
@@ -263,7 +268,7 @@ func (c *JiedanController) RejectJiedan(ctx *gin.Context) {
 
 // UpdateJiedan 更新接单记录
 // @Summary 更新接单记录
-// @Description 更新接单记录信息
+// @Description 修改待处理接单的价格，记为工厂新一轮报价；状态只能通过同意、拒绝或撤回接单变更
 // @Tags 接单管理
 // @Accept json
 // @Produce json
@@ -284,9 +289,9 @@ func (c *JiedanController) UpdateJiedan(ctx *gin.Context) {
 		return
 	}
 
-	jiedan, err := c.jiedanService.UpdateJiedan(uint(id), &req)
+	jiedan, err := c.jiedanService.WithActor(middleware.CurrentActor(ctx)).UpdateJiedan(uint(id), &req)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondJiedanError(ctx, err)
 		return
 	}
 
@@ -309,7 +314,7 @@ func (c *JiedanController) DeleteJiedan(ctx *gin.Context) {
 		return
 	}
 
-	if err := c.jiedanService.DeleteJiedan(uint(id)); err != nil {
+	if err := c.jiedanService.WithActor(middleware.CurrentActor(ctx)).DeleteJiedan(uint(id)); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -394,4 +399,121 @@ func (c *JiedanController) GetJiedanByOrderIDAndFactoryID(ctx *gin.Context) {
 		"success": true,
 		"data":    responseData,
 	})
-} 
\ No newline at end of file
+}
+
+// GetJiedanQuotes 获取接单议价记录
+// @Summary 获取接单议价记录
+// @Description 获取接单的全部报价/还价轮次，仅接单工厂和订单设计师可查看
+// @Tags 接单管理
+// @Produce json
+// @Param id path int true "接单记录ID"
+// @Success 200 {object} gin.H
+// @Router /api/jiedan/{id}/quotes [get]
+func (c *JiedanController) GetJiedanQuotes(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的接单记录ID"})
+		return
+	}
+
+	quotes, err := c.jiedanService.GetJiedanQuotes(uint(id))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    quotes,
+	})
+}
+
+// ProposeQuote 提交报价或还价
+// @Summary 提交报价或还价
+// @Description 工厂报价、设计师还价，双方交替进行，每轮单独保存
+// @Tags 接单管理
+// @Accept json
+// @Produce json
+// @Param id path int true "接单记录ID"
+// @Param request body models.ProposeQuoteRequest true "报价请求"
+// @Success 201 {object} models.JiedanQuote
+// @Router /api/jiedan/{id}/quotes [post]
+func (c *JiedanController) ProposeQuote(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的接单记录ID"})
+		return
+	}
+
+	var req models.ProposeQuoteRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	quote, err := c.jiedanService.WithActor(middleware.CurrentActor(ctx)).ProposeQuote(uint(id), &req)
+	if err != nil {
+		respondJiedanError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    quote,
+	})
+}
+
+// AcceptQuote 接受指定轮次的报价
+// @Summary 接受报价
+// @Description 接受对方提出的某一轮报价，该轮单价成为接单最终价格
+// @Tags 接单管理
+// @Produce json
+// @Param id path int true "接单记录ID"
+// @Param quoteId path int true "报价轮次ID"
+// @Success 200 {object} models.JiedanQuote
+// @Router /api/jiedan/{id}/quotes/{quoteId}/accept [post]
+func (c *JiedanController) AcceptQuote(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的接单记录ID"})
+		return
+	}
+	quoteID, err := strconv.ParseUint(ctx.Param("quoteId"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的报价ID"})
+		return
+	}
+
+	quote, err := c.jiedanService.WithActor(middleware.CurrentActor(ctx)).AcceptQuote(uint(id), uint(quoteID))
+	if err != nil {
+		respondJiedanError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    quote,
+	})
+}
+
+// respondJiedanError 将接单服务错误转换为HTTP响应
+func respondJiedanError(ctx *gin.Context, err error) {
+	var forbiddenErr *services.ForbiddenError
+	switch {
+	case errors.As(err, &forbiddenErr):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": forbiddenErr.Reason, "code": "forbidden"})
+	case errors.Is(err, services.ErrJiedanNotFound), errors.Is(err, services.ErrOrderNotFound),
+		errors.Is(err, services.ErrQuoteNotFound), errors.Is(err, services.ErrResourceNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrJiedanNotPending), errors.Is(err, services.ErrOrderAlreadyAwarded),
+		errors.Is(err, services.ErrQuoteNotPending), errors.Is(err, services.ErrQuoteExpired),
+		errors.Is(err, services.ErrQuoteOutOfTurn), errors.Is(err, services.ErrQuoteOwnProposal),
+		errors.Is(err, services.ErrNegotiationClosed), errors.Is(err, services.ErrJiedanDuplicate),
+		errors.Is(err, services.ErrOrderNotOpenForBids):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrOrderLineNotFound), errors.Is(err, services.ErrOrderLineDuplicate):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		respondOrderStatusError(ctx, err)
+	}
+}
@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"errors"
+	"gongChang/middleware"
+	"gongChang/models"
+	"gongChang/services"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MessageController struct {
+	messageService *services.MessageService
+	fileService    *services.FileService
+}
+
+func NewMessageController(messageService *services.MessageService, fileService *services.FileService) *MessageController {
+	return &MessageController{messageService: messageService, fileService: fileService}
+}
+
+// OpenThread 打开或创建订单上与某工厂的会话
+// @Summary 打开订单会话
+// @Description 设计师需指定 factory_id，工厂默认打开自己的会话；该工厂必须已对订单接单
+// @Tags 消息
+// @Accept json
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param request body models.OpenThreadRequest false "会话工厂"
+// @Success 200 {object} gin.H
+// @Router /api/orders/{id}/threads [post]
+func (c *MessageController) OpenThread(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+
+	var req models.OpenThreadRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+			return
+		}
+	}
+
+	thread, err := c.messageService.WithActor(middleware.CurrentActor(ctx)).OpenThread(uint(orderID), req.FactoryID)
+	if err != nil {
+		respondMessageError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": thread})
+}
+
+// ListThreads 获取订单上当前用户参与的会话
+// @Summary 获取订单会话列表
+// @Tags 消息
+// @Produce json
+// @Param id path int true "订单ID"
+// @Success 200 {object} gin.H
+// @Router /api/orders/{id}/threads [get]
+func (c *MessageController) ListThreads(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+
+	threads, err := c.messageService.WithActor(middleware.CurrentActor(ctx)).ListThreads(uint(orderID))
+	if err != nil {
+		respondMessageError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": threads})
+}
+
+// GetThread 获取会话详情
+// @Summary 获取会话详情
+// @Tags 消息
+// @Produce json
+// @Param threadId path int true "会话ID"
+// @Success 200 {object} gin.H
+// @Router /api/threads/{threadId} [get]
+func (c *MessageController) GetThread(ctx *gin.Context) {
+	threadID, ok := parseThreadID(ctx)
+	if !ok {
+		return
+	}
+
+	thread, err := c.messageService.GetThread(threadID)
+	if err != nil {
+		respondMessageError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": thread})
+}
+
+// ListMessages 分页获取会话消息（按时间倒序）
+// @Summary 获取会话消息
+// @Tags 消息
+// @Produce json
+// @Param threadId path int true "会话ID"
+// @Param before_id query int false "只返回ID小于该值的消息"
+// @Param limit query int false "每页数量，默认30，最大100"
+// @Success 200 {object} gin.H
+// @Router /api/threads/{threadId}/messages [get]
+func (c *MessageController) ListMessages(ctx *gin.Context) {
+	threadID, ok := parseThreadID(ctx)
+	if !ok {
+		return
+	}
+	beforeID, _ := strconv.ParseUint(ctx.DefaultQuery("before_id", "0"), 10, 32)
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "0"))
+
+	messages, hasMore, err := c.messageService.ListMessages(threadID, uint(beforeID), limit)
+	if err != nil {
+		respondMessageError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"messages": messages,
+			"has_more": hasMore,
+		},
+	})
+}
+
+// PostMessage 发送消息
+// @Summary 发送消息
+// @Description 支持 JSON（attachment_ids 引用已上传的文件）或 multipart/form-data（files 字段直接上传附件）
+// @Tags 消息
+// @Accept json,mpfd
+// @Produce json
+// @Param threadId path int true "会话ID"
+// @Param request body models.PostMessageRequest true "消息内容"
+// @Success 200 {object} gin.H
+// @Router /api/threads/{threadId}/messages [post]
+func (c *MessageController) PostMessage(ctx *gin.Context) {
+	threadID, ok := parseThreadID(ctx)
+	if !ok {
+		return
+	}
+	actor := middleware.CurrentActor(ctx)
+
+	var req models.PostMessageRequest
+	if strings.HasPrefix(ctx.ContentType(), "multipart/") {
+		if err := ctx.ShouldBind(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+			return
+		}
+		form, err := ctx.MultipartForm()
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "解析上传内容失败"})
+			return
+		}
+		// 直接上传的附件先通过文件服务保存，再作为附件引用
+		for _, header := range form.File["files"] {
+			file, err := header.Open()
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "读取附件失败: " + header.Filename})
+				return
+			}
+			record, err := c.fileService.WithActor(actor).SaveFile(file, header.Filename, nil, "", actor.UserID)
+			file.Close()
+			if err != nil {
+				log.Printf("Failed to save message attachment %s: %v", header.Filename, err)
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			req.AttachmentIDs = append(req.AttachmentIDs, record.ID)
+		}
+	} else if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	message, err := c.messageService.WithActor(actor).PostMessage(threadID, req.Content, req.AttachmentIDs)
+	if err != nil {
+		respondMessageError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": message})
+}
+
+// MarkRead 标记会话已读
+// @Summary 标记会话已读
+// @Tags 消息
+// @Accept json
+// @Produce json
+// @Param threadId path int true "会话ID"
+// @Param request body models.MarkThreadReadRequest false "已读到的消息ID，为空时标记到最新一条"
+// @Success 200 {object} gin.H
+// @Router /api/threads/{threadId}/read [put]
+func (c *MessageController) MarkRead(ctx *gin.Context) {
+	threadID, ok := parseThreadID(ctx)
+	if !ok {
+		return
+	}
+
+	var req models.MarkThreadReadRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+			return
+		}
+	}
+
+	thread, err := c.messageService.WithActor(middleware.CurrentActor(ctx)).MarkRead(threadID, req.MessageID)
+	if err != nil {
+		respondMessageError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": thread})
+}
+
+func parseThreadID(ctx *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(ctx.Param("threadId"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的会话ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func respondMessageError(ctx *gin.Context, err error) {
+	var forbiddenErr *services.ForbiddenError
+	switch {
+	case errors.As(err, &forbiddenErr):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": forbiddenErr.Reason, "code": "forbidden"})
+	case errors.Is(err, services.ErrThreadNotFound), errors.Is(err, services.ErrOrderNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrThreadRequiresJiedan):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrThreadFactoryRequired), errors.Is(err, services.ErrMessageEmpty),
+		errors.Is(err, services.ErrMessageNotInThread), errors.Is(err, services.ErrAttachmentNotOwned):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Message operation failed: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"errors"
+	"gongChang/middleware"
+	"gongChang/models"
+	"gongChang/services"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MilestoneController struct {
+	milestoneService *services.MilestoneService
+}
+
+func NewMilestoneController(milestoneService *services.MilestoneService) *MilestoneController {
+	return &MilestoneController{milestoneService: milestoneService}
+}
+
+// PublishPlan 发布或替换订单的生产计划
+// @Summary 发布生产计划
+// @Description 承接工厂为每个进度阶段设置计划开始和完成日期，重复发布将替换原计划
+// @Tags 进度管理
+// @Accept json
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param request body models.PublishMilestonePlanRequest true "生产计划"
+// @Success 200 {object} gin.H
+// @Router /api/orders/{id}/milestones [put]
+func (c *MilestoneController) PublishPlan(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+
+	var req models.PublishMilestonePlanRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	milestones, err := c.milestoneService.WithActor(middleware.CurrentActor(ctx)).PublishPlan(uint(orderID), req.Milestones)
+	if err != nil {
+		respondMilestoneError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": milestones})
+}
+
+// GetPlan 获取订单的生产计划
+// @Summary 获取生产计划
+// @Tags 进度管理
+// @Produce json
+// @Param id path int true "订单ID"
+// @Success 200 {object} gin.H
+// @Router /api/orders/{id}/milestones [get]
+func (c *MilestoneController) GetPlan(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+
+	milestones, err := c.milestoneService.GetPlan(uint(orderID))
+	if err != nil {
+		respondMilestoneError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": milestones})
+}
+
+// GetScheduleVariance 获取订单计划与实际进度的偏差
+// @Summary 获取进度偏差
+// @Description 返回每个阶段的开始、完成偏差天数（正数为延后）、预计完成时间以及进度记录列表
+// @Tags 进度管理
+// @Produce json
+// @Param id path int true "订单ID"
+// @Success 200 {object} gin.H
+// @Router /api/orders/{id}/schedule [get]
+func (c *MilestoneController) GetScheduleVariance(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+
+	variance, err := c.milestoneService.GetScheduleVariance(uint(orderID))
+	if err != nil {
+		respondMilestoneError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": variance})
+}
+
+func respondMilestoneError(ctx *gin.Context, err error) {
+	var forbiddenErr *services.ForbiddenError
+	switch {
+	case errors.As(err, &forbiddenErr):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": forbiddenErr.Reason, "code": "forbidden"})
+	case errors.Is(err, services.ErrOrderNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrOrderNotAwarded):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrMilestoneInvalidType), errors.Is(err, services.ErrMilestoneDuplicateType),
+		errors.Is(err, services.ErrMilestoneInvalidRange):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Milestone operation failed: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"errors"
+	"gongChang/models"
+	"gongChang/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type NotificationController struct {
+	notificationService *services.NotificationService
+}
+
+func NewNotificationController(notificationService *services.NotificationService) *NotificationController {
+	return &NotificationController{notificationService: notificationService}
+}
+
+// ListNotifications 获取当前用户的通知列表
+// @Summary 获取通知列表
+// @Tags 通知
+// @Produce json
+// @Param unread_only query bool false "只看未读"
+// @Param category query string false "通知类别"
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Success 200 {object} gin.H
+// @Router /api/notifications [get]
+func (c *NotificationController) ListNotifications(ctx *gin.Context) {
+	var query models.NotificationListQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	notifications, total, err := c.notificationService.ListNotifications(ctx.GetString("user_id"), &query)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"notifications": notifications,
+			"total":         total,
+			"page":          query.Page,
+			"page_size":     query.PageSize,
+		},
+	})
+}
+
+// GetUnreadCount 获取当前用户的未读通知数量
+// @Summary 获取未读通知数量
+// @Tags 通知
+// @Produce json
+// @Success 200 {object} gin.H
+// @Router /api/notifications/unread-count [get]
+func (c *NotificationController) GetUnreadCount(ctx *gin.Context) {
+	count, err := c.notificationService.GetUnreadCount(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": count})
+}
+
+// MarkRead 将单条通知标记为已读
+// @Summary 标记通知已读
+// @Tags 通知
+// @Produce json
+// @Param id path int true "通知ID"
+// @Success 200 {object} gin.H
+// @Router /api/notifications/{id}/read [put]
+func (c *NotificationController) MarkRead(ctx *gin.Context) {
+	c.markOne(ctx, true)
+}
+
+// MarkUnread 将单条通知标记为未读
+// @Summary 标记通知未读
+// @Tags 通知
+// @Produce json
+// @Param id path int true "通知ID"
+// @Success 200 {object} gin.H
+// @Router /api/notifications/{id}/unread [put]
+func (c *NotificationController) MarkUnread(ctx *gin.Context) {
+	c.markOne(ctx, false)
+}
+
+func (c *NotificationController) markOne(ctx *gin.Context, read bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的通知ID"})
+		return
+	}
+
+	updated, err := c.notificationService.MarkNotifications(ctx.GetString("user_id"), []uint{uint(id)}, read)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"updated": updated}})
+}
+
+// MarkBatch 批量标记通知已读或未读
+// @Summary 批量标记通知
+// @Tags 通知
+// @Accept json
+// @Produce json
+// @Param request body models.MarkNotificationsRequest true "通知ID列表"
+// @Success 200 {object} gin.H
+// @Router /api/notifications/mark [put]
+func (c *NotificationController) MarkBatch(ctx *gin.Context) {
+	var req models.MarkNotificationsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	updated, err := c.notificationService.MarkNotifications(ctx.GetString("user_id"), req.IDs, req.Read)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"updated": updated}})
+}
+
+// MarkAllRead 将全部通知标记为已读
+// @Summary 全部标记已读
+// @Tags 通知
+// @Produce json
+// @Success 200 {object} gin.H
+// @Router /api/notifications/read-all [put]
+func (c *NotificationController) MarkAllRead(ctx *gin.Context) {
+	updated, err := c.notificationService.MarkAllRead(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"updated": updated}})
+}
+
+// GetPreferences 获取通知订阅设置
+// @Summary 获取通知订阅设置
+// @Tags 通知
+// @Produce json
+// @Success 200 {object} gin.H
+// @Router /api/notifications/preferences [get]
+func (c *NotificationController) GetPreferences(ctx *gin.Context) {
+	prefs, err := c.notificationService.GetPreferences(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": prefs})
+}
+
+// UpdatePreferences 更新通知订阅设置（按类别静音）
+// @Summary 更新通知订阅设置
+// @Tags 通知
+// @Accept json
+// @Produce json
+// @Param request body models.UpdateNotificationPreferencesRequest true "静音设置"
+// @Success 200 {object} gin.H
+// @Router /api/notifications/preferences [put]
+func (c *NotificationController) UpdatePreferences(ctx *gin.Context) {
+	var req models.UpdateNotificationPreferencesRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	prefs, err := c.notificationService.UpdatePreferences(ctx.GetString("user_id"), req.Muted)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownNotificationCategory) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": prefs})
+}
@@ -1,9 +1,10 @@
 package controllers
 
 import (
+	"gongChang/middleware"
 	"gongChang/models"
 	"gongChang/services"
-	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -11,7 +12,6 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
@@ -34,8 +34,13 @@ func (c *OrderController) CreateOrder(ctx *gin.Context) {
 		return
 	}
 
-	// 验证必要字段
-	if req.Quantity <= 0 {
+	// 验证必要字段，有尺码 × 颜色明细时数量由明细汇总
+	lines, err := services.NewOrderLines(req.Lines)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(lines) == 0 && req.Quantity <= 0 {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "数量必须大于 0"})
 		return
 	}
@@ -62,53 +67,17 @@ func (c *OrderController) CreateOrder(ctx *gin.Context) {
 		SpecialRequirements: req.SpecialRequirements,
 	}
 
-	// 处理文件关联
-	if req.Attachments != nil && len(req.Attachments) > 0 {
-		attachmentsJSON, err := json.Marshal(req.Attachments)
-		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachments format"})
-			return
-		}
-		jsonData := datatypes.JSON(attachmentsJSON)
-		order.Attachments = &jsonData
-	}
-
-	if req.Models != nil && len(req.Models) > 0 {
-		modelsJSON, err := json.Marshal(req.Models)
-		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid models format"})
-			return
-		}
-		jsonData := datatypes.JSON(modelsJSON)
-		order.Models = &jsonData
-	}
-
-	if req.Images != nil && len(req.Images) > 0 {
-		imagesJSON, err := json.Marshal(req.Images)
-		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid images format"})
-			return
-		}
-		jsonData := datatypes.JSON(imagesJSON)
-		order.Images = &jsonData
-	}
-
-	if req.Videos != nil && len(req.Videos) > 0 {
-		videosJSON, err := json.Marshal(req.Videos)
-		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid videos format"})
-			return
-		}
-		jsonData := datatypes.JSON(videosJSON)
-		order.Videos = &jsonData
+	// 文件关联由服务层写入 order_files
+	order.Attachments = req.Attachments
+	order.Models = req.Models
+	order.Images = req.Images
+	order.Videos = req.Videos
+	if len(lines) > 0 {
+		order.Lines = lines
 	}
 
-	// 设置默认值
-	if req.Status == "" {
-		order.Status = models.OrderStatusDraft
-	} else {
-		order.Status = models.OrderStatus(req.Status)
-	}
+	// 设置默认值，初始状态由服务层校验
+	order.Status = models.OrderStatus(req.Status)
 
 	// 判断时间字段是否为 nil
 	if req.DeliveryDate != nil {
@@ -119,8 +88,13 @@ func (c *OrderController) CreateOrder(ctx *gin.Context) {
 	}
 
 	// 创建订单
-	if err := c.orderService.CreateOrder(order); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := c.orderService.WithActor(middleware.CurrentActor(ctx)).CreateOrder(order); err != nil {
+		var transitionErr *services.InvalidStatusTransitionError
+		if errors.As(err, &transitionErr) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "新订单状态只能为 draft 或 published"})
+			return
+		}
+		respondOrderFileError(ctx, err)
 		return
 	}
 
@@ -134,10 +108,12 @@ func (c *OrderController) CreateOrder(ctx *gin.Context) {
 		"designer_id": order.DesignerID,
 		"customer_id": order.CustomerID,
 		"status": order.Status,
-		"attachments": req.Attachments,
-		"models": req.Models,
-		"images": req.Images,
-		"videos": req.Videos,
+		"attachments": order.Attachments,
+		"models": order.Models,
+		"images": order.Images,
+		"videos": order.Videos,
+		"total_price": order.TotalPrice,
+		"lines": order.Lines,
 		"created_at": order.CreatedAt,
 		"updated_at": order.UpdatedAt,
 	})
@@ -238,21 +214,6 @@ func (c *OrderController) GetOrderByID(ctx *gin.Context) {
 		return
 	}
 
-	// 处理文件信息
-	var attachments, models, images, videos []string
-	if order.Attachments != nil {
-		json.Unmarshal(*order.Attachments, &attachments)
-	}
-	if order.Models != nil {
-		json.Unmarshal(*order.Models, &models)
-	}
-	if order.Images != nil {
-		json.Unmarshal(*order.Images, &images)
-	}
-	if order.Videos != nil {
-		json.Unmarshal(*order.Videos, &videos)
-	}
-
 	// 查询布料详细信息
 	var fabrics []map[string]interface{}
 	fabricsIDs := order.Fabrics
@@ -316,6 +277,20 @@ func (c *OrderController) GetOrderByID(ctx *gin.Context) {
 		}
 	}
 
+	// 物料清单及成本汇总
+	bom, err := c.orderService.GetOrderBOM(order.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 尺码 × 颜色明细及生产完成数量
+	lines, err := c.orderService.GetOrderLines(order.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{
 		"id": order.ID,
 		"title": order.Title,
@@ -324,11 +299,12 @@ func (c *OrderController) GetOrderByID(ctx *gin.Context) {
 		"quantity": order.Quantity,
 		"factory_id": order.FactoryID,
 		"status": order.Status,
-		"attachments": attachments,
-		"models": models,
-		"images": images,
-		"videos": videos,
+		"attachments": order.Attachments,
+		"models": order.Models,
+		"images": order.Images,
+		"videos": order.Videos,
 		"files": order.Files,
+		"order_files": order.OrderFiles,
 		"createTime": order.CreatedAt,
 		"updated_at": order.UpdatedAt,
 		"designer_id": order.DesignerID,
@@ -340,12 +316,25 @@ func (c *OrderController) GetOrderByID(ctx *gin.Context) {
 		"order_type": order.OrderType,
 		"fabrics": fabrics,
 		"fabrics_ids": fabricsIDs,
+		"bom": bom,
+		"lines": lines.Lines,
+		"completed_quantity": lines.CompletedQuantity,
 		"delivery_date": order.DeliveryDate,
 		"order_date": order.OrderDate,
 		"special_requirements": order.SpecialRequirements,
 	})
 }
 
+// UpdateOrderStatus 按订单状态机变更订单状态
+// @Summary 更新订单状态
+// @Description 按订单生命周期变更状态，非法流转返回409，并记录状态流转历史
+// @Tags 订单管理
+// @Accept json
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param request body models.UpdateOrderStatusRequest true "更新订单状态请求"
+// @Success 200 {object} gin.H
+// @Router /api/orders/{id}/status [put]
 func (c *OrderController) UpdateOrderStatus(ctx *gin.Context) {
 	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
 	if err != nil {
@@ -353,20 +342,105 @@ func (c *OrderController) UpdateOrderStatus(ctx *gin.Context) {
 		return
 	}
 
-	var statusUpdate struct {
-		Status models.OrderStatus `json:"status"`
-	}
-	if err := ctx.ShouldBindJSON(&statusUpdate); err != nil {
+	var req models.UpdateOrderStatusRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := c.orderService.UpdateOrderStatus(uint(orderID), statusUpdate.Status); err != nil {
+	order, err := c.orderService.WithActor(middleware.CurrentActor(ctx)).UpdateOrderStatus(uint(orderID), services.StatusChange{
+		To:     req.Status,
+		Reason: req.Reason,
+	})
+	if err != nil {
+		respondOrderStatusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":       "Order status updated successfully",
+		"status":        order.Status,
+		"next_statuses": order.Status.NextStatuses(),
+	})
+}
+
+// GetOrderStatusHistory 获取订单状态流转历史
+// @Summary 获取订单状态流转历史
+// @Description 获取订单每次状态变更的操作人、时间和原因
+// @Tags 订单管理
+// @Produce json
+// @Param id path int true "订单ID"
+// @Success 200 {object} gin.H
+// @Router /api/orders/{id}/status-history [get]
+func (c *OrderController) GetOrderStatusHistory(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+
+	history, err := c.orderService.GetOrderStatusHistory(uint(orderID))
+	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "Order status updated successfully"})
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    history,
+	})
+}
+
+// GetOrderTimeline 获取订单时间线
+// @Summary 获取订单时间线
+// @Description 按时间先后汇总订单状态变更、生产进度、样衣提交与审批、工艺单发布和质量检验
+// @Tags 订单管理
+// @Produce json
+// @Param id path int true "订单ID"
+// @Success 200 {array} models.OrderTimelineEntry
+// @Router /api/orders/{id}/timeline [get]
+func (c *OrderController) GetOrderTimeline(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+
+	timeline, err := c.orderService.GetOrderTimeline(uint(orderID))
+	if err != nil {
+		respondOrderStatusError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    timeline,
+	})
+}
+
+// respondOrderStatusError 将订单状态机错误转换为HTTP响应
+func respondOrderStatusError(ctx *gin.Context, err error) {
+	var transitionErr *services.InvalidStatusTransitionError
+	switch {
+	case errors.Is(err, services.ErrOrderNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUnknownOrderStatus):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrStatusChangeDenied):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrQCInspectionFailed), errors.Is(err, services.ErrStatusNeedsFactory),
+		errors.Is(err, services.ErrStatusNeedsShipment), errors.Is(err, services.ErrPPSampleNotApproved):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.As(err, &transitionErr):
+		ctx.JSON(http.StatusConflict, gin.H{
+			"error":         err.Error(),
+			"from":          transitionErr.From,
+			"to":            transitionErr.To,
+			"next_statuses": transitionErr.From.NextStatuses(),
+		})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
 }
 
 func (c *OrderController) SearchOrders(ctx *gin.Context) {
@@ -558,9 +632,9 @@ func (c *OrderController) UpdateOrder(ctx *gin.Context) {
 		return
 	}
 
-	// 更新订单
-	if err := c.orderService.UpdateOrder(uint(orderID), &req); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// 更新订单，状态变更与字段更新在同一事务内完成
+	if err := c.orderService.WithActor(middleware.CurrentActor(ctx)).UpdateOrder(uint(orderID), &req); err != nil {
+		respondOrderFileError(ctx, err)
 		return
 	}
 
@@ -583,7 +657,7 @@ func (c *OrderController) DeleteOrder(ctx *gin.Context) {
 	}
 
 	// 删除订单
-	if err := c.orderService.DeleteOrder(uint(orderID)); err != nil {
+	if err := c.orderService.WithActor(middleware.CurrentActor(ctx)).DeleteOrder(uint(orderID)); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -648,7 +722,7 @@ func (c *OrderController) GetPublicOrders(ctx *gin.Context) {
 
 // AddFabricToOrder 添加布料到订单
 // @Summary 添加布料到订单
-// @Description 创建新布料并关联到指定订单
+// @Description 关联已有布料（fabric_id）或创建新布料到指定订单，quantity 大于 0 时为订单预留库存
 // @Tags 订单管理
 // @Accept json
 // @Produce json
@@ -677,37 +751,10 @@ func (c *OrderController) AddFabricToOrder(ctx *gin.Context) {
 		return
 	}
 
-	// 获取当前用户角色
-	userRole, exists := ctx.Get("user_role")
-	if !exists {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "用户角色未找到"})
-		return
-	}
-
-	// 验证权限：只有设计师和供应商可以添加布料
-	switch userRole.(string) {
-	case "designer", "supplier":
-		// 允许操作
-	default:
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "用户角色不允许添加布料"})
-		return
-	}
-
-	// 创建布料服务实例
-	fabricService := services.NewFabricService(c.DB)
-
-	// 根据用户角色设置相应的ID字段
-	switch userRole.(string) {
-	case "designer":
-		// 设计师角色，在服务层处理设计师ID设置
-	case "supplier":
-		// 供应商角色，在服务层处理供应商ID设置
-	}
-
 	// 调用服务层方法
-	response, err := c.orderService.AddFabricToOrder(uint(orderID), &req, fabricService)
+	response, err := c.orderService.WithActor(middleware.CurrentActor(ctx)).AddFabricToOrder(uint(orderID), &req)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondFabricLedgerError(ctx, err)
 		return
 	}
 
@@ -745,11 +792,8 @@ func (c *OrderController) RemoveFabricFromOrder(ctx *gin.Context) {
 		return
 	}
 
-	// 创建布料服务实例
-	fabricService := services.NewFabricService(c.orderService.GetDB())
-
 	// 调用服务层方法
-	response, err := c.orderService.RemoveFabricFromOrder(uint(orderID), &req, fabricService)
+	response, err := c.orderService.WithActor(middleware.CurrentActor(ctx)).RemoveFabricFromOrder(uint(orderID), &req)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -808,13 +852,62 @@ func (c *OrderController) RemoveFileFromOrder(ctx *gin.Context) {
 	}
 
 	// 调用服务层方法
-	response, err := c.orderService.RemoveFileFromOrder(uint(orderID), &req)
+	response, err := c.orderService.WithActor(middleware.CurrentActor(ctx)).RemoveFileFromOrder(uint(orderID), &req)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondOrderFileError(ctx, err)
 		return
 	}
 
 	ctx.JSON(http.StatusOK, response)
+}
+
+// UpdateOrderFile 修改订单文件的说明或排序
+// @Summary 修改订单文件
+// @Tags 订单管理
+// @Accept json
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param fileId path string true "文件ID"
+// @Param request body models.UpdateOrderFileRequest true "说明和排序"
+// @Success 200 {object} models.OrderFile
+// @Router /api/orders/{id}/files/{fileId} [patch]
+func (c *OrderController) UpdateOrderFile(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+
+	var req models.UpdateOrderFileRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	link, err := c.orderService.WithActor(middleware.CurrentActor(ctx)).UpdateOrderFile(uint(orderID), ctx.Param("fileId"), &req)
+	if err != nil {
+		respondOrderFileError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": link})
+}
+
+func respondOrderFileError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrResourceNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+	case errors.Is(err, services.ErrOrderFileNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrOrderFileMissing), errors.Is(err, services.ErrOrderFileRoleInvalid):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInsufficientStock), errors.Is(err, services.ErrOrderLineHasProgress),
+		errors.Is(err, services.ErrOrderLineInUse), errors.Is(err, services.ErrOrderLineBelowFulfilled):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrOrderLineDuplicate), errors.Is(err, services.ErrOrderLineQuantityLocked):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		respondOrderStatusError(ctx, err)
+	}
 } 
 
 // AcceptOrder 工厂接受订单
@@ -855,13 +948,6 @@ func (c *OrderController) AcceptOrder(ctx *gin.Context) {
 		return
 	}
 
-	// 验证用户角色
-	userRole := ctx.GetString("user_role")
-	if userRole != "factory" {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "只有工厂用户可以接受订单"})
-		return
-	}
-
 	// 验证工厂ID是否与当前用户匹配
 	if req.FactoryID != userID {
 		ctx.JSON(http.StatusForbidden, gin.H{"error": "只能以自己的工厂身份接受订单"})
@@ -878,7 +964,7 @@ func (c *OrderController) AcceptOrder(ctx *gin.Context) {
 		Price:     req.PriceQuote,
 	}
 
-	jiedan, err := jiedanService.CreateJiedan(createReq)
+	jiedan, err := jiedanService.WithActor(middleware.CurrentActor(ctx)).CreateJiedan(createReq)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
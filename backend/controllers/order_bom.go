@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"gongChang/middleware"
+	"gongChang/models"
+	"gongChang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetOrderBOM 获取订单物料清单
+// @Summary 获取订单物料清单
+// @Description 返回每行的每件用量、损耗率、按订单数量计算的需求、当前预留和材料成本汇总
+// @Tags 订单管理
+// @Produce json
+// @Param id path int true "订单ID"
+// @Success 200 {object} models.OrderBOM
+// @Router /api/orders/{id}/bom [get]
+func (c *OrderController) GetOrderBOM(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+
+	bom, err := c.orderService.GetOrderBOM(uint(orderID))
+	if err != nil {
+		respondOrderBOMError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": bom})
+}
+
+// SaveOrderBOM 保存订单物料清单
+// @Summary 保存订单物料清单
+// @Description 整体替换订单的布料和辅料清单，并按需求调整订单的布料预留；可用库存不足返回409
+// @Tags 订单管理
+// @Accept json
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param request body models.SaveOrderBOMRequest true "物料清单"
+// @Success 200 {object} models.OrderBOM
+// @Router /api/orders/{id}/bom [put]
+func (c *OrderController) SaveOrderBOM(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+
+	var req models.SaveOrderBOMRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	bom, err := c.orderService.WithActor(middleware.CurrentActor(ctx)).SaveOrderBOM(uint(orderID), &req)
+	if err != nil {
+		respondOrderBOMError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": bom})
+}
+
+// respondOrderBOMError 将物料清单错误映射为 HTTP 响应
+func respondOrderBOMError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrBOMFabricRequired), errors.Is(err, services.ErrBOMDuplicateFabric),
+		errors.Is(err, services.ErrBOMTrimNameRequired):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		respondFabricLedgerError(ctx, err)
+	}
+}
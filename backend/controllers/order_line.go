@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"gongChang/middleware"
+	"gongChang/models"
+	"gongChang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetOrderLines 获取订单尺码颜色明细
+// @Summary 获取订单尺码颜色明细
+// @Description 返回订单的尺码 × 颜色明细、每行金额和最近一次生产上报的完成数量
+// @Tags 订单管理
+// @Produce json
+// @Param id path int true "订单ID"
+// @Success 200 {object} models.OrderLinesResponse
+// @Router /api/orders/{id}/lines [get]
+func (c *OrderController) GetOrderLines(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+
+	lines, err := c.orderService.GetOrderLines(uint(orderID))
+	if err != nil {
+		respondOrderLineError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": lines})
+}
+
+// SaveOrderLines 保存订单尺码颜色明细
+// @Summary 保存订单尺码颜色明细
+// @Description 整体替换订单的尺码 × 颜色明细，订单数量和总价按明细重新汇总；已上报生产数量的行不能删除
+// @Tags 订单管理
+// @Accept json
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param request body models.SaveOrderLinesRequest true "订单明细"
+// @Success 200 {object} models.OrderLinesResponse
+// @Router /api/orders/{id}/lines [put]
+func (c *OrderController) SaveOrderLines(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+
+	var req models.SaveOrderLinesRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lines, err := c.orderService.WithActor(middleware.CurrentActor(ctx)).SetOrderLines(uint(orderID), &req)
+	if err != nil {
+		respondOrderLineError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": lines})
+}
+
+// respondOrderLineError 将订单明细错误映射为 HTTP 响应
+func respondOrderLineError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrOrderNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrOrderLineDuplicate):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrOrderLineHasProgress), errors.Is(err, services.ErrInsufficientStock),
+		errors.Is(err, services.ErrOrderLineInUse), errors.Is(err, services.ErrOrderLineBelowFulfilled):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
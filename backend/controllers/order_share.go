@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"errors"
+	"gongChang/middleware"
+	"gongChang/models"
+	"gongChang/services"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OrderShareController struct {
+	shareService *services.OrderShareService
+}
+
+func NewOrderShareController(shareService *services.OrderShareService) *OrderShareController {
+	return &OrderShareController{shareService: shareService}
+}
+
+// CreateShareToken 为订单创建分享令牌
+// @Summary 创建订单分享令牌
+// @Description 设计师为没有平台账号的客户签发访问订单文件的令牌，scope 为 view（查看）或 upload（查看并上传），令牌明文只返回一次
+// @Tags 订单管理
+// @Accept json
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param request body models.CreateShareTokenRequest true "分享令牌"
+// @Success 201 {object} gin.H
+// @Router /api/orders/{id}/share-tokens [post]
+func (c *OrderShareController) CreateShareToken(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+
+	var req models.CreateShareTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	token, err := c.shareService.WithActor(middleware.CurrentActor(ctx)).CreateShareToken(uint(orderID), &req)
+	if err != nil {
+		respondOrderShareError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"success": true, "data": token})
+}
+
+// ListShareTokens 获取订单的分享令牌
+// @Summary 获取订单分享令牌
+// @Tags 订单管理
+// @Produce json
+// @Param id path int true "订单ID"
+// @Success 200 {object} gin.H
+// @Router /api/orders/{id}/share-tokens [get]
+func (c *OrderShareController) ListShareTokens(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+
+	tokens, err := c.shareService.ListShareTokens(uint(orderID))
+	if err != nil {
+		respondOrderShareError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": tokens})
+}
+
+// RevokeShareToken 撤销订单分享令牌
+// @Summary 撤销订单分享令牌
+// @Tags 订单管理
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param tokenId path int true "令牌ID"
+// @Success 200 {object} gin.H
+// @Router /api/orders/{id}/share-tokens/{tokenId} [delete]
+func (c *OrderShareController) RevokeShareToken(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+	tokenID, err := strconv.ParseUint(ctx.Param("tokenId"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的令牌ID"})
+		return
+	}
+
+	if err := c.shareService.WithActor(middleware.CurrentActor(ctx)).RevokeShareToken(uint(orderID), uint(tokenID)); err != nil {
+		respondOrderShareError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "message": "分享链接已撤销"})
+}
+
+func respondOrderShareError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrResourceNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Order share token request failed: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -2,8 +2,10 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"gongChang/middleware"
 	"gongChang/models"
 	"gongChang/services"
 
@@ -56,22 +58,15 @@ func (c *ProgressController) CreateProgress(ctx *gin.Context) {
 		return
 	}
 
-	// 验证用户角色
-	userRole := ctx.GetString("user_role")
-	if userRole != "factory" {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "只有工厂用户可以创建进度记录"})
-		return
-	}
-
 	// 验证工厂ID是否与当前用户匹配
 	if req.FactoryID != userID {
 		ctx.JSON(http.StatusForbidden, gin.H{"error": "只能以自己的工厂身份创建进度记录"})
 		return
 	}
 
-	progress, err := c.progressService.CreateProgress(&req)
+	progress, err := c.progressService.WithActor(middleware.CurrentActor(ctx)).CreateProgress(&req)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondProgressLineError(ctx, err)
 		return
 	}
 
@@ -94,6 +89,7 @@ func (c *ProgressController) CreateProgress(ctx *gin.Context) {
 		"start_time":    progress.StartTime,
 		"completed_time": progress.CompletedTime,
 		"images":        images,
+		"line_quantities": progress.LineQuantities,
 		"created_at":    progress.CreatedAt,
 		"updated_at":    progress.UpdatedAt,
 	}
@@ -147,6 +143,7 @@ func (c *ProgressController) GetProgressByOrderID(ctx *gin.Context) {
 			"start_time":    progress.StartTime,
 			"completed_time": progress.CompletedTime,
 			"images":        images,
+			"line_quantities": progress.LineQuantities,
 			"created_at":    progress.CreatedAt,
 			"updated_at":    progress.UpdatedAt,
 		})
@@ -188,41 +185,22 @@ func (c *ProgressController) UpdateProgress(ctx *gin.Context) {
 		return
 	}
 
-	// 获取当前用户ID
-	userID := ctx.GetString("user_id")
-	if userID == "" {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
-		return
-	}
-
-	// 验证用户角色
-	userRole := ctx.GetString("user_role")
-	if userRole != "factory" {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "只有工厂用户可以更新进度记录"})
-		return
-	}
-
-	// 验证权限：只能更新自己工厂的进度记录
+	// 归属权限已由 ProgressOwner 策略校验
 	progress, err := c.progressService.GetProgressByID(uint(progressID))
 	if err != nil {
 		ctx.JSON(http.StatusNotFound, gin.H{"error": "进度记录不存在"})
 		return
 	}
 
-	if progress.FactoryID != userID {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "只能更新自己工厂的进度记录"})
-		return
-	}
-
 	// 验证订单ID一致性
 	if progress.OrderID != uint(orderID) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "进度记录不属于指定的订单"})
 		return
 	}
 
-	updatedProgress, err := c.progressService.UpdateProgress(uint(progressID), &req)
+	updatedProgress, err := c.progressService.WithActor(middleware.CurrentActor(ctx)).UpdateProgress(uint(progressID), &req)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondProgressLineError(ctx, err)
 		return
 	}
 
@@ -245,6 +223,7 @@ func (c *ProgressController) UpdateProgress(ctx *gin.Context) {
 		"start_time":    updatedProgress.StartTime,
 		"completed_time": updatedProgress.CompletedTime,
 		"images":        images,
+		"line_quantities": updatedProgress.LineQuantities,
 		"created_at":    updatedProgress.CreatedAt,
 		"updated_at":    updatedProgress.UpdatedAt,
 	}
@@ -278,39 +257,20 @@ func (c *ProgressController) DeleteProgress(ctx *gin.Context) {
 		return
 	}
 
-	// 获取当前用户ID
-	userID := ctx.GetString("user_id")
-	if userID == "" {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
-		return
-	}
-
-	// 验证用户角色
-	userRole := ctx.GetString("user_role")
-	if userRole != "factory" {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "只有工厂用户可以删除进度记录"})
-		return
-	}
-
-	// 验证权限：只能删除自己工厂的进度记录
+	// 归属权限已由 ProgressOwner 策略校验
 	progress, err := c.progressService.GetProgressByID(uint(progressID))
 	if err != nil {
 		ctx.JSON(http.StatusNotFound, gin.H{"error": "进度记录不存在"})
 		return
 	}
 
-	if progress.FactoryID != userID {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "只能删除自己工厂的进度记录"})
-		return
-	}
-
 	// 验证订单ID一致性
 	if progress.OrderID != uint(orderID) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "进度记录不属于指定的订单"})
 		return
 	}
 
-	if err := c.progressService.DeleteProgress(uint(progressID)); err != nil {
+	if err := c.progressService.WithActor(middleware.CurrentActor(ctx)).DeleteProgress(uint(progressID)); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -386,6 +346,7 @@ func (c *ProgressController) GetProgressByFactoryID(ctx *gin.Context) {
 			StartTime:     p.StartTime,
 			CompletedTime: p.CompletedTime,
 			Images:        images,
+			LineQuantities: p.LineQuantities,
 			CreatedAt:     p.CreatedAt,
 			UpdatedAt:     p.UpdatedAt,
 			Order:         &p.Order,
@@ -445,4 +406,19 @@ func (c *ProgressController) GetProgressStatistics(ctx *gin.Context) {
 	}
 
 	ctx.JSON(http.StatusOK, response)
-} 
\ No newline at end of file
+} 
+
+// respondProgressLineError 明细数量校验失败返回 400，未满足生产或发货的前置条件返回 409，其他错误保持 500
+func respondProgressLineError(ctx *gin.Context, err error) {
+	if errors.Is(err, services.ErrOrderLineNotFound) || errors.Is(err, services.ErrOrderLineDuplicate) ||
+		errors.Is(err, services.ErrLineQuantityExceeded) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrTechPackNotAcknowledged) || errors.Is(err, services.ErrPPSampleNotApproved) ||
+		errors.Is(err, services.ErrQCInspectionFailed) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
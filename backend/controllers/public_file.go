@@ -1,71 +1,359 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
+	"gongChang/models"
 	"gongChang/services"
+	"gongChang/storage"
+	"log"
+	"mime/multipart"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+const (
+	// ShareTokenHeader 分享令牌的请求头，也可以通过 ?token= 传递，便于直接在浏览器中打开
+	ShareTokenHeader = "X-Share-Token"
+	// SharePinHeader 分享链接 PIN 的请求头，也可以通过 ?pin= 传递
+	SharePinHeader = "X-Share-Pin"
+)
+
+// PublicFileController 没有平台账号的客户凭订单分享令牌访问订单文件
 type PublicFileController struct {
-	fileService *services.FileService
-	db         *gorm.DB
+	fileService  *services.FileService
+	shareService *services.OrderShareService
+	db           *gorm.DB
 }
 
-func NewPublicFileController(db *gorm.DB) *PublicFileController {
+func NewPublicFileController(db *gorm.DB, fileService *services.FileService, shareService *services.OrderShareService) *PublicFileController {
 	return &PublicFileController{
-		fileService: services.NewFileService(db, "./uploads"),
-		db:         db,
+		fileService:  fileService,
+		shareService: shareService,
+		db:           db,
+	}
+}
+
+// shareTokenFromRequest 读取请求中的分享令牌明文
+func shareTokenFromRequest(ctx *gin.Context) string {
+	if token := ctx.GetHeader(ShareTokenHeader); token != "" {
+		return token
+	}
+	return ctx.Query("token")
+}
+
+// sharePinFromRequest 读取请求中的分享链接 PIN
+func sharePinFromRequest(ctx *gin.Context) string {
+	if pin := ctx.GetHeader(SharePinHeader); pin != "" {
+		return pin
+	}
+	return ctx.Query("pin")
+}
+
+// authorizeShare 校验分享令牌对订单的权限，失败时已写入响应
+// orderID 为 0 时只校验令牌本身，调用方需再确认资源属于令牌的订单。
+func authorizeShare(ctx *gin.Context, shareService *services.OrderShareService, orderID uint, scope models.ShareScope) (*models.OrderShareToken, bool) {
+	token, err := shareService.Authorize(shareTokenFromRequest(ctx), sharePinFromRequest(ctx), orderID, scope)
+	if err != nil {
+		respondShareError(ctx, err)
+		return nil, false
+	}
+	return token, true
+}
+
+// shareActor 分享令牌请求的操作人，用于审计
+func shareActor(ctx *gin.Context, token *models.OrderShareToken) models.Actor {
+	return models.ShareActor(token.ID, ctx.GetString("request_id"), ctx.ClientIP())
+}
+
+func respondShareError(ctx *gin.Context, err error) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, services.ErrShareTokenInvalid), errors.Is(err, services.ErrShareTokenExpired),
+		errors.Is(err, services.ErrShareTokenRevoked):
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSharePinRequired):
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "code": "pin_required"})
+	case errors.Is(err, services.ErrSharePinInvalid):
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "code": "pin_invalid"})
+	case errors.Is(err, services.ErrSharePinLocked):
+		ctx.JSON(http.StatusLocked, gin.H{"error": err.Error(), "code": "pin_locked"})
+	case errors.Is(err, services.ErrShareScopeDenied):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "forbidden"})
+	case errors.Is(err, services.ErrShareRateLimited):
+		ctx.Header("Retry-After", "60")
+		ctx.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrResourceNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, storage.ErrNotExist):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+	case errors.Is(err, services.ErrFileInUse):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.As(err, &maxBytesErr):
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("文件大小超过限制 (最大 %d MB)", services.MaxFileSize/1024/1024)})
+	case errors.Is(err, services.ErrUnsupportedFileType), errors.Is(err, services.ErrUnknownDerivative),
+		errors.Is(err, services.ErrDerivativeUnsupported):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Shared file request failed: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// parsePublicOrderID 解析路径中的订单ID
+func parsePublicOrderID(ctx *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// listShared 返回令牌订单中指定用途的文件，role 为空时返回全部
+func (c *PublicFileController) listShared(ctx *gin.Context, role models.OrderFileRole) {
+	orderID, ok := parsePublicOrderID(ctx)
+	if !ok {
+		return
+	}
+	if _, ok := authorizeShare(ctx, c.shareService, orderID, models.ShareScopeView); !ok {
+		return
+	}
+	files, err := c.fileService.SharedOrderFiles(orderID, role)
+	if err != nil {
+		respondShareError(ctx, err)
+		return
+	}
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": files})
+}
+
+// uploadShared 通过分享令牌上传文件到订单，表单字段 files（可多个）或 file；role 为空时按扩展名归类
+func (c *PublicFileController) uploadShared(ctx *gin.Context, role models.OrderFileRole) {
+	orderID, ok := parsePublicOrderID(ctx)
+	if !ok {
+		return
+	}
+	token, ok := authorizeShare(ctx, c.shareService, orderID, models.ShareScopeUpload)
+	if !ok {
+		return
+	}
+
+	// 整个请求体的上限为单文件上限的 5 倍，单个文件的大小由 SaveFile 校验
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, 5*services.MaxFileSize)
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondShareError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "获取文件失败"})
+		return
+	}
+	headers := append(form.File["files"], form.File["file"]...)
+	if len(headers) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请选择要上传的文件"})
+		return
 	}
+	if role == "" {
+		if t := ctx.PostForm("type"); t != "" {
+			role = models.OrderFileRole(t)
+			if !role.IsValid() {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": services.ErrOrderFileRoleInvalid.Error()})
+				return
+			}
+		}
+	}
+	caption := ctx.PostForm("caption")
+
+	actor := shareActor(ctx, token)
+	fileService := c.fileService.WithActor(actor)
+	orderService := services.NewOrderService(c.db).WithActor(actor)
+
+	uploaded := make([]string, 0, len(headers))
+	failed := make([]*models.FailedFileInfo, 0)
+	for _, header := range headers {
+		fileID, err := c.saveSharedFile(fileService, orderService, header, orderID, role, caption)
+		if err != nil {
+			log.Printf("Shared upload of %s to order %d failed: %v", header.Filename, orderID, err)
+			failed = append(failed, &models.FailedFileInfo{Name: header.Filename, Error: err.Error()})
+			continue
+		}
+		uploaded = append(uploaded, fileID)
+	}
+
+	files, err := c.fileService.SharedOrderFiles(orderID, role)
+	if err != nil {
+		respondShareError(ctx, err)
+		return
+	}
+	result := make([]models.SharedFile, 0, len(uploaded))
+	for _, id := range uploaded {
+		for _, f := range files {
+			if f.ID == id {
+				result = append(result, f)
+				break
+			}
+		}
+	}
+
+	status := http.StatusCreated
+	if len(uploaded) == 0 {
+		status = http.StatusBadRequest
+	}
+	ctx.JSON(status, gin.H{
+		"success": len(uploaded) > 0,
+		"data": gin.H{
+			"files":        result,
+			"failed_files": failed,
+		},
+	})
+}
+
+// saveSharedFile 保存单个上传文件并加入订单，caption 非空时写入订单文件说明
+func (c *PublicFileController) saveSharedFile(fileService *services.FileService, orderService *services.OrderService,
+	header *multipart.FileHeader, orderID uint, role models.OrderFileRole, caption string) (string, error) {
+	if header.Size > services.MaxFileSize {
+		return "", fmt.Errorf("文件大小超过限制 (最大 %d MB)", services.MaxFileSize/1024/1024)
+	}
+	src, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	fileRecord, err := fileService.SaveFile(src, header.Filename, &orderID, string(role), "")
+	if err != nil {
+		return "", err
+	}
+	if caption != "" {
+		if role == "" {
+			// 未指定用途时由 SaveFile 按扩展名归类，读取实际写入的用途
+			var link models.OrderFile
+			if err := c.db.Where("order_id = ? AND file_id = ?", orderID, fileRecord.ID).First(&link).Error; err != nil {
+				return "", err
+			}
+			role = link.Role
+		}
+		if _, err := orderService.AttachOrderFile(orderID, fileRecord.ID, role, caption); err != nil {
+			return "", err
+		}
+	}
+	return fileRecord.ID, nil
 }
 
-// UploadOrderFiles 上传订单文件
+// UploadOrderFiles 上传订单文件，可通过表单字段 type 指定用途，未指定时按扩展名归类
 func (c *PublicFileController) UploadOrderFiles(ctx *gin.Context) {
-	ctx.JSON(http.StatusNotImplemented, gin.H{"error": "功能尚未实现"})
+	c.uploadShared(ctx, "")
 }
 
 // GetOrderFiles 获取订单文件
 func (c *PublicFileController) GetOrderFiles(ctx *gin.Context) {
-	ctx.JSON(http.StatusNotImplemented, gin.H{"error": "功能尚未实现"})
+	c.listShared(ctx, "")
 }
 
-// GetFile 获取文件
+// GetFile 重定向到文件的签名下载地址，图片可通过 size 参数获取衍生版本
 func (c *PublicFileController) GetFile(ctx *gin.Context) {
-	ctx.JSON(http.StatusNotImplemented, gin.H{"error": "功能尚未实现"})
+	fileID := ctx.Param("fileId")
+	token, ok := authorizeShare(ctx, c.shareService, 0, models.ShareScopeView)
+	if !ok {
+		return
+	}
+	file, ok := c.sharedFile(ctx, token, fileID)
+	if !ok {
+		return
+	}
+
+	var target string
+	var err error
+	if size := ctx.Query("size"); size != "" && size != "original" {
+		var derivative *models.FileDerivative
+		derivative, err = c.fileService.GetDerivative(file.ID, size)
+		if err == nil {
+			target, err = c.fileService.GetDerivativeURL(derivative)
+		}
+	} else {
+		target, err = c.fileService.GetDownloadURL(file, ctx.Query("attachment") == "1")
+	}
+	if err != nil {
+		respondShareError(ctx, err)
+		return
+	}
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Redirect(http.StatusFound, target)
 }
 
-// DeleteFile 删除文件
+// sharedFile 读取属于令牌订单的文件，不属于时按不存在处理，避免泄露其他订单的文件ID
+func (c *PublicFileController) sharedFile(ctx *gin.Context, token *models.OrderShareToken, fileID string) (*models.File, bool) {
+	inOrder, err := c.fileService.OrderHasFile(token.OrderID, fileID)
+	if err != nil {
+		respondShareError(ctx, err)
+		return nil, false
+	}
+	if !inOrder {
+		respondShareError(ctx, services.ErrResourceNotFound)
+		return nil, false
+	}
+	file, err := c.fileService.GetFileByID(fileID)
+	if err != nil {
+		respondShareError(ctx, err)
+		return nil, false
+	}
+	return file, true
+}
+
+// DeleteFile 删除通过同一分享令牌上传的文件
 func (c *PublicFileController) DeleteFile(ctx *gin.Context) {
-	ctx.JSON(http.StatusNotImplemented, gin.H{"error": "功能尚未实现"})
+	fileID := ctx.Param("fileId")
+	token, ok := authorizeShare(ctx, c.shareService, 0, models.ShareScopeUpload)
+	if !ok {
+		return
+	}
+	file, ok := c.sharedFile(ctx, token, fileID)
+	if !ok {
+		return
+	}
+	if file.ShareTokenID == nil || *file.ShareTokenID != token.ID {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "只能删除通过该分享链接上传的文件", "code": "forbidden"})
+		return
+	}
+	if err := c.fileService.WithActor(shareActor(ctx, token)).DeleteFile(file.ID); err != nil {
+		respondShareError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "message": "文件删除成功"})
 }
 
 // UploadOrderModels 上传订单3D模型
 func (c *PublicFileController) UploadOrderModels(ctx *gin.Context) {
-	ctx.JSON(http.StatusNotImplemented, gin.H{"error": "功能尚未实现"})
+	c.uploadShared(ctx, models.OrderFileRoleModel)
 }
 
 // GetOrderModels 获取订单3D模型
 func (c *PublicFileController) GetOrderModels(ctx *gin.Context) {
-	ctx.JSON(http.StatusNotImplemented, gin.H{"error": "功能尚未实现"})
+	c.listShared(ctx, models.OrderFileRoleModel)
 }
 
 // UploadOrderImages 上传订单图片
 func (c *PublicFileController) UploadOrderImages(ctx *gin.Context) {
-	ctx.JSON(http.StatusNotImplemented, gin.H{"error": "功能尚未实现"})
+	c.uploadShared(ctx, models.OrderFileRoleImage)
 }
 
 // GetOrderImages 获取订单图片
 func (c *PublicFileController) GetOrderImages(ctx *gin.Context) {
-	ctx.JSON(http.StatusNotImplemented, gin.H{"error": "功能尚未实现"})
+	c.listShared(ctx, models.OrderFileRoleImage)
 }
 
 // UploadOrderVideos 上传订单视频
 func (c *PublicFileController) UploadOrderVideos(ctx *gin.Context) {
-	ctx.JSON(http.StatusNotImplemented, gin.H{"error": "功能尚未实现"})
+	c.uploadShared(ctx, models.OrderFileRoleVideo)
 }
 
 // GetOrderVideos 获取订单视频
 func (c *PublicFileController) GetOrderVideos(ctx *gin.Context) {
-	ctx.JSON(http.StatusNotImplemented, gin.H{"error": "功能尚未实现"})
-} 
\ No newline at end of file
+	c.listShared(ctx, models.OrderFileRoleVideo)
+}
@@ -2,20 +2,24 @@ package controllers
 
 import (
 	"math"
+	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"gongChang/models"
+	"gongChang/services"
 )
 
 type PublicOrderController struct {
-	db *gorm.DB
+	db           *gorm.DB
+	fileService  *services.FileService
+	shareService *services.OrderShareService
 }
 
-func NewPublicOrderController(db *gorm.DB) *PublicOrderController {
-	return &PublicOrderController{db: db}
+func NewPublicOrderController(db *gorm.DB, fileService *services.FileService, shareService *services.OrderShareService) *PublicOrderController {
+	return &PublicOrderController{db: db, fileService: fileService, shareService: shareService}
 }
 
 // GetPublicOrders 获取公开订单列表
@@ -98,11 +102,13 @@ func (c *PublicOrderController) GetPublicOrders(ctx *gin.Context) {
 
 // GetPublicOrderDetail 获取公开订单详情
 // @Summary 获取公开订单详情
-// @Description 获取公开订单的详细信息，无需认证
+// @Description 获取公开订单的详细信息，无需认证；携带分享令牌（token 参数或 X-Share-Token 请求头，设置了 PIN 时还需 pin）时返回分享页面的订单进度视图，不包含价格
 // @Tags 公开订单
 // @Accept json
 // @Produce json
 // @Param id path int true "订单ID"
+// @Param token query string false "分享令牌"
+// @Param pin query string false "分享链接 PIN"
 // @Success 200 {object} models.PublicOrder
 // @Router /public/orders/{id} [get]
 func (c *PublicOrderController) GetPublicOrderDetail(ctx *gin.Context) {
@@ -114,6 +120,11 @@ func (c *PublicOrderController) GetPublicOrderDetail(ctx *gin.Context) {
 		return
 	}
 
+	if shareTokenFromRequest(ctx) != "" {
+		c.getSharedOrder(ctx, uint(orderID))
+		return
+	}
+
 	// 查询订单
 	var order models.Order
 	if err := c.db.Preload("Factory").First(&order, orderID).Error; err != nil {
@@ -137,4 +148,23 @@ func (c *PublicOrderController) GetPublicOrderDetail(ctx *gin.Context) {
 	}
 
 	ctx.JSON(200, publicOrder)
-} 
\ No newline at end of file
+}
+
+// getSharedOrder 分享链接查看的订单：标题、图片、进度时间线和交货日期
+func (c *PublicOrderController) getSharedOrder(ctx *gin.Context, orderID uint) {
+	token, ok := authorizeShare(ctx, c.shareService, orderID, models.ShareScopeView)
+	if !ok {
+		return
+	}
+	view, err := c.shareService.SharedOrder(token)
+	if err != nil {
+		respondShareError(ctx, err)
+		return
+	}
+	if view.Images, err = c.fileService.SharedOrderFiles(orderID, models.OrderFileRoleImage); err != nil {
+		respondShareError(ctx, err)
+		return
+	}
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": view})
+}
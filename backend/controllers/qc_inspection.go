@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gongChang/middleware"
+	"gongChang/models"
+	"gongChang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type QCInspectionController struct {
+	qcService *services.QCInspectionService
+}
+
+func NewQCInspectionController(qcService *services.QCInspectionService) *QCInspectionController {
+	return &QCInspectionController{qcService: qcService}
+}
+
+// GetAQLPlan 查询抽样方案
+// @Summary 查询 AQL 抽样方案
+// @Description 按 ISO 2859-1 一次正常抽样，根据批量、检验水平和 AQL 计算样本量和接收/拒收数
+// @Tags 质量检验
+// @Produce json
+// @Param lot_size query int true "批量"
+// @Param inspection_level query string false "检验水平 I、II、III、S-1 至 S-4，默认 II"
+// @Param aql query number false "AQL，默认 2.5"
+// @Success 200 {object} models.AQLPlan
+// @Router /api/qc/aql-plan [get]
+func (c *QCInspectionController) GetAQLPlan(ctx *gin.Context) {
+	var req models.AQLPlanRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	plan, err := services.ComputeAQLPlan(req.LotSize, req.InspectionLevel, req.AQL)
+	if err != nil {
+		respondQCError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": plan})
+}
+
+// ListInspections 获取订单的检验报告
+// @Summary 获取订单检验报告
+// @Tags 质量检验
+// @Produce json
+// @Param id path int true "订单ID"
+// @Success 200 {array} models.QCInspection
+// @Router /api/orders/{id}/inspections [get]
+func (c *QCInspectionController) ListInspections(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+	inspections, err := c.qcService.ListInspections(uint(orderID))
+	if err != nil {
+		respondQCError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": inspections})
+}
+
+// GetInspection 获取一份检验报告
+// @Summary 获取检验报告
+// @Tags 质量检验
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param inspectionId path int true "检验报告ID"
+// @Success 200 {object} models.QCInspection
+// @Router /api/orders/{id}/inspections/{inspectionId} [get]
+func (c *QCInspectionController) GetInspection(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+	inspectionID, err := strconv.ParseUint(ctx.Param("inspectionId"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的检验报告ID"})
+		return
+	}
+	inspection, err := c.qcService.GetInspection(uint(orderID), uint(inspectionID))
+	if err != nil {
+		respondQCError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": inspection})
+}
+
+// CreateInspection 提交检验报告
+// @Summary 提交检验报告
+// @Description 订单设计师按批量和检验水平计算抽样方案，记录各等级缺陷并判定是否合格；最近一次检验不合格的订单不能进入发货阶段
+// @Tags 质量检验
+// @Accept json
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param request body models.CreateQCInspectionRequest true "检验结果"
+// @Success 201 {object} models.QCInspection
+// @Router /api/orders/{id}/inspections [post]
+func (c *QCInspectionController) CreateInspection(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+	var req models.CreateQCInspectionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	inspection, err := c.qcService.WithActor(middleware.CurrentActor(ctx)).CreateInspection(uint(orderID), &req)
+	if err != nil {
+		respondQCError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"success": true, "data": inspection})
+}
+
+// GetFactoryQualityStats 获取工厂的质量检验统计
+// @Summary 获取工厂质量统计
+// @Description 检验次数、合格率和每百件缺陷数，以及出现最多的缺陷类别；from/to 为 RFC3339 时间，可选
+// @Tags 质量检验
+// @Produce json
+// @Param factory_id path string true "工厂用户ID"
+// @Param from query string false "开始时间"
+// @Param to query string false "结束时间"
+// @Success 200 {object} models.FactoryQualityStats
+// @Router /api/factories/{factory_id}/quality-stats [get]
+func (c *QCInspectionController) GetFactoryQualityStats(ctx *gin.Context) {
+	var from, to *time.Time
+	for name, target := range map[string]**time.Time{"from": &from, "to": &to} {
+		value := ctx.Query(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的时间参数 " + name})
+			return
+		}
+		*target = &t
+	}
+	stats, err := c.qcService.FactoryQualityStats(ctx.Param("factory_id"), from, to)
+	if err != nil {
+		respondQCError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": stats})
+}
+
+// respondQCError 将质量检验错误映射为 HTTP 响应
+func respondQCError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrOrderNotFound), errors.Is(err, services.ErrQCInspectionNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidInspectionLevel), errors.Is(err, services.ErrUnsupportedAQL),
+		errors.Is(err, services.ErrInvalidLotSize), errors.Is(err, services.ErrQCProgressInvalid):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrQCNoFactory):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"gongChang/middleware"
+	"gongChang/models"
+	"gongChang/services"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	streamHeartbeatInterval = 25 * time.Second
+	streamReplayLimit       = 1000
+)
+
+type RealtimeController struct {
+	hub           *services.RealtimeHub
+	policyService *services.PolicyService
+}
+
+func NewRealtimeController(hub *services.RealtimeHub, policyService *services.PolicyService) *RealtimeController {
+	return &RealtimeController{hub: hub, policyService: policyService}
+}
+
+// StreamOrder 订阅订单实时事件（SSE）
+// @Summary 订阅订单事件
+// @Description 推送接单、议价、状态变更、进度和文件事件；按订阅者对订单的访问级别过滤，支持 Last-Event-ID 续传
+// @Tags 实时推送
+// @Produce text/event-stream
+// @Param id path int true "订单ID"
+// @Param Last-Event-ID header string false "上次收到的事件ID"
+// @Router /api/orders/{id}/stream [get]
+func (c *RealtimeController) StreamOrder(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+
+	level, err := c.policyService.OrderAccessLevel(middleware.CurrentActor(ctx), uint(orderID))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "权限校验失败"})
+		return
+	}
+	if level == models.OrderAccessNone {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "无权查看该订单", "code": "forbidden"})
+		return
+	}
+
+	c.stream(ctx, models.OrderChannel(uint(orderID)), level)
+}
+
+// StreamUser 订阅当前用户的个人频道（SSE），推送通知和对方还价
+// @Summary 订阅个人事件
+// @Tags 实时推送
+// @Produce text/event-stream
+// @Param Last-Event-ID header string false "上次收到的事件ID"
+// @Router /api/stream [get]
+func (c *RealtimeController) StreamUser(ctx *gin.Context) {
+	c.stream(ctx, models.UserChannel(ctx.GetString("user_id")), models.OrderAccessOwner)
+}
+
+// stream 先订阅再补发断线期间的事件，之后持续推送直到客户端断开
+func (c *RealtimeController) stream(ctx *gin.Context, channel string, level models.OrderAccess) {
+	lastEventID := ctx.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = ctx.Query("last_event_id")
+	}
+	var afterID uint64
+	if lastEventID != "" {
+		var err error
+		if afterID, err = strconv.ParseUint(lastEventID, 10, 64); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的 Last-Event-ID"})
+			return
+		}
+	}
+
+	sub := c.hub.Subscribe(channel)
+	defer sub.Close()
+
+	// 长连接不受服务器写超时限制
+	if err := http.NewResponseController(ctx.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to clear write deadline for stream: %v", err)
+	}
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	ctx.Writer.Flush()
+
+	replayed := make(map[uint]bool)
+	if afterID > 0 {
+		events, err := c.hub.Replay(channel, uint(afterID), streamReplayLimit)
+		if err != nil {
+			log.Printf("Failed to replay events on %s: %v", channel, err)
+			return
+		}
+		for _, event := range events {
+			replayed[event.ID] = true
+			if event.MinAccess > level {
+				continue
+			}
+			if err := writeStreamEvent(ctx, event); err != nil {
+				return
+			}
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(ctx.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			ctx.Writer.Flush()
+		case event, ok := <-sub.C:
+			if !ok {
+				// 订阅被服务端断开，客户端应携带 Last-Event-ID 重连
+				return
+			}
+			if replayed[event.ID] || event.MinAccess > level {
+				continue
+			}
+			if err := writeStreamEvent(ctx, event); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeStreamEvent(ctx *gin.Context, event models.RealtimeEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(ctx.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+		return err
+	}
+	ctx.Writer.Flush()
+	return nil
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"gongChang/middleware"
+	"gongChang/models"
+	"gongChang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SampleController struct {
+	sampleService *services.SampleService
+}
+
+func NewSampleController(sampleService *services.SampleService) *SampleController {
+	return &SampleController{sampleService: sampleService}
+}
+
+// ListSamples 获取订单的样衣记录
+// @Summary 获取订单样衣记录
+// @Description 按提交先后返回各类型各轮样衣及审批结果
+// @Tags 样衣
+// @Produce json
+// @Param id path int true "订单ID"
+// @Success 200 {array} models.OrderSample
+// @Router /api/orders/{id}/samples [get]
+func (c *SampleController) ListSamples(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+	samples, err := c.sampleService.WithActor(middleware.CurrentActor(ctx)).ListSamples(uint(orderID))
+	if err != nil {
+		respondSampleError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": samples})
+}
+
+// SubmitSample 承接工厂提交一轮样衣
+// @Summary 提交样衣
+// @Description 提交初样、试身样、齐码样或产前样的照片和实测尺寸；实测尺寸按当前发布的工艺单计算偏差
+// @Tags 样衣
+// @Accept json
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param request body models.SubmitSampleRequest true "样衣内容"
+// @Success 201 {object} models.OrderSample
+// @Router /api/orders/{id}/samples [post]
+func (c *SampleController) SubmitSample(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+	var req models.SubmitSampleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sample, err := c.sampleService.WithActor(middleware.CurrentActor(ctx)).SubmitSample(uint(orderID), &req)
+	if err != nil {
+		respondSampleError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"success": true, "data": sample})
+}
+
+// ReviewSample 设计师审批样衣
+// @Summary 审批样衣
+// @Description 批准或驳回一轮样衣，驳回时必须填写意见；批准产前样后工厂才能开始大货生产
+// @Tags 样衣
+// @Accept json
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param sampleId path int true "样衣ID"
+// @Param request body models.ReviewSampleRequest true "审批结果"
+// @Success 200 {object} models.OrderSample
+// @Router /api/orders/{id}/samples/{sampleId}/review [post]
+func (c *SampleController) ReviewSample(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+	sampleID, err := strconv.ParseUint(ctx.Param("sampleId"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的样衣ID"})
+		return
+	}
+	var req models.ReviewSampleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sample, err := c.sampleService.WithActor(middleware.CurrentActor(ctx)).ReviewSample(uint(orderID), uint(sampleID), &req)
+	if err != nil {
+		respondSampleError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": sample})
+}
+
+// respondSampleError 将样衣错误映射为 HTTP 响应
+func respondSampleError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrOrderNotFound), errors.Is(err, services.ErrSampleNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSampleFactoryOnly):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSampleOrderClosed), errors.Is(err, services.ErrSamplePending),
+		errors.Is(err, services.ErrSampleAlreadyReviewed):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSampleCommentRequired):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
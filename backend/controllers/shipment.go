@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"gongChang/middleware"
+	"gongChang/models"
+	"gongChang/services"
+	"gongChang/tracking"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ShipmentController struct {
+	shipmentService *services.ShipmentService
+}
+
+func NewShipmentController(shipmentService *services.ShipmentService) *ShipmentController {
+	return &ShipmentController{shipmentService: shipmentService}
+}
+
+// parseShipmentPath 解析路径中的订单ID和发货批次ID
+func parseShipmentPath(ctx *gin.Context) (uint, uint, bool) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return 0, 0, false
+	}
+	shipmentID, err := strconv.ParseUint(ctx.Param("shipmentId"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的发货批次ID"})
+		return 0, 0, false
+	}
+	return uint(orderID), uint(shipmentID), true
+}
+
+// ListShipments 获取订单的发货批次
+// @Summary 获取订单发货批次
+// @Description 返回全部发货批次及装箱单，以及订购、已发和已确认收货的件数
+// @Tags 发货
+// @Produce json
+// @Param id path int true "订单ID"
+// @Success 200 {object} models.OrderShipments
+// @Router /api/orders/{id}/shipments [get]
+func (c *ShipmentController) ListShipments(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+	shipments, err := c.shipmentService.ListShipments(uint(orderID))
+	if err != nil {
+		respondShipmentError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": shipments})
+}
+
+// GetShipment 获取发货批次详情
+// @Summary 获取发货批次
+// @Tags 发货
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param shipmentId path int true "发货批次ID"
+// @Success 200 {object} models.Shipment
+// @Router /api/orders/{id}/shipments/{shipmentId} [get]
+func (c *ShipmentController) GetShipment(ctx *gin.Context) {
+	orderID, shipmentID, ok := parseShipmentPath(ctx)
+	if !ok {
+		return
+	}
+	shipment, err := c.shipmentService.GetShipment(orderID, shipmentID)
+	if err != nil {
+		respondShipmentError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": shipment})
+}
+
+// CreateShipment 登记发货批次
+// @Summary 登记发货批次
+// @Description 承接工厂登记承运商、运单号、箱数、重量和装箱单；可以分多批发货，累计件数不能超过订购数量，首批发货后订单变为已发货
+// @Tags 发货
+// @Accept json
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param request body models.CreateShipmentRequest true "发货信息"
+// @Success 201 {object} models.Shipment
+// @Router /api/orders/{id}/shipments [post]
+func (c *ShipmentController) CreateShipment(ctx *gin.Context) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return
+	}
+	var req models.CreateShipmentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	shipment, err := c.shipmentService.WithActor(middleware.CurrentActor(ctx)).CreateShipment(uint(orderID), &req)
+	if err != nil {
+		respondShipmentError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"success": true, "data": shipment})
+}
+
+// RefreshTracking 立即查询物流轨迹
+// @Summary 刷新物流轨迹
+// @Description 向承运商查询最新轨迹并保存，不必等待定时轮询
+// @Tags 发货
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param shipmentId path int true "发货批次ID"
+// @Success 200 {object} models.Shipment
+// @Router /api/orders/{id}/shipments/{shipmentId}/track [post]
+func (c *ShipmentController) RefreshTracking(ctx *gin.Context) {
+	orderID, shipmentID, ok := parseShipmentPath(ctx)
+	if !ok {
+		return
+	}
+	shipment, err := c.shipmentService.WithActor(middleware.CurrentActor(ctx)).RefreshTracking(ctx.Request.Context(), orderID, shipmentID)
+	if err != nil {
+		respondShipmentError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": shipment})
+}
+
+// ConfirmDelivery 确认收货
+// @Summary 确认收货
+// @Description 订单设计师或客户确认收到一个发货批次；全部批次确认且发货数量达到订购数量时订单变为已送达
+// @Tags 发货
+// @Accept json
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param shipmentId path int true "发货批次ID"
+// @Param request body models.ConfirmDeliveryRequest false "备注"
+// @Success 200 {object} models.Shipment
+// @Router /api/orders/{id}/shipments/{shipmentId}/confirm-delivery [post]
+func (c *ShipmentController) ConfirmDelivery(ctx *gin.Context) {
+	orderID, shipmentID, ok := parseShipmentPath(ctx)
+	if !ok {
+		return
+	}
+	var req models.ConfirmDeliveryRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	shipment, err := c.shipmentService.WithActor(middleware.CurrentActor(ctx)).ConfirmDelivery(orderID, shipmentID, &req)
+	if err != nil {
+		respondShipmentError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": shipment})
+}
+
+// respondShipmentError 将发货错误映射为 HTTP 响应
+func respondShipmentError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrOrderNotFound), errors.Is(err, services.ErrShipmentNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrShipmentFactoryOnly), errors.Is(err, services.ErrShipmentConfirmForbidden):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrShipmentLineUnknown), errors.Is(err, services.ErrShipmentItemDuplicate),
+		errors.Is(err, services.ErrShipmentWeightInvalid), errors.Is(err, services.ErrShipmentETAInvalid):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrShipmentOrderStatus), errors.Is(err, services.ErrShipmentDuplicate),
+		errors.Is(err, services.ErrShipmentQuantityExceeded), errors.Is(err, services.ErrShipmentAlreadyConfirmed):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, tracking.ErrNotFound), errors.Is(err, tracking.ErrUnknownCarrier):
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	default:
+		respondOrderStatusError(ctx, err)
+	}
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"errors"
+	"gongChang/services"
+	"gongChang/storage"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+)
+
+type StorageController struct {
+	local       *storage.LocalStorage
+	fileService *services.FileService
+}
+
+func NewStorageController(local *storage.LocalStorage, fileService *services.FileService) *StorageController {
+	return &StorageController{local: local, fileService: fileService}
+}
+
+// ServeSigned 校验签名后返回本地存储中的文件，仅在使用本地存储时注册
+// @Summary 签名下载
+// @Description 下载地址由文件接口生成，过期或签名不符时返回 403；支持 Range 请求
+// @Tags 文件管理
+// @Param key path string true "对象键"
+// @Param expires query int true "过期时间戳"
+// @Param signature query string true "签名"
+// @Router /api/storage/{key} [get]
+func (c *StorageController) ServeSigned(ctx *gin.Context) {
+	key, err := storage.CleanKey(ctx.Param("key"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		return
+	}
+
+	if err := c.local.VerifyPresigned(key, ctx.Request.URL.Query()); err != nil {
+		message := "下载地址无效"
+		if errors.Is(err, storage.ErrSignatureExpired) {
+			message = "下载地址已过期"
+		}
+		ctx.JSON(http.StatusForbidden, gin.H{"error": message, "code": "forbidden"})
+		return
+	}
+
+	f, err := c.local.Open(key)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotExist) {
+			log.Printf("Failed to open stored file %s: %v", key, err)
+		}
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		return
+	}
+
+	contentType := ctx.Query("content_type")
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+	if contentType != "" {
+		ctx.Header("Content-Type", contentType)
+	}
+	ctx.Header("Content-Disposition", ctx.Query("disposition"))
+	ctx.Header("Access-Control-Allow-Origin", "*")
+	ctx.Header("Cache-Control", "private, max-age=3600")
+	http.ServeContent(ctx.Writer, ctx.Request, "", info.ModTime(), f)
+}
+
+// ServeLegacy 兼容 /uploads/<key> 形式的旧地址，公开文件重定向到签名地址
+func (c *StorageController) ServeLegacy(ctx *gin.Context) {
+	url, err := c.fileService.PublicURL(ctx.Param("key"))
+	if err != nil {
+		if !errors.Is(err, services.ErrFileNotPublic) {
+			log.Printf("Failed to resolve legacy upload %s: %v", ctx.Param("key"), err)
+		}
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		return
+	}
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Redirect(http.StatusFound, url)
+}
@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"gongChang/middleware"
+	"gongChang/models"
+	"gongChang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TechPackController struct {
+	techPackService *services.TechPackService
+}
+
+func NewTechPackController(techPackService *services.TechPackService) *TechPackController {
+	return &TechPackController{techPackService: techPackService}
+}
+
+// parseTechPackParams 解析路径中的订单ID和版本号
+func parseTechPackParams(ctx *gin.Context, withVersion bool) (uint, int, bool) {
+	orderID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的订单ID"})
+		return 0, 0, false
+	}
+	if !withVersion {
+		return uint(orderID), 0, true
+	}
+	version, err := strconv.Atoi(ctx.Param("version"))
+	if err != nil || version <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的工艺单版本"})
+		return 0, 0, false
+	}
+	return uint(orderID), version, true
+}
+
+// ListTechPacks 获取订单工艺单版本列表
+// @Summary 获取订单工艺单版本列表
+// @Description 按版本从新到旧返回工艺单及工厂确认记录，草稿只对订单设计师可见
+// @Tags 工艺单
+// @Produce json
+// @Param id path int true "订单ID"
+// @Success 200 {array} models.TechPack
+// @Router /api/orders/{id}/tech-packs [get]
+func (c *TechPackController) ListTechPacks(ctx *gin.Context) {
+	orderID, _, ok := parseTechPackParams(ctx, false)
+	if !ok {
+		return
+	}
+	packs, err := c.techPackService.WithActor(middleware.CurrentActor(ctx)).ListTechPacks(orderID)
+	if err != nil {
+		respondTechPackError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": packs})
+}
+
+// GetTechPack 获取指定版本的工艺单
+// @Summary 获取工艺单
+// @Tags 工艺单
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param version path int true "版本号"
+// @Success 200 {object} models.TechPack
+// @Router /api/orders/{id}/tech-packs/{version} [get]
+func (c *TechPackController) GetTechPack(ctx *gin.Context) {
+	orderID, version, ok := parseTechPackParams(ctx, true)
+	if !ok {
+		return
+	}
+	pack, _, err := c.techPackService.WithActor(middleware.CurrentActor(ctx)).GetTechPack(orderID, version)
+	if err != nil {
+		respondTechPackError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": pack})
+}
+
+// CreateTechPack 创建新版本的工艺单草稿
+// @Summary 创建工艺单草稿
+// @Description 版本号在订单内递增，同一订单同时只能有一个草稿
+// @Tags 工艺单
+// @Accept json
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param request body models.TechPackRequest true "工艺单内容"
+// @Success 201 {object} models.TechPack
+// @Router /api/orders/{id}/tech-packs [post]
+func (c *TechPackController) CreateTechPack(ctx *gin.Context) {
+	orderID, _, ok := parseTechPackParams(ctx, false)
+	if !ok {
+		return
+	}
+	var req models.TechPackRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pack, err := c.techPackService.WithActor(middleware.CurrentActor(ctx)).CreateTechPack(orderID, &req)
+	if err != nil {
+		respondTechPackError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"success": true, "data": pack})
+}
+
+// UpdateTechPack 修改工艺单草稿
+// @Summary 修改工艺单草稿
+// @Tags 工艺单
+// @Accept json
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param version path int true "版本号"
+// @Param request body models.TechPackRequest true "工艺单内容"
+// @Success 200 {object} models.TechPack
+// @Router /api/orders/{id}/tech-packs/{version} [put]
+func (c *TechPackController) UpdateTechPack(ctx *gin.Context) {
+	orderID, version, ok := parseTechPackParams(ctx, true)
+	if !ok {
+		return
+	}
+	var req models.TechPackRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pack, err := c.techPackService.WithActor(middleware.CurrentActor(ctx)).UpdateTechPack(orderID, version, &req)
+	if err != nil {
+		respondTechPackError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": pack})
+}
+
+// ReleaseTechPack 发布工艺单草稿
+// @Summary 发布工艺单
+// @Description 发布后内容不可修改，之前的版本转为已取代，承接工厂需要确认新版本后才能开始生产
+// @Tags 工艺单
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param version path int true "版本号"
+// @Success 200 {object} models.TechPack
+// @Router /api/orders/{id}/tech-packs/{version}/release [post]
+func (c *TechPackController) ReleaseTechPack(ctx *gin.Context) {
+	orderID, version, ok := parseTechPackParams(ctx, true)
+	if !ok {
+		return
+	}
+	pack, err := c.techPackService.WithActor(middleware.CurrentActor(ctx)).ReleaseTechPack(orderID, version)
+	if err != nil {
+		respondTechPackError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": pack})
+}
+
+// AcknowledgeTechPack 承接工厂确认工艺单版本
+// @Summary 确认工艺单
+// @Description 承接工厂确认当前发布的工艺单版本，确认后才能上报生产进度
+// @Tags 工艺单
+// @Accept json
+// @Produce json
+// @Param id path int true "订单ID"
+// @Param version path int true "版本号"
+// @Param request body models.AcknowledgeTechPackRequest false "确认备注"
+// @Success 200 {object} models.TechPackAcknowledgement
+// @Router /api/orders/{id}/tech-packs/{version}/acknowledge [post]
+func (c *TechPackController) AcknowledgeTechPack(ctx *gin.Context) {
+	orderID, version, ok := parseTechPackParams(ctx, true)
+	if !ok {
+		return
+	}
+	var req models.AcknowledgeTechPackRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	ack, err := c.techPackService.WithActor(middleware.CurrentActor(ctx)).AcknowledgeTechPack(orderID, version, &req)
+	if err != nil {
+		respondTechPackError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": ack})
+}
+
+// DownloadTechPackPDF 导出可打印的工艺单 PDF
+// @Summary 导出工艺单 PDF
+// @Tags 工艺单
+// @Produce application/pdf
+// @Param id path int true "订单ID"
+// @Param version path int true "版本号"
+// @Success 200 {file} file
+// @Router /api/orders/{id}/tech-packs/{version}/pdf [get]
+func (c *TechPackController) DownloadTechPackPDF(ctx *gin.Context) {
+	orderID, version, ok := parseTechPackParams(ctx, true)
+	if !ok {
+		return
+	}
+	data, filename, err := c.techPackService.WithActor(middleware.CurrentActor(ctx)).RenderTechPackPDF(orderID, version)
+	if err != nil {
+		respondTechPackError(ctx, err)
+		return
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	ctx.Data(http.StatusOK, "application/pdf", data)
+}
+
+// respondTechPackError 将工艺单错误映射为 HTTP 响应
+func respondTechPackError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrOrderNotFound), errors.Is(err, services.ErrTechPackNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTechPackFactoryOnly):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTechPackDraftExists), errors.Is(err, services.ErrTechPackNotDraft),
+		errors.Is(err, services.ErrTechPackNotCurrent):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTechPackDuplicateSize), errors.Is(err, services.ErrTechPackSizeUnknown),
+		errors.Is(err, services.ErrTechPackIncomplete):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
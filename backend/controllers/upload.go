@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"errors"
+	"gongChang/middleware"
+	"gongChang/models"
+	"gongChang/services"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// chunkReadTimeout 接收单个分片的最长时间
+const chunkReadTimeout = 10 * time.Minute
+
+// InitiateUpload 创建可续传的分片上传会话
+// @Summary 创建分片上传
+// @Description 用于大文件（3D模型、视频等）；声明文件大小和完整文件的 SHA-256，返回分片大小和分片数量
+// @Tags 文件管理
+// @Accept json
+// @Produce json
+// @Param request body models.InitiateUploadRequest true "上传信息"
+// @Success 200 {object} models.UploadSessionStatus
+// @Router /api/files/uploads [post]
+func (c *FileController) InitiateUpload(ctx *gin.Context) {
+	var req models.InitiateUploadRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数: " + err.Error()})
+		return
+	}
+
+	status, err := c.fileService.WithActor(middleware.CurrentActor(ctx)).InitiateUpload(&req)
+	if err != nil {
+		respondUploadError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"success": true, "data": status})
+}
+
+// GetUploadStatus 查询上传会话，missing_chunks 为尚未上传的分片序号
+// @Summary 查询分片上传状态
+// @Tags 文件管理
+// @Produce json
+// @Param uploadId path string true "上传会话ID"
+// @Success 200 {object} models.UploadSessionStatus
+// @Router /api/files/uploads/{uploadId} [get]
+func (c *FileController) GetUploadStatus(ctx *gin.Context) {
+	status, err := c.fileService.WithActor(middleware.CurrentActor(ctx)).GetUploadStatus(ctx.Param("uploadId"))
+	if err != nil {
+		respondUploadError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": status})
+}
+
+// UploadChunk 上传一个分片，请求体为分片原始数据，X-Chunk-SHA256 为分片的 SHA-256
+// @Summary 上传分片
+// @Tags 文件管理
+// @Accept application/octet-stream
+// @Produce json
+// @Param uploadId path string true "上传会话ID"
+// @Param index path int true "分片序号，从0开始"
+// @Param X-Chunk-SHA256 header string true "分片的 SHA-256（十六进制）"
+// @Router /api/files/uploads/{uploadId}/chunks/{index} [put]
+func (c *FileController) UploadChunk(ctx *gin.Context) {
+	index, err := strconv.Atoi(ctx.Param("index"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": services.ErrChunkIndexInvalid.Error()})
+		return
+	}
+	if ctx.Request.ContentLength > services.MaxChunkSize {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": services.ErrChunkSizeInvalid.Error()})
+		return
+	}
+
+	// 工厂网络较慢，单个分片不受服务器 30 秒读超时限制
+	if err := http.NewResponseController(ctx.Writer).SetReadDeadline(time.Now().Add(chunkReadTimeout)); err != nil {
+		log.Printf("Failed to extend read deadline for chunk upload: %v", err)
+	}
+
+	checksum := ctx.GetHeader("X-Chunk-SHA256")
+	if checksum == "" {
+		checksum = ctx.Query("sha256")
+	}
+	body := http.MaxBytesReader(ctx.Writer, ctx.Request.Body, services.MaxChunkSize+1)
+	chunk, err := c.fileService.WithActor(middleware.CurrentActor(ctx)).PutChunk(ctx.Param("uploadId"), index, body, checksum)
+	if err != nil {
+		respondUploadError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "data": chunk})
+}
+
+// CompleteUpload 合并分片并校验 SHA-256；会话关联订单时同时将文件加入订单
+// @Summary 完成分片上传
+// @Tags 文件管理
+// @Accept json
+// @Produce json
+// @Param uploadId path string true "上传会话ID"
+// @Param request body models.CompleteUploadRequest false "文件描述"
+// @Router /api/files/uploads/{uploadId}/complete [post]
+func (c *FileController) CompleteUpload(ctx *gin.Context) {
+	var req models.CompleteUploadRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+			return
+		}
+	}
+
+	fileRecord, session, err := c.fileService.WithActor(middleware.CurrentActor(ctx)).CompleteUpload(ctx.Param("uploadId"))
+	if err != nil {
+		respondUploadError(ctx, err)
+		return
+	}
+
+	fileURL, err := c.fileService.GetDownloadURL(fileRecord, false)
+	if err != nil {
+		log.Printf("Failed to presign file %s: %v", fileRecord.ID, err)
+	}
+	fileInfo := &models.FileInfo{
+		ID:          fileRecord.ID,
+		URL:         fileURL,
+		Type:        fileRecord.Type,
+		Name:        fileRecord.Name,
+		Description: req.Description,
+	}
+
+	// 文件在合并时已加入订单，这里与 AddFileToOrder 相同返回订单并保存文件说明
+	if session.OrderID != nil && session.FileType != "" {
+		order, err := c.appendFileToOrder(ctx, *session.OrderID, fileRecord.ID, session.FileType, req.Description)
+		if err != nil {
+			log.Printf("Failed to add file %s to order %d: %v", fileRecord.ID, *session.OrderID, err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "更新订单失败"})
+			return
+		}
+		ctx.JSON(http.StatusOK, models.AddFileToOrderResponse{Success: true, Order: order, File: fileInfo})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "file": fileInfo})
+}
+
+// AbortUpload 取消上传并删除已上传的分片
+// @Summary 取消分片上传
+// @Tags 文件管理
+// @Param uploadId path string true "上传会话ID"
+// @Router /api/files/uploads/{uploadId} [delete]
+func (c *FileController) AbortUpload(ctx *gin.Context) {
+	if err := c.fileService.WithActor(middleware.CurrentActor(ctx)).AbortUpload(ctx.Param("uploadId")); err != nil {
+		respondUploadError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"success": true, "message": "上传已取消"})
+}
+
+func respondUploadError(ctx *gin.Context, err error) {
+	var forbiddenErr *services.ForbiddenError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &forbiddenErr):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": forbiddenErr.Reason, "code": "forbidden"})
+	case errors.Is(err, services.ErrUploadNotFound), errors.Is(err, services.ErrResourceNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUploadNotActive), errors.Is(err, services.ErrUploadIncomplete),
+		errors.Is(err, services.ErrUploadChecksumMismatch):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.As(err, &maxBytesErr), errors.Is(err, services.ErrUploadTooLarge):
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUnsupportedFileType), errors.Is(err, services.ErrChunkIndexInvalid),
+		errors.Is(err, services.ErrChunkSizeInvalid), errors.Is(err, services.ErrChunkChecksumMissing),
+		errors.Is(err, services.ErrChunkChecksumMismatch):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Chunked upload failed: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
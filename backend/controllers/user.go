@@ -1,18 +1,14 @@
 package controllers
 
 import (
-	"fmt"
 	"gongChang/config"
 	"gongChang/middleware"
 	"gongChang/models"
 	"gongChang/services"
-	"io"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strings"
 
-	"github.com/google/uuid"
 	"gorm.io/gorm"
 
 	"github.com/gin-gonic/gin"
@@ -21,12 +17,18 @@ import (
 )
 
 type UserController struct {
-	userService *services.UserService
+	userService  *services.UserService
+	tokenService *services.TokenService
+	fileService  *services.FileService
+	cfg          *config.Config
 }
 
-func NewUserController(userService *services.UserService) *UserController {
+func NewUserController(userService *services.UserService, tokenService *services.TokenService, fileService *services.FileService, cfg *config.Config) *UserController {
 	return &UserController{
-		userService: userService,
+		userService:  userService,
+		tokenService: tokenService,
+		fileService:  fileService,
+		cfg:          cfg,
 	}
 }
 
@@ -67,26 +69,28 @@ func (uc *UserController) Login(c *gin.Context) {
 		return
 	}
 
-	// 加载配置以获取JWT密钥
-	cfg, err := config.LoadConfig()
+	// 生成访问令牌
+	token, err := middleware.GenerateToken(user.ID, user.Role, uc.cfg.JWT.Secret, uc.cfg.AccessTokenTTL())
 	if err != nil {
-		log.Printf("Failed to load configuration for JWT: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
 		return
 	}
 
-	// 生成JWT token
-	token, err := middleware.GenerateToken(user.ID, user.Role, cfg.JWT.Secret)
+	// 签发刷新令牌，开启新的登录会话
+	refreshToken, err := uc.tokenService.IssueRefreshToken(user.ID, tokenClient(c))
 	if err != nil {
+		log.Printf("Failed to issue refresh token: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"token":   token,
-		"user":    user,
-		"profile": profile,
+		"message":       "Login successful",
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(uc.cfg.AccessTokenTTL().Seconds()),
+		"user":          user,
+		"profile":       profile,
 	})
 }
 
@@ -185,44 +189,110 @@ func (c *UserController) UpdateUserProfile(ctx *gin.Context) {
 	})
 }
 
-// RefreshToken 刷新Token
+// RefreshToken 使用刷新令牌换取新的访问令牌和刷新令牌
+// @Summary 刷新令牌
+// @Description 刷新令牌只能使用一次，重复使用会导致该登录会话的全部令牌失效
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param request body models.RefreshTokenRequest true "刷新令牌"
+// @Success 200 {object} gin.H
+// @Router /api/auth/refresh [post]
 func (c *UserController) RefreshToken(ctx *gin.Context) {
-	// 从请求头获取token
-	token := ctx.GetHeader("Authorization")
-	if token == "" {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未提供token"})
+	var req models.RefreshTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
 		return
 	}
 
-	// 去掉Bearer前缀
-	if strings.HasPrefix(token, "Bearer ") {
-		token = token[7:]
-	}
-
-	// 验证token
-	claims, err := middleware.ValidateToken(token)
+	refreshToken, user, err := c.tokenService.RotateRefreshToken(req.RefreshToken, tokenClient(ctx))
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "token无效"})
+		respondTokenError(ctx, err)
 		return
 	}
 
-	// 生成新token
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "加载配置失败"})
-		return
-	}
-	newToken, err := middleware.GenerateToken(claims.UserID, claims.Role, cfg.JWT.Secret)
+	token, err := middleware.GenerateToken(user.ID, user.Role, c.cfg.JWT.Secret, c.cfg.AccessTokenTTL())
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{
-		"token": newToken,
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(c.cfg.AccessTokenTTL().Seconds()),
 	})
 }
 
+// Logout 退出当前设备
+// @Summary 退出登录
+// @Description 吊销刷新令牌所属的登录会话
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param request body models.LogoutRequest true "刷新令牌"
+// @Success 200 {object} gin.H
+// @Router /api/auth/logout [post]
+func (c *UserController) Logout(ctx *gin.Context) {
+	var req models.LogoutRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	if err := c.tokenService.RevokeRefreshToken(req.RefreshToken); err != nil {
+		respondTokenError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "已退出登录"})
+}
+
+// LogoutAll 退出所有设备
+// @Summary 退出所有设备
+// @Description 吊销当前用户的全部刷新令牌，已签发的访问令牌在过期前仍然有效
+// @Tags 认证
+// @Produce json
+// @Success 200 {object} gin.H
+// @Router /api/auth/logout-all [post]
+func (c *UserController) LogoutAll(ctx *gin.Context) {
+	userID := ctx.GetString("user_id")
+	if userID == "" {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	if err := c.tokenService.RevokeAllForUser(userID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "退出失败: " + err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "已退出所有设备"})
+}
+
+// tokenClient 记录签发令牌时的客户端信息
+func tokenClient(ctx *gin.Context) models.TokenClient {
+	return models.TokenClient{
+		UserAgent: ctx.Request.UserAgent(),
+		IP:        ctx.ClientIP(),
+	}
+}
+
+// respondTokenError 将刷新令牌错误统一映射为 401
+func respondTokenError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrRefreshTokenReused):
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "code": "refresh_token_reused"})
+	case errors.Is(err, services.ErrRefreshTokenInvalid),
+		errors.Is(err, services.ErrRefreshTokenExpired),
+		errors.Is(err, services.ErrRefreshTokenRevoked):
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "code": "invalid_refresh_token"})
+	default:
+		log.Printf("Refresh token operation failed: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "令牌处理失败"})
+	}
+}
+
 // UploadAvatar 上传头像
 func (c *UserController) UploadAvatar(ctx *gin.Context) {
 	userID := ctx.GetString("user_id")
@@ -260,37 +330,14 @@ func (c *UserController) UploadAvatar(ctx *gin.Context) {
 		return
 	}
 
-	// 生成唯一文件名
-	fileID := uuid.New().String()
-	newFilename := fileID + ext
-
-	// 确保上传目录存在
-	uploadDir := "./uploads/avatars"
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "创建上传目录失败"})
-		return
-	}
-
-	// 保存文件
-	finalPath := filepath.Join(uploadDir, newFilename)
-	dst, err := os.Create(finalPath)
+	// 保存到存储后端
+	fileURL, err := c.fileService.SaveAvatar(file, header.Size, ext)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "创建文件失败"})
-		return
-	}
-	defer dst.Close()
-
-	// 复制文件内容
-	_, err = io.Copy(dst, file)
-	if err != nil {
-		os.Remove(finalPath) // 清理失败的文件
+		log.Printf("Failed to save avatar: %v", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "保存文件失败"})
 		return
 	}
 
-	// 构建文件访问URL
-	fileURL := fmt.Sprintf("/uploads/avatars/%s", newFilename)
-
 	// 返回成功响应
 	response := models.UploadAvatarResponse{
 		Success: true,
@@ -432,6 +479,11 @@ func (c *UserController) ChangePassword(ctx *gin.Context) {
 		return
 	}
 
+	// 修改密码后使所有设备的登录会话失效
+	if err := c.tokenService.RevokeAllForUser(userID); err != nil {
+		log.Printf("Failed to revoke refresh tokens after password change: %v", err)
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{
 		"message": "密码修改成功",
 	})
@@ -1,24 +1,50 @@
 package database
 
 import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
 	"gongChang/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"log"
 )
 
 func MigrateData(db *gorm.DB) error {
+	if err := dedupeJiedanBids(db); err != nil {
+		return err
+	}
+
 	// 自动迁移数据库表结构
 	err := db.AutoMigrate(
 		&models.User{},
 		&models.Product{},
 		&models.Order{},
 		&models.File{},
+		&models.OrderFile{},
+		&models.OrderShareToken{},
+		&models.FileBlob{},
+		&models.FileDerivative{},
+		&models.UploadSession{},
+		&models.UploadChunk{},
 		&models.DesignerProfile{},
 		&models.FactoryProfile{},
 		&models.SupplierProfile{},
 		&models.OrderProgress{},
 		&models.OrderAttachment{},
 		&models.Fabric{},
+		&models.FabricLedgerEntry{},
+		&models.OrderBOMItem{},
+		&models.OrderLine{},
+		&models.ProgressLineQuantity{},
+		&models.TechPack{},
+		&models.TechPackAcknowledgement{},
+		&models.OrderSample{},
+		&models.QCInspection{},
+		&models.QCDefect{},
+		&models.Shipment{},
+		&models.ShipmentItem{},
+		&models.ShipmentEvent{},
 		&models.FabricCategory{},
 		&models.Jiedan{},
 		&models.FactoryEmployee{},
@@ -26,11 +52,30 @@ func MigrateData(db *gorm.DB) error {
 		&models.FactoryRating{},
 		&models.DesignerSpecialty{},
 		&models.DesignerRating{},
+		&models.OrderStatusHistory{},
+		&models.JiedanQuote{},
+		&models.JiedanQuoteLine{},
+		&models.RefreshToken{},
+		&models.AuditEvent{},
+		&models.Notification{},
+		&models.NotificationPreference{},
+		&models.RealtimeEvent{},
+		&models.MessageThread{},
+		&models.Message{},
+		&models.MessageAttachment{},
+		&models.ProgressMilestone{},
 	)
 	if err != nil {
 		return err
 	}
 
+	if err := migrateOrderFileArrays(db); err != nil {
+		return err
+	}
+	if err := migrateFabricOpeningStock(db); err != nil {
+		return err
+	}
+
 	// 执行额外的迁移
 	if err := db.Exec("ALTER TABLE users MODIFY COLUMN role varchar(191) NOT NULL").Error; err != nil {
 		return err
@@ -104,4 +149,160 @@ func MigrateData(db *gorm.DB) error {
 	log.Println("SQL migrations completed")
 
 	return nil
-} 
\ No newline at end of file
+}
+
+// legacyOrderFileColumn 订单上原来保存文件ID数组的 JSON 列及对应的文件用途
+type legacyOrderFileColumn struct {
+	Column string
+	Role   models.OrderFileRole
+}
+
+var legacyOrderFileColumns = []legacyOrderFileColumn{
+	{"attachments", models.OrderFileRoleAttachment},
+	{"models", models.OrderFileRoleModel},
+	{"images", models.OrderFileRoleImage},
+	{"videos", models.OrderFileRoleVideo},
+}
+
+// migrateOrderFileArrays 将订单 JSON 列中的文件ID和 files.order_id 关联转换为 order_files 记录，完成后删除 JSON 列
+// 插入时忽略已存在的关联，中途失败可以重新执行；不存在的文件ID会被跳过并记录日志。
+func migrateOrderFileArrays(db *gorm.DB) error {
+	var columns []legacyOrderFileColumn
+	selects := []string{"id"}
+	for _, legacy := range legacyOrderFileColumns {
+		if db.Migrator().HasColumn(&models.Order{}, legacy.Column) {
+			columns = append(columns, legacy)
+			selects = append(selects, legacy.Column)
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	log.Printf("Converting order file columns %v to order_files...", selects[1:])
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		rows, err := tx.Table("orders").Select(selects).Rows()
+		if err != nil {
+			return err
+		}
+		var links []models.OrderFile
+		// 每个订单每种用途的下一个排序号
+		nextSort := make(map[string]int)
+		addLink := func(orderID uint, fileID string, role models.OrderFileRole) {
+			key := fmt.Sprintf("%d/%s", orderID, role)
+			links = append(links, models.OrderFile{OrderID: orderID, FileID: fileID, Role: role, SortOrder: nextSort[key]})
+			nextSort[key]++
+		}
+		for rows.Next() {
+			var orderID uint
+			values := make([]sql.NullString, len(columns))
+			dest := []interface{}{&orderID}
+			for i := range values {
+				dest = append(dest, &values[i])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return err
+			}
+			for i, legacy := range columns {
+				if !values[i].Valid || values[i].String == "" {
+					continue
+				}
+				var ids []string
+				if err := json.Unmarshal([]byte(values[i].String), &ids); err != nil {
+					log.Printf("Warning: order %d has invalid %s value, skipped: %v", orderID, legacy.Column, err)
+					continue
+				}
+				for _, id := range ids {
+					addLink(orderID, id, legacy.Role)
+				}
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// 只通过 files.order_id 关联、不在 JSON 列中的文件按文件类型排在对应用途的末尾
+		var files []models.File
+		if err := tx.Where("order_id IS NOT NULL").Order("created_at").Find(&files).Error; err != nil {
+			return err
+		}
+		for _, file := range files {
+			role := models.OrderFileRole(file.Type)
+			if !role.IsValid() {
+				role = models.OrderFileRoleAttachment
+			}
+			addLink(*file.OrderID, file.ID, role)
+		}
+
+		var existing []string
+		if err := tx.Model(&models.File{}).Pluck("id", &existing).Error; err != nil {
+			return err
+		}
+		known := make(map[string]bool, len(existing))
+		for _, id := range existing {
+			known[id] = true
+		}
+		converted := 0
+		for i := range links {
+			if !known[links[i].FileID] {
+				log.Printf("Warning: order %d references missing file %s, skipped", links[i].OrderID, links[i].FileID)
+				continue
+			}
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&links[i])
+			if result.Error != nil {
+				return result.Error
+			}
+			converted += int(result.RowsAffected)
+		}
+		log.Printf("Created %d order_files records", converted)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, legacy := range columns {
+		if err := db.Migrator().DropColumn(&models.Order{}, legacy.Column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dedupeJiedanBids 创建接单 (order_id, factory_id) 唯一索引之前，清除与其他接单重复的已撤回接单
+// 保留未撤回的接单，全部已撤回时保留最早的一条；索引已存在时跳过。
+func dedupeJiedanBids(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.Jiedan{}) || db.Migrator().HasIndex(&models.Jiedan{}, "uk_order_factory") {
+		return nil
+	}
+	result := db.Exec(`DELETE j FROM jiedan j
+		JOIN jiedan k ON k.order_id = j.order_id AND k.factory_id = j.factory_id AND k.id <> j.id
+		WHERE j.deleted_at IS NOT NULL AND (k.deleted_at IS NULL OR k.id < j.id)`)
+	if result.Error != nil {
+		return fmt.Errorf("清除重复接单失败: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Removed %d withdrawn duplicate jiedan records", result.RowsAffected)
+	}
+	return nil
+}
+
+// migrateFabricOpeningStock 为引入库存流水之前已有库存的布料补一条期初调整流水，使流水汇总与布料库存一致
+// 只处理还没有任何流水的布料，可以重复执行。
+func migrateFabricOpeningStock(db *gorm.DB) error {
+	result := db.Exec(`INSERT INTO fabric_ledger_entries
+		(fabric_id, type, quantity, stock_delta, reserved_delta, stock_after, reserved_after, note, operator_id, created_at)
+		SELECT f.id, ?, f.stock, f.stock, 0, f.stock, 0, ?, ?, NOW()
+		FROM fabrics f
+		WHERE f.stock <> 0 AND NOT EXISTS (SELECT 1 FROM fabric_ledger_entries e WHERE e.fabric_id = f.id)`,
+		models.FabricLedgerAdjustment, "期初库存", "system")
+	if result.Error != nil {
+		return fmt.Errorf("补充布料期初库存流水失败: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Recorded opening stock ledger entries for %d fabrics", result.RowsAffected)
+	}
+	return nil
+}
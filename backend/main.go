@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 	"gongChang/config"
 	"gongChang/database"
@@ -61,7 +65,12 @@ func main() {
 	}
 
 	// 设置路由
-	router := routes.SetupRouter(db, cfg)
+	router, background := routes.SetupRouter(db, cfg)
+
+	// 启动后台任务，收到退出信号时随 ctx 一起停止
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	background.Start(ctx)
 
 	// 打印所有已注册的路由
 	for _, route := range router.Routes() {
@@ -77,9 +86,19 @@ func main() {
 		IdleTimeout:  120 * time.Second,
 	}
 
+	// 收到退出信号后停止接收新请求，等待进行中的请求完成
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Failed to shut down server: %v", err)
+		}
+	}()
+
 	// 启动服务器
 	log.Printf("Server starting on %s", server.Addr)
-	if err := server.ListenAndServe(); err != nil {
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 } 
\ No newline at end of file
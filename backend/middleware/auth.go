@@ -87,12 +87,13 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
-func GenerateToken(userID string, role models.UserRole, secret string) (string, error) {
+// GenerateToken 签发访问令牌，有效期由 ttl 指定（见 config.AccessTokenTTL）
+func GenerateToken(userID string, role models.UserRole, secret string, ttl time.Duration) (string, error) {
 	claims := Claims{
 		UserID: userID,
 		Role:   role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
@@ -121,26 +122,3 @@ func ValidateToken(tokenString string) (*Claims, error) {
 
 	return nil, jwt.ErrSignatureInvalid
 }
-
-// FactoryRoleMiddleware 工厂角色验证中间件
-func FactoryRoleMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// 先执行认证中间件
-		AuthMiddleware()(c)
-		
-		// 如果认证失败，直接返回
-		if c.IsAborted() {
-			return
-		}
-		
-		// 检查用户角色
-		userRole := c.GetString("user_role")
-		if userRole != string(models.RoleFactory) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "仅工厂角色可以访问此功能"})
-			c.Abort()
-			return
-		}
-		
-		c.Next()
-	}
-} 
\ No newline at end of file
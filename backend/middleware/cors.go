@@ -16,7 +16,7 @@ func CORSMiddleware() gin.HandlerFunc {
 		c.Writer.Header().Set("Access-Control-Allow-Headers", 
 			"Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, "+
 			"Authorization, Accept, Origin, Cache-Control, X-Requested-With, "+
-			"Access-Control-Request-Headers, Access-Control-Request-Method")
+			"Access-Control-Request-Headers, Access-Control-Request-Method, X-Share-Token, X-Share-Pin")
 		
 		// 允许的请求方法
 		c.Writer.Header().Set("Access-Control-Allow-Methods", 
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"errors"
+	"gongChang/models"
+	"gongChang/services"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CurrentActor 从上下文中取出认证中间件写入的当前用户及请求信息
+func CurrentActor(c *gin.Context) models.Actor {
+	return models.Actor{
+		UserID:    c.GetString("user_id"),
+		Role:      models.UserRole(c.GetString("user_role")),
+		RequestID: c.GetString("request_id"),
+		IP:        c.ClientIP(),
+	}
+}
+
+// Policy 授权中间件集合，所有资源归属检查都委托给 PolicyService
+type Policy struct {
+	policy *services.PolicyService
+}
+
+func NewPolicy(policy *services.PolicyService) *Policy {
+	return &Policy{policy: policy}
+}
+
+// RequireRole 要求当前用户具有指定角色之一
+func (p *Policy) RequireRole(roles ...models.UserRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p.authorize(c, p.policy.RequireRole(CurrentActor(c), roles...))
+	}
+}
+
+// Self 要求路径参数中的用户ID为当前用户
+func (p *Policy) Self(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p.authorize(c, p.policy.RequireSelf(CurrentActor(c), c.Param(param)))
+	}
+}
+
+// OrderViewer 要求当前用户可以查看路径参数中的订单
+func (p *Policy) OrderViewer(param string) gin.HandlerFunc {
+	return p.byUintParam(param, p.policy.CanViewOrder)
+}
+
+// OrderOwner 要求当前用户是路径参数中订单的设计师
+func (p *Policy) OrderOwner(param string) gin.HandlerFunc {
+	return p.byUintParam(param, p.policy.CanManageOrder)
+}
+
+// OrderOperator 要求当前用户是订单设计师或承接工厂
+func (p *Policy) OrderOperator(param string) gin.HandlerFunc {
+	return p.byUintParam(param, p.policy.CanOperateOrder)
+}
+
+// OrderFactory 要求当前用户是路径参数中订单的承接工厂
+func (p *Policy) OrderFactory(param string) gin.HandlerFunc {
+	return p.byUintParam(param, p.policy.CanProduceOrder)
+}
+
+// JiedanViewer 要求当前用户是接单工厂或订单设计师
+func (p *Policy) JiedanViewer(param string) gin.HandlerFunc {
+	return p.byUintParam(param, p.policy.CanViewJiedan)
+}
+
+// JiedanOwner 要求当前用户是接单工厂
+func (p *Policy) JiedanOwner(param string) gin.HandlerFunc {
+	return p.byUintParam(param, p.policy.CanManageJiedan)
+}
+
+// JiedanDecider 要求当前用户是接单所属订单的设计师
+func (p *Policy) JiedanDecider(param string) gin.HandlerFunc {
+	return p.byUintParam(param, p.policy.CanDecideJiedan)
+}
+
+// JiedanParty 要求当前用户是议价的一方：接单工厂或订单设计师
+func (p *Policy) JiedanParty(param string) gin.HandlerFunc {
+	return p.byUintParam(param, p.policy.CanNegotiateJiedan)
+}
+
+// ProgressOwner 要求当前用户是进度记录所属工厂
+func (p *Policy) ProgressOwner(param string) gin.HandlerFunc {
+	return p.byUintParam(param, p.policy.CanManageProgress)
+}
+
+// FabricOwner 要求当前用户是路径参数中布料的所有方
+func (p *Policy) FabricOwner(param string) gin.HandlerFunc {
+	return p.byUintParam(param, p.policy.CanManageFabric)
+}
+
+// ThreadParticipant 要求当前用户是路径参数中会话的一方
+func (p *Policy) ThreadParticipant(param string) gin.HandlerFunc {
+	return p.byUintParam(param, p.policy.CanAccessThread)
+}
+
+// FileReader 要求当前用户可以读取路径参数中的文件
+func (p *Policy) FileReader(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p.authorize(c, p.policy.CanAccessFile(CurrentActor(c), c.Param(param), false))
+	}
+}
+
+// FileWriter 要求当前用户可以修改或删除路径参数中的文件
+func (p *Policy) FileWriter(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p.authorize(c, p.policy.CanAccessFile(CurrentActor(c), c.Param(param), true))
+	}
+}
+
+func (p *Policy) byUintParam(param string, check func(models.Actor, uint) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param(param), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的ID"})
+			c.Abort()
+			return
+		}
+		p.authorize(c, check(CurrentActor(c), uint(id)))
+	}
+}
+
+// authorize 根据检查结果放行或返回统一格式的错误响应
+func (p *Policy) authorize(c *gin.Context, err error) {
+	if err == nil {
+		c.Next()
+		return
+	}
+
+	var forbiddenErr *services.ForbiddenError
+	switch {
+	case errors.As(err, &forbiddenErr):
+		c.JSON(http.StatusForbidden, gin.H{"error": forbiddenErr.Reason, "code": "forbidden"})
+	case errors.Is(err, services.ErrResourceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "not_found"})
+	default:
+		log.Printf("Authorization check failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "权限校验失败"})
+	}
+	c.Abort()
+}
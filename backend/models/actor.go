@@ -0,0 +1,24 @@
+package models
+
+// Actor 当前请求的操作人
+type Actor struct {
+	UserID    string   `json:"user_id"`
+	Role      UserRole `json:"role"`
+	RequestID string   `json:"request_id,omitempty"`
+	IP        string   `json:"ip,omitempty"`
+
+	ShareTokenID uint `json:"share_token_id,omitempty"` // 通过订单分享令牌访问时的令牌ID
+}
+
+// IsDesigner 是否为设计师
+func (a Actor) IsDesigner() bool {
+	return a.Role == RoleDesigner
+}
+
+// IsFactory 是否为工厂
+func (a Actor) IsFactory() bool {
+	return a.Role == RoleFactory
+}
+
+// SystemActor 后台任务使用的系统操作人
+var SystemActor = Actor{Role: "system"}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ErrAuditEventImmutable 审计事件只允许追加
+var ErrAuditEventImmutable = errors.New("审计事件不可修改或删除")
+
+// 审计实体类型
+const (
+	AuditEntityOrder        = "order"
+	AuditEntityJiedan       = "jiedan"
+	AuditEntityJiedanQuote  = "jiedan_quote"
+	AuditEntityProgress     = "progress"
+	AuditEntityFabric       = "fabric"
+	AuditEntityEmployee     = "employee"
+	AuditEntityFile         = "file"
+	AuditEntityMilestone    = "milestone"
+	AuditEntityOrderShare   = "order_share"
+	AuditEntityTechPack     = "tech_pack"
+	AuditEntitySample       = "sample"
+	AuditEntityQCInspection = "qc_inspection"
+	AuditEntityShipment     = "shipment"
+)
+
+// 审计动作
+const (
+	AuditActionCreate       = "create"
+	AuditActionUpdate       = "update"
+	AuditActionDelete       = "delete"
+	AuditActionStatusChange = "status_change"
+	AuditActionAccept       = "accept"
+	AuditActionReject       = "reject"
+	AuditActionStockChange  = "stock_change"
+	AuditActionDelay        = "delay"
+)
+
+// AuditEvent 审计事件，记录谁在何时对哪个实体做了什么以及字段前后值
+type AuditEvent struct {
+	ID         uint           `json:"id" gorm:"primaryKey"`
+	ActorID    string         `json:"actor_id" gorm:"type:varchar(191);index"`
+	ActorRole  string         `json:"actor_role" gorm:"type:varchar(50)"`
+	EntityType string         `json:"entity_type" gorm:"type:varchar(50);not null;index:idx_audit_entity"`
+	EntityID   string         `json:"entity_id" gorm:"type:varchar(191);not null;index:idx_audit_entity"`
+	Action     string         `json:"action" gorm:"type:varchar(50);not null"`
+	OrderID    *uint          `json:"order_id" gorm:"index"`                   // 关联订单，设计师按订单查看
+	OwnerID    string         `json:"owner_id" gorm:"type:varchar(191);index"` // 实体归属用户，工厂/设计师按归属查看
+	Changes    datatypes.JSON `json:"changes"`                                 // {"字段": {"before": 旧值, "after": 新值}}
+	RequestID  string         `json:"request_id" gorm:"type:varchar(64);index"`
+	IP         string         `json:"ip" gorm:"type:varchar(64)"`
+	CreatedAt  time.Time      `json:"created_at" gorm:"index"`
+}
+
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
+
+// BeforeUpdate 禁止修改审计事件
+func (AuditEvent) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditEventImmutable
+}
+
+// BeforeDelete 禁止删除审计事件
+func (AuditEvent) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditEventImmutable
+}
+
+// AuditEventQuery 审计事件查询条件
+type AuditEventQuery struct {
+	EntityType string     `form:"entity_type"`
+	EntityID   string     `form:"entity_id"`
+	OrderID    uint       `form:"order_id"`
+	Action     string     `form:"action"`
+	ActorID    string     `form:"actor_id"`
+	From       *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To         *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Page       int        `form:"page"`
+	PageSize   int        `form:"page_size"`
+}
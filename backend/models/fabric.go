@@ -17,7 +17,11 @@ type Fabric struct {
 	Width       float64        `json:"width" gorm:"type:decimal(8,2)"`                // 幅宽 (cm)
 	Price       float64        `json:"price" gorm:"type:decimal(10,2)"`               // 单价 (元/米)
 	Unit        string         `json:"unit" gorm:"type:varchar(50);default:'米'"`      // 单位
-	Stock       int            `json:"stock" gorm:"default:0"`                        // 库存数量
+	Stock       int            `json:"stock" gorm:"default:0"`                        // 在库数量，含已预留的部分，只通过库存流水变更
+	Reserved    int            `json:"reserved" gorm:"not null;default:0"`            // 已为订单预留的数量
+	ReorderPoint    int        `json:"reorder_point" gorm:"not null;default:0"`       // 再订货点，可用数量降到该值及以下时提醒补货，0 表示不提醒
+	ReorderQuantity int        `json:"reorder_quantity" gorm:"not null;default:0"`    // 建议补货数量
+	LowStockAlertedAt *time.Time `json:"low_stock_alerted_at"`                        // 本次低于再订货点已提醒的时间，回到再订货点以上后清空
 	MinOrder    int            `json:"min_order" gorm:"default:1"`                    // 最小订购量
 	Description string         `json:"description" gorm:"type:text"`                  // 描述
 	ImageURL    string         `json:"image_url" gorm:"type:varchar(500)"`            // 图片URL
@@ -32,6 +36,11 @@ type Fabric struct {
 	DeletedAt   gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 }
 
+// Available 可预留的数量
+func (f *Fabric) Available() int {
+	return f.Stock - f.Reserved
+}
+
 // FabricCategory 布料分类
 type FabricCategory struct {
 	ID          uint           `json:"id" gorm:"primaryKey"`
@@ -58,6 +67,8 @@ type FabricRequest struct {
 	Unit        string  `json:"unit"`
 	Stock       int     `json:"stock"`
 	MinOrder    int     `json:"min_order"`
+	ReorderPoint    int `json:"reorder_point" binding:"min=0"`
+	ReorderQuantity int `json:"reorder_quantity" binding:"min=0"`
 	Description string  `json:"description"`
 	ImageURL    string  `json:"image_url"`
 	ThumbnailURL string `json:"thumbnail_url"`
@@ -78,8 +89,10 @@ type FabricUpdateRequest struct {
 	Width       float64 `json:"width"`
 	Price       float64 `json:"price"`
 	Unit        string  `json:"unit"`
-	Stock       int     `json:"stock"`
+	Stock       *int    `json:"stock"` // 目标在库数量，与当前不同时记录一条盘点调整流水
 	MinOrder    int     `json:"min_order"`
+	ReorderPoint    *int `json:"reorder_point" binding:"omitempty,min=0"`
+	ReorderQuantity *int `json:"reorder_quantity" binding:"omitempty,min=0"`
 	Description string  `json:"description"`
 	ImageURL    string  `json:"image_url"`
 	ThumbnailURL string `json:"thumbnail_url"`
@@ -117,7 +130,11 @@ type FabricResponse struct {
 	Price       float64   `json:"price"`
 	Unit        string    `json:"unit"`
 	Stock       int       `json:"stock"`
+	Reserved    int       `json:"reserved"`
+	Available   int       `json:"available"`
 	MinOrder    int       `json:"min_order"`
+	ReorderPoint    int   `json:"reorder_point"`
+	ReorderQuantity int   `json:"reorder_quantity"`
 	Description string    `json:"description"`
 	ImageURL    string    `json:"image_url"`
 	ThumbnailURL string   `json:"thumbnail_url"`
@@ -136,4 +153,24 @@ type FabricListResponse struct {
 	Page     int              `json:"page"`
 	PageSize int              `json:"page_size"`
 	Fabrics  []FabricResponse `json:"fabrics"`
-}
\ No newline at end of file
+}
+
+// FabricReplenishment 需要补货的布料
+type FabricReplenishment struct {
+	FabricID          uint       `json:"fabric_id"`
+	Name              string     `json:"name"`
+	Color             string     `json:"color"`
+	Unit              string     `json:"unit"`
+	Stock             int        `json:"stock"`
+	Reserved          int        `json:"reserved"`
+	OpenOrderReserved int        `json:"open_order_reserved"` // 未完成、未取消订单的预留数量
+	Available         int        `json:"available"`
+	ReorderPoint      int        `json:"reorder_point"`
+	ReorderQuantity   int        `json:"reorder_quantity"`
+	Shortfall         int        `json:"shortfall"`          // 距离回到再订货点以上还差的数量
+	SuggestedQuantity int        `json:"suggested_quantity"` // 建议补货数量，不少于缺口
+	LowStockAlertedAt *time.Time `json:"low_stock_alerted_at"`
+	DesignerID        *string    `json:"designer_id"`
+	SupplierID        *string    `json:"supplier_id"`
+	FactoryID         *string    `json:"factory_id"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// FabricLedgerType 布料库存流水类型
+type FabricLedgerType string
+
+const (
+	FabricLedgerReceipt     FabricLedgerType = "receipt"     // 入库，增加在库数量
+	FabricLedgerReservation FabricLedgerType = "reservation" // 为订单预留，减少可用数量
+	FabricLedgerRelease     FabricLedgerType = "release"     // 释放订单的预留
+	FabricLedgerConsumption FabricLedgerType = "consumption" // 生产领用，优先扣减订单的预留
+	FabricLedgerAdjustment  FabricLedgerType = "adjustment"  // 盘点调整，数量可为负
+)
+
+// FabricLedgerEntry 布料库存流水，只追加不修改
+// 布料的 Stock 和 Reserved 分别等于全部流水 StockDelta 和 ReservedDelta 之和。
+type FabricLedgerEntry struct {
+	ID            uint             `json:"id" gorm:"primaryKey"`
+	FabricID      uint             `json:"fabric_id" gorm:"not null;index:idx_fabric_ledger_fabric_order"`
+	OrderID       *uint            `json:"order_id" gorm:"index:idx_fabric_ledger_fabric_order;index"`
+	Type          FabricLedgerType `json:"type" gorm:"type:varchar(20);not null"`
+	Quantity      int              `json:"quantity" gorm:"not null"`
+	StockDelta    int              `json:"stock_delta" gorm:"not null;default:0"`    // 对在库数量的影响
+	ReservedDelta int              `json:"reserved_delta" gorm:"not null;default:0"` // 对预留数量的影响
+	StockAfter    int              `json:"stock_after" gorm:"not null"`
+	ReservedAfter int              `json:"reserved_after" gorm:"not null"`
+	Note          string           `json:"note" gorm:"type:varchar(500)"`
+	OperatorID    string           `json:"operator_id" gorm:"type:varchar(191)"`
+	CreatedAt     time.Time        `json:"created_at"`
+}
+
+func (FabricLedgerEntry) TableName() string {
+	return "fabric_ledger_entries"
+}
+
+// FabricLedgerRequest 记录库存流水的请求
+type FabricLedgerRequest struct {
+	Type     FabricLedgerType `json:"type" binding:"required,oneof=receipt reservation release consumption adjustment"`
+	Quantity int              `json:"quantity" binding:"required"` // 调整可为负数，其他类型必须大于 0
+	OrderID  *uint            `json:"order_id"`                    // 预留和释放必填
+	Note     string           `json:"note" binding:"max=500"`
+}
+
+// FabricOrderReservation 订单对布料的预留数量
+type FabricOrderReservation struct {
+	OrderID  uint `json:"order_id"`
+	Reserved int  `json:"reserved"`
+}
+
+// FabricLedgerResponse 布料库存流水及与流水核对后的库存
+type FabricLedgerResponse struct {
+	FabricID       uint                     `json:"fabric_id"`
+	Stock          int                      `json:"stock"`
+	Reserved       int                      `json:"reserved"`
+	Available      int                      `json:"available"`
+	LedgerStock    int                      `json:"ledger_stock"`    // 按流水汇总的在库数量
+	LedgerReserved int                      `json:"ledger_reserved"` // 按流水汇总的预留数量
+	Consistent     bool                     `json:"consistent"`      // 布料库存与流水汇总是否一致
+	Reservations   []FabricOrderReservation `json:"reservations"`
+	Entries        []FabricLedgerEntry      `json:"entries"`
+}
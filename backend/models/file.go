@@ -13,8 +13,38 @@ type File struct {
 	FactoryID string     `json:"factory_id,omitempty" gorm:"index"` // 新增：关联工厂
 	Category  string     `json:"category,omitempty"`                 // 新增：图片分类
 	Size      int64      `json:"size,omitempty"`                     // 新增：文件大小
+	UploaderID string    `json:"uploader_id,omitempty" gorm:"type:varchar(191);index"` // 上传人ID
+	BlobHash  string     `json:"blob_hash,omitempty" gorm:"type:char(64);index"`         // 引用的内容 blob，为空表示去重之前上传的文件
+	ShareTokenID *uint   `json:"-" gorm:"index"`                                        // 通过订单分享令牌上传时的令牌ID
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
+
+	Derivatives []FileDerivative `json:"derivatives,omitempty" gorm:"foreignKey:FileID"`
+}
+
+// 图片衍生版本
+const (
+	DerivativeThumbnail = "thumbnail" // 缩略图，用于列表和相册
+	DerivativeMedium    = "medium"    // 中图，用于移动端预览
+	DerivativeWebP      = "webp"      // WebP 版本
+)
+
+// FileDerivative 由原图生成的衍生图片，Path 为存储对象键
+type FileDerivative struct {
+	ID        uint      `json:"-" gorm:"primaryKey"`
+	FileID    string    `json:"file_id" gorm:"type:varchar(191);not null;uniqueIndex:idx_file_derivative"`
+	Variant   string    `json:"variant" gorm:"type:varchar(20);not null;uniqueIndex:idx_file_derivative"`
+	Path      string    `json:"path" gorm:"type:varchar(255);not null"`
+	MimeType  string    `json:"mime_type" gorm:"type:varchar(50)"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (FileDerivative) TableName() string {
+	return "file_derivatives"
 }
 
 // AddFileToOrderRequest 添加文件到订单的请求模型
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// FileBlob 按内容 SHA-256 存储的文件内容，相同内容只保存一份
+// 每个引用它的 File 计一次引用，引用数归零时删除 blob 及存储对象。
+type FileBlob struct {
+	Hash      string    `json:"hash" gorm:"type:char(64);primaryKey"`
+	Key       string    `json:"key" gorm:"type:varchar(255);not null"` // 存储对象键
+	Size      int64     `json:"size"`
+	MimeType  string    `json:"mime_type" gorm:"type:varchar(100)"`
+	RefCount  int       `json:"ref_count" gorm:"not null;default:0"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (FileBlob) TableName() string {
+	return "file_blobs"
+}
+
+// BlobRefMismatch 记录的引用数与实际引用的文件数不一致
+type BlobRefMismatch struct {
+	Hash     string `json:"hash"`
+	RefCount int    `json:"ref_count"`
+	Actual   int    `json:"actual"`
+}
+
+// DanglingOrderFile 订单文件关联指向不存在的文件
+type DanglingOrderFile struct {
+	OrderID uint          `json:"order_id"`
+	Role    OrderFileRole `json:"role"`
+	FileID  string        `json:"file_id"`
+}
+
+// FileReconcileReport 存储与数据库的一致性检查结果
+type FileReconcileReport struct {
+	OrphanObjects      []string            `json:"orphan_objects"`       // 没有任何记录引用的存储对象
+	RefMismatches      []BlobRefMismatch   `json:"ref_mismatches"`       // 引用数不一致的 blob
+	MissingBlobs       []string            `json:"missing_blobs"`        // 记录存在但存储对象缺失的 blob
+	DanglingOrderFiles []DanglingOrderFile `json:"dangling_order_files"` // 订单中失效的文件ID
+	Fixed              bool                `json:"fixed"`
+}
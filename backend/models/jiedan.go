@@ -17,13 +17,14 @@ const (
 // Jiedan 接单模型
 type Jiedan struct {
 	ID           uint           `json:"id" gorm:"primaryKey"`
-	OrderID      uint           `json:"order_id" gorm:"not null;index"`
-	FactoryID    string         `json:"factory_id" gorm:"type:varchar(191);not null;index"`
+	OrderID      uint           `json:"order_id" gorm:"not null;index;uniqueIndex:uk_order_factory"` // 每家工厂对同一订单只能接单一次
+	FactoryID    string         `json:"factory_id" gorm:"type:varchar(191);not null;index;uniqueIndex:uk_order_factory"`
 	Status       JiedanStatus   `json:"status" gorm:"type:varchar(50);not null;default:'pending';index"`
 	Price        *float64       `json:"price" gorm:"type:decimal(10,2);comment:接单价格"`
 	JiedanTime   *time.Time     `json:"jiedan_time" gorm:"comment:接单时间"`
 	AgreeTime    *time.Time     `json:"agree_time" gorm:"comment:同意时间"`
 	AgreeUserID  *string        `json:"agree_user_id" gorm:"type:varchar(191);comment:同意的用户ID"`
+	RejectReason string         `json:"reject_reason" gorm:"type:varchar(500);comment:拒绝原因"`
 	CreatedAt    *time.Time     `json:"created_at" gorm:"autoCreateTime:false"`
 	UpdatedAt    *time.Time     `json:"updated_at" gorm:"autoUpdateTime:false"`
 	DeletedAt    gorm.DeletedAt `json:"deleted_at" gorm:"index"`
@@ -45,11 +46,9 @@ type CreateJiedanRequest struct {
 	Price     *float64 `json:"price"`
 }
 
-// UpdateJiedanRequest 更新接单请求
+// UpdateJiedanRequest 更新接单请求，只能修改待处理接单的价格
 type UpdateJiedanRequest struct {
-	Status      JiedanStatus `json:"status"`
-	Price       *float64     `json:"price"`
-	AgreeUserID string       `json:"agree_user_id"`
+	Price *float64 `json:"price" binding:"required,gt=0"`
 }
 
 // JiedanResponse 接单响应
@@ -62,6 +61,7 @@ type JiedanResponse struct {
 	JiedanTime   *time.Time   `json:"jiedan_time"`
 	AgreeTime    *time.Time   `json:"agree_time"`
 	AgreeUserID  *string      `json:"agree_user_id"`
+	RejectReason string       `json:"reject_reason"`
 	CreatedAt    *time.Time   `json:"created_at"`
 	UpdatedAt    *time.Time   `json:"updated_at"`
 	
@@ -78,9 +78,16 @@ type JiedanListResponse struct {
 	Jiedans  []JiedanResponse `json:"jiedans"`
 }
 
-// AcceptJiedanRequest 同意接单请求
+// AcceptJiedanRequest 同意接单请求（AgreeUserID 由当前登录用户填充）
 type AcceptJiedanRequest struct {
-	AgreeUserID string `json:"agree_user_id" binding:"required"`
+	AgreeUserID string `json:"agree_user_id"`
+}
+
+// AcceptJiedanResult 同意接单（授标）结果
+type AcceptJiedanResult struct {
+	Jiedan          *Jiedan `json:"jiedan"`
+	Order           *Order  `json:"order"`
+	RejectedJiedans []uint  `json:"rejected_jiedans"`
 }
 
 // RejectJiedanRequest 拒绝接单请求
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+)
+
+// QuoteStatus 报价轮次状态
+type QuoteStatus string
+
+const (
+	QuoteStatusPending    QuoteStatus = "pending"    // 待对方回应
+	QuoteStatusAccepted   QuoteStatus = "accepted"   // 已接受
+	QuoteStatusSuperseded QuoteStatus = "superseded" // 已被新一轮报价取代
+)
+
+// JiedanQuote 接单议价轮次：工厂报价、设计师还价、工厂再报价……每轮单独保存
+type JiedanQuote struct {
+	ID           uint        `json:"id" gorm:"primaryKey"`
+	JiedanID     uint        `json:"jiedan_id" gorm:"not null;index"`
+	Round        int         `json:"round" gorm:"not null;comment:轮次，从1开始"`
+	ProposerID   string      `json:"proposer_id" gorm:"type:varchar(191);not null;comment:报价人ID"`
+	ProposerRole UserRole    `json:"proposer_role" gorm:"type:varchar(50);not null;comment:报价人角色"`
+	UnitPrice    float64     `json:"unit_price" gorm:"type:decimal(10,2);not null;comment:单价"`
+	LeadTimeDays int         `json:"lead_time_days" gorm:"default:0;comment:交期(天)"`
+	MOQ          int         `json:"moq" gorm:"column:moq;default:0;comment:最小起订量"`
+	ValidUntil   *time.Time  `json:"valid_until" gorm:"comment:报价有效期"`
+	Message      string      `json:"message" gorm:"type:text;comment:留言"`
+	Status       QuoteStatus `json:"status" gorm:"type:varchar(50);not null;default:'pending';index"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+
+	// 按订单明细行的报价，未列出的行使用 UnitPrice
+	LinePrices []JiedanQuoteLine `json:"line_prices,omitempty" gorm:"foreignKey:QuoteID"`
+}
+
+// TableName 指定表名
+func (JiedanQuote) TableName() string {
+	return "jiedan_quotes"
+}
+
+// JiedanQuoteLine 议价轮次中某个订单明细行的单价
+type JiedanQuoteLine struct {
+	ID          uint    `json:"id" gorm:"primaryKey"`
+	QuoteID     uint    `json:"quote_id" gorm:"not null;index"`
+	OrderLineID uint    `json:"order_line_id" gorm:"not null"`
+	UnitPrice   float64 `json:"unit_price" gorm:"type:decimal(10,2);not null;comment:单价"`
+}
+
+// TableName 指定表名
+func (JiedanQuoteLine) TableName() string {
+	return "jiedan_quote_lines"
+}
+
+// IsExpired 报价是否已过有效期
+func (q *JiedanQuote) IsExpired(now time.Time) bool {
+	return q.ValidUntil != nil && now.After(*q.ValidUntil)
+}
+
+// ProposeQuoteRequest 提交报价/还价请求
+type ProposeQuoteRequest struct {
+	UnitPrice    float64    `json:"unit_price" binding:"required,gt=0"`
+	LeadTimeDays int        `json:"lead_time_days" binding:"min=0"`
+	MOQ          int        `json:"moq" binding:"min=0"`
+	ValidUntil   *time.Time `json:"valid_until"`
+	Message      string     `json:"message"`
+	// 按订单明细行报价，未列出的行使用 UnitPrice
+	LinePrices []QuoteLinePriceRequest `json:"line_prices" binding:"omitempty,dive"`
+}
+
+// QuoteLinePriceRequest 订单明细行的报价
+type QuoteLinePriceRequest struct {
+	OrderLineID uint    `json:"order_line_id" binding:"required"`
+	UnitPrice   float64 `json:"unit_price" binding:"required,gt=0"`
+}
@@ -0,0 +1,98 @@
+package models
+
+import "time"
+
+// MessageThread 订单会话，设计师与每个接单工厂各一个会话
+type MessageThread struct {
+	ID                 uint       `json:"id" gorm:"primaryKey"`
+	OrderID            uint       `json:"order_id" gorm:"not null;index"`
+	JiedanID           uint       `json:"jiedan_id" gorm:"not null;uniqueIndex"`
+	DesignerID         string     `json:"designer_id" gorm:"type:varchar(191);not null;index"`
+	FactoryID          string     `json:"factory_id" gorm:"type:varchar(191);not null;index"`
+	DesignerLastReadID uint       `json:"designer_last_read_id" gorm:"default:0"` // 设计师已读到的最后一条消息
+	FactoryLastReadID  uint       `json:"factory_last_read_id" gorm:"default:0"`  // 工厂已读到的最后一条消息
+	LastMessageAt      *time.Time `json:"last_message_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+func (MessageThread) TableName() string {
+	return "message_threads"
+}
+
+// IsParty 是否为会话双方之一
+func (t *MessageThread) IsParty(userID string) bool {
+	return userID != "" && (t.DesignerID == userID || t.FactoryID == userID)
+}
+
+// Counterpart 会话中的另一方
+func (t *MessageThread) Counterpart(userID string) string {
+	if t.DesignerID == userID {
+		return t.FactoryID
+	}
+	return t.DesignerID
+}
+
+// LastReadIDOf 指定用户已读到的最后一条消息ID
+func (t *MessageThread) LastReadIDOf(userID string) uint {
+	if t.DesignerID == userID {
+		return t.DesignerLastReadID
+	}
+	return t.FactoryLastReadID
+}
+
+// Message 会话中的一条消息
+type Message struct {
+	ID          uint                `json:"id" gorm:"primaryKey"`
+	ThreadID    uint                `json:"thread_id" gorm:"not null;index"`
+	SenderID    string              `json:"sender_id" gorm:"type:varchar(191);not null"`
+	SenderRole  UserRole            `json:"sender_role" gorm:"type:varchar(50)"`
+	Content     string              `json:"content" gorm:"type:text"`
+	CreatedAt   time.Time           `json:"created_at"`
+	Attachments []MessageAttachment `json:"attachments" gorm:"foreignKey:MessageID"`
+}
+
+func (Message) TableName() string {
+	return "messages"
+}
+
+// MessageAttachment 消息附件，文件本身通过 FileService 存储
+type MessageAttachment struct {
+	ID        uint   `json:"-" gorm:"primaryKey"`
+	MessageID uint   `json:"-" gorm:"not null;index"`
+	ThreadID  uint   `json:"-" gorm:"not null;index"`
+	FileID    string `json:"file_id" gorm:"type:varchar(191);not null;index"`
+	File      File   `json:"file" gorm:"foreignKey:FileID"`
+}
+
+func (MessageAttachment) TableName() string {
+	return "message_attachments"
+}
+
+// OpenThreadRequest 打开会话请求；设计师需指定工厂，工厂默认为自己
+type OpenThreadRequest struct {
+	FactoryID string `json:"factory_id"`
+}
+
+// PostMessageRequest 发送消息请求，附件为已通过文件接口上传的文件ID
+type PostMessageRequest struct {
+	Content       string   `json:"content" form:"content"`
+	AttachmentIDs []string `json:"attachment_ids" form:"attachment_ids"`
+}
+
+// MarkThreadReadRequest 标记已读，MessageID 为空时标记到最新一条
+type MarkThreadReadRequest struct {
+	MessageID uint `json:"message_id"`
+}
+
+// MessageView 消息及其已读回执
+type MessageView struct {
+	Message
+	ReadByCounterpart bool `json:"read_by_counterpart"`
+}
+
+// ThreadSummary 会话列表项
+type ThreadSummary struct {
+	MessageThread
+	UnreadCount int64 `json:"unread_count"`
+}
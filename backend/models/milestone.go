@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// ProgressMilestone 生产计划中的一个阶段：工厂承接订单后按进度类型发布的计划起止日期
+// 实际开始和完成时间由同类型的进度记录同步而来。
+type ProgressMilestone struct {
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	OrderID         uint           `json:"order_id" gorm:"not null;uniqueIndex:idx_milestone_order_type"`
+	FactoryID       string         `json:"factory_id" gorm:"type:varchar(191);not null;index"`
+	Type            ProgressType   `json:"type" gorm:"type:varchar(50);not null;uniqueIndex:idx_milestone_order_type"`
+	Sequence        int            `json:"sequence" gorm:"not null;default:0"`
+	Status          ProgressStatus `json:"status" gorm:"type:varchar(50);not null;default:'not_started';index"`
+	PlannedStart    time.Time      `json:"planned_start" gorm:"not null"`
+	PlannedDue      time.Time      `json:"planned_due" gorm:"not null;index"`
+	ActualStart     *time.Time     `json:"actual_start"`
+	ActualCompleted *time.Time     `json:"actual_completed"`
+	DelayedAt       *time.Time     `json:"delayed_at"` // 被判定为延期的时间
+	Note            string         `json:"note" gorm:"type:varchar(500)"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+}
+
+func (ProgressMilestone) TableName() string {
+	return "progress_milestones"
+}
+
+// MilestonePlanItem 计划中的一个阶段
+type MilestonePlanItem struct {
+	Type         ProgressType `json:"type" binding:"required"`
+	PlannedStart time.Time    `json:"planned_start" binding:"required"`
+	PlannedDue   time.Time    `json:"planned_due" binding:"required"`
+	Note         string       `json:"note"`
+}
+
+// PublishMilestonePlanRequest 发布或替换生产计划
+type PublishMilestonePlanRequest struct {
+	Milestones []MilestonePlanItem `json:"milestones" binding:"required,min=1,dive"`
+}
+
+// MilestoneVariance 单个阶段的计划与实际偏差，偏差单位为天，正数表示晚于计划
+type MilestoneVariance struct {
+	ProgressMilestone
+	StartVarianceDays  *float64 `json:"start_variance_days"`
+	FinishVarianceDays *float64 `json:"finish_variance_days"`
+	Overdue            bool     `json:"overdue"`
+}
+
+// ScheduleVariance 订单的进度偏差视图
+type ScheduleVariance struct {
+	OrderID        uint                `json:"order_id"`
+	Milestones     []MilestoneVariance `json:"milestones"`
+	Progress       []OrderProgress     `json:"progress"`
+	PlannedFinish  *time.Time          `json:"planned_finish"`
+	ForecastFinish *time.Time          `json:"forecast_finish"` // 按当前最大延误顺延后的预计完成时间
+	DelayedCount   int                 `json:"delayed_count"`
+	CompletedCount int                 `json:"completed_count"`
+	MaxDelayDays   float64             `json:"max_delay_days"`
+}
@@ -0,0 +1,103 @@
+package models
+
+import "time"
+
+// NotificationCategory 通知类别，用户可按类别静音
+type NotificationCategory string
+
+const (
+	NotificationJiedanNew            NotificationCategory = "jiedan_new"             // 工厂对我的订单接单
+	NotificationJiedanAccepted       NotificationCategory = "jiedan_accepted"        // 我的接单被采纳
+	NotificationJiedanRejected       NotificationCategory = "jiedan_rejected"        // 我的接单被拒绝或落选
+	NotificationProgressNew          NotificationCategory = "progress_new"           // 订单有新的生产进度
+	NotificationMilestoneDelayed     NotificationCategory = "milestone_delayed"      // 生产计划阶段逾期
+	NotificationFabricLowStock       NotificationCategory = "fabric_low_stock"       // 布料可用数量低于再订货点
+	NotificationTechPackReleased     NotificationCategory = "tech_pack_released"     // 承接订单发布了新版工艺单
+	NotificationTechPackAcknowledged NotificationCategory = "tech_pack_acknowledged" // 工厂确认了我的工艺单
+	NotificationSampleSubmitted      NotificationCategory = "sample_submitted"       // 工厂提交了样衣等待审批
+	NotificationSampleReviewed       NotificationCategory = "sample_reviewed"        // 我提交的样衣被批准或驳回
+	NotificationQCInspection         NotificationCategory = "qc_inspection"          // 订单有新的质量检验结果
+	NotificationShipmentUpdate       NotificationCategory = "shipment_update"        // 订单发货、签收、物流异常或确认收货
+)
+
+// AllNotificationCategories 全部通知类别
+var AllNotificationCategories = []NotificationCategory{
+	NotificationJiedanNew,
+	NotificationJiedanAccepted,
+	NotificationJiedanRejected,
+	NotificationProgressNew,
+	NotificationMilestoneDelayed,
+	NotificationFabricLowStock,
+	NotificationTechPackReleased,
+	NotificationTechPackAcknowledged,
+	NotificationSampleSubmitted,
+	NotificationSampleReviewed,
+	NotificationQCInspection,
+	NotificationShipmentUpdate,
+}
+
+// IsValid 是否为已知的通知类别
+func (c NotificationCategory) IsValid() bool {
+	for _, category := range AllNotificationCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// Notification 站内通知，每个接收人一条
+type Notification struct {
+	ID         uint                 `json:"id" gorm:"primaryKey"`
+	UserID     string               `json:"user_id" gorm:"type:varchar(191);not null;index:idx_notifications_user_read"`
+	Category   NotificationCategory `json:"category" gorm:"type:varchar(50);not null"`
+	Title      string               `json:"title" gorm:"type:varchar(255);not null"`
+	Content    string               `json:"content" gorm:"type:text"`
+	EntityType string               `json:"entity_type" gorm:"type:varchar(50)"`
+	EntityID   string               `json:"entity_id" gorm:"type:varchar(191)"`
+	OrderID    *uint                `json:"order_id"`
+	ReadAt     *time.Time           `json:"read_at" gorm:"index:idx_notifications_user_read"`
+	CreatedAt  time.Time            `json:"created_at"`
+}
+
+func (Notification) TableName() string {
+	return "notifications"
+}
+
+// NotificationPreference 用户对某类通知的订阅设置
+type NotificationPreference struct {
+	ID        uint                 `json:"-" gorm:"primaryKey"`
+	UserID    string               `json:"-" gorm:"type:varchar(191);not null;uniqueIndex:idx_notification_pref"`
+	Category  NotificationCategory `json:"category" gorm:"type:varchar(50);not null;uniqueIndex:idx_notification_pref"`
+	Muted     bool                 `json:"muted" gorm:"default:false"`
+	UpdatedAt time.Time            `json:"updated_at"`
+}
+
+func (NotificationPreference) TableName() string {
+	return "notification_preferences"
+}
+
+// NotificationListQuery 通知列表查询条件
+type NotificationListQuery struct {
+	UnreadOnly bool                 `form:"unread_only"`
+	Category   NotificationCategory `form:"category"`
+	Page       int                  `form:"page"`
+	PageSize   int                  `form:"page_size"`
+}
+
+// MarkNotificationsRequest 批量标记已读/未读
+type MarkNotificationsRequest struct {
+	IDs  []uint `json:"ids" binding:"required,min=1"`
+	Read bool   `json:"read"`
+}
+
+// UpdateNotificationPreferencesRequest 更新通知订阅，key 为类别，value 为是否静音
+type UpdateNotificationPreferencesRequest struct {
+	Muted map[NotificationCategory]bool `json:"muted" binding:"required"`
+}
+
+// UnreadNotificationCount 未读通知数量
+type UnreadNotificationCount struct {
+	Total      int64                          `json:"total"`
+	ByCategory map[NotificationCategory]int64 `json:"by_category"`
+}
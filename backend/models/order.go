@@ -3,16 +3,20 @@ package models
 import (
 	"gorm.io/gorm"
 	"time"
-	"gorm.io/datatypes"
 )
 
 type OrderStatus string
 
 const (
-	OrderStatusDraft     OrderStatus = "draft"
-	OrderStatusPublished OrderStatus = "published"
-	OrderStatusCompleted OrderStatus = "completed"
-	OrderStatusCancelled OrderStatus = "cancelled"
+	OrderStatusDraft         OrderStatus = "draft"          // 草稿
+	OrderStatusPublished     OrderStatus = "published"      // 已发布，接受工厂接单
+	OrderStatusBiddingClosed OrderStatus = "bidding_closed" // 停止接单
+	OrderStatusInProduction  OrderStatus = "in_production"  // 生产中
+	OrderStatusShipped       OrderStatus = "shipped"        // 已发货
+	OrderStatusDelivered     OrderStatus = "delivered"      // 已送达
+	OrderStatusCompleted     OrderStatus = "completed"      // 已完成
+	OrderStatusCancelled     OrderStatus = "cancelled"      // 已取消
+	OrderStatusDisputed      OrderStatus = "disputed"       // 争议中
 )
 
 type Order struct {
@@ -40,20 +44,40 @@ type Order struct {
 	OrderDate         *time.Time  `json:"order_date"`
 	SpecialRequirements string    `json:"special_requirements"`
 
-	Attachments       *datatypes.JSON `json:"attachments" gorm:"type:jsonb;default:null"`
-	Models            *datatypes.JSON `json:"models" gorm:"type:jsonb;default:null"`
-	Images            *datatypes.JSON `json:"images" gorm:"type:jsonb;default:null"`
-	Videos            *datatypes.JSON `json:"videos" gorm:"type:jsonb;default:null"`
-	
-	// 添加文件关联
-	Files             []File         `json:"files" gorm:"foreignKey:OrderID"`
+	// 各用途的文件ID列表，由 order_files 关联表填充，保持原有响应格式
+	Attachments       []string    `json:"attachments" gorm:"-"`
+	Models            []string    `json:"models" gorm:"-"`
+	Images            []string    `json:"images" gorm:"-"`
+	Videos            []string    `json:"videos" gorm:"-"`
+
+	// 文件关联
+	OrderFiles        []OrderFile `json:"order_files" gorm:"foreignKey:OrderID"`
+	Files             []File      `json:"files" gorm:"-"`
+
+	// 尺码 × 颜色明细，有明细时数量和总价由明细汇总
+	Lines             []OrderLine `json:"lines,omitempty" gorm:"foreignKey:OrderID"`
+}
+
+// FileIDs 返回指定用途的文件ID列表
+func (o *Order) FileIDs(role OrderFileRole) []string {
+	switch role {
+	case OrderFileRoleImage:
+		return o.Images
+	case OrderFileRoleAttachment:
+		return o.Attachments
+	case OrderFileRoleModel:
+		return o.Models
+	case OrderFileRoleVideo:
+		return o.Videos
+	}
+	return nil
 }
 
 type OrderRequest struct {
 	Title             string    `json:"title" binding:"required"`
 	Description       string    `json:"description"`
 	Fabric            string    `json:"fabric"`
-	Quantity          int       `json:"quantity" binding:"required,min=1"`
+	Quantity          int       `json:"quantity" binding:"required_without=Lines,gte=0"` // 有明细时由明细汇总
 	DesignerID        string    `json:"designer_id" binding:"required"`
 	CustomerID        string    `json:"customer_id" binding:"required"`
 	UnitPrice         float64   `json:"unit_price"`
@@ -70,6 +94,7 @@ type OrderRequest struct {
 	Models            []string  `json:"models"`
 	Images            []string  `json:"images"`
 	Videos            []string  `json:"videos"`
+	Lines             []OrderLineRequest `json:"lines" binding:"omitempty,dive"`
 }
 
 type PublicOrder struct {
@@ -131,6 +156,7 @@ type OrderUpdateRequest struct {
 	Models            []string  `json:"models"`
 	Images            []string  `json:"images"`
 	Videos            []string  `json:"videos"`
+	Lines             []OrderLineRequest `json:"lines" binding:"omitempty,dive"` // 给出时整体替换订单明细
 } 
 
 // OrderDetailResponse 订单详情响应（包含布料详细信息）
@@ -151,6 +177,8 @@ type OrderDetailResponse struct {
 	OrderType          string                  `json:"order_type"`
 	Fabrics            []Fabric                `json:"fabrics"`           // 布料详细信息数组
 	FabricsIDs         string                  `json:"fabrics_ids"`       // 原始布料ID字符串
+	BOM                *OrderBOM               `json:"bom"`               // 物料清单及成本汇总
+	Lines              []OrderLineView         `json:"lines"`             // 尺码 × 颜色明细
 	DeliveryDate       *time.Time              `json:"delivery_date"`
 	OrderDate          *time.Time              `json:"order_date"`
 	SpecialRequirements string                 `json:"special_requirements"`
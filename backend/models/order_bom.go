@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// OrderBOMItemType 物料清单行类型
+type OrderBOMItemType string
+
+const (
+	OrderBOMFabric OrderBOMItemType = "fabric" // 布料，按米计算用量并从库存预留
+	OrderBOMTrim   OrderBOMItemType = "trim"   // 辅料，如纽扣、拉链、标签
+)
+
+// OrderBOMItem 订单物料清单的一行：每件成衣的用量和损耗率
+// 布料行关联库存中的布料，单价取 Fabric.Price；辅料行不占用库存，单价记录在行上。
+type OrderBOMItem struct {
+	ID              uint             `json:"id" gorm:"primaryKey"`
+	OrderID         uint             `json:"order_id" gorm:"not null;index"`
+	Type            OrderBOMItemType `json:"type" gorm:"type:varchar(20);not null"`
+	FabricID        *uint            `json:"fabric_id" gorm:"index"`
+	Name            string           `json:"name" gorm:"type:varchar(200)"`                        // 辅料名称，布料行为空时使用布料名称
+	Unit            string           `json:"unit" gorm:"type:varchar(50)"`                         // 辅料单位，布料行使用布料单位
+	UsagePerGarment float64          `json:"usage_per_garment" gorm:"type:decimal(10,3);not null"` // 每件用量
+	WastagePercent  float64          `json:"wastage_percent" gorm:"type:decimal(5,2);not null;default:0"`
+	UnitCost        float64          `json:"unit_cost" gorm:"type:decimal(10,2);not null;default:0"` // 辅料单价
+	Note            string           `json:"note" gorm:"type:varchar(500)"`
+	SortOrder       int              `json:"sort_order" gorm:"not null;default:0"`
+	CreatedAt       time.Time        `json:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at"`
+
+	Fabric *Fabric `json:"fabric,omitempty" gorm:"foreignKey:FabricID"`
+}
+
+func (OrderBOMItem) TableName() string {
+	return "order_bom_items"
+}
+
+// OrderBOMItemRequest 物料清单行
+type OrderBOMItemRequest struct {
+	Type            OrderBOMItemType `json:"type" binding:"required,oneof=fabric trim"`
+	FabricID        *uint            `json:"fabric_id"` // 布料行必填
+	Name            string           `json:"name" binding:"max=200"`
+	Unit            string           `json:"unit" binding:"max=50"`
+	UsagePerGarment float64          `json:"usage_per_garment" binding:"required,gt=0"`
+	WastagePercent  float64          `json:"wastage_percent" binding:"min=0,max=100"`
+	UnitCost        float64          `json:"unit_cost" binding:"min=0"`
+	Note            string           `json:"note" binding:"max=500"`
+}
+
+// SaveOrderBOMRequest 整体替换订单的物料清单
+type SaveOrderBOMRequest struct {
+	Items []OrderBOMItemRequest `json:"items" binding:"dive"`
+	// 默认按清单调整订单的布料预留，为 true 时只保存清单
+	SkipReservation bool `json:"skip_reservation"`
+}
+
+// OrderBOMLine 物料清单行及按订单数量计算的需求和成本
+type OrderBOMLine struct {
+	OrderBOMItem
+	RequiredQuantity float64 `json:"required_quantity"` // 订单数量 × 每件用量 × (1 + 损耗率)
+	ReserveQuantity  int     `json:"reserve_quantity"`  // 布料按整数单位向上取整后的预留目标
+	Reserved         int     `json:"reserved"`          // 订单当前对该布料的预留
+	UnitPrice        float64 `json:"unit_price"`        // 布料取 Fabric.Price，辅料取 UnitCost
+	Cost             float64 `json:"cost"`
+}
+
+// OrderBOM 订单物料清单及成本汇总
+type OrderBOM struct {
+	OrderID             uint           `json:"order_id"`
+	Quantity            int            `json:"quantity"`
+	Items               []OrderBOMLine `json:"items"`
+	FabricCost          float64        `json:"fabric_cost"`
+	TrimCost            float64        `json:"trim_cost"`
+	MaterialCost        float64        `json:"material_cost"`
+	MaterialCostPerUnit float64        `json:"material_cost_per_unit"`
+}
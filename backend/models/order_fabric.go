@@ -23,8 +23,12 @@ type OrderFabric struct {
 // AddFabricToOrderRequest 添加布料到订单的请求
 type AddFabricToOrderRequest struct {
 	OrderID uint `json:"order_id" binding:"required"`
+	// 关联已有布料时填写 FabricID，否则按下面的布料信息创建新布料
+	FabricID uint `json:"fabric_id"`
+	// 为订单预留的数量，为 0 时不预留
+	Quantity int `json:"quantity" binding:"omitempty,min=1"`
 	// 布料信息
-	Name         string  `json:"name" binding:"required"`
+	Name         string  `json:"name" binding:"required_without=FabricID"`
 	Category     string  `json:"category"`
 	Material     string  `json:"material"`
 	Color        string  `json:"color"`
@@ -47,6 +51,7 @@ type AddFabricToOrderResponse struct {
 	Fabric            *Fabric `json:"fabric"`
 	OrderID           uint    `json:"order_id"`
 	AssociationCreated bool   `json:"association_created"`
+	Reservation        *FabricLedgerEntry `json:"reservation,omitempty"`
 }
 
 // FabricIDList 布料ID列表工具函数
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// OrderFileRole 文件在订单中的用途
+type OrderFileRole string
+
+const (
+	OrderFileRoleImage      OrderFileRole = "image"      // 款式图片
+	OrderFileRoleAttachment OrderFileRole = "attachment" // 附件文档
+	OrderFileRoleModel      OrderFileRole = "model"      // 3D模型
+	OrderFileRoleVideo      OrderFileRole = "video"      // 视频
+)
+
+// OrderFileRoles 全部文件用途，顺序与订单响应中的字段一致
+var OrderFileRoles = []OrderFileRole{
+	OrderFileRoleAttachment,
+	OrderFileRoleModel,
+	OrderFileRoleImage,
+	OrderFileRoleVideo,
+}
+
+// IsValid 是否为支持的文件用途
+func (r OrderFileRole) IsValid() bool {
+	for _, role := range OrderFileRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderFile 订单与文件的关联，同一文件在同一订单中每种用途只出现一次
+type OrderFile struct {
+	ID        uint          `json:"id" gorm:"primaryKey"`
+	OrderID   uint          `json:"order_id" gorm:"not null;uniqueIndex:idx_order_file_role,priority:1"`
+	FileID    string        `json:"file_id" gorm:"type:varchar(191);not null;uniqueIndex:idx_order_file_role,priority:2;index"`
+	Role      OrderFileRole `json:"role" gorm:"type:varchar(20);not null;uniqueIndex:idx_order_file_role,priority:3"`
+	SortOrder int           `json:"sort_order" gorm:"not null;default:0"`
+	Caption   string        `json:"caption" gorm:"type:varchar(500)"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+
+	File *File `json:"file,omitempty" gorm:"foreignKey:FileID"`
+}
+
+func (OrderFile) TableName() string {
+	return "order_files"
+}
+
+// UpdateOrderFileRequest 修改订单文件的说明或排序
+type UpdateOrderFileRequest struct {
+	Role      OrderFileRole `json:"role" binding:"required,oneof=image attachment model video"`
+	Caption   *string       `json:"caption" binding:"omitempty,max=500"`
+	SortOrder *int          `json:"sort_order" binding:"omitempty,min=0"`
+}
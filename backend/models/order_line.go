@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// OrderLine 订单的尺码 × 颜色明细行
+// 订单有明细行时，Order.Quantity 为各行数量之和，Order.TotalPrice 按各行单价（未设置时取订单单价）汇总。
+type OrderLine struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	OrderID   uint      `json:"order_id" gorm:"not null;uniqueIndex:idx_order_line_size_color"`
+	Size      string    `json:"size" gorm:"type:varchar(50);not null;uniqueIndex:idx_order_line_size_color"`
+	Color     string    `json:"color" gorm:"type:varchar(100);not null;uniqueIndex:idx_order_line_size_color"`
+	SKU       string    `json:"sku" gorm:"column:sku;type:varchar(100)"`
+	Quantity  int       `json:"quantity" gorm:"not null"`
+	UnitPrice *float64  `json:"unit_price" gorm:"type:decimal(10,2)"` // 为空时使用订单单价
+	SortOrder int       `json:"sort_order" gorm:"not null;default:0"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (OrderLine) TableName() string {
+	return "order_lines"
+}
+
+// EffectiveUnitPrice 明细行实际使用的单价
+func (l *OrderLine) EffectiveUnitPrice(orderUnitPrice float64) float64 {
+	if l.UnitPrice != nil {
+		return *l.UnitPrice
+	}
+	return orderUnitPrice
+}
+
+// OrderLineRequest 订单明细行
+type OrderLineRequest struct {
+	Size      string   `json:"size" binding:"required,max=50"`
+	Color     string   `json:"color" binding:"required,max=100"`
+	SKU       string   `json:"sku" binding:"max=100"`
+	Quantity  int      `json:"quantity" binding:"required,min=1"`
+	UnitPrice *float64 `json:"unit_price" binding:"omitempty,min=0"`
+}
+
+// SaveOrderLinesRequest 整体替换订单的尺码 × 颜色明细
+type SaveOrderLinesRequest struct {
+	Lines []OrderLineRequest `json:"lines" binding:"required,min=1,dive"`
+}
+
+// OrderLineView 订单明细行及金额和生产完成数量
+type OrderLineView struct {
+	OrderLine
+	EffectiveUnitPrice float64 `json:"effective_unit_price"`
+	Amount             float64 `json:"amount"`
+	CompletedQuantity  int     `json:"completed_quantity"` // 最近一次生产进度上报的累计完成数量
+}
+
+// OrderLinesResponse 订单的尺码 × 颜色明细及汇总
+type OrderLinesResponse struct {
+	OrderID           uint            `json:"order_id"`
+	Quantity          int             `json:"quantity"`
+	UnitPrice         float64         `json:"unit_price"`
+	TotalPrice        float64         `json:"total_price"`
+	CompletedQuantity int             `json:"completed_quantity"`
+	Lines             []OrderLineView `json:"lines"`
+}
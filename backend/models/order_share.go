@@ -0,0 +1,108 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// ShareScope 分享令牌的权限范围
+type ShareScope string
+
+const (
+	ShareScopeView   ShareScope = "view"   // 查看订单文件
+	ShareScopeUpload ShareScope = "upload" // 查看并上传订单文件，可删除通过该令牌上传的文件
+)
+
+// Allows 令牌范围是否包含所需权限，upload 包含 view
+func (s ShareScope) Allows(required ShareScope) bool {
+	return s == required || (s == ShareScopeUpload && required == ShareScopeView)
+}
+
+// ActorRoleShare 通过分享令牌访问的外部客户
+const ActorRoleShare UserRole = "share"
+
+// ShareActor 分享令牌对应的操作人，审计事件中记录为 share:<令牌ID>
+func ShareActor(tokenID uint, requestID, ip string) Actor {
+	return Actor{
+		UserID:       fmt.Sprintf("share:%d", tokenID),
+		Role:         ActorRoleShare,
+		RequestID:    requestID,
+		IP:           ip,
+		ShareTokenID: tokenID,
+	}
+}
+
+// OrderShareToken 订单分享令牌，没有平台账号的客户凭令牌查看订单进度和访问订单文件
+// 只保存令牌的 SHA-256，明文只在创建时返回一次；设置了 PIN 的令牌还需要同时提供 PIN。
+type OrderShareToken struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	OrderID     uint       `json:"order_id" gorm:"not null;index"`
+	TokenHash   string     `json:"-" gorm:"type:char(64);not null;uniqueIndex"`
+	Scope       ShareScope `json:"scope" gorm:"type:varchar(20);not null"`
+	Label       string     `json:"label" gorm:"type:varchar(100)"`
+	RateLimit   int        `json:"rate_limit"` // 每分钟最多请求数
+	PinHash     string     `json:"-" gorm:"type:varchar(100)"`
+	PinRequired bool       `json:"pin_required" gorm:"not null;default:false"`
+	PinFailures int        `json:"pin_failures" gorm:"not null;default:0"` // 连续输错 PIN 的次数，成功后清零
+	AccessCount int64      `json:"access_count" gorm:"not null;default:0"`
+	ExpiresAt   time.Time  `json:"expires_at" gorm:"not null;index"`
+	CreatedBy   string     `json:"created_by" gorm:"type:varchar(191);not null"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (OrderShareToken) TableName() string {
+	return "order_share_tokens"
+}
+
+// CreateShareTokenRequest 创建分享令牌的请求
+type CreateShareTokenRequest struct {
+	Scope          ShareScope `json:"scope" binding:"required,oneof=view upload"`
+	Label          string     `json:"label" binding:"max=100"`
+	ExpiresInHours int        `json:"expires_in_hours" binding:"omitempty,min=1,max=2160"` // 默认 7 天，最长 90 天
+	RateLimit      int        `json:"rate_limit" binding:"omitempty,min=1,max=600"`        // 默认每分钟 60 次
+	Pin            string     `json:"pin" binding:"omitempty,numeric,min=4,max=8"`         // 可选，4-8 位数字
+}
+
+// CreateShareTokenResponse 创建分享令牌的响应，Token 只返回这一次
+type CreateShareTokenResponse struct {
+	OrderShareToken
+	Token string `json:"token"`
+}
+
+// SharedFile 通过分享令牌返回的订单文件，URL 为限时签名地址
+type SharedFile struct {
+	ID           string        `json:"id"`
+	Name         string        `json:"name"`
+	Role         OrderFileRole `json:"role"`
+	Caption      string        `json:"caption,omitempty"`
+	Size         int64         `json:"size"`
+	URL          string        `json:"url"`
+	ThumbnailURL string        `json:"thumbnail_url,omitempty"`
+	CreatedAt    time.Time     `json:"created_at"`
+}
+
+// SharedOrderProgress 分享页面中的进度节点
+type SharedOrderProgress struct {
+	Type          ProgressType   `json:"type"`
+	Status        ProgressStatus `json:"status"`
+	Description   string         `json:"description,omitempty"`
+	PlannedDue    *time.Time     `json:"planned_due,omitempty"` // 生产计划中该阶段的计划完成日期
+	StartTime     *time.Time     `json:"start_time,omitempty"`
+	CompletedTime *time.Time     `json:"completed_time,omitempty"`
+}
+
+// SharedOrderView 通过分享链接查看的订单，不包含价格、付款和收货地址等信息
+type SharedOrderView struct {
+	ID           uint                  `json:"id"`
+	Title        string                `json:"title"`
+	Status       string                `json:"status"`
+	Quantity     int                   `json:"quantity"`
+	Factory      string                `json:"factory,omitempty"`
+	DeliveryDate *time.Time            `json:"delivery_date"`
+	Images       []SharedFile          `json:"images"`
+	Progress     []SharedOrderProgress `json:"progress"`
+	ExpiresAt    time.Time             `json:"expires_at"` // 分享链接的过期时间
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"time"
+)
+
+// AllOrderStatuses 全部订单状态，按生命周期顺序排列
+var AllOrderStatuses = []OrderStatus{
+	OrderStatusDraft,
+	OrderStatusPublished,
+	OrderStatusBiddingClosed,
+	OrderStatusInProduction,
+	OrderStatusShipped,
+	OrderStatusDelivered,
+	OrderStatusCompleted,
+	OrderStatusCancelled,
+	OrderStatusDisputed,
+}
+
+// orderStatusTransitions 订单状态机：每个状态允许流转到的下一状态
+var orderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusDraft:         {OrderStatusPublished, OrderStatusCancelled},
+	OrderStatusPublished:     {OrderStatusDraft, OrderStatusBiddingClosed, OrderStatusCancelled},
+	OrderStatusBiddingClosed: {OrderStatusPublished, OrderStatusInProduction, OrderStatusCancelled},
+	OrderStatusInProduction:  {OrderStatusShipped, OrderStatusCancelled, OrderStatusDisputed},
+	OrderStatusShipped:       {OrderStatusDelivered, OrderStatusDisputed},
+	OrderStatusDelivered:     {OrderStatusCompleted, OrderStatusDisputed},
+	OrderStatusDisputed:      {OrderStatusInProduction, OrderStatusShipped, OrderStatusDelivered, OrderStatusCompleted, OrderStatusCancelled},
+	OrderStatusCompleted:     {},
+	OrderStatusCancelled:     {},
+}
+
+// IsValid 判断是否为已定义的订单状态
+func (s OrderStatus) IsValid() bool {
+	_, ok := orderStatusTransitions[s]
+	return ok
+}
+
+// CanTransitionTo 判断当前状态能否流转到目标状态
+func (s OrderStatus) CanTransitionTo(to OrderStatus) bool {
+	for _, next := range orderStatusTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// factoryOrderStatuses 工厂可以手动变更到的订单状态，其余状态只能由设计师变更
+// 工厂通过创建发货单把订单标记为已发货，不能直接设置。
+var factoryOrderStatuses = map[OrderStatus]bool{
+	OrderStatusDisputed: true,
+}
+
+// CanBeSetBy 判断该角色能否手动把订单变更到此状态
+func (s OrderStatus) CanBeSetBy(role UserRole) bool {
+	switch role {
+	case RoleDesigner:
+		return true
+	case RoleFactory:
+		return factoryOrderStatuses[s]
+	}
+	return false
+}
+
+// NextStatuses 返回当前状态允许流转到的状态列表
+func (s OrderStatus) NextStatuses() []OrderStatus {
+	return orderStatusTransitions[s]
+}
+
+// OrderStatusHistory 订单状态流转记录
+type OrderStatusHistory struct {
+	ID           uint        `json:"id" gorm:"primaryKey"`
+	OrderID      uint        `json:"order_id" gorm:"not null;index"`
+	FromStatus   OrderStatus `json:"from_status" gorm:"type:varchar(50);comment:原状态"`
+	ToStatus     OrderStatus `json:"to_status" gorm:"type:varchar(50);not null;comment:新状态"`
+	OperatorID   string      `json:"operator_id" gorm:"type:varchar(191);index;comment:操作人ID"`
+	OperatorRole string      `json:"operator_role" gorm:"type:varchar(50);comment:操作人角色"`
+	Reason       string      `json:"reason" gorm:"type:text;comment:变更原因"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+// TableName 指定表名
+func (OrderStatusHistory) TableName() string {
+	return "order_status_history"
+}
+
+// UpdateOrderStatusRequest 更新订单状态请求
+type UpdateOrderStatusRequest struct {
+	Status OrderStatus `json:"status" binding:"required"`
+	Reason string      `json:"reason"`
+}
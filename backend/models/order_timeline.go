@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// OrderTimelineEntry 订单时间线中的一条记录
+type OrderTimelineEntry struct {
+	Time       time.Time   `json:"time"`
+	Kind       string      `json:"kind"`
+	Title      string      `json:"title"`
+	Detail     string      `json:"detail,omitempty"`
+	ActorID    string      `json:"actor_id,omitempty"`
+	EntityType string      `json:"entity_type"`
+	EntityID   uint        `json:"entity_id"`
+	Data       interface{} `json:"data,omitempty"`
+}
+
+// 订单时间线记录类型
+const (
+	TimelineStatusChange     = "status_change"
+	TimelineProgress         = "progress"
+	TimelineSampleSubmitted  = "sample_submitted"
+	TimelineSampleReviewed   = "sample_reviewed"
+	TimelineTechPackReleased = "tech_pack_released"
+	TimelineQCInspection     = "qc_inspection"
+	TimelineShipment         = "shipment"
+	TimelineTrackingEvent    = "tracking_event"
+	TimelineDeliveryConfirm  = "delivery_confirmed"
+)
@@ -45,8 +45,9 @@ type OrderProgress struct {
 	DeletedAt     gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 	
 	// 关联关系
-	Order   Order          `json:"order" gorm:"foreignKey:OrderID"`
-	Factory FactoryProfile `json:"factory" gorm:"foreignKey:FactoryID;references:UserID"`
+	Order          Order                  `json:"order" gorm:"foreignKey:OrderID"`
+	Factory        FactoryProfile         `json:"factory" gorm:"foreignKey:FactoryID;references:UserID"`
+	LineQuantities []ProgressLineQuantity `json:"line_quantities,omitempty" gorm:"foreignKey:ProgressID"`
 }
 
 // TableName 指定表名
@@ -54,6 +55,26 @@ func (OrderProgress) TableName() string {
 	return "order_progress"
 }
 
+// ProgressLineQuantity 进度上报的订单明细行累计完成数量
+type ProgressLineQuantity struct {
+	ID                uint      `json:"id" gorm:"primaryKey"`
+	ProgressID        uint      `json:"progress_id" gorm:"not null;index"`
+	OrderLineID       uint      `json:"order_line_id" gorm:"not null;index"`
+	CompletedQuantity int       `json:"completed_quantity" gorm:"not null;comment:截至本次上报的累计完成数量"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (ProgressLineQuantity) TableName() string {
+	return "progress_line_quantities"
+}
+
+// ProgressLineQuantityRequest 按订单明细行上报的累计完成数量
+type ProgressLineQuantityRequest struct {
+	OrderLineID       uint `json:"order_line_id" binding:"required"`
+	CompletedQuantity int  `json:"completed_quantity" binding:"min=0"`
+}
+
 // CreateProgressRequest 创建进度请求（符合要求文档）
 type CreateProgressRequest struct {
 	OrderID       uint         `json:"order_id" binding:"required"`
@@ -64,6 +85,7 @@ type CreateProgressRequest struct {
 	StartTime     *time.Time   `json:"start_time"`
 	CompletedTime *time.Time   `json:"completed_time"`
 	Images        []string     `json:"images"`
+	LineQuantities []ProgressLineQuantityRequest `json:"line_quantities" binding:"omitempty,dive"`
 }
 
 // UpdateProgressRequest 更新进度请求（符合要求文档）
@@ -74,6 +96,7 @@ type UpdateProgressRequest struct {
 	StartTime     *time.Time   `json:"start_time"`
 	CompletedTime *time.Time   `json:"completed_time"`
 	Images        []string     `json:"images"`
+	LineQuantities []ProgressLineQuantityRequest `json:"line_quantities" binding:"omitempty,dive"` // 给出时整体替换本次上报的明细数量
 }
 
 // ProgressResponse 进度响应（符合要求文档）
@@ -87,6 +110,7 @@ type ProgressResponse struct {
 	StartTime     *time.Time   `json:"start_time"`
 	CompletedTime *time.Time   `json:"completed_time"`
 	Images        []string     `json:"images"`
+	LineQuantities []ProgressLineQuantity `json:"line_quantities"`
 	CreatedAt     *time.Time   `json:"created_at"`
 	UpdatedAt     *time.Time   `json:"updated_at"`
 	
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// DefectSeverity 缺陷等级
+type DefectSeverity string
+
+const (
+	DefectCritical DefectSeverity = "critical" // 致命缺陷，可能危及安全或违反法规
+	DefectMajor    DefectSeverity = "major"    // 严重缺陷，影响使用或销售
+	DefectMinor    DefectSeverity = "minor"    // 轻微缺陷，不影响使用
+)
+
+// QCResult 检验结论
+type QCResult string
+
+const (
+	QCResultPass QCResult = "pass"
+	QCResultFail QCResult = "fail"
+)
+
+// AQLPlan 按 ISO 2859-1 一次正常抽样得到的抽样方案
+type AQLPlan struct {
+	LotSize         int     `json:"lot_size"`
+	InspectionLevel string  `json:"inspection_level"`
+	AQL             float64 `json:"aql"`
+	CodeLetter      string  `json:"code_letter"`
+	SampleSize      int     `json:"sample_size"` // 样本量不小于批量时为全检
+	Accept          int     `json:"accept"`      // 接收数 Ac
+	Reject          int     `json:"reject"`      // 拒收数 Re
+}
+
+// QCInspection 一次质量检验：按批量和检验水平抽样，记录各等级缺陷并给出结论
+// 各缺陷等级按各自的 AQL 判定，实际抽样数量取各等级方案中的最大值。
+type QCInspection struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	OrderID         uint       `json:"order_id" gorm:"not null;index"`
+	FactoryID       string     `json:"factory_id" gorm:"type:varchar(191);not null;index"`
+	ProgressID      *uint      `json:"progress_id" gorm:"index"` // 对应的质检阶段进度
+	InspectorID     string     `json:"inspector_id" gorm:"type:varchar(191);not null"`
+	LotSize         int        `json:"lot_size" gorm:"not null"`
+	InspectionLevel string     `json:"inspection_level" gorm:"type:varchar(10);not null"`
+	CodeLetter      string     `json:"code_letter" gorm:"type:varchar(2);not null"`
+	SampleSize      int        `json:"sample_size" gorm:"not null"`
+	AQLCritical     float64    `json:"aql_critical"` // 0 表示不允许出现
+	AQLMajor        float64    `json:"aql_major"`
+	AQLMinor        float64    `json:"aql_minor"`
+	CriticalAccept  int        `json:"critical_accept"`
+	CriticalReject  int        `json:"critical_reject"`
+	MajorAccept     int        `json:"major_accept"`
+	MajorReject     int        `json:"major_reject"`
+	MinorAccept     int        `json:"minor_accept"`
+	MinorReject     int        `json:"minor_reject"`
+	CriticalFound   int        `json:"critical_found"`
+	MajorFound      int        `json:"major_found"`
+	MinorFound      int        `json:"minor_found"`
+	Result          QCResult   `json:"result" gorm:"type:varchar(10);not null;index"`
+	Note            string     `json:"note" gorm:"type:text"`
+	InspectedAt     time.Time  `json:"inspected_at" gorm:"index"`
+	CreatedAt       time.Time  `json:"created_at"`
+	Defects         []QCDefect `json:"defects" gorm:"foreignKey:InspectionID"`
+}
+
+func (QCInspection) TableName() string {
+	return "qc_inspections"
+}
+
+// QCDefect 检验中发现的一类缺陷
+type QCDefect struct {
+	ID           uint                        `json:"id" gorm:"primaryKey"`
+	InspectionID uint                        `json:"inspection_id" gorm:"not null;index"`
+	Severity     DefectSeverity              `json:"severity" gorm:"type:varchar(10);not null"`
+	Category     string                      `json:"category" gorm:"type:varchar(100);not null;index"` // 缺陷类别，如 跳针、污渍、色差
+	Quantity     int                         `json:"quantity" gorm:"not null"`
+	Description  string                      `json:"description" gorm:"type:varchar(500)"`
+	Photos       datatypes.JSONSlice[string] `json:"photos"`
+}
+
+func (QCDefect) TableName() string {
+	return "qc_defects"
+}
+
+// AQLPlanRequest 查询抽样方案
+type AQLPlanRequest struct {
+	LotSize         int     `form:"lot_size" binding:"required,min=2"`
+	InspectionLevel string  `form:"inspection_level,default=II"`
+	AQL             float64 `form:"aql,default=2.5" binding:"min=0"`
+}
+
+// QCDefectRequest 记录一类缺陷
+type QCDefectRequest struct {
+	Severity    DefectSeverity `json:"severity" binding:"required,oneof=critical major minor"`
+	Category    string         `json:"category" binding:"required,max=100"`
+	Quantity    int            `json:"quantity" binding:"required,min=1"`
+	Description string         `json:"description" binding:"max=500"`
+	Photos      []string       `json:"photos" binding:"dive,required,max=500"`
+}
+
+// CreateQCInspectionRequest 提交检验报告；AQL 不填时按服装行业常用值：致命 0、严重 2.5、轻微 4.0
+type CreateQCInspectionRequest struct {
+	ProgressID      *uint             `json:"progress_id"`
+	LotSize         int               `json:"lot_size" binding:"required,min=2"`
+	InspectionLevel string            `json:"inspection_level"`
+	AQLCritical     *float64          `json:"aql_critical" binding:"omitempty,min=0"`
+	AQLMajor        *float64          `json:"aql_major" binding:"omitempty,min=0"`
+	AQLMinor        *float64          `json:"aql_minor" binding:"omitempty,min=0"`
+	Defects         []QCDefectRequest `json:"defects" binding:"dive"`
+	Note            string            `json:"note" binding:"max=5000"`
+	InspectedAt     *time.Time        `json:"inspected_at"`
+}
+
+// QCDefectCategoryCount 某类缺陷的累计数量
+type QCDefectCategoryCount struct {
+	Category string `json:"category"`
+	Quantity int64  `json:"quantity"`
+}
+
+// FactoryQualityStats 工厂的质量检验统计，缺陷率为每百件样本中的缺陷数
+type FactoryQualityStats struct {
+	FactoryID       string                  `json:"factory_id"`
+	Inspections     int64                   `json:"inspections"`
+	Passed          int64                   `json:"passed"`
+	Failed          int64                   `json:"failed"`
+	PassRate        float64                 `json:"pass_rate"`
+	SampledUnits    int64                   `json:"sampled_units"`
+	CriticalDefects int64                   `json:"critical_defects"`
+	MajorDefects    int64                   `json:"major_defects"`
+	MinorDefects    int64                   `json:"minor_defects"`
+	DefectRate      float64                 `json:"defect_rate"`
+	TopCategories   []QCDefectCategoryCount `json:"top_categories,omitempty"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// OrderAccess 对订单的访问级别，与 REST 接口的授权规则一致
+type OrderAccess int
+
+const (
+	OrderAccessNone     OrderAccess = iota
+	OrderAccessViewer               // 可查看订单、进度、文件
+	OrderAccessOperator             // 承接工厂，可推进订单
+	OrderAccessOwner                // 订单设计师，可查看接单与议价
+)
+
+// 实时事件类型
+const (
+	RealtimeJiedanCreated       = "jiedan.created"
+	RealtimeJiedanAccepted      = "jiedan.accepted"
+	RealtimeJiedanRejected      = "jiedan.rejected"
+	RealtimeQuoteProposed       = "quote.proposed"
+	RealtimeOrderStatusChanged  = "order.status_changed"
+	RealtimeProgressCreated     = "progress.created"
+	RealtimeProgressUpdated     = "progress.updated"
+	RealtimeProgressDeleted     = "progress.deleted"
+	RealtimeFileAttached        = "file.attached"
+	RealtimeNotificationCreated = "notification.created"
+	RealtimeMilestonePlanned    = "milestone.planned"
+	RealtimeMilestoneDelayed    = "milestone.delayed"
+	RealtimeMessageCreated      = "message.created"
+	RealtimeMessageRead         = "message.read"
+	RealtimeSampleSubmitted     = "sample.submitted"
+	RealtimeSampleReviewed      = "sample.reviewed"
+	RealtimeQCInspected         = "qc.inspected"
+	RealtimeShipmentCreated     = "shipment.created"
+	RealtimeShipmentTracking    = "shipment.tracking"
+	RealtimeShipmentDelivered   = "shipment.delivered"
+)
+
+// RealtimeEvent 推送给订阅者的实时事件，持久化以支持断线后按 Last-Event-ID 续传
+type RealtimeEvent struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	Channel   string         `json:"channel" gorm:"type:varchar(191);not null;index"`
+	Type      string         `json:"type" gorm:"type:varchar(50);not null"`
+	MinAccess OrderAccess    `json:"-" gorm:"not null;default:0"` // 订单频道中接收该事件所需的最低访问级别
+	Payload   datatypes.JSON `json:"payload"`
+	CreatedAt time.Time      `json:"created_at" gorm:"index"`
+}
+
+func (RealtimeEvent) TableName() string {
+	return "realtime_events"
+}
+
+// OrderChannel 订单频道名
+func OrderChannel(orderID uint) string {
+	return fmt.Sprintf("order:%d", orderID)
+}
+
+// UserChannel 用户个人频道名
+func UserChannel(userID string) string {
+	return "user:" + userID
+}
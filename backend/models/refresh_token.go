@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// RefreshToken 服务端保存的刷新令牌，仅存储令牌哈希
+// 同一次登录轮换产生的令牌属于同一个 FamilyID，任何一个被重复使用时整个家族都会被吊销。
+type RefreshToken struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       string     `json:"user_id" gorm:"type:varchar(191);not null;index"`
+	FamilyID     string     `json:"family_id" gorm:"type:varchar(191);not null;index"`
+	TokenHash    string     `json:"-" gorm:"type:char(64);not null;uniqueIndex"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt       *time.Time `json:"used_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	ReplacedByID *uint      `json:"replaced_by_id"`
+	UserAgent    string     `json:"user_agent" gorm:"type:varchar(255)"`
+	IP           string     `json:"ip" gorm:"type:varchar(64)"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// RefreshTokenRequest 刷新令牌请求
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// LogoutRequest 退出登录请求，吊销该刷新令牌所属的登录会话
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// TokenClient 签发令牌时记录的客户端信息
+type TokenClient struct {
+	UserAgent string
+	IP        string
+}
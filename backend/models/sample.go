@@ -0,0 +1,76 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// SampleType 样衣类型，按打样流程先后排列
+type SampleType string
+
+const (
+	SampleTypeProto   SampleType = "proto"    // 初样，确认款式
+	SampleTypeFit     SampleType = "fit"      // 试身样，确认版型
+	SampleTypeSizeSet SampleType = "size_set" // 齐码样，确认放码
+	SampleTypePP      SampleType = "pp"       // 产前样，批准后才能开始大货生产
+)
+
+// SampleStatus 样衣审批状态
+type SampleStatus string
+
+const (
+	SampleStatusSubmitted SampleStatus = "submitted" // 工厂已提交，等待设计师审批
+	SampleStatusApproved  SampleStatus = "approved"  // 已批准
+	SampleStatusRejected  SampleStatus = "rejected"  // 已驳回，工厂需要重新打样
+)
+
+// SampleMeasurement 样衣的实测尺寸
+// Spec 和 WithinTolerance 在提交时按当前发布的工艺单计算，工艺单中没有对应部位和尺码时为空。
+type SampleMeasurement struct {
+	Point           string   `json:"point" binding:"required,max=100"` // 测量部位，与工艺单尺寸表的代码或部位名称对应
+	Size            string   `json:"size" binding:"required,max=50"`
+	Actual          float64  `json:"actual" binding:"min=0"` // 实测值
+	Spec            *float64 `json:"spec,omitempty"`         // 工艺单规定值
+	Deviation       *float64 `json:"deviation,omitempty"`    // 实测值 - 规定值
+	WithinTolerance *bool    `json:"within_tolerance,omitempty"`
+}
+
+// OrderSample 订单的一轮样衣：工厂提交照片和实测尺寸，设计师批准或驳回
+// 同一类型每次重新提交都是新的一轮，Round 在订单和类型内递增。
+type OrderSample struct {
+	ID              uint                                   `json:"id" gorm:"primaryKey"`
+	OrderID         uint                                   `json:"order_id" gorm:"not null;uniqueIndex:idx_order_sample_round"`
+	FactoryID       string                                 `json:"factory_id" gorm:"type:varchar(191);not null;index"`
+	Type            SampleType                             `json:"type" gorm:"type:varchar(20);not null;uniqueIndex:idx_order_sample_round"`
+	Round           int                                    `json:"round" gorm:"not null;uniqueIndex:idx_order_sample_round"`
+	Status          SampleStatus                           `json:"status" gorm:"type:varchar(20);not null;default:'submitted';index"`
+	Description     string                                 `json:"description" gorm:"type:text"`
+	Photos          datatypes.JSONSlice[string]            `json:"photos"`            // 照片 URL
+	Measurements    datatypes.JSONSlice[SampleMeasurement] `json:"measurements"`      // 实测尺寸
+	TechPackVersion *int                                   `json:"tech_pack_version"` // 对照的工艺单版本
+	SubmittedAt     time.Time                              `json:"submitted_at"`
+	ReviewedBy      string                                 `json:"reviewed_by" gorm:"type:varchar(191)"`
+	ReviewedAt      *time.Time                             `json:"reviewed_at"`
+	ReviewComment   string                                 `json:"review_comment" gorm:"type:text"`
+	CreatedAt       time.Time                              `json:"created_at"`
+	UpdatedAt       time.Time                              `json:"updated_at"`
+}
+
+func (OrderSample) TableName() string {
+	return "order_samples"
+}
+
+// SubmitSampleRequest 工厂提交一轮样衣
+type SubmitSampleRequest struct {
+	Type         SampleType          `json:"type" binding:"required,oneof=proto fit size_set pp"`
+	Description  string              `json:"description" binding:"max=5000"`
+	Photos       []string            `json:"photos" binding:"required,min=1,dive,required,max=500"`
+	Measurements []SampleMeasurement `json:"measurements" binding:"dive"`
+}
+
+// ReviewSampleRequest 设计师审批样衣，驳回时必须填写意见
+type ReviewSampleRequest struct {
+	Status  SampleStatus `json:"status" binding:"required,oneof=approved rejected"`
+	Comment string       `json:"comment" binding:"max=5000"`
+}
@@ -0,0 +1,113 @@
+package models
+
+import "time"
+
+// ShipmentStatus 发货批次的物流状态，由承运商轨迹更新
+type ShipmentStatus string
+
+const (
+	ShipmentStatusShipped        ShipmentStatus = "shipped"          // 已发货，承运商暂无轨迹
+	ShipmentStatusInTransit      ShipmentStatus = "in_transit"       // 运输中
+	ShipmentStatusOutForDelivery ShipmentStatus = "out_for_delivery" // 派送中
+	ShipmentStatusDelivered      ShipmentStatus = "delivered"        // 已签收
+	ShipmentStatusException      ShipmentStatus = "exception"        // 运输异常
+)
+
+// Shipment 订单的一个发货批次，一个订单可以分多批发货
+// 承运商签收只更新物流状态；收货方确认收货后记录 ConfirmedAt，全部批次确认且发货数量达到订单数量时订单变为已送达。
+type Shipment struct {
+	ID             uint            `json:"id" gorm:"primaryKey"`
+	OrderID        uint            `json:"order_id" gorm:"not null;index"`
+	FactoryID      string          `json:"factory_id" gorm:"type:varchar(191);not null;index"`
+	Carrier        string          `json:"carrier" gorm:"type:varchar(50);not null;uniqueIndex:idx_shipment_tracking"`
+	TrackingNumber string          `json:"tracking_number" gorm:"type:varchar(100);not null;uniqueIndex:idx_shipment_tracking"`
+	Cartons        int             `json:"cartons" gorm:"not null"`
+	GrossWeight    float64         `json:"gross_weight" gorm:"type:decimal(10,2)"` // 毛重（千克）
+	NetWeight      float64         `json:"net_weight" gorm:"type:decimal(10,2)"`   // 净重（千克）
+	Quantity       int             `json:"quantity" gorm:"not null"`               // 本批件数，为装箱单合计
+	ShipTo         string          `json:"ship_to" gorm:"type:varchar(500)"`       // 收货地址，默认取订单收货地址
+	ShipDate       time.Time       `json:"ship_date"`
+	ETA            *time.Time      `json:"eta"`
+	Status         ShipmentStatus  `json:"status" gorm:"type:varchar(20);not null;default:'shipped';index"`
+	DeliveredAt    *time.Time      `json:"delivered_at"` // 承运商签收时间
+	ConfirmedAt    *time.Time      `json:"confirmed_at"` // 收货方确认收货时间
+	ConfirmedBy    string          `json:"confirmed_by" gorm:"type:varchar(191)"`
+	LastTrackedAt  *time.Time      `json:"last_tracked_at"`
+	TrackingError  string          `json:"tracking_error,omitempty" gorm:"type:varchar(255)"` // 最近一次查询轨迹失败的原因
+	Note           string          `json:"note" gorm:"type:varchar(500)"`
+	CreatedBy      string          `json:"created_by" gorm:"type:varchar(191)"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	Items          []ShipmentItem  `json:"items" gorm:"foreignKey:ShipmentID"`
+	Events         []ShipmentEvent `json:"events,omitempty" gorm:"foreignKey:ShipmentID"`
+}
+
+func (Shipment) TableName() string {
+	return "shipments"
+}
+
+// ShipmentItem 装箱单的一行：某个尺码和颜色的件数
+type ShipmentItem struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	ShipmentID  uint   `json:"shipment_id" gorm:"not null;index"`
+	OrderLineID *uint  `json:"order_line_id" gorm:"index"` // 订单有尺码 × 颜色明细时对应的明细行
+	Size        string `json:"size" gorm:"type:varchar(50)"`
+	Color       string `json:"color" gorm:"type:varchar(100)"`
+	Quantity    int    `json:"quantity" gorm:"not null"`
+	Cartons     int    `json:"cartons"`
+}
+
+func (ShipmentItem) TableName() string {
+	return "shipment_items"
+}
+
+// ShipmentEvent 承运商返回的一条物流轨迹
+type ShipmentEvent struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	ShipmentID  uint      `json:"shipment_id" gorm:"not null;index"`
+	OrderID     uint      `json:"order_id" gorm:"not null;index"`
+	Time        time.Time `json:"time"`
+	Status      string    `json:"status" gorm:"type:varchar(20);not null"`
+	Location    string    `json:"location" gorm:"type:varchar(200)"`
+	Description string    `json:"description" gorm:"type:varchar(500)"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (ShipmentEvent) TableName() string {
+	return "shipment_events"
+}
+
+// ShipmentItemRequest 装箱单的一行
+type ShipmentItemRequest struct {
+	Size     string `json:"size" binding:"max=50"`
+	Color    string `json:"color" binding:"max=100"`
+	Quantity int    `json:"quantity" binding:"required,min=1"`
+	Cartons  int    `json:"cartons" binding:"min=0"`
+}
+
+// CreateShipmentRequest 工厂登记一个发货批次
+type CreateShipmentRequest struct {
+	Carrier        string                `json:"carrier" binding:"required,max=50"`
+	TrackingNumber string                `json:"tracking_number" binding:"required,max=100"`
+	Cartons        int                   `json:"cartons" binding:"required,min=1"`
+	GrossWeight    float64               `json:"gross_weight" binding:"min=0"`
+	NetWeight      float64               `json:"net_weight" binding:"min=0"`
+	ShipTo         string                `json:"ship_to" binding:"max=500"`
+	ShipDate       *time.Time            `json:"ship_date"` // 默认当前时间
+	ETA            *time.Time            `json:"eta"`
+	Note           string                `json:"note" binding:"max=500"`
+	Items          []ShipmentItemRequest `json:"items" binding:"required,min=1,dive"`
+}
+
+// ConfirmDeliveryRequest 收货方确认收货
+type ConfirmDeliveryRequest struct {
+	Note string `json:"note" binding:"max=500"`
+}
+
+// OrderShipments 订单的发货批次及发货进度
+type OrderShipments struct {
+	OrderQuantity     int        `json:"order_quantity"`
+	ShippedQuantity   int        `json:"shipped_quantity"`
+	DeliveredQuantity int        `json:"delivered_quantity"` // 已确认收货的件数
+	Shipments         []Shipment `json:"shipments"`
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// TechPackStatus 工艺单版本状态
+type TechPackStatus string
+
+const (
+	TechPackStatusDraft      TechPackStatus = "draft"      // 草稿，只有设计师可见，可修改
+	TechPackStatusReleased   TechPackStatus = "released"   // 已发布，工厂按此版本生产
+	TechPackStatusSuperseded TechPackStatus = "superseded" // 已被新发布的版本取代
+)
+
+// TechPackMeasurement 尺寸表的一个测量部位：各尺码的数值和公差
+type TechPackMeasurement struct {
+	Code           string             `json:"code" binding:"max=20"`            // 部位代码，如 A、B
+	Point          string             `json:"point" binding:"required,max=100"` // 测量部位，如 胸围、衣长
+	HowToMeasure   string             `json:"how_to_measure" binding:"max=500"` // 测量方法
+	TolerancePlus  float64            `json:"tolerance_plus" binding:"min=0"`   // 正公差
+	ToleranceMinus float64            `json:"tolerance_minus" binding:"min=0"`  // 负公差
+	Values         map[string]float64 `json:"values" binding:"required"`        // 尺码 → 数值
+}
+
+// TechPackOperation 一道工序的做工说明
+type TechPackOperation struct {
+	Seq         int    `json:"seq"`
+	Operation   string `json:"operation" binding:"required,max=100"` // 工序名称，如 上领
+	Description string `json:"description" binding:"max=2000"`       // 做工要求
+	Machine     string `json:"machine" binding:"max=100"`            // 机器
+	StitchType  string `json:"stitch_type" binding:"max=100"`        // 线迹，如 301 平缝
+	SPI         int    `json:"spi" binding:"min=0"`                  // 针距（针/英寸）
+}
+
+// TechPackTrim 辅料清单项
+type TechPackTrim struct {
+	Name               string  `json:"name" binding:"required,max=100"`
+	Specification      string  `json:"specification" binding:"max=500"` // 规格、颜色、材质
+	Placement          string  `json:"placement" binding:"max=200"`     // 使用位置
+	QuantityPerGarment float64 `json:"quantity_per_garment" binding:"min=0"`
+	Supplier           string  `json:"supplier" binding:"max=100"`
+}
+
+// TechPack 订单工艺单的一个版本
+// 每次修改产生新版本：草稿可改，发布后内容不再变化，新版本发布时旧版本转为已取代。
+type TechPack struct {
+	ID                    uint                                     `json:"id" gorm:"primaryKey"`
+	OrderID               uint                                     `json:"order_id" gorm:"not null;uniqueIndex:idx_tech_pack_order_version"`
+	Version               int                                      `json:"version" gorm:"not null;uniqueIndex:idx_tech_pack_order_version"`
+	Status                TechPackStatus                           `json:"status" gorm:"type:varchar(20);not null;default:'draft';index"`
+	Title                 string                                   `json:"title" gorm:"type:varchar(200)"`
+	Sizes                 datatypes.JSONSlice[string]              `json:"sizes"`        // 尺码顺序
+	Measurements          datatypes.JSONSlice[TechPackMeasurement] `json:"measurements"` // 尺寸表（放码表）
+	Construction          datatypes.JSONSlice[TechPackOperation]   `json:"construction"` // 工序做工说明
+	Trims                 datatypes.JSONSlice[TechPackTrim]        `json:"trims"`        // 辅料清单
+	LabelInstructions     string                                   `json:"label_instructions" gorm:"type:text"`
+	PackagingInstructions string                                   `json:"packaging_instructions" gorm:"type:text"`
+	ChangeNote            string                                   `json:"change_note" gorm:"type:varchar(500)"` // 本版本的修改说明
+	CreatedBy             string                                   `json:"created_by" gorm:"type:varchar(191)"`
+	ReleasedBy            string                                   `json:"released_by" gorm:"type:varchar(191)"`
+	ReleasedAt            *time.Time                               `json:"released_at"`
+	CreatedAt             time.Time                                `json:"created_at"`
+	UpdatedAt             time.Time                                `json:"updated_at"`
+
+	Acknowledgements []TechPackAcknowledgement `json:"acknowledgements,omitempty" gorm:"foreignKey:TechPackID"`
+}
+
+func (TechPack) TableName() string {
+	return "tech_packs"
+}
+
+// TechPackAcknowledgement 工厂对工艺单某个版本的确认
+type TechPackAcknowledgement struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	TechPackID     uint      `json:"tech_pack_id" gorm:"not null;uniqueIndex:idx_tech_pack_ack_factory"`
+	OrderID        uint      `json:"order_id" gorm:"not null;index"`
+	Version        int       `json:"version" gorm:"not null"`
+	FactoryID      string    `json:"factory_id" gorm:"type:varchar(191);not null;uniqueIndex:idx_tech_pack_ack_factory"`
+	Note           string    `json:"note" gorm:"type:varchar(500)"`
+	AcknowledgedAt time.Time `json:"acknowledged_at"`
+}
+
+func (TechPackAcknowledgement) TableName() string {
+	return "tech_pack_acknowledgements"
+}
+
+// TechPackRequest 创建或修改工艺单草稿
+type TechPackRequest struct {
+	Title                 string                `json:"title" binding:"max=200"`
+	Sizes                 []string              `json:"sizes" binding:"dive,required,max=50"`
+	Measurements          []TechPackMeasurement `json:"measurements" binding:"dive"`
+	Construction          []TechPackOperation   `json:"construction" binding:"dive"`
+	Trims                 []TechPackTrim        `json:"trims" binding:"dive"`
+	LabelInstructions     string                `json:"label_instructions" binding:"max=5000"`
+	PackagingInstructions string                `json:"packaging_instructions" binding:"max=5000"`
+	ChangeNote            string                `json:"change_note" binding:"max=500"`
+}
+
+// AcknowledgeTechPackRequest 工厂确认工艺单
+type AcknowledgeTechPackRequest struct {
+	Note string `json:"note" binding:"max=500"`
+}
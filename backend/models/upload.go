@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+// 分片上传会话状态
+const (
+	UploadStatusUploading  = "uploading"  // 正在上传分片
+	UploadStatusAssembling = "assembling" // 正在合并分片
+	UploadStatusCompleted  = "completed"  // 已合并为文件
+	UploadStatusFailed     = "failed"     // 合并后校验失败
+)
+
+// UploadSession 可续传的分片上传会话，分片暂存在存储后端，完成后合并为 File
+type UploadSession struct {
+	ID          string    `json:"id" gorm:"type:varchar(36);primaryKey"`
+	UploaderID  string    `json:"uploader_id" gorm:"type:varchar(191);not null;index"`
+	Filename    string    `json:"filename" gorm:"type:varchar(255);not null"`
+	FileType    string    `json:"file_type" gorm:"type:varchar(20)"`
+	OrderID     *uint     `json:"order_id,omitempty" gorm:"index"`
+	TotalSize   int64     `json:"total_size"`
+	ChunkSize   int64     `json:"chunk_size"`
+	TotalChunks int       `json:"total_chunks"`
+	SHA256      string    `json:"sha256" gorm:"type:char(64);not null"` // 完整文件的 SHA-256（十六进制）
+	Status      string    `json:"status" gorm:"type:varchar(20);not null;index"`
+	FileID      string    `json:"file_id,omitempty" gorm:"type:varchar(191)"` // 合并完成后生成的文件
+	ExpiresAt   time.Time `json:"expires_at" gorm:"index"`                    // 超时未完成的会话会被清理
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (UploadSession) TableName() string {
+	return "upload_sessions"
+}
+
+// UploadChunk 已接收的分片
+type UploadChunk struct {
+	ID        uint      `json:"-" gorm:"primaryKey"`
+	SessionID string    `json:"-" gorm:"type:varchar(36);not null;uniqueIndex:idx_upload_chunk"`
+	Index     int       `json:"index" gorm:"column:chunk_index;not null;uniqueIndex:idx_upload_chunk"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256" gorm:"type:char(64);not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (UploadChunk) TableName() string {
+	return "upload_chunks"
+}
+
+// InitiateUploadRequest 创建分片上传会话
+type InitiateUploadRequest struct {
+	Filename  string `json:"filename" binding:"required"`
+	Size      int64  `json:"size" binding:"required,gt=0"`
+	SHA256    string `json:"sha256" binding:"required,len=64,hexadecimal"`
+	Type      string `json:"type" binding:"omitempty,oneof=image attachment model video"`
+	OrderID   *uint  `json:"order_id"`
+	ChunkSize int64  `json:"chunk_size"` // 可选，默认 8MB
+}
+
+// CompleteUploadRequest 完成分片上传
+type CompleteUploadRequest struct {
+	Description string `json:"description"`
+}
+
+// UploadSessionStatus 上传会话及待上传的分片，客户端据此续传
+type UploadSessionStatus struct {
+	*UploadSession
+	ReceivedChunks []int `json:"received_chunks"`
+	MissingChunks  []int `json:"missing_chunks"`
+}
@@ -0,0 +1,20 @@
+package routes
+
+import "context"
+
+// Background 路由依赖的后台任务，由调用方传入可取消的 context 启动，context 结束时全部退出
+type Background struct {
+	jobs []func(ctx context.Context)
+}
+
+// add 登记一个后台任务
+func (b *Background) add(job func(ctx context.Context)) {
+	b.jobs = append(b.jobs, job)
+}
+
+// Start 在独立的 goroutine 中启动全部后台任务
+func (b *Background) Start(ctx context.Context) {
+	for _, job := range b.jobs {
+		go job(ctx)
+	}
+}
@@ -37,8 +37,11 @@ func SetupFabricRoutes(router *gin.Engine, fabricController *controllers.FabricC
 	authFabricGroup.Use(middleware.AuthMiddleware())
 	{
 		// authFabricGroup.POST("", fabricController.CreateFabric)  // 注释掉，避免与router.go中的路由冲突
+		authFabricGroup.GET("/replenishment", fabricController.GetReplenishment)
 		authFabricGroup.PUT("/:id", fabricController.UpdateFabric)
 		authFabricGroup.DELETE("/:id", fabricController.DeleteFabric)
 		authFabricGroup.PUT("/:id/stock", fabricController.UpdateFabricStock)
+		authFabricGroup.GET("/:id/ledger", fabricController.GetFabricLedger)
+		authFabricGroup.POST("/:id/ledger", fabricController.RecordLedgerEntry)
 	}
 } 
\ No newline at end of file
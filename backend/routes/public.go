@@ -4,19 +4,20 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"gongChang/controllers"
+	"gongChang/services"
 )
 
-func RegisterPublicRoutes(r *gin.Engine, db *gorm.DB) {
+func RegisterPublicRoutes(r *gin.Engine, db *gorm.DB, fileService *services.FileService, shareService *services.OrderShareService) {
 	// 创建公开路由组
 	public := r.Group("/public")
 	{
 		// 订单相关路由
-		orderController := controllers.NewPublicOrderController(db)
+		orderController := controllers.NewPublicOrderController(db, fileService, shareService)
 		public.GET("/orders", orderController.GetPublicOrders)
 		public.GET("/orders/:id", orderController.GetPublicOrderDetail)
 		
-		// 订单文件相关路由
-		fileController := controllers.NewPublicFileController(db)
+		// 订单文件相关路由，需要携带订单分享令牌（X-Share-Token 请求头或 token 参数）
+		fileController := controllers.NewPublicFileController(db, fileService, shareService)
 		public.POST("/orders/:id/files", fileController.UploadOrderFiles)
 		public.GET("/orders/:id/files", fileController.GetOrderFiles)
 		public.GET("/files/:fileId", fileController.GetFile)
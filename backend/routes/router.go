@@ -1,17 +1,24 @@
 package routes
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"gongChang/controllers"
 	"gongChang/services"
 	"gongChang/middleware"
 	"gongChang/config"
+	"gongChang/models"
+	"gongChang/storage"
+	"gongChang/tracking"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 )
 
-func SetupRouter(db *gorm.DB, cfg *config.Config) *gin.Engine {
+// SetupRouter 注册路由并返回需要由调用方启动的后台任务
+func SetupRouter(db *gorm.DB, cfg *config.Config) (*gin.Engine, *Background) {
 	r := gin.Default()
 
 	// 设置受信任的代理
@@ -25,10 +32,22 @@ func SetupRouter(db *gorm.DB, cfg *config.Config) *gin.Engine {
 	// 添加 CORS 中间件
 	r.Use(middleware.CORSMiddleware())
 
-	// 添加静态文件服务，专门用于提供上传的文件
-	r.Static("/uploads", "./uploads")
-	
-	// 为静态文件添加CORS头
+	// 请求ID，用于审计事件和日志关联
+	r.Use(middleware.RequestIDMiddleware())
+
+	// 文件存储后端
+	store, err := storage.NewFromConfig(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	// 物流轨迹查询
+	tracker, err := tracking.NewFromConfig(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracking: %v", err)
+	}
+
+	// 为文件地址添加CORS头
 	r.Use(func(c *gin.Context) {
 		if c.Request.URL.Path == "/uploads" || strings.HasPrefix(c.Request.URL.Path, "/uploads/") {
 			c.Header("Access-Control-Allow-Origin", "*")
@@ -43,7 +62,7 @@ func SetupRouter(db *gorm.DB, cfg *config.Config) *gin.Engine {
 	userService := services.NewUserService(db)
 	productService := services.NewProductService(db)
 	orderService := services.NewOrderService(db)
-	fileService := services.NewFileService(db, "./uploads")
+	fileService := services.NewFileService(db, store, cfg.StorageURLTTL())
 	fabricService := services.NewFabricService(db)
 	jiedanService := services.NewJiedanService(db)
 	progressService := services.NewProgressService(db)
@@ -51,13 +70,42 @@ func SetupRouter(db *gorm.DB, cfg *config.Config) *gin.Engine {
 	orderSearchService := services.NewOrderSearchService(db)
 	factorySearchService := services.NewFactorySearchService(db)
 	designerSearchService := services.NewDesignerSearchService(db)
+	policyService := services.NewPolicyService(db)
+	tokenService := services.NewTokenService(db, cfg.RefreshTokenTTL())
+	auditService := services.NewAuditService(db)
+	notificationService := services.NewNotificationService(db)
+	messageService := services.NewMessageService(db)
+	milestoneService := services.NewMilestoneService(db)
+	orderShareService := services.NewOrderShareService(db)
+	techPackService := services.NewTechPackService(db)
+	sampleService := services.NewSampleService(db)
+	qcInspectionService := services.NewQCInspectionService(db)
+	shipmentService := services.NewShipmentService(db, tracker)
+
+	background := &Background{}
+
+	// 实时事件分发
+	realtimeHub := services.NewRealtimeHub(db)
+	background.add(realtimeHub.Run)
+
+	// 生产计划延期检测
+	background.add(func(ctx context.Context) { milestoneService.RunDelayMonitor(ctx, 10*time.Minute) })
+
+	// 布料低库存提醒
+	background.add(func(ctx context.Context) { fabricService.RunLowStockMonitor(ctx, 30*time.Minute) })
+
+	// 清理超时未完成的分片上传
+	background.add(func(ctx context.Context) { fileService.RunUploadCleanup(ctx, time.Hour) })
+
+	// 轮询未确认收货批次的物流轨迹
+	background.add(func(ctx context.Context) { shipmentService.RunTrackingPoller(ctx, cfg.TrackingPollInterval()) })
 
 	// 创建控制器实例
-	userController := controllers.NewUserController(userService)
+	userController := controllers.NewUserController(userService, tokenService, fileService, cfg)
 	productController := controllers.NewProductController(productService)
 	orderController := controllers.NewOrderController(orderService, db)
-	fileController := controllers.NewFileController(fileService, "./uploads", cfg)
-	factoryController := &controllers.FactoryController{DB: db}
+	fileController := controllers.NewFileController(fileService, cfg)
+	factoryController := &controllers.FactoryController{DB: db, FileService: fileService}
 	fabricController := controllers.NewFabricController(fabricService)
 	jiedanController := controllers.NewJiedanController(jiedanService)
 	progressController := controllers.NewProgressController(progressService)
@@ -65,6 +113,24 @@ func SetupRouter(db *gorm.DB, cfg *config.Config) *gin.Engine {
 	orderSearchController := controllers.NewOrderSearchController(orderSearchService)
 	factorySearchController := controllers.NewFactorySearchController(factorySearchService)
 	designerSearchController := controllers.NewDesignerSearchController(designerSearchService)
+	auditController := controllers.NewAuditController(auditService)
+	notificationController := controllers.NewNotificationController(notificationService)
+	realtimeController := controllers.NewRealtimeController(realtimeHub, policyService)
+	messageController := controllers.NewMessageController(messageService, fileService)
+	milestoneController := controllers.NewMilestoneController(milestoneService)
+	orderShareController := controllers.NewOrderShareController(orderShareService)
+	techPackController := controllers.NewTechPackController(techPackService)
+	sampleController := controllers.NewSampleController(sampleService)
+	qcInspectionController := controllers.NewQCInspectionController(qcInspectionService)
+	shipmentController := controllers.NewShipmentController(shipmentService)
+	localStore, _ := store.(*storage.LocalStorage)
+	storageController := controllers.NewStorageController(localStore, fileService)
+
+	// 旧的 /uploads 地址：公开文件（头像、工厂图片）重定向到签名地址
+	r.GET("/uploads/*key", storageController.ServeLegacy)
+
+	// 授权策略
+	policy := middleware.NewPolicy(policyService)
 
 	// API 路由组
 	api := r.Group("/api")
@@ -75,6 +141,8 @@ func SetupRouter(db *gorm.DB, cfg *config.Config) *gin.Engine {
 			authGroup.POST("/login", userController.Login)
 			authGroup.POST("/register", userController.Register)
 			authGroup.POST("/refresh", userController.RefreshToken)
+			authGroup.POST("/logout", userController.Logout)
+			authGroup.POST("/logout-all", middleware.AuthMiddleware(), userController.LogoutAll)
 		}
 
 		// 公开路由（无需认证）
@@ -111,6 +179,11 @@ func SetupRouter(db *gorm.DB, cfg *config.Config) *gin.Engine {
 		// 获取最近订单（公开路由）
 		api.GET("/orders/recent", orderController.GetRecentOrders)
 
+		// 本地存储的签名下载地址（签名即授权，无需认证）
+		if localStore != nil {
+			api.GET("/storage/*key", storageController.ServeSigned)
+		}
+
 		// 需要认证的路由
 		authRequiredGroup := api.Group("")
 		authRequiredGroup.Use(middleware.AuthMiddleware())
@@ -122,8 +195,8 @@ func SetupRouter(db *gorm.DB, cfg *config.Config) *gin.Engine {
 				userGroup.PUT("/profile", userController.UpdateUserProfile)
 				userGroup.POST("/change-password", userController.ChangePassword)
 				userGroup.GET("/:id", userController.GetUser)
-				userGroup.PUT("/:id", userController.UpdateUser)
-				userGroup.DELETE("/:id", userController.DeleteUser)
+				userGroup.PUT("/:id", policy.Self("id"), userController.UpdateUser)
+				userGroup.DELETE("/:id", policy.Self("id"), userController.DeleteUser)
 			}
 
 			// 设计师管理路由
@@ -154,42 +227,78 @@ func SetupRouter(db *gorm.DB, cfg *config.Config) *gin.Engine {
 			{
 				orderGroup.POST("", orderController.CreateOrder)
 				orderGroup.GET("", orderController.GetOrdersByUserID)
-				orderGroup.GET("/:id", orderController.GetOrderByID)
-				orderGroup.PUT("/:id", orderController.UpdateOrder)
-				orderGroup.DELETE("/:id", orderController.DeleteOrder)
-				orderGroup.PUT("/:id/status", orderController.UpdateOrderStatus)
+				orderGroup.GET("/:id", policy.OrderViewer("id"), orderController.GetOrderByID)
+				orderGroup.PUT("/:id", policy.OrderOwner("id"), orderController.UpdateOrder)
+				orderGroup.DELETE("/:id", policy.OrderOwner("id"), orderController.DeleteOrder)
+				orderGroup.PUT("/:id/status", policy.OrderOperator("id"), orderController.UpdateOrderStatus)
+				orderGroup.GET("/:id/status-history", policy.OrderViewer("id"), orderController.GetOrderStatusHistory)
+				orderGroup.GET("/:id/timeline", policy.OrderViewer("id"), orderController.GetOrderTimeline)
+				orderGroup.GET("/:id/stream", policy.OrderViewer("id"), realtimeController.StreamOrder)
 				orderGroup.GET("/statistics", orderController.GetOrderStatistics)
-				orderGroup.POST("/:id/add-fabric", orderController.AddFabricToOrder)
-				orderGroup.DELETE("/:id/remove-fabric", orderController.RemoveFabricFromOrder)
-				orderGroup.POST("/:id/add-file", fileController.AddFileToOrder)
-				orderGroup.DELETE("/:id/remove-file", orderController.RemoveFileFromOrder)
-				orderGroup.GET("/:id/jiedan", jiedanController.GetJiedanByOrderIDAndFactoryID)
-				orderGroup.GET("/:id/jiedans", jiedanController.GetJiedansByOrderID)
-				orderGroup.POST("/:id/accept", orderController.AcceptOrder)
+				orderGroup.POST("/:id/add-fabric", policy.OrderOwner("id"), orderController.AddFabricToOrder)
+				orderGroup.DELETE("/:id/remove-fabric", policy.OrderOwner("id"), orderController.RemoveFabricFromOrder)
+				orderGroup.GET("/:id/bom", policy.OrderViewer("id"), orderController.GetOrderBOM)
+				orderGroup.PUT("/:id/bom", policy.OrderOwner("id"), orderController.SaveOrderBOM)
+				orderGroup.GET("/:id/lines", policy.OrderViewer("id"), orderController.GetOrderLines)
+				orderGroup.PUT("/:id/lines", policy.OrderOwner("id"), orderController.SaveOrderLines)
+				orderGroup.GET("/:id/tech-packs", policy.OrderViewer("id"), techPackController.ListTechPacks)
+				orderGroup.POST("/:id/tech-packs", policy.OrderOwner("id"), techPackController.CreateTechPack)
+				orderGroup.GET("/:id/tech-packs/:version", policy.OrderViewer("id"), techPackController.GetTechPack)
+				orderGroup.PUT("/:id/tech-packs/:version", policy.OrderOwner("id"), techPackController.UpdateTechPack)
+				orderGroup.POST("/:id/tech-packs/:version/release", policy.OrderOwner("id"), techPackController.ReleaseTechPack)
+				orderGroup.POST("/:id/tech-packs/:version/acknowledge", policy.OrderOperator("id"), techPackController.AcknowledgeTechPack)
+				orderGroup.GET("/:id/tech-packs/:version/pdf", policy.OrderViewer("id"), techPackController.DownloadTechPackPDF)
+				orderGroup.GET("/:id/samples", policy.OrderViewer("id"), sampleController.ListSamples)
+				orderGroup.POST("/:id/samples", policy.OrderOperator("id"), sampleController.SubmitSample)
+				orderGroup.POST("/:id/samples/:sampleId/review", policy.OrderOwner("id"), sampleController.ReviewSample)
+				orderGroup.GET("/:id/inspections", policy.OrderViewer("id"), qcInspectionController.ListInspections)
+				orderGroup.POST("/:id/inspections", policy.OrderOwner("id"), qcInspectionController.CreateInspection)
+				orderGroup.GET("/:id/inspections/:inspectionId", policy.OrderViewer("id"), qcInspectionController.GetInspection)
+				orderGroup.GET("/:id/shipments", policy.OrderViewer("id"), shipmentController.ListShipments)
+				orderGroup.POST("/:id/shipments", policy.OrderOperator("id"), shipmentController.CreateShipment)
+				orderGroup.GET("/:id/shipments/:shipmentId", policy.OrderViewer("id"), shipmentController.GetShipment)
+				orderGroup.POST("/:id/shipments/:shipmentId/track", policy.OrderViewer("id"), shipmentController.RefreshTracking)
+				orderGroup.POST("/:id/shipments/:shipmentId/confirm-delivery", policy.OrderViewer("id"), shipmentController.ConfirmDelivery)
+				orderGroup.POST("/:id/add-file", policy.OrderOperator("id"), fileController.AddFileToOrder)
+				orderGroup.DELETE("/:id/remove-file", policy.OrderOperator("id"), orderController.RemoveFileFromOrder)
+				orderGroup.PATCH("/:id/files/:fileId", policy.OrderOperator("id"), orderController.UpdateOrderFile)
+				orderGroup.POST("/:id/share-tokens", policy.OrderOwner("id"), orderShareController.CreateShareToken)
+				orderGroup.GET("/:id/share-tokens", policy.OrderOwner("id"), orderShareController.ListShareTokens)
+				orderGroup.DELETE("/:id/share-tokens/:tokenId", policy.OrderOwner("id"), orderShareController.RevokeShareToken)
+				orderGroup.GET("/:id/jiedan", policy.OrderViewer("id"), jiedanController.GetJiedanByOrderIDAndFactoryID)
+				orderGroup.GET("/:id/jiedans", policy.OrderOwner("id"), jiedanController.GetJiedansByOrderID)
+				orderGroup.POST("/:id/accept", policy.RequireRole(models.RoleFactory), orderController.AcceptOrder)
+				orderGroup.POST("/:id/threads", policy.OrderViewer("id"), messageController.OpenThread)
+				orderGroup.GET("/:id/threads", policy.OrderViewer("id"), messageController.ListThreads)
 				
 				// 进度管理路由
-				orderGroup.POST("/:id/progress", progressController.CreateProgress)
-				orderGroup.GET("/:id/progress", progressController.GetProgressByOrderID)
-				orderGroup.PUT("/:id/progress/:progressId", progressController.UpdateProgress)
-				orderGroup.DELETE("/:id/progress/:progressId", progressController.DeleteProgress)
+				orderGroup.POST("/:id/progress", policy.OrderFactory("id"), progressController.CreateProgress)
+				orderGroup.GET("/:id/progress", policy.OrderViewer("id"), progressController.GetProgressByOrderID)
+				orderGroup.PUT("/:id/progress/:progressId", policy.ProgressOwner("progressId"), progressController.UpdateProgress)
+				orderGroup.DELETE("/:id/progress/:progressId", policy.ProgressOwner("progressId"), progressController.DeleteProgress)
 				
 				// 兼容路由（支持前端使用的复数形式）
-				orderGroup.POST("/:id/progresses", progressController.CreateProgress)
-				orderGroup.GET("/:id/progresses", progressController.GetProgressByOrderID)
+				orderGroup.POST("/:id/progresses", policy.OrderFactory("id"), progressController.CreateProgress)
+				orderGroup.GET("/:id/progresses", policy.OrderViewer("id"), progressController.GetProgressByOrderID)
+
+				// 生产计划路由
+				orderGroup.PUT("/:id/milestones", policy.OrderOperator("id"), milestoneController.PublishPlan)
+				orderGroup.GET("/:id/milestones", policy.OrderViewer("id"), milestoneController.GetPlan)
+				orderGroup.GET("/:id/schedule", policy.OrderViewer("id"), milestoneController.GetScheduleVariance)
 			}
 
 			// 工厂订单路由
 			factoryGroup := authRequiredGroup.Group("/factory")
 			{
 				factoryGroup.GET("/orders", orderController.GetOrdersByUserID)
-				factoryGroup.PUT("/orders/:id", orderController.UpdateOrderStatus)
+				factoryGroup.PUT("/orders/:id", policy.OrderOperator("id"), orderController.UpdateOrderStatus)
 			}
 
 			// 设计师订单路由
-			designerGroup := authRequiredGroup.Group("/designer")
+			designerOrderGroup := authRequiredGroup.Group("/designer")
 			{
-				designerGroup.GET("/orders", orderController.GetOrdersByDesignerID)
-				designerGroup.POST("/orders", orderController.CreateOrder)
+				designerOrderGroup.GET("/orders", orderController.GetOrdersByDesignerID)
+				designerOrderGroup.POST("/orders", orderController.CreateOrder)
 			}
 
 			// 文件路由
@@ -197,39 +306,52 @@ func SetupRouter(db *gorm.DB, cfg *config.Config) *gin.Engine {
 			{
 				fileGroup.POST("/upload", fileController.UploadFile)
 				fileGroup.POST("/batch", fileController.GetBatchFileDetails)
-				fileGroup.GET("/:id", fileController.GetFileDetails)
-				fileGroup.GET("/download/:id", fileController.DownloadFile)
-				fileGroup.DELETE("/:id", fileController.DeleteFile)
-				fileGroup.GET("/order/:id", fileController.GetOrderFiles)
+				fileGroup.GET("/:id", policy.FileReader("id"), fileController.GetFileDetails)
+				fileGroup.GET("/download/:id", policy.FileReader("id"), fileController.DownloadFile)
+				fileGroup.DELETE("/:id", policy.FileWriter("id"), fileController.DeleteFile)
+				fileGroup.GET("/order/:id", policy.OrderViewer("id"), fileController.GetOrderFiles)
+
+				// 可续传的分片上传
+				fileGroup.POST("/uploads", fileController.InitiateUpload)
+				fileGroup.GET("/uploads/:uploadId", fileController.GetUploadStatus)
+				fileGroup.PUT("/uploads/:uploadId/chunks/:index", fileController.UploadChunk)
+				fileGroup.POST("/uploads/:uploadId/complete", fileController.CompleteUpload)
+				fileGroup.DELETE("/uploads/:uploadId", fileController.AbortUpload)
 			}
 
 			// 布料管理路由（需要认证）
 			fabricGroup := authRequiredGroup.Group("/fabrics")
 			{
-				fabricGroup.POST("", fabricController.CreateFabric)
-				fabricGroup.PUT("/:id", fabricController.UpdateFabric)
-				fabricGroup.DELETE("/:id", fabricController.DeleteFabric)
-				fabricGroup.PUT("/:id/stock", fabricController.UpdateFabricStock)
+				fabricGroup.POST("", policy.RequireRole(models.RoleDesigner, models.RoleSupplier), fabricController.CreateFabric)
+				fabricGroup.GET("/replenishment", fabricController.GetReplenishment)
+				fabricGroup.PUT("/:id", policy.FabricOwner("id"), fabricController.UpdateFabric)
+				fabricGroup.DELETE("/:id", policy.FabricOwner("id"), fabricController.DeleteFabric)
+				fabricGroup.PUT("/:id/stock", policy.FabricOwner("id"), fabricController.UpdateFabricStock)
+				fabricGroup.GET("/:id/ledger", policy.FabricOwner("id"), fabricController.GetFabricLedger)
+				fabricGroup.POST("/:id/ledger", policy.FabricOwner("id"), fabricController.RecordLedgerEntry)
 			}
 
 			// 接单管理路由（需要认证）
 			jiedanGroup := authRequiredGroup.Group("/jiedan")
 			{
-				jiedanGroup.POST("", jiedanController.CreateJiedan)
-				jiedanGroup.GET("/:id", jiedanController.GetJiedanByID)
-				jiedanGroup.PUT("/:id", jiedanController.UpdateJiedan)
-				jiedanGroup.DELETE("/:id", jiedanController.DeleteJiedan)
-				jiedanGroup.POST("/:id/accept", jiedanController.AcceptJiedan)
-				jiedanGroup.POST("/:id/reject", jiedanController.RejectJiedan)
+				jiedanGroup.POST("", policy.RequireRole(models.RoleFactory), jiedanController.CreateJiedan)
+				jiedanGroup.GET("/:id", policy.JiedanViewer("id"), jiedanController.GetJiedanByID)
+				jiedanGroup.PUT("/:id", policy.JiedanOwner("id"), jiedanController.UpdateJiedan)
+				jiedanGroup.DELETE("/:id", policy.JiedanOwner("id"), jiedanController.DeleteJiedan)
+				jiedanGroup.POST("/:id/accept", policy.JiedanDecider("id"), jiedanController.AcceptJiedan)
+				jiedanGroup.POST("/:id/reject", policy.JiedanDecider("id"), jiedanController.RejectJiedan)
+				jiedanGroup.GET("/:id/quotes", policy.JiedanParty("id"), jiedanController.GetJiedanQuotes)
+				jiedanGroup.POST("/:id/quotes", policy.JiedanParty("id"), jiedanController.ProposeQuote)
+				jiedanGroup.POST("/:id/quotes/:quoteId/accept", policy.JiedanParty("id"), jiedanController.AcceptQuote)
 			}
 
 			// 工厂接单相关路由
-			authRequiredGroup.GET("/factories/:factory_id/jiedans", jiedanController.GetJiedansByFactoryID)
-			authRequiredGroup.GET("/factories/:factory_id/jiedan-statistics", jiedanController.GetJiedanStatistics)
+			authRequiredGroup.GET("/factories/:factory_id/jiedans", policy.Self("factory_id"), jiedanController.GetJiedansByFactoryID)
+			authRequiredGroup.GET("/factories/:factory_id/jiedan-statistics", policy.Self("factory_id"), jiedanController.GetJiedanStatistics)
 			
 			// 工厂进度管理路由
-			authRequiredGroup.GET("/factories/:factory_id/progress", progressController.GetProgressByFactoryID)
-			authRequiredGroup.GET("/factories/:factory_id/progress-statistics", progressController.GetProgressStatistics)
+			authRequiredGroup.GET("/factories/:factory_id/progress", policy.Self("factory_id"), progressController.GetProgressByFactoryID)
+			authRequiredGroup.GET("/factories/:factory_id/progress-statistics", policy.Self("factory_id"), progressController.GetProgressStatistics)
 			
 			// 根据工厂ID获取工厂详情（需要认证）
 			authRequiredGroup.GET("/factory/:id", factoryController.GetFactoryByID)
@@ -252,6 +374,8 @@ func SetupRouter(db *gorm.DB, cfg *config.Config) *gin.Engine {
 			authRequiredGroup.POST("/factories/:factory_id/ratings", factorySearchController.CreateFactoryRating)
 			authRequiredGroup.GET("/factories/:factory_id/ratings", factorySearchController.GetFactoryRatings)
 			authRequiredGroup.GET("/factories/:factory_id/ratings/stats", factorySearchController.GetFactoryRatingStats)
+			authRequiredGroup.GET("/factories/:factory_id/quality-stats", qcInspectionController.GetFactoryQualityStats)
+			authRequiredGroup.GET("/qc/aql-plan", qcInspectionController.GetAQLPlan)
 			
 			// 设计师专业领域和评分管理路由（需要认证）
 			authRequiredGroup.POST("/designers/:designer_id/specialties", designerSearchController.CreateDesignerSpecialty)
@@ -261,7 +385,7 @@ func SetupRouter(db *gorm.DB, cfg *config.Config) *gin.Engine {
 			
 			// 职工管理路由（仅工厂角色）
 			employeeGroup := authRequiredGroup.Group("/employees")
-			employeeGroup.Use(middleware.FactoryRoleMiddleware())
+			employeeGroup.Use(policy.RequireRole(models.RoleFactory))
 			{
 				employeeGroup.POST("", employeeController.CreateEmployee)
 				employeeGroup.GET("", employeeController.GetEmployees)
@@ -271,11 +395,40 @@ func SetupRouter(db *gorm.DB, cfg *config.Config) *gin.Engine {
 				employeeGroup.PUT("/:id", employeeController.UpdateEmployee)
 				employeeGroup.DELETE("/:id", employeeController.DeleteEmployee)
 			}
+
+			// 订单会话路由（仅会话双方）
+			threadGroup := authRequiredGroup.Group("/threads/:threadId")
+			threadGroup.Use(policy.ThreadParticipant("threadId"))
+			{
+				threadGroup.GET("", messageController.GetThread)
+				threadGroup.GET("/messages", messageController.ListMessages)
+				threadGroup.POST("/messages", messageController.PostMessage)
+				threadGroup.PUT("/read", messageController.MarkRead)
+			}
+
+			// 审计日志路由
+			authRequiredGroup.GET("/audit-events", auditController.ListAuditEvents)
+
+			// 实时推送路由（SSE）
+			authRequiredGroup.GET("/stream", realtimeController.StreamUser)
+
+			// 通知中心路由
+			notificationGroup := authRequiredGroup.Group("/notifications")
+			{
+				notificationGroup.GET("", notificationController.ListNotifications)
+				notificationGroup.GET("/unread-count", notificationController.GetUnreadCount)
+				notificationGroup.PUT("/read-all", notificationController.MarkAllRead)
+				notificationGroup.PUT("/mark", notificationController.MarkBatch)
+				notificationGroup.GET("/preferences", notificationController.GetPreferences)
+				notificationGroup.PUT("/preferences", notificationController.UpdatePreferences)
+				notificationGroup.PUT("/:id/read", notificationController.MarkRead)
+				notificationGroup.PUT("/:id/unread", notificationController.MarkUnread)
+			}
 		}
 	}
 
 	// 注册公开路由
-	RegisterPublicRoutes(r, db)
+	RegisterPublicRoutes(r, db, fileService, orderShareService)
 
-	return r
+	return r, background
 } 
\ No newline at end of file
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"gongChang/models"
+	"reflect"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// auditEntry 一次待记录的实体变更；Before 为 nil 表示创建，After 为 nil 表示删除
+type auditEntry struct {
+	EntityType string
+	EntityID   interface{}
+	Action     string
+	OrderID    *uint
+	OwnerID    string
+	Before     interface{}
+	After      interface{}
+}
+
+// 不参与差异比较的字段
+var auditIgnoredFields = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"deleted_at": true,
+	"password":   true,
+}
+
+// recordAudit 在调用方的事务内追加审计事件，与业务变更同时提交或回滚
+func recordAudit(tx *gorm.DB, actor models.Actor, entry auditEntry) error {
+	changes, err := auditDiff(entry.Before, entry.After)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.AuditEvent{
+		ActorID:    actor.UserID,
+		ActorRole:  string(actor.Role),
+		EntityType: entry.EntityType,
+		EntityID:   fmt.Sprint(entry.EntityID),
+		Action:     entry.Action,
+		OrderID:    entry.OrderID,
+		OwnerID:    entry.OwnerID,
+		Changes:    changes,
+		RequestID:  actor.RequestID,
+		IP:         actor.IP,
+	}).Error
+}
+
+// auditDiff 比较实体前后的 JSON 表示，只保留发生变化的字段
+func auditDiff(before, after interface{}) (datatypes.JSON, error) {
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := make(map[string]map[string]interface{})
+	for key, value := range afterFields {
+		if auditIgnoredFields[key] {
+			continue
+		}
+		old, existed := beforeFields[key]
+		if existed && reflect.DeepEqual(old, value) {
+			continue
+		}
+		if !existed && value == nil {
+			continue
+		}
+		diff[key] = map[string]interface{}{"before": old, "after": value}
+	}
+	for key, old := range beforeFields {
+		if auditIgnoredFields[key] || old == nil {
+			continue
+		}
+		if _, ok := afterFields[key]; !ok {
+			diff[key] = map[string]interface{}{"before": old, "after": nil}
+		}
+	}
+
+	data, err := json.Marshal(diff)
+	if err != nil {
+		return nil, err
+	}
+	return datatypes.JSON(data), nil
+}
+
+func auditFields(v interface{}) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return fields, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// AuditService 审计事件查询
+type AuditService struct {
+	db *gorm.DB
+}
+
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// ListEvents 按条件查询操作人可见的审计事件
+// 设计师可见自己订单上的全部事件以及归属自己的实体事件，其他角色只能查看归属自己的实体事件。
+func (s *AuditService) ListEvents(actor models.Actor, q *models.AuditEventQuery) ([]models.AuditEvent, int64, error) {
+	if actor.UserID == "" {
+		return nil, 0, forbidden("无权查看审计记录")
+	}
+
+	query := s.db.Model(&models.AuditEvent{})
+	if actor.IsDesigner() {
+		query = query.Where("owner_id = ? OR order_id IN (?)", actor.UserID,
+			s.db.Model(&models.Order{}).Select("id").Where("designer_id = ?", actor.UserID))
+	} else {
+		query = query.Where("owner_id = ?", actor.UserID)
+	}
+
+	if q.EntityType != "" {
+		query = query.Where("entity_type = ?", q.EntityType)
+	}
+	if q.EntityID != "" {
+		query = query.Where("entity_id = ?", q.EntityID)
+	}
+	if q.OrderID > 0 {
+		query = query.Where("order_id = ?", q.OrderID)
+	}
+	if q.Action != "" {
+		query = query.Where("action = ?", q.Action)
+	}
+	if q.ActorID != "" {
+		query = query.Where("actor_id = ?", q.ActorID)
+	}
+	if q.From != nil {
+		query = query.Where("created_at >= ?", *q.From)
+	}
+	if q.To != nil {
+		query = query.Where("created_at <= ?", *q.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.PageSize <= 0 || q.PageSize > 100 {
+		q.PageSize = 20
+	}
+
+	var events []models.AuditEvent
+	err := query.Order("id DESC").Offset((q.Page - 1) * q.PageSize).Limit(q.PageSize).Find(&events).Error
+	return events, total, err
+}
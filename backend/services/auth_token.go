@@ -0,0 +1,156 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"gongChang/models"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("刷新令牌无效")
+	ErrRefreshTokenExpired = errors.New("刷新令牌已过期")
+	ErrRefreshTokenRevoked = errors.New("刷新令牌已被吊销")
+	ErrRefreshTokenReused  = errors.New("刷新令牌被重复使用，该登录会话已全部失效")
+)
+
+// TokenService 刷新令牌的签发、轮换与吊销
+type TokenService struct {
+	db         *gorm.DB
+	refreshTTL time.Duration
+}
+
+func NewTokenService(db *gorm.DB, refreshTTL time.Duration) *TokenService {
+	return &TokenService{db: db, refreshTTL: refreshTTL}
+}
+
+// IssueRefreshToken 登录时签发新的刷新令牌，开启一个新的令牌家族
+func (s *TokenService) IssueRefreshToken(userID string, client models.TokenClient) (string, error) {
+	raw, _, err := s.createRefreshToken(s.db, userID, uuid.New().String(), client)
+	return raw, err
+}
+
+// RotateRefreshToken 使用刷新令牌换取新的刷新令牌，旧令牌立即失效（单次使用）
+// 已使用过的令牌再次出现视为泄露，整个令牌家族将被吊销。
+func (s *TokenService) RotateRefreshToken(raw string, client models.TokenClient) (string, *models.User, error) {
+	var (
+		newRaw string
+		user   models.User
+		reused bool
+	)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var token models.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashRefreshToken(raw)).First(&token).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRefreshTokenInvalid
+			}
+			return err
+		}
+
+		if token.RevokedAt != nil {
+			return ErrRefreshTokenRevoked
+		}
+		if token.UsedAt != nil {
+			// 在事务内吊销整个家族，事务提交后再向调用方报告重复使用
+			reused = true
+			log.Printf("Refresh token reuse detected: user=%s family=%s", token.UserID, token.FamilyID)
+			return revokeRefreshTokens(tx.Where("family_id = ?", token.FamilyID))
+		}
+		if time.Now().After(token.ExpiresAt) {
+			return ErrRefreshTokenExpired
+		}
+
+		if err := tx.First(&user, "id = ?", token.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRefreshTokenInvalid
+			}
+			return err
+		}
+
+		var next *models.RefreshToken
+		var err error
+		newRaw, next, err = s.createRefreshToken(tx, token.UserID, token.FamilyID, client)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		return tx.Model(&token).Updates(map[string]interface{}{
+			"used_at":        now,
+			"replaced_by_id": next.ID,
+		}).Error
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if reused {
+		return "", nil, ErrRefreshTokenReused
+	}
+	return newRaw, &user, nil
+}
+
+// RevokeRefreshToken 退出当前设备：吊销刷新令牌所属的整个家族
+func (s *TokenService) RevokeRefreshToken(raw string) error {
+	var token models.RefreshToken
+	if err := s.db.Where("token_hash = ?", hashRefreshToken(raw)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRefreshTokenInvalid
+		}
+		return err
+	}
+	return revokeRefreshTokens(s.db.Where("family_id = ?", token.FamilyID))
+}
+
+// RevokeAllForUser 退出所有设备：吊销用户全部刷新令牌
+func (s *TokenService) RevokeAllForUser(userID string) error {
+	return revokeRefreshTokens(s.db.Where("user_id = ?", userID))
+}
+
+func (s *TokenService) createRefreshToken(tx *gorm.DB, userID, familyID string, client models.TokenClient) (string, *models.RefreshToken, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+
+	token := &models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashRefreshToken(raw),
+		ExpiresAt: time.Now().Add(s.refreshTTL),
+		UserAgent: truncate(client.UserAgent, 255),
+		IP:        client.IP,
+	}
+	if err := tx.Create(token).Error; err != nil {
+		return "", nil, err
+	}
+	return raw, token, nil
+}
+
+// revokeRefreshTokens 吊销查询条件匹配的所有未吊销令牌
+func revokeRefreshTokens(scope *gorm.DB) error {
+	return scope.Model(&models.RefreshToken{}).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", time.Now()).Error
+}
+
+func hashRefreshToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max]
+}
@@ -8,13 +8,37 @@ import (
 )
 
 type EmployeeService struct {
-	db *gorm.DB
+	db    *gorm.DB
+	actor models.Actor
 }
 
 func NewEmployeeService(db *gorm.DB) *EmployeeService {
 	return &EmployeeService{db: db}
 }
 
+// WithActor 返回绑定操作人的服务副本，写操作将以该操作人记录审计事件
+func (s *EmployeeService) WithActor(actor models.Actor) *EmployeeService {
+	c := *s
+	c.actor = actor
+	return &c
+}
+
+// auditEmployee 记录职工变更的审计事件
+func (s *EmployeeService) auditEmployee(tx *gorm.DB, action string, before, after *models.FactoryEmployee) error {
+	target := after
+	if target == nil {
+		target = before
+	}
+	return recordAudit(tx, s.actor, auditEntry{
+		EntityType: models.AuditEntityEmployee,
+		EntityID:   target.ID,
+		Action:     action,
+		OwnerID:    target.FactoryID,
+		Before:     before,
+		After:      after,
+	})
+}
+
 // CreateEmployee 创建职工
 func (s *EmployeeService) CreateEmployee(factoryID string, req *models.CreateEmployeeRequest) (*models.FactoryEmployee, error) {
 	// 验证工厂是否存在
@@ -41,7 +65,13 @@ func (s *EmployeeService) CreateEmployee(factoryID string, req *models.CreateEmp
 		employee.Status = models.EmployeeStatusActive
 	}
 
-	if err := s.db.Create(employee).Error; err != nil {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(employee).Error; err != nil {
+			return err
+		}
+		return s.auditEmployee(tx, models.AuditActionCreate, nil, employee)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -158,7 +188,14 @@ func (s *EmployeeService) UpdateEmployee(factoryID string, employeeID uint, req
 
 	updates["updated_at"] = time.Now()
 
-	if err := s.db.Model(employee).Updates(updates).Error; err != nil {
+	before := *employee
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(employee).Updates(updates).Error; err != nil {
+			return err
+		}
+		return s.auditEmployee(tx, models.AuditActionUpdate, &before, employee)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -173,7 +210,12 @@ func (s *EmployeeService) DeleteEmployee(factoryID string, employeeID uint) erro
 		return err
 	}
 
-	return s.db.Delete(employee).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(employee).Error; err != nil {
+			return err
+		}
+		return s.auditEmployee(tx, models.AuditActionDelete, employee, nil)
+	})
 }
 
 // GetEmployeeStatistics 获取职工统计
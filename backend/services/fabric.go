@@ -1,20 +1,57 @@
 package services
 
 import (
+	"errors"
 	"gongChang/models"
 	"gorm.io/gorm"
-	"errors"
+	"gorm.io/gorm/clause"
 	"log"
 )
 
 type FabricService struct {
-	db *gorm.DB
+	db    *gorm.DB
+	actor models.Actor
 }
 
 func NewFabricService(db *gorm.DB) *FabricService {
 	return &FabricService{db: db}
 }
 
+// WithActor 返回绑定操作人的服务副本，写操作将以该操作人记录审计事件
+func (s *FabricService) WithActor(actor models.Actor) *FabricService {
+	c := *s
+	c.actor = actor
+	return &c
+}
+
+// auditFabric 记录布料变更的审计事件，归属于布料的设计师、工厂或供应商
+func (s *FabricService) auditFabric(tx *gorm.DB, action string, before, after *models.Fabric) error {
+	target := after
+	if target == nil {
+		target = before
+	}
+	return recordAudit(tx, s.actor, auditEntry{
+		EntityType: models.AuditEntityFabric,
+		EntityID:   target.ID,
+		Action:     action,
+		OwnerID:    fabricOwnerID(target),
+		Before:     before,
+		After:      after,
+	})
+}
+
+func fabricOwnerID(fabric *models.Fabric) string {
+	switch {
+	case fabric.DesignerID != nil && *fabric.DesignerID != "":
+		return *fabric.DesignerID
+	case fabric.FactoryID != nil && *fabric.FactoryID != "":
+		return *fabric.FactoryID
+	case fabric.SupplierID != nil && *fabric.SupplierID != "":
+		return *fabric.SupplierID
+	}
+	return ""
+}
+
 // CreateFabric 创建布料
 func (s *FabricService) CreateFabric(req *models.FabricRequest) (*models.Fabric, error) {
 	log.Printf("CreateFabric service called with req.DesignerID=%s, req.SupplierID=%s, req.FactoryID=%s", req.DesignerID, req.SupplierID, req.FactoryID)
@@ -31,6 +68,8 @@ func (s *FabricService) CreateFabric(req *models.FabricRequest) (*models.Fabric,
 		Unit:         req.Unit,
 		Stock:        req.Stock,
 		MinOrder:     req.MinOrder,
+		ReorderPoint:    req.ReorderPoint,
+		ReorderQuantity: req.ReorderQuantity,
 		Description:  req.Description,
 		ImageURL:     req.ImageURL,
 		ThumbnailURL: req.ThumbnailURL,
@@ -58,7 +97,30 @@ func (s *FabricService) CreateFabric(req *models.FabricRequest) (*models.Fabric,
 
 	log.Printf("CreateFabric service: final fabric.DesignerID=%v, fabric.SupplierID=%v, fabric.FactoryID=%v", fabric.DesignerID, fabric.SupplierID, fabric.FactoryID)
 
-	if err := s.db.Create(fabric).Error; err != nil {
+	// 初始库存作为一条入库流水记录，布料先以 0 库存创建
+	initialStock := fabric.Stock
+	fabric.Stock = 0
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(fabric).Error; err != nil {
+			return err
+		}
+		if err := s.auditFabric(tx, models.AuditActionCreate, nil, fabric); err != nil {
+			return err
+		}
+		if initialStock > 0 {
+			entry, err := s.postLedger(tx, fabric.ID, models.FabricLedgerEntry{
+				Type:     models.FabricLedgerReceipt,
+				Quantity: initialStock,
+				Note:     "初始库存",
+			})
+			if err != nil {
+				return err
+			}
+			fabric.Stock = entry.StockAfter
+		}
+		return nil
+	})
+	if err != nil {
 		log.Printf("CreateFabric service: database error: %v", err)
 		return nil, err
 	}
@@ -82,6 +144,7 @@ func (s *FabricService) UpdateFabric(id uint, req *models.FabricUpdateRequest) (
 	if err != nil {
 		return nil, err
 	}
+	before := *fabric
 
 	// 更新字段
 	if req.Name != "" {
@@ -111,12 +174,15 @@ func (s *FabricService) UpdateFabric(id uint, req *models.FabricUpdateRequest) (
 	if req.Unit != "" {
 		fabric.Unit = req.Unit
 	}
-	if req.Stock >= 0 {
-		fabric.Stock = req.Stock
-	}
 	if req.MinOrder > 0 {
 		fabric.MinOrder = req.MinOrder
 	}
+	if req.ReorderPoint != nil {
+		fabric.ReorderPoint = *req.ReorderPoint
+	}
+	if req.ReorderQuantity != nil {
+		fabric.ReorderQuantity = *req.ReorderQuantity
+	}
 	if req.Description != "" {
 		fabric.Description = req.Description
 	}
@@ -142,7 +208,37 @@ func (s *FabricService) UpdateFabric(id uint, req *models.FabricUpdateRequest) (
 		fabric.FactoryID = &req.FactoryID
 	}
 
-	if err := s.db.Save(fabric).Error; err != nil {
+	// 库存只通过流水变更，保存时不覆盖并发写入的在库、预留数量和补货提醒状态
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("stock", "reserved", "low_stock_alerted_at").Save(fabric).Error; err != nil {
+			return err
+		}
+		if err := s.auditFabric(tx, models.AuditActionUpdate, &before, fabric); err != nil {
+			return err
+		}
+		if req.Stock == nil {
+			return nil
+		}
+		var current models.Fabric
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "stock").First(&current, id).Error; err != nil {
+			return err
+		}
+		if *req.Stock == current.Stock {
+			return nil
+		}
+		entry, err := s.postLedger(tx, id, models.FabricLedgerEntry{
+			Type:     models.FabricLedgerAdjustment,
+			Quantity: *req.Stock - current.Stock,
+			Note:     "编辑布料时修改库存",
+		})
+		if err != nil {
+			return err
+		}
+		fabric.Stock = entry.StockAfter
+		fabric.Reserved = entry.ReservedAfter
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -151,7 +247,19 @@ func (s *FabricService) UpdateFabric(id uint, req *models.FabricUpdateRequest) (
 
 // DeleteFabric 删除布料
 func (s *FabricService) DeleteFabric(id uint) error {
-	return s.db.Delete(&models.Fabric{}, id).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var fabric models.Fabric
+		if err := tx.First(&fabric, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrFabricNotFound
+			}
+			return err
+		}
+		if err := tx.Delete(&fabric).Error; err != nil {
+			return err
+		}
+		return s.auditFabric(tx, models.AuditActionDelete, &fabric, nil)
+	})
 }
 
 // SearchFabrics 搜索布料
@@ -190,9 +298,9 @@ func (s *FabricService) SearchFabrics(req *models.FabricSearchRequest) (*models.
 		query = query.Where("price <= ?", req.MaxPrice)
 	}
 
-	// 库存筛选
+	// 库存筛选，按可用数量（在库减去预留）
 	if req.MinStock > 0 {
-		query = query.Where("stock >= ?", req.MinStock)
+		query = query.Where("stock - reserved >= ?", req.MinStock)
 	}
 
 	// 状态筛选
@@ -243,7 +351,11 @@ func (s *FabricService) SearchFabrics(req *models.FabricSearchRequest) (*models.
 			Price:        fabric.Price,
 			Unit:         fabric.Unit,
 			Stock:        fabric.Stock,
+			Reserved:     fabric.Reserved,
+			Available:    fabric.Available(),
 			MinOrder:     fabric.MinOrder,
+			ReorderPoint:    fabric.ReorderPoint,
+			ReorderQuantity: fabric.ReorderQuantity,
 			Description:  fabric.Description,
 			ImageURL:     fabric.ImageURL,
 			ThumbnailURL: fabric.ThumbnailURL,
@@ -286,7 +398,11 @@ func (s *FabricService) GetAllFabrics() ([]models.FabricResponse, error) {
 			Price:        fabric.Price,
 			Unit:         fabric.Unit,
 			Stock:        fabric.Stock,
+			Reserved:     fabric.Reserved,
+			Available:    fabric.Available(),
 			MinOrder:     fabric.MinOrder,
+			ReorderPoint:    fabric.ReorderPoint,
+			ReorderQuantity: fabric.ReorderQuantity,
 			Description:  fabric.Description,
 			ImageURL:     fabric.ImageURL,
 			ThumbnailURL: fabric.ThumbnailURL,
@@ -336,19 +452,13 @@ func (s *FabricService) GetFabricsByMaterial(material string, page, pageSize int
 	return s.SearchFabrics(req)
 }
 
-// UpdateFabricStock 更新布料库存
+// UpdateFabricStock 按变化量调整布料在库数量，记录为一条盘点调整流水
 func (s *FabricService) UpdateFabricStock(id uint, quantity int) error {
-	fabric, err := s.GetFabricByID(id)
-	if err != nil {
-		return err
-	}
-
-	newStock := fabric.Stock + quantity
-	if newStock < 0 {
-		return errors.New("库存不足")
-	}
-
-	return s.db.Model(fabric).Update("stock", newStock).Error
+	_, err := s.RecordLedgerEntry(id, &models.FabricLedgerRequest{
+		Type:     models.FabricLedgerAdjustment,
+		Quantity: quantity,
+	})
+	return err
 }
 
 // GetFabricStatistics 获取布料统计信息
@@ -365,8 +475,10 @@ func (s *FabricService) GetFabricStatistics() (map[string]interface{}, error) {
 		return nil, err
 	}
 
-	// 库存不足的布料数量（库存小于10）
-	if err := s.db.Model(&models.Fabric{}).Where("stock < ?", 10).Count(&lowStockFabrics).Error; err != nil {
+	// 库存不足的布料数量：设置了再订货点的按再订货点判断，否则可用数量小于10
+	if err := s.db.Model(&models.Fabric{}).
+		Where("(reorder_point > 0 AND stock - reserved <= reorder_point) OR (reorder_point = 0 AND stock - reserved < ?)", 10).
+		Count(&lowStockFabrics).Error; err != nil {
 		return nil, err
 	}
 
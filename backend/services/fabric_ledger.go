@@ -0,0 +1,252 @@
+package services
+
+import (
+	"errors"
+	"gongChang/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrFabricNotFound            = errors.New("布料不存在")
+	ErrInsufficientStock         = errors.New("可用库存不足")
+	ErrFabricLedgerQuantity      = errors.New("数量必须大于 0")
+	ErrFabricLedgerOrderRequired = errors.New("预留和释放必须指定订单")
+	ErrFabricReservationExceeded = errors.New("释放数量超过订单的预留数量")
+	ErrFabricLedgerTypeInvalid   = errors.New("无效的库存流水类型")
+	ErrFabricStockBelowZero      = errors.New("调整后在库数量不能小于 0")
+)
+
+// postLedger 在事务内锁定布料行、校验数量并写入一条库存流水，同时更新布料的在库和预留数量
+// 对同一布料的并发操作在行锁上串行执行，不会超额预留。
+func (s *FabricService) postLedger(tx *gorm.DB, fabricID uint, entry models.FabricLedgerEntry) (*models.FabricLedgerEntry, error) {
+	var fabric models.Fabric
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&fabric, fabricID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFabricNotFound
+		}
+		return nil, err
+	}
+
+	if entry.Type != models.FabricLedgerAdjustment && entry.Quantity <= 0 {
+		return nil, ErrFabricLedgerQuantity
+	}
+	if entry.Type == models.FabricLedgerAdjustment && entry.Quantity == 0 {
+		return nil, ErrFabricLedgerQuantity
+	}
+	if entry.OrderID != nil {
+		var count int64
+		if err := tx.Model(&models.Order{}).Where("id = ?", *entry.OrderID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, ErrOrderNotFound
+		}
+	}
+
+	switch entry.Type {
+	case models.FabricLedgerReceipt:
+		entry.StockDelta = entry.Quantity
+	case models.FabricLedgerAdjustment:
+		if fabric.Stock+entry.Quantity < 0 {
+			return nil, ErrFabricStockBelowZero
+		}
+		entry.StockDelta = entry.Quantity
+	case models.FabricLedgerReservation:
+		if entry.OrderID == nil {
+			return nil, ErrFabricLedgerOrderRequired
+		}
+		if fabric.Available() < entry.Quantity {
+			return nil, ErrInsufficientStock
+		}
+		entry.ReservedDelta = entry.Quantity
+	case models.FabricLedgerRelease:
+		if entry.OrderID == nil {
+			return nil, ErrFabricLedgerOrderRequired
+		}
+		reserved, err := orderFabricReserved(tx, fabricID, *entry.OrderID)
+		if err != nil {
+			return nil, err
+		}
+		if reserved < entry.Quantity {
+			return nil, ErrFabricReservationExceeded
+		}
+		entry.ReservedDelta = -entry.Quantity
+	case models.FabricLedgerConsumption:
+		// 领用先扣减订单自己的预留，超出预留的部分占用可用库存
+		fromReserved := 0
+		if entry.OrderID != nil {
+			reserved, err := orderFabricReserved(tx, fabricID, *entry.OrderID)
+			if err != nil {
+				return nil, err
+			}
+			fromReserved = reserved
+			if fromReserved > entry.Quantity {
+				fromReserved = entry.Quantity
+			}
+		}
+		if entry.Quantity-fromReserved > fabric.Available() {
+			return nil, ErrInsufficientStock
+		}
+		entry.StockDelta = -entry.Quantity
+		entry.ReservedDelta = -fromReserved
+	default:
+		return nil, ErrFabricLedgerTypeInvalid
+	}
+
+	before := fabric
+	fabric.Stock += entry.StockDelta
+	fabric.Reserved += entry.ReservedDelta
+	entry.FabricID = fabricID
+	entry.StockAfter = fabric.Stock
+	entry.ReservedAfter = fabric.Reserved
+	entry.OperatorID = s.actor.UserID
+
+	if err := tx.Model(&fabric).UpdateColumns(map[string]interface{}{
+		"stock":    fabric.Stock,
+		"reserved": fabric.Reserved,
+	}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	if err := recordAudit(tx, s.actor, auditEntry{
+		EntityType: models.AuditEntityFabric,
+		EntityID:   fabric.ID,
+		Action:     models.AuditActionStockChange,
+		OrderID:    entry.OrderID,
+		OwnerID:    fabricOwnerID(&fabric),
+		Before:     map[string]interface{}{"stock": before.Stock, "reserved": before.Reserved},
+		After:      map[string]interface{}{"stock": fabric.Stock, "reserved": fabric.Reserved, "ledger_entry_id": entry.ID, "type": entry.Type},
+	}); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// orderFabricReserved 订单当前对布料的预留数量
+func orderFabricReserved(tx *gorm.DB, fabricID, orderID uint) (int, error) {
+	var reserved int
+	err := tx.Model(&models.FabricLedgerEntry{}).
+		Where("fabric_id = ? AND order_id = ?", fabricID, orderID).
+		Select("COALESCE(SUM(reserved_delta), 0)").Scan(&reserved).Error
+	return reserved, err
+}
+
+// RecordLedgerEntry 记录一条库存流水：入库、预留、释放、领用或盘点调整
+// 为订单预留或释放时操作人还必须是该订单的设计师，不能动别人订单的预留。
+func (s *FabricService) RecordLedgerEntry(fabricID uint, req *models.FabricLedgerRequest) (*models.FabricLedgerEntry, error) {
+	if req.OrderID != nil && (req.Type == models.FabricLedgerReservation || req.Type == models.FabricLedgerRelease) {
+		if err := NewPolicyService(s.db).CanManageOrder(s.actor, *req.OrderID); err != nil {
+			return nil, err
+		}
+	}
+	var entry *models.FabricLedgerEntry
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		entry, err = s.postLedger(tx, fabricID, models.FabricLedgerEntry{
+			OrderID:  req.OrderID,
+			Type:     req.Type,
+			Quantity: req.Quantity,
+			Note:     req.Note,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// ReserveForOrder 为订单预留布料
+func (s *FabricService) ReserveForOrder(tx *gorm.DB, fabricID, orderID uint, quantity int) (*models.FabricLedgerEntry, error) {
+	return s.postLedger(tx, fabricID, models.FabricLedgerEntry{
+		OrderID:  &orderID,
+		Type:     models.FabricLedgerReservation,
+		Quantity: quantity,
+	})
+}
+
+// ReleaseOrderReservations 释放订单对布料的全部预留，fabricID 为 0 时释放订单的所有布料
+func (s *FabricService) ReleaseOrderReservations(tx *gorm.DB, orderID, fabricID uint, note string) error {
+	var rows []struct {
+		FabricID uint
+		Reserved int
+	}
+	query := tx.Model(&models.FabricLedgerEntry{}).
+		Select("fabric_id, SUM(reserved_delta) AS reserved").
+		Where("order_id = ?", orderID)
+	if fabricID != 0 {
+		query = query.Where("fabric_id = ?", fabricID)
+	}
+	if err := query.Group("fabric_id").Having("SUM(reserved_delta) > 0").Order("fabric_id").Scan(&rows).Error; err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if _, err := s.postLedger(tx, row.FabricID, models.FabricLedgerEntry{
+			OrderID:  &orderID,
+			Type:     models.FabricLedgerRelease,
+			Quantity: row.Reserved,
+			Note:     note,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetFabricLedger 布料的库存流水，并按流水汇总核对布料上记录的库存
+func (s *FabricService) GetFabricLedger(fabricID uint, orderID *uint, limit int) (*models.FabricLedgerResponse, error) {
+	var fabric models.Fabric
+	if err := s.db.First(&fabric, fabricID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFabricNotFound
+		}
+		return nil, err
+	}
+
+	var totals struct {
+		Stock    int
+		Reserved int
+	}
+	if err := s.db.Model(&models.FabricLedgerEntry{}).Where("fabric_id = ?", fabricID).
+		Select("COALESCE(SUM(stock_delta), 0) AS stock, COALESCE(SUM(reserved_delta), 0) AS reserved").
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+
+	reservations := make([]models.FabricOrderReservation, 0)
+	if err := s.db.Model(&models.FabricLedgerEntry{}).
+		Select("order_id, SUM(reserved_delta) AS reserved").
+		Where("fabric_id = ? AND order_id IS NOT NULL", fabricID).
+		Group("order_id").Having("SUM(reserved_delta) <> 0").Order("order_id").
+		Scan(&reservations).Error; err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	entries := make([]models.FabricLedgerEntry, 0)
+	query := s.db.Where("fabric_id = ?", fabricID)
+	if orderID != nil {
+		query = query.Where("order_id = ?", *orderID)
+	}
+	if err := query.Order("id DESC").Limit(limit).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	return &models.FabricLedgerResponse{
+		FabricID:       fabric.ID,
+		Stock:          fabric.Stock,
+		Reserved:       fabric.Reserved,
+		Available:      fabric.Available(),
+		LedgerStock:    totals.Stock,
+		LedgerReserved: totals.Reserved,
+		Consistent:     totals.Stock == fabric.Stock && totals.Reserved == fabric.Reserved,
+		Reservations:   reservations,
+		Entries:        entries,
+	}, nil
+}
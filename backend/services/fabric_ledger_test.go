@@ -0,0 +1,162 @@
+package services
+
+import (
+	"errors"
+	"gongChang/models"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func newFabricLedgerTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return openTestDB(t,
+		&models.Order{},
+		&models.Fabric{},
+		&models.FabricLedgerEntry{},
+		&models.AuditEvent{},
+	)
+}
+
+func seedLedgerFabric(t *testing.T, db *gorm.DB, ownerID string, stock int) *models.Fabric {
+	t.Helper()
+	fabric := &models.Fabric{Name: "府绸", DesignerID: &ownerID}
+	if err := db.Create(fabric).Error; err != nil {
+		t.Fatalf("seed fabric: %v", err)
+	}
+	if stock > 0 {
+		owner := models.Actor{UserID: ownerID, Role: models.RoleDesigner}
+		if _, err := NewFabricService(db).WithActor(owner).RecordLedgerEntry(fabric.ID, &models.FabricLedgerRequest{
+			Type: models.FabricLedgerReceipt, Quantity: stock,
+		}); err != nil {
+			t.Fatalf("seed receipt: %v", err)
+		}
+	}
+	return fabric
+}
+
+func seedLedgerOrder(t *testing.T, db *gorm.DB, designerID string) *models.Order {
+	t.Helper()
+	order := &models.Order{Title: "衬衫", Quantity: 10, DesignerID: designerID, Status: models.OrderStatusDraft}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("seed order: %v", err)
+	}
+	return order
+}
+
+func reloadFabric(t *testing.T, db *gorm.DB, id uint) models.Fabric {
+	t.Helper()
+	var fabric models.Fabric
+	if err := db.First(&fabric, id).Error; err != nil {
+		t.Fatalf("reload fabric: %v", err)
+	}
+	return fabric
+}
+
+func TestFabricLedgerReservations(t *testing.T) {
+	db := newFabricLedgerTestDB(t)
+	fabric := seedLedgerFabric(t, db, testDesignerID, 100)
+	order := seedLedgerOrder(t, db, testDesignerID)
+	svc := NewFabricService(db).WithActor(testDesigner)
+
+	if _, err := svc.ReserveForOrder(db, fabric.ID, order.ID, 70); err != nil {
+		t.Fatalf("ReserveForOrder: %v", err)
+	}
+	other := seedLedgerOrder(t, db, testDesignerID)
+	if _, err := svc.ReserveForOrder(db, fabric.ID, other.ID, 31); !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("over-reservation = %v, want ErrInsufficientStock", err)
+	}
+	if got := reloadFabric(t, db, fabric.ID); got.Stock != 100 || got.Reserved != 70 || got.Available() != 30 {
+		t.Fatalf("after reservation stock %d reserved %d", got.Stock, got.Reserved)
+	}
+
+	cases := []struct {
+		name string
+		req  models.FabricLedgerRequest
+		want error
+	}{
+		{"release without order", models.FabricLedgerRequest{Type: models.FabricLedgerRelease, Quantity: 1}, ErrFabricLedgerOrderRequired},
+		{"release beyond reservation", models.FabricLedgerRequest{Type: models.FabricLedgerRelease, Quantity: 71, OrderID: &order.ID}, ErrFabricReservationExceeded},
+		{"adjustment below zero", models.FabricLedgerRequest{Type: models.FabricLedgerAdjustment, Quantity: -101}, ErrFabricStockBelowZero},
+		{"zero receipt", models.FabricLedgerRequest{Type: models.FabricLedgerReceipt}, ErrFabricLedgerQuantity},
+		{"consumption beyond available", models.FabricLedgerRequest{Type: models.FabricLedgerConsumption, Quantity: 31}, ErrInsufficientStock},
+	}
+	for _, tc := range cases {
+		req := tc.req
+		if _, err := svc.RecordLedgerEntry(fabric.ID, &req); !errors.Is(err, tc.want) {
+			t.Errorf("%s: RecordLedgerEntry = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	// 领用先扣减订单自己的预留，超出部分占用可用库存
+	if _, err := svc.RecordLedgerEntry(fabric.ID, &models.FabricLedgerRequest{
+		Type: models.FabricLedgerConsumption, Quantity: 80, OrderID: &order.ID,
+	}); err != nil {
+		t.Fatalf("consumption: %v", err)
+	}
+	if got := reloadFabric(t, db, fabric.ID); got.Stock != 20 || got.Reserved != 0 {
+		t.Fatalf("after consumption stock %d reserved %d, want 20/0", got.Stock, got.Reserved)
+	}
+
+	if _, err := svc.ReserveForOrder(db, fabric.ID, other.ID, 15); err != nil {
+		t.Fatalf("ReserveForOrder: %v", err)
+	}
+	if err := svc.ReleaseOrderReservations(db, other.ID, 0, "订单取消"); err != nil {
+		t.Fatalf("ReleaseOrderReservations: %v", err)
+	}
+
+	ledger, err := svc.GetFabricLedger(fabric.ID, nil, 0)
+	if err != nil {
+		t.Fatalf("GetFabricLedger: %v", err)
+	}
+	if !ledger.Consistent || ledger.Stock != 20 || ledger.Reserved != 0 || len(ledger.Reservations) != 0 || len(ledger.Entries) != 5 {
+		t.Fatalf("ledger = stock %d reserved %d consistent %v reservations %d entries %d",
+			ledger.Stock, ledger.Reserved, ledger.Consistent, len(ledger.Reservations), len(ledger.Entries))
+	}
+}
+
+func TestFabricLedgerOrderEntriesRequireOrderOwner(t *testing.T) {
+	db := newFabricLedgerTestDB(t)
+	const otherDesignerID = "designer-2"
+	otherDesigner := models.Actor{UserID: otherDesignerID, Role: models.RoleDesigner}
+	fabric := seedLedgerFabric(t, db, testDesignerID, 50)
+	otherFabric := seedLedgerFabric(t, db, otherDesignerID, 50)
+	order := seedLedgerOrder(t, db, testDesignerID)
+
+	if _, err := NewFabricService(db).WithActor(testDesigner).RecordLedgerEntry(fabric.ID, &models.FabricLedgerRequest{
+		Type: models.FabricLedgerReservation, Quantity: 20, OrderID: &order.ID,
+	}); err != nil {
+		t.Fatalf("owner reservation: %v", err)
+	}
+
+	// 另一位设计师即使拥有布料，也不能为别人的订单预留或释放
+	var forbiddenErr *ForbiddenError
+	for _, typ := range []models.FabricLedgerType{models.FabricLedgerReservation, models.FabricLedgerRelease} {
+		_, err := NewFabricService(db).WithActor(otherDesigner).RecordLedgerEntry(otherFabric.ID, &models.FabricLedgerRequest{
+			Type: typ, Quantity: 5, OrderID: &order.ID,
+		})
+		if !errors.As(err, &forbiddenErr) {
+			t.Errorf("%s on another designer's order = %v, want ForbiddenError", typ, err)
+		}
+	}
+	missing := uint(999)
+	if _, err := NewFabricService(db).WithActor(testDesigner).RecordLedgerEntry(fabric.ID, &models.FabricLedgerRequest{
+		Type: models.FabricLedgerRelease, Quantity: 5, OrderID: &missing,
+	}); !errors.Is(err, ErrResourceNotFound) {
+		t.Errorf("release on missing order = %v, want ErrResourceNotFound", err)
+	}
+	if got := reloadFabric(t, db, fabric.ID); got.Reserved != 20 {
+		t.Fatalf("reserved = %d, want 20", got.Reserved)
+	}
+
+	policy := NewPolicyService(db)
+	if err := policy.CanManageFabric(testDesigner, fabric.ID); err != nil {
+		t.Errorf("owner CanManageFabric = %v", err)
+	}
+	if err := policy.CanManageFabric(otherDesigner, fabric.ID); !errors.As(err, &forbiddenErr) {
+		t.Errorf("other CanManageFabric = %v, want ForbiddenError", err)
+	}
+	if err := policy.CanManageFabric(testDesigner, 999); !errors.Is(err, ErrResourceNotFound) {
+		t.Errorf("missing CanManageFabric = %v, want ErrResourceNotFound", err)
+	}
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gongChang/models"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// lowStockCondition 启用中、设置了再订货点且可用数量不高于再订货点的布料
+const lowStockCondition = "status = 1 AND reorder_point > 0 AND stock - reserved <= reorder_point"
+
+// DetectLowStock 检测可用数量降到再订货点及以下的布料并通知布料的设计师、供应商和工厂；返回本次提醒的数量
+// 每次降到再订货点以下只提醒一次，回到再订货点以上后重新计算。
+func (s *FabricService) DetectLowStock(now time.Time) (int, error) {
+	// 已补货或调高了可用数量的布料重新开始计算
+	if err := s.db.Model(&models.Fabric{}).
+		Where("low_stock_alerted_at IS NOT NULL AND (reorder_point = 0 OR stock - reserved > reorder_point)").
+		UpdateColumn("low_stock_alerted_at", nil).Error; err != nil {
+		return 0, err
+	}
+
+	var candidates []uint
+	if err := s.db.Model(&models.Fabric{}).
+		Where(lowStockCondition+" AND low_stock_alerted_at IS NULL").
+		Pluck("id", &candidates).Error; err != nil {
+		return 0, err
+	}
+
+	alerted := 0
+	for _, id := range candidates {
+		marked := false
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			var fabric models.Fabric
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&fabric, id).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil
+				}
+				return err
+			}
+			// 加锁后复核，期间可能已入库或释放了预留
+			if fabric.LowStockAlertedAt != nil || fabric.ReorderPoint <= 0 || fabric.Available() > fabric.ReorderPoint {
+				return nil
+			}
+			if err := tx.Model(&fabric).UpdateColumn("low_stock_alerted_at", now).Error; err != nil {
+				return err
+			}
+			marked = true
+
+			content := fmt.Sprintf("布料「%s」可用数量 %d%s 已不高于再订货点 %d%s", fabric.Name, fabric.Available(), fabric.Unit, fabric.ReorderPoint, fabric.Unit)
+			if fabric.ReorderQuantity > 0 {
+				content += fmt.Sprintf("，建议补货 %d%s", fabric.ReorderQuantity, fabric.Unit)
+			}
+			return notify(tx, models.SystemActor, notificationEvent{
+				Category:   models.NotificationFabricLowStock,
+				Title:      "布料库存不足，请及时补货",
+				Content:    content,
+				EntityType: models.AuditEntityFabric,
+				EntityID:   fabric.ID,
+			}, fabricOwners(&fabric)...)
+		})
+		if err != nil {
+			return alerted, err
+		}
+		if marked {
+			alerted++
+		}
+	}
+	return alerted, nil
+}
+
+// RunLowStockMonitor 定期执行低库存检测直到 ctx 结束
+func (s *FabricService) RunLowStockMonitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			count, err := s.DetectLowStock(time.Now())
+			if err != nil {
+				log.Printf("Fabric low stock detection failed: %v", err)
+			} else if count > 0 {
+				log.Printf("Fabric low stock detection alerted %d fabrics", count)
+			}
+		}
+	}
+}
+
+// fabricOwners 布料的设计师、供应商和工厂
+func fabricOwners(fabric *models.Fabric) []string {
+	owners := make([]string, 0, 3)
+	for _, id := range []*string{fabric.DesignerID, fabric.SupplierID, fabric.FactoryID} {
+		if id != nil && *id != "" {
+			owners = append(owners, *id)
+		}
+	}
+	return owners
+}
+
+// ListReplenishment 用户名下需要补货的布料，按缺口从大到小排列，并给出未完成订单的预留数量
+func (s *FabricService) ListReplenishment(ownerID string) ([]models.FabricReplenishment, error) {
+	var fabrics []models.Fabric
+	if err := s.db.Where(lowStockCondition).
+		Where("(designer_id = ? OR supplier_id = ? OR factory_id = ?)", ownerID, ownerID, ownerID).
+		Order("reorder_point - (stock - reserved) DESC, id").
+		Find(&fabrics).Error; err != nil {
+		return nil, err
+	}
+	result := make([]models.FabricReplenishment, 0, len(fabrics))
+	if len(fabrics) == 0 {
+		return result, nil
+	}
+
+	ids := make([]uint, len(fabrics))
+	for i, fabric := range fabrics {
+		ids[i] = fabric.ID
+	}
+	var rows []struct {
+		FabricID uint
+		Reserved int
+	}
+	if err := s.db.Table("fabric_ledger_entries AS e").
+		Select("e.fabric_id, COALESCE(SUM(e.reserved_delta), 0) AS reserved").
+		Joins("JOIN orders o ON o.id = e.order_id AND o.deleted_at IS NULL").
+		Where("e.fabric_id IN ? AND o.status NOT IN ?", ids, []models.OrderStatus{models.OrderStatusCompleted, models.OrderStatusCancelled}).
+		Group("e.fabric_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	openReserved := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		openReserved[row.FabricID] = row.Reserved
+	}
+
+	for _, fabric := range fabrics {
+		// 缺口为回到再订货点以上所需的数量
+		shortfall := fabric.ReorderPoint - fabric.Available() + 1
+		suggested := fabric.ReorderQuantity
+		if suggested < shortfall {
+			suggested = shortfall
+		}
+		result = append(result, models.FabricReplenishment{
+			FabricID:          fabric.ID,
+			Name:              fabric.Name,
+			Color:             fabric.Color,
+			Unit:              fabric.Unit,
+			Stock:             fabric.Stock,
+			Reserved:          fabric.Reserved,
+			OpenOrderReserved: openReserved[fabric.ID],
+			Available:         fabric.Available(),
+			ReorderPoint:      fabric.ReorderPoint,
+			ReorderQuantity:   fabric.ReorderQuantity,
+			Shortfall:         shortfall,
+			SuggestedQuantity: suggested,
+			LowStockAlertedAt: fabric.LowStockAlertedAt,
+			DesignerID:        fabric.DesignerID,
+			SupplierID:        fabric.SupplierID,
+			FactoryID:         fabric.FactoryID,
+		})
+	}
+	return result, nil
+}
@@ -1,7 +1,12 @@
 package services
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"gongChang/models"
+	"gongChang/storage"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"io"
@@ -10,6 +15,7 @@ import (
 	"path/filepath"
 	"fmt"
 	"strings"
+	"time"
 	"mime"
 	"mime/multipart"
 	"encoding/json"
@@ -35,25 +41,61 @@ var SupportedFileTypes = map[string][]string{
 	},
 }
 
+// 头像存放的对象键前缀
+const avatarKeyPrefix = "avatars/"
+
+var (
+	// ErrFileNotPublic 文件不允许通过公开地址访问
+	ErrFileNotPublic = errors.New("文件不允许公开访问")
+	// ErrUnsupportedFileType 扩展名与文件类型不匹配
+	ErrUnsupportedFileType = errors.New("不支持的文件类型")
+)
+
+// FileService 文件服务，文件内容保存在存储后端，File.Path 为对象键
 type FileService struct {
-	db         *gorm.DB
-	uploadPath string
+	db     *gorm.DB
+	store  storage.Storage
+	urlTTL time.Duration
+	actor  models.Actor
 }
 
-func NewFileService(db *gorm.DB, uploadPath string) *FileService {
-	// 确保上传目录存在
-	if err := os.MkdirAll(uploadPath, 0755); err != nil {
-		log.Printf("Failed to create upload directory: %v", err)
-		panic(err)
-	}
-	log.Printf("File service initialized with upload path: %s", uploadPath)
+func NewFileService(db *gorm.DB, store storage.Storage, urlTTL time.Duration) *FileService {
 	return &FileService{
-		db:         db,
-		uploadPath: uploadPath,
+		db:     db,
+		store:  store,
+		urlTTL: urlTTL,
 	}
 }
 
-func (s *FileService) SaveFile(file io.Reader, filename string, orderID *uint, fileType string) (*models.File, error) {
+// WithActor 返回绑定操作人的服务副本，写操作将以该操作人记录审计事件
+func (s *FileService) WithActor(actor models.Actor) *FileService {
+	c := *s
+	c.actor = actor
+	return &c
+}
+
+// auditFile 记录文件变更的审计事件，归属于上传人或所属工厂
+func (s *FileService) auditFile(tx *gorm.DB, action string, before, after *models.File) error {
+	target := after
+	if target == nil {
+		target = before
+	}
+	ownerID := target.UploaderID
+	if ownerID == "" {
+		ownerID = target.FactoryID
+	}
+	return recordAudit(tx, s.actor, auditEntry{
+		EntityType: models.AuditEntityFile,
+		EntityID:   target.ID,
+		Action:     action,
+		OrderID:    target.OrderID,
+		OwnerID:    ownerID,
+		Before:     before,
+		After:      after,
+	})
+}
+
+func (s *FileService) SaveFile(file io.Reader, filename string, orderID *uint, fileType string, uploaderID string) (*models.File, error) {
 	log.Printf("Starting SaveFile process for file: %s, type: %s", filename, fileType)
 	if orderID != nil {
 		log.Printf("OrderID provided: %d", *orderID)
@@ -61,6 +103,44 @@ func (s *FileService) SaveFile(file io.Reader, filename string, orderID *uint, f
 		log.Printf("No OrderID provided")
 	}
 
+	finalExt, err := resolveUploadExt(filename, fileType)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先写入本地临时文件，校验通过后再写入存储后端
+	dst, err := os.CreateTemp("", "upload_*"+finalExt)
+	if err != nil {
+		log.Printf("Failed to create temporary file: %v", err)
+		return nil, err
+	}
+	tempFile := dst.Name()
+	defer func() {
+		dst.Close()
+		os.Remove(tempFile) // 清理临时文件
+	}()
+	log.Printf("Created temporary file: %s", tempFile)
+
+	// 复制文件内容并检查大小，同时计算内容哈希
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(dst, hash), file)
+	if err != nil {
+		log.Printf("Failed to copy file content: %v", err)
+		return nil, err
+	}
+	log.Printf("File content copied, size: %d bytes", written)
+
+	// 检查文件大小
+	if written > MaxFileSize {
+		log.Printf("File too large: %d bytes (max: %d bytes)", written, MaxFileSize)
+		return nil, fmt.Errorf("文件大小超过限制 (最大 %d MB)", MaxFileSize/1024/1024)
+	}
+
+	return s.storeFile(dst, written, hex.EncodeToString(hash.Sum(nil)), finalExt, filename, orderID, fileType, uploaderID)
+}
+
+// resolveUploadExt 校验扩展名与文件类型是否匹配，返回保存时使用的扩展名
+func resolveUploadExt(filename, fileType string) (string, error) {
 	// 获取原始扩展名 - 保持原始大小写
 	originalExt := filepath.Ext(filename)
 	log.Printf("Original extension: %s", originalExt)
@@ -77,14 +157,11 @@ func (s *FileService) SaveFile(file io.Reader, filename string, orderID *uint, f
 				}
 			}
 			if !extSupported {
-				return nil, fmt.Errorf("不支持的文件类型: %s (支持的类型: %v)", lowerExt, supportedExts)
+				return "", fmt.Errorf("%w: %s (支持的类型: %v)", ErrUnsupportedFileType, lowerExt, supportedExts)
 			}
 		}
 	}
 
-	// 生成唯一文件名
-	fileID := uuid.New().String()
-	
 	// 处理扩展名 - 保持客户端原始扩展名
 	var finalExt string
 	if originalExt == "" {
@@ -108,68 +185,40 @@ func (s *FileService) SaveFile(file io.Reader, filename string, orderID *uint, f
 		log.Printf("Using original extension from client: %s", finalExt)
 	}
 	
-	newFilename := fileID + finalExt
-	log.Printf("Generated new filename: %s", newFilename)
-
-	// 确保上传目录存在
-	if err := os.MkdirAll(s.uploadPath, 0755); err != nil {
-		log.Printf("Failed to create upload directory: %v", err)
-		return nil, err
-	}
-	log.Printf("Upload directory verified: %s", s.uploadPath)
-
-	// 创建临时文件
-	tempFile := filepath.Join(s.uploadPath, "temp_"+newFilename)
-	dst, err := os.Create(tempFile)
-	if err != nil {
-		log.Printf("Failed to create temporary file: %v", err)
-		return nil, err
-	}
-	defer func() {
-		dst.Close()
-		os.Remove(tempFile) // 清理临时文件
-	}()
-	log.Printf("Created temporary file: %s", tempFile)
-
-	// 复制文件内容并检查大小
-	written, err := io.Copy(dst, file)
-	if err != nil {
-		log.Printf("Failed to copy file content: %v", err)
-		return nil, err
-	}
-	log.Printf("File content copied, size: %d bytes", written)
+	return finalExt, nil
+}
 
-	// 检查文件大小
-	if written > MaxFileSize {
-		log.Printf("File too large: %d bytes (max: %d bytes)", written, MaxFileSize)
-		return nil, fmt.Errorf("文件大小超过限制 (最大 %d MB)", MaxFileSize/1024/1024)
-	}
+// storeFile 校验本地临时文件内容后创建文件记录，内容按哈希去重后写入存储后端
+func (s *FileService) storeFile(dst *os.File, written int64, contentHash, finalExt, filename string, orderID *uint, fileType string, uploaderID string) (*models.File, error) {
+	fileID := uuid.New().String()
 
 	// 验证文件内容（可选：检查文件头）
-	if err := s.validateFileContent(tempFile, fileType, finalExt); err != nil {
+	if err := s.validateFileContent(dst.Name(), fileType, finalExt); err != nil {
 		log.Printf("File content validation failed: %v", err)
 		return nil, err
 	}
 
-	// 重命名临时文件为最终文件
-	finalPath := filepath.Join(s.uploadPath, newFilename)
-	if err := os.Rename(tempFile, finalPath); err != nil {
-		log.Printf("Failed to rename temporary file: %v", err)
+	if _, err := dst.Seek(0, io.SeekStart); err != nil {
 		return nil, err
 	}
-	log.Printf("File renamed to final path: %s", finalPath)
 
-	// 创建文件记录
+	// 创建文件记录，Path 在引用 blob 后设置为 blob 的对象键
 	fileRecord := &models.File{
-		ID:      fileID,
-		Name:    filename,
-		Path:    newFilename,  // 确保包含扩展名
-		OrderID: orderID,
+		ID:         fileID,
+		Name:       filename,
+		Type:       fileType,
+		OrderID:    orderID,
+		UploaderID: uploaderID,
+		Size:       written,
+		BlobHash:   contentHash,
+	}
+	if s.actor.ShareTokenID != 0 {
+		tokenID := s.actor.ShareTokenID
+		fileRecord.ShareTokenID = &tokenID
 	}
-	log.Printf("Created file record: %+v", fileRecord)
 
 	// 使用事务来确保数据一致性
-	err = s.db.Transaction(func(tx *gorm.DB) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
 		// 如果提供了订单ID，检查订单是否存在
 		if orderID != nil {
 			var count int64
@@ -184,24 +233,50 @@ func (s *FileService) SaveFile(file io.Reader, filename string, orderID *uint, f
 			log.Printf("Order exists: %d", *orderID)
 		}
 
+		// 相同内容只存储一份
+		blob, err := s.acquireBlob(tx, contentHash, dst, written, mime.TypeByExtension(strings.ToLower(finalExt)))
+		if err != nil {
+			log.Printf("Failed to store file content %s: %v", contentHash, err)
+			return fmt.Errorf("保存文件失败: %w", err)
+		}
+		fileRecord.Path = blob.Key
+		if blob.RefCount > 1 {
+			log.Printf("Reusing stored content %s (%d references)", contentHash, blob.RefCount)
+		}
+
 		// 创建文件记录
 		if err := tx.Create(fileRecord).Error; err != nil {
 			log.Printf("Failed to create file record: %v", err)
 			return err
 		}
-		log.Printf("File record created successfully")
+		log.Printf("File record created successfully: %+v", fileRecord)
 
+		if err := s.auditFile(tx, models.AuditActionCreate, nil, fileRecord); err != nil {
+			return err
+		}
+		if orderID != nil {
+			// 上传到订单的文件同时加入订单的文件列表
+			role := orderFileRoleFor(fileType, filename)
+			if _, err := NewOrderService(tx).WithActor(s.actor).AttachOrderFile(*orderID, fileRecord.ID, role, ""); err != nil {
+				return err
+			}
+			return publishOrderEvent(tx, *orderID, models.RealtimeFileAttached, models.OrderAccessViewer, map[string]interface{}{
+				"file_id":  fileRecord.ID,
+				"order_id": *orderID,
+				"name":     fileRecord.Name,
+				"type":     fileRecord.Type,
+			})
+		}
 		return nil
 	})
 
 	if err != nil {
 		log.Printf("Transaction failed: %v", err)
-		// 如果数据库操作失败，删除已上传的文件
-		os.Remove(finalPath)
 		return nil, err
 	}
 
-	log.Printf("File saved successfully: %s (%d bytes)", newFilename, written)
+	log.Printf("File saved successfully: %s (%d bytes)", fileRecord.Path, written)
+	fileRecord.Derivatives = s.generateDerivativesAfterUpload(fileRecord)
 	if orderID != nil {
 		log.Printf("Associated with order: %d", *orderID)
 	} else {
@@ -210,10 +285,65 @@ func (s *FileService) SaveFile(file io.Reader, filename string, orderID *uint, f
 	return fileRecord, nil
 }
 
+// GetOrderFiles 订单关联的全部文件，按用途和排序返回，同一文件只出现一次
 func (s *FileService) GetOrderFiles(orderID uint) ([]models.File, error) {
-	var files []models.File
-	err := s.db.Where("orderID = ?", orderID).Find(&files).Error
-	return files, err
+	order := models.Order{ID: orderID}
+	if err := LoadOrderFiles(s.db, &order); err != nil {
+		return nil, err
+	}
+	return order.Files, nil
+}
+
+// SharedOrderFiles 分享令牌可见的订单文件，role 为空时返回全部用途；URL 和图片缩略图地址均为限时签名地址
+func (s *FileService) SharedOrderFiles(orderID uint, role models.OrderFileRole) ([]models.SharedFile, error) {
+	order := models.Order{ID: orderID}
+	if err := LoadOrderFiles(s.db, &order); err != nil {
+		return nil, err
+	}
+	files := make(map[string]*models.File, len(order.Files))
+	for i := range order.Files {
+		files[order.Files[i].ID] = &order.Files[i]
+	}
+
+	shared := make([]models.SharedFile, 0, len(order.OrderFiles))
+	for _, link := range order.OrderFiles {
+		if role != "" && link.Role != role {
+			continue
+		}
+		file := files[link.FileID]
+		if file == nil {
+			continue
+		}
+		url, err := s.GetDownloadURL(file, false)
+		if err != nil {
+			return nil, err
+		}
+		item := models.SharedFile{
+			ID:        file.ID,
+			Name:      file.Name,
+			Role:      link.Role,
+			Caption:   link.Caption,
+			Size:      file.Size,
+			URL:       url,
+			CreatedAt: file.CreatedAt,
+		}
+		if IsRasterFile(file) {
+			if derivative, err := s.GetDerivative(file.ID, models.DerivativeThumbnail); err != nil {
+				log.Printf("Failed to prepare thumbnail for file %s: %v", file.ID, err)
+			} else if item.ThumbnailURL, err = s.GetDerivativeURL(derivative); err != nil {
+				return nil, err
+			}
+		}
+		shared = append(shared, item)
+	}
+	return shared, nil
+}
+
+// OrderHasFile 文件是否属于订单，用于分享令牌访问单个文件前的校验
+func (s *FileService) OrderHasFile(orderID uint, fileID string) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.OrderFile{}).Where("order_id = ? AND file_id = ?", orderID, fileID).Count(&count).Error
+	return count > 0, err
 }
 
 func (s *FileService) GetFileByID(fileID string) (*models.File, error) {
@@ -228,37 +358,134 @@ func (s *FileService) DeleteFile(fileID string) error {
 		return err
 	}
 
-	// 删除物理文件
-	if err := os.Remove(filepath.Join(s.uploadPath, file.Path)); err != nil && !os.IsNotExist(err) {
+	// 其他订单仍在引用时不允许删除，避免订单中出现失效的文件ID
+	orderIDs, err := ordersReferencingFile(s.db, file.ID)
+	if err != nil {
 		return err
 	}
+	for _, orderID := range orderIDs {
+		if file.OrderID == nil || orderID != *file.OrderID {
+			return ErrFileInUse
+		}
+	}
 
-	// 删除数据库记录
-	return s.db.Delete(&file).Error
+	// 删除数据库记录和存储中的文件
+	return s.deleteFileRecord(&file)
 }
 
-func (s *FileService) GetFilePath(fileID string) (string, error) {
-	var file models.File
-	if err := s.db.First(&file, "id = ?", fileID).Error; err != nil {
-		log.Printf("Failed to find file with ID %s: %v", fileID, err)
-		return "", err
+// deleteFileRecord 删除文件记录及其衍生图片，并记录审计事件
+// 文件内容的 blob 只在没有其他文件引用时删除；去重之前上传的文件直接删除存储对象。
+func (s *FileService) deleteFileRecord(file *models.File) error {
+	var derivatives []models.FileDerivative
+	unreferenced := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_id = ?", file.ID).Find(&derivatives).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("file_id = ?", file.ID).Delete(&models.FileDerivative{}).Error; err != nil {
+			return err
+		}
+		if err := s.detachFromOrders(tx, file.ID); err != nil {
+			return err
+		}
+		if err := tx.Delete(file).Error; err != nil {
+			return err
+		}
+		if err := s.auditFile(tx, models.AuditActionDelete, file, nil); err != nil {
+			return err
+		}
+		if file.BlobHash != "" {
+			var err error
+			unreferenced, err = s.releaseBlob(tx, file.BlobHash)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if unreferenced {
+		if err := s.purgeBlob(file.BlobHash); err != nil {
+			log.Printf("Failed to remove content %s: %v", file.BlobHash, err)
+		}
 	}
+	if file.BlobHash == "" {
+		if err := s.store.Delete(context.Background(), file.Path); err != nil {
+			log.Printf("Failed to remove file %s: %v", file.Path, err)
+		}
+	}
+	s.removeDerivativeFiles(derivatives)
+	return nil
+}
 
-	// 确保文件路径是绝对路径
-	filePath := filepath.Join(s.uploadPath, file.Path)
-	absPath, err := filepath.Abs(filePath)
+// detachFromOrders 从关联了该文件的订单中移除文件，并记录订单变更
+func (s *FileService) detachFromOrders(tx *gorm.DB, fileID string) error {
+	orderIDs, err := ordersReferencingFile(tx, fileID)
 	if err != nil {
-		log.Printf("Failed to get absolute path for %s: %v", filePath, err)
-		return "", err
+		return err
 	}
+	orderService := NewOrderService(tx).WithActor(s.actor)
+	for _, orderID := range orderIDs {
+		before, err := lockOrderWithFiles(tx, orderID)
+		if err != nil && !errors.Is(err, ErrResourceNotFound) {
+			return err
+		}
+		if err := tx.Where("order_id = ? AND file_id = ?", orderID, fileID).Delete(&models.OrderFile{}).Error; err != nil {
+			return err
+		}
+		if before != nil {
+			if _, err := orderService.auditOrderFiles(tx, before); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
-	// 验证文件路径是否在上传目录内
-	if !strings.HasPrefix(absPath, s.uploadPath) {
-		log.Printf("Invalid file path: %s (outside upload directory)", absPath)
-		return "", fmt.Errorf("invalid file path")
+// GetDownloadURL 生成文件原图的签名下载地址，有效期由存储配置决定
+func (s *FileService) GetDownloadURL(file *models.File, attachment bool) (string, error) {
+	return s.store.PresignGet(context.Background(), file.Path, s.urlTTL, storage.PresignOptions{
+		Filename:    file.Name,
+		ContentType: mime.TypeByExtension(strings.ToLower(filepath.Ext(file.Name))),
+		Attachment:  attachment,
+	})
+}
+
+// PresignKey 为存储中的任意对象键生成签名下载地址
+func (s *FileService) PresignKey(key string) (string, error) {
+	return s.store.PresignGet(context.Background(), key, s.urlTTL, storage.PresignOptions{})
+}
+
+// PublicURL 将 /uploads/<key> 形式的旧地址转换为签名地址
+// 只有头像、工厂展示图片及其衍生图片允许公开访问，订单文件必须经过鉴权下载。
+func (s *FileService) PublicURL(key string) (string, error) {
+	key, err := storage.CleanKey(key)
+	if err != nil {
+		return "", ErrFileNotPublic
 	}
+	if !strings.HasPrefix(key, avatarKeyPrefix) {
+		var count int64
+		err := s.db.Model(&models.File{}).
+			Where("factory_id <> '' AND (path = ? OR id IN (?))", key,
+				s.db.Model(&models.FileDerivative{}).Select("file_id").Where("path = ?", key)).
+			Count(&count).Error
+		if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return "", ErrFileNotPublic
+		}
+	}
+	return s.PresignKey(key)
+}
 
-	return absPath, nil
+// SaveAvatar 保存头像图片，返回可长期使用的访问地址
+func (s *FileService) SaveAvatar(r io.Reader, size int64, ext string) (string, error) {
+	key := avatarKeyPrefix + uuid.New().String() + ext
+	if err := s.store.Put(context.Background(), key, r, size, mime.TypeByExtension(ext)); err != nil {
+		return "", err
+	}
+	return "/uploads/" + key, nil
 }
 
 // GetFilesByIDs 批量获取文件信息
@@ -351,55 +578,51 @@ func (s *FileService) processFactoryPhoto(fileHeader *multipart.FileHeader, fact
 		return nil, fmt.Errorf("不支持的文件格式: %s (支持: JPG, PNG, WebP)", ext)
 	}
 
-	// 生成唯一文件名
-	fileID := uuid.New().String()
-	newFilename := fileID + ext
-
-	// 保存文件
-	finalPath := filepath.Join(s.uploadPath, newFilename)
-	dst, err := os.Create(finalPath)
-	if err != nil {
-		return nil, fmt.Errorf("创建文件失败: %v", err)
-	}
-	defer dst.Close()
-
-	// 复制文件内容
-	written, err := io.Copy(dst, file)
+	// 计算内容哈希，相同图片只存储一份
+	contentHash, err := hashContent(file)
 	if err != nil {
-		os.Remove(finalPath) // 清理失败的文件
-		return nil, fmt.Errorf("保存文件失败: %v", err)
+		return nil, fmt.Errorf("读取文件失败: %v", err)
 	}
 
-	// 创建文件记录
+	fileID := uuid.New().String()
+	written := fileHeader.Size
 	fileRecord := &models.File{
 		ID:        fileID,
 		Name:      fileHeader.Filename,
-		Path:      newFilename,
 		Type:      "image",
 		FactoryID: factoryID,
 		Category:  category,
 		Size:      written,
+		BlobHash:  contentHash,
 	}
 
-	// 保存到数据库
-	if err := s.db.Create(fileRecord).Error; err != nil {
-		os.Remove(finalPath) // 清理失败的文件
-		return nil, fmt.Errorf("保存文件记录失败: %v", err)
+	// 保存文件和记录
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		blob, err := s.acquireBlob(tx, contentHash, file, written, mime.TypeByExtension(ext))
+		if err != nil {
+			return err
+		}
+		fileRecord.Path = blob.Key
+		if err := tx.Create(fileRecord).Error; err != nil {
+			return err
+		}
+		return s.auditFile(tx, models.AuditActionCreate, nil, fileRecord)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("保存文件失败: %v", err)
 	}
 
-	// 生成缩略图（可选）
+	// 生成缩略图等衍生图片
 	thumbnailURL := ""
-	if written > 1024*1024 { // 大于1MB的图片生成缩略图
-		thumbnailPath, err := s.generateThumbnail(finalPath, fileID)
-		if err == nil {
-			thumbnailURL = "/uploads/thumbnails/" + filepath.Base(thumbnailPath)
-		}
+	fileRecord.Derivatives = s.generateDerivativesAfterUpload(fileRecord)
+	if len(fileRecord.Derivatives) > 0 {
+		thumbnailURL = s.thumbnailURL(fileRecord)
 	}
 
 	return &models.FactoryPhotoInfo{
 		ID:           fileID,
 		Name:         fileHeader.Filename,
-		URL:          "/uploads/" + newFilename,
+		URL:          "/uploads/" + fileRecord.Path,
 		ThumbnailURL: thumbnailURL,
 		Category:     category,
 		Size:         written,
@@ -425,21 +648,17 @@ func (s *FileService) GetFactoryPhotos(factoryID string, category string, page,
 	// 分页查询
 	var files []models.File
 	offset := (page - 1) * pageSize
-	query.Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&files)
+	query.Preload("Derivatives").Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&files)
 
-	// 转换为响应格式
+	// 转换为响应格式，历史图片的缩略图在此时补生成
 	photos := make([]*models.FactoryPhotoInfo, 0, len(files))
-	for _, file := range files {
-		thumbnailURL := ""
-		if file.Size > 1024*1024 {
-			thumbnailURL = "/uploads/thumbnails/" + strings.TrimSuffix(file.Path, filepath.Ext(file.Path)) + "_thumb" + filepath.Ext(file.Path)
-		}
-
+	for i := range files {
+		file := &files[i]
 		photos = append(photos, &models.FactoryPhotoInfo{
 			ID:           file.ID,
 			Name:         file.Name,
 			URL:          "/uploads/" + file.Path,
-			ThumbnailURL: thumbnailURL,
+			ThumbnailURL: s.thumbnailURL(file),
 			Category:     file.Category,
 			Size:         file.Size,
 			FactoryID:    file.FactoryID,
@@ -472,18 +691,8 @@ func (s *FileService) DeleteFactoryPhoto(photoID string, factoryID string) error
 		return err
 	}
 
-	// 删除物理文件
-	filePath := filepath.Join(s.uploadPath, file.Path)
-	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
-		log.Printf("Failed to remove file %s: %v", filePath, err)
-	}
-
-	// 删除缩略图（如果存在）
-	thumbnailPath := filepath.Join(s.uploadPath, "thumbnails", strings.TrimSuffix(file.Path, filepath.Ext(file.Path))+"_thumb"+filepath.Ext(file.Path))
-	os.Remove(thumbnailPath)
-
-	// 删除数据库记录
-	return s.db.Delete(&file).Error
+	// 删除数据库记录、衍生图片及不再被引用的文件内容
+	return s.deleteFileRecord(&file)
 }
 
 // BatchDeleteFactoryPhotos 批量删除工厂图片
@@ -570,13 +779,6 @@ func (s *FileService) getPhotoCategories(factoryID string) ([]*models.PhotoCateg
 	return defaultCategories, nil
 }
 
-// generateThumbnail 生成缩略图
-func (s *FileService) generateThumbnail(imagePath, fileID string) (string, error) {
-	// 这里可以集成图片处理库（如imaging）来生成缩略图
-	// 目前返回原图路径
-	return imagePath, nil
-}
-
 // validateFileContent 验证文件内容
 func (s *FileService) validateFileContent(filePath, fileType, extension string) error {
 	// 读取文件头进行验证
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"gongChang/models"
+	"io"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 内容 blob 的对象键前缀
+const blobDir = "blobs"
+
+// ErrFileInUse 文件仍被其他订单引用
+var ErrFileInUse = errors.New("文件仍被其他订单引用，请先从这些订单中移除")
+
+// blobKey 按哈希前两位分目录，避免单个目录下对象过多
+func blobKey(hash string) string {
+	return blobDir + "/" + hash[:2] + "/" + hash
+}
+
+// hashContent 计算内容的 SHA-256 后将读取位置恢复到开头
+func hashContent(r io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// acquireBlob 在事务内为内容增加一次引用，内容尚未存储时写入存储后端
+// 已有的 blob 加行锁后再计数，与 purgeBlob 串行，不会引用到正在删除的对象；
+// 引用数为 0 的 blob 可能已删除了存储对象，重新写入一次。
+// 事务回滚时新写入的对象会成为孤立对象，由对账命令清理。
+func (s *FileService) acquireBlob(tx *gorm.DB, hash string, r io.Reader, size int64, mimeType string) (*models.FileBlob, error) {
+	var blob models.FileBlob
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&blob, "hash = ?", hash).Error
+	if err == nil {
+		if blob.RefCount <= 0 {
+			if err := s.store.Put(context.Background(), blob.Key, r, size, mimeType); err != nil {
+				return nil, err
+			}
+		}
+		if err := tx.Model(&blob).Update("ref_count", gorm.Expr("ref_count + 1")).Error; err != nil {
+			return nil, err
+		}
+		blob.RefCount++
+		return &blob, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	blob = models.FileBlob{
+		Hash:     hash,
+		Key:      blobKey(hash),
+		Size:     size,
+		MimeType: mimeType,
+		RefCount: 1,
+	}
+	if err := s.store.Put(context.Background(), blob.Key, r, size, mimeType); err != nil {
+		return nil, err
+	}
+	// 并发上传相同内容时另一方可能已插入记录，此时只增加引用数
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "hash"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"ref_count": gorm.Expr("ref_count + 1")}),
+	}).Create(&blob).Error; err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
+
+// releaseBlob 在事务内减少一次引用，返回引用是否归零
+// 引用归零的 blob 保留记录，由调用方在事务提交后调用 purgeBlob 删除存储对象，
+// 避免事务回滚时记录还在而对象已被删除。
+func (s *FileService) releaseBlob(tx *gorm.DB, hash string) (bool, error) {
+	var blob models.FileBlob
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&blob, "hash = ?", hash).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Model(&blob).Update("ref_count", gorm.Expr("ref_count - 1")).Error; err != nil {
+		return false, err
+	}
+	return blob.RefCount <= 1, nil
+}
+
+// purgeBlob 在行锁内确认 blob 仍没有引用后删除存储对象和记录
+// 对象删除失败时保留记录，由对账命令再次清理；同一内容被重新上传时 acquireBlob 会重新写入对象。
+func (s *FileService) purgeBlob(hash string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var blob models.FileBlob
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&blob, "hash = ?", hash).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if blob.RefCount > 0 {
+			return nil
+		}
+		if err := s.store.Delete(context.Background(), blob.Key); err != nil {
+			return err
+		}
+		return tx.Delete(&blob).Error
+	})
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"gongChang/models"
+	"gongChang/storage"
+	"gongChang/utils"
+	"image"
+	"image/jpeg"
+	"io"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 衍生图片的对象键前缀
+const derivativeDir = "derivatives"
+
+var (
+	ErrUnknownDerivative     = errors.New("未知的图片尺寸")
+	ErrDerivativeUnsupported = errors.New("该文件不是可处理的图片")
+)
+
+// imageDerivativeSpec 一种衍生图片的尺寸和格式
+type imageDerivativeSpec struct {
+	Variant string
+	MaxSize int
+	Format  string
+}
+
+// imageDerivativeSpecs 上传图片时生成的全部衍生版本
+// WebP 使用纯 Go 无损编码，体积大于有损编码，因此与中图同尺寸，供支持 WebP 的客户端按需选择。
+var imageDerivativeSpecs = []imageDerivativeSpec{
+	{Variant: models.DerivativeThumbnail, MaxSize: 320, Format: "jpeg"},
+	{Variant: models.DerivativeMedium, MaxSize: 1280, Format: "jpeg"},
+	{Variant: models.DerivativeWebP, MaxSize: 1280, Format: "webp"},
+}
+
+// 可以解码生成衍生图片的扩展名
+var rasterImageExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".bmp": true, ".webp": true,
+}
+
+// IsRasterImage 是否为可生成衍生图片的位图文件
+func IsRasterImage(path string) bool {
+	return rasterImageExts[strings.ToLower(filepath.Ext(path))]
+}
+
+// IsRasterFile 文件是否为位图；内容按哈希存储后对象键没有扩展名，按原始文件名判断
+func IsRasterFile(file *models.File) bool {
+	return IsRasterImage(file.Name) || IsRasterImage(file.Path)
+}
+
+func derivativeSpec(variant string) (imageDerivativeSpec, bool) {
+	for _, spec := range imageDerivativeSpecs {
+		if spec.Variant == variant {
+			return spec, true
+		}
+	}
+	return imageDerivativeSpec{}, false
+}
+
+// generateDerivatives 解码原图一次，按 EXIF 方向校正后生成全部衍生版本并保存记录
+func (s *FileService) generateDerivatives(file *models.File) ([]models.FileDerivative, error) {
+	if !IsRasterFile(file) {
+		return nil, ErrDerivativeUnsupported
+	}
+
+	src, err := s.store.Get(context.Background(), file.Path)
+	if err != nil {
+		return nil, err
+	}
+	img, _, orientation, err := utils.DecodeImage(src)
+	src.Close()
+	if err != nil {
+		return nil, fmt.Errorf("解码图片失败: %w", err)
+	}
+
+	derivatives := make([]models.FileDerivative, 0, len(imageDerivativeSpecs))
+	for _, spec := range imageDerivativeSpecs {
+		// 先缩放再校正方向，避免对原尺寸大图逐像素旋转
+		resized := utils.ApplyOrientation(utils.FitImage(img, spec.MaxSize), orientation)
+		derivative, err := s.writeDerivative(file, spec, resized)
+		if err != nil {
+			return nil, err
+		}
+		derivatives = append(derivatives, *derivative)
+	}
+	return derivatives, nil
+}
+
+// writeDerivative 编码并写入一个衍生图片，已存在的记录会被覆盖
+func (s *FileService) writeDerivative(file *models.File, spec imageDerivativeSpec, img image.Image) (*models.FileDerivative, error) {
+	ext, mimeType := ".jpg", "image/jpeg"
+	if spec.Format == "webp" {
+		ext, mimeType = ".webp", "image/webp"
+	}
+	key := path.Join(derivativeDir, file.ID+"_"+spec.Variant+ext)
+
+	var buf bytes.Buffer
+	if err := encodeDerivative(&buf, spec.Format, img); err != nil {
+		return nil, err
+	}
+	size := int64(buf.Len())
+	if err := s.store.Put(context.Background(), key, &buf, size, mimeType); err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	derivative := &models.FileDerivative{
+		FileID:   file.ID,
+		Variant:  spec.Variant,
+		Path:     key,
+		MimeType: mimeType,
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		Size:     size,
+	}
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "file_id"}, {Name: "variant"}},
+		DoUpdates: clause.AssignmentColumns([]string{"path", "mime_type", "width", "height", "size", "updated_at"}),
+	}).Create(derivative).Error; err != nil {
+		return nil, err
+	}
+	return derivative, nil
+}
+
+func encodeDerivative(w io.Writer, format string, img image.Image) error {
+	if format == "webp" {
+		return utils.EncodeWebPLossless(w, img)
+	}
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: 82})
+}
+
+// generateDerivativesAfterUpload 上传成功后生成衍生图片；失败只记录日志，访问时会再次尝试生成
+func (s *FileService) generateDerivativesAfterUpload(file *models.File) []models.FileDerivative {
+	if !IsRasterFile(file) {
+		return nil
+	}
+	derivatives, err := s.generateDerivatives(file)
+	if err != nil {
+		log.Printf("Failed to generate derivatives for file %s: %v", file.ID, err)
+		return nil
+	}
+	return derivatives
+}
+
+// GetDerivative 获取文件指定尺寸的衍生图片；记录或对象缺失时（如历史上传）即时生成
+func (s *FileService) GetDerivative(fileID, variant string) (*models.FileDerivative, error) {
+	if _, ok := derivativeSpec(variant); !ok {
+		return nil, ErrUnknownDerivative
+	}
+
+	var derivative models.FileDerivative
+	err := s.db.Where("file_id = ? AND variant = ?", fileID, variant).First(&derivative).Error
+	if err == nil {
+		if _, statErr := s.store.Stat(context.Background(), derivative.Path); statErr == nil {
+			return &derivative, nil
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	file, err := s.GetFileByID(fileID)
+	if err != nil {
+		return nil, err
+	}
+	derivatives, err := s.generateDerivatives(file)
+	if err != nil {
+		return nil, err
+	}
+	for i := range derivatives {
+		if derivatives[i].Variant == variant {
+			return &derivatives[i], nil
+		}
+	}
+	return nil, ErrUnknownDerivative
+}
+
+// GetDerivativeURL 生成衍生图片的签名下载地址
+func (s *FileService) GetDerivativeURL(derivative *models.FileDerivative) (string, error) {
+	return s.store.PresignGet(context.Background(), derivative.Path, s.urlTTL, storage.PresignOptions{
+		ContentType: derivative.MimeType,
+	})
+}
+
+// thumbnailURL 图片缩略图的访问地址，缺失时即时生成；无法生成时返回空字符串
+// 缩略图只用于工厂展示图片，返回可长期使用的公开地址。
+func (s *FileService) thumbnailURL(file *models.File) string {
+	for _, derivative := range file.Derivatives {
+		if derivative.Variant == models.DerivativeThumbnail {
+			return "/uploads/" + derivative.Path
+		}
+	}
+	derivative, err := s.GetDerivative(file.ID, models.DerivativeThumbnail)
+	if err != nil {
+		log.Printf("Failed to prepare thumbnail for file %s: %v", file.ID, err)
+		return ""
+	}
+	return "/uploads/" + derivative.Path
+}
+
+// removeDerivativeFiles 删除文件的全部衍生图片
+func (s *FileService) removeDerivativeFiles(derivatives []models.FileDerivative) {
+	for _, derivative := range derivatives {
+		if err := s.store.Delete(context.Background(), derivative.Path); err != nil {
+			log.Printf("Failed to remove derivative %s: %v", derivative.Path, err)
+		}
+	}
+}
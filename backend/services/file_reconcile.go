@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"gongChang/models"
+	"gongChang/storage"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// reconcileGracePeriod 最近写入的对象可能属于尚未提交的上传事务，不视为孤立对象
+const reconcileGracePeriod = time.Hour
+
+// ReconcileFiles 检查存储与数据库的一致性：孤立的存储对象、引用数错误或对象缺失的 blob、
+// 订单中失效的文件ID。fix 为 true 时删除孤立对象、修正引用数并从订单中移除失效的文件ID。
+func (s *FileService) ReconcileFiles(fix bool) (*models.FileReconcileReport, error) {
+	report := &models.FileReconcileReport{
+		OrphanObjects:      make([]string, 0),
+		RefMismatches:      make([]models.BlobRefMismatch, 0),
+		MissingBlobs:       make([]string, 0),
+		DanglingOrderFiles: make([]models.DanglingOrderFile, 0),
+		Fixed:              fix,
+	}
+	if err := s.reconcileBlobs(report, fix); err != nil {
+		return nil, err
+	}
+	if err := s.reconcileObjects(report, fix); err != nil {
+		return nil, err
+	}
+	if err := s.reconcileOrders(report, fix); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// reconcileBlobs 按实际引用的文件数校正 blob 引用数，并检查存储对象是否存在
+func (s *FileService) reconcileBlobs(report *models.FileReconcileReport, fix bool) error {
+	var blobs []models.FileBlob
+	return s.db.FindInBatches(&blobs, 500, func(tx *gorm.DB, batch int) error {
+		for _, blob := range blobs {
+			var actual int64
+			if err := s.db.Model(&models.File{}).Where("blob_hash = ?", blob.Hash).Count(&actual).Error; err != nil {
+				return err
+			}
+			// 引用数为 0 的 blob 是提交后未能删除存储对象的记录，同样交给 fixBlobRefCount 清理
+			if int(actual) != blob.RefCount || actual == 0 {
+				report.RefMismatches = append(report.RefMismatches, models.BlobRefMismatch{
+					Hash: blob.Hash, RefCount: blob.RefCount, Actual: int(actual),
+				})
+				if fix {
+					if err := s.fixBlobRefCount(blob.Hash); err != nil {
+						return err
+					}
+				}
+			}
+			if actual > 0 {
+				if _, err := s.store.Stat(context.Background(), blob.Key); errors.Is(err, storage.ErrNotExist) {
+					report.MissingBlobs = append(report.MissingBlobs, blob.Hash)
+				} else if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}).Error
+}
+
+// fixBlobRefCount 在行锁内重新计数，没有引用时在提交后删除 blob
+func (s *FileService) fixBlobRefCount(hash string) error {
+	unreferenced := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var blob models.FileBlob
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&blob, "hash = ?", hash).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		var actual int64
+		if err := tx.Model(&models.File{}).Where("blob_hash = ?", hash).Count(&actual).Error; err != nil {
+			return err
+		}
+		unreferenced = actual == 0
+		return tx.Model(&blob).Update("ref_count", actual).Error
+	})
+	if err != nil || !unreferenced {
+		return err
+	}
+	return s.purgeBlob(hash)
+}
+
+// reconcileObjects 遍历存储中的全部对象，找出没有任何记录引用的对象
+func (s *FileService) reconcileObjects(report *models.FileReconcileReport, fix bool) error {
+	cutoff := time.Now().Add(-reconcileGracePeriod)
+	ctx := context.Background()
+	return s.store.List(ctx, "", func(object storage.ObjectInfo) error {
+		if object.ModTime.After(cutoff) {
+			return nil
+		}
+		referenced, err := s.objectReferenced(object.Key)
+		if err != nil {
+			return err
+		}
+		if referenced {
+			return nil
+		}
+		report.OrphanObjects = append(report.OrphanObjects, object.Key)
+		if fix {
+			if err := s.store.Delete(ctx, object.Key); err != nil {
+				log.Printf("Failed to remove orphan object %s: %v", object.Key, err)
+			}
+		}
+		return nil
+	})
+}
+
+// objectReferenced 根据对象键的前缀判断是否仍有记录引用
+func (s *FileService) objectReferenced(key string) (bool, error) {
+	var count int64
+	var err error
+	switch {
+	case strings.HasPrefix(key, blobDir+"/"):
+		err = s.db.Model(&models.FileBlob{}).Where("`key` = ?", key).Count(&count).Error
+	case strings.HasPrefix(key, derivativeDir+"/"):
+		err = s.db.Model(&models.FileDerivative{}).Where("path = ?", key).Count(&count).Error
+	case strings.HasPrefix(key, uploadChunkDir+"/"):
+		sessionID := strings.SplitN(strings.TrimPrefix(key, uploadChunkDir+"/"), "/", 2)[0]
+		err = s.db.Model(&models.UploadSession{}).Where("id = ?", sessionID).Count(&count).Error
+	case strings.HasPrefix(key, avatarKeyPrefix):
+		// 头像地址保存在设计师资料中，可能带有前端拼上的域名
+		url := "/uploads/" + key
+		err = s.db.Model(&models.DesignerProfile{}).Where("avatar = ? OR avatar LIKE ?", url, "%"+url).Count(&count).Error
+	case !strings.Contains(key, "/"):
+		// 去重之前上传的文件直接以文件名保存在根目录
+		err = s.db.Model(&models.File{}).Where("path = ?", key).Count(&count).Error
+	default:
+		// 其他目录不由文件服务管理
+		return true, nil
+	}
+	return count > 0, err
+}
+
+// reconcileOrders 找出指向已不存在文件的订单文件关联
+func (s *FileService) reconcileOrders(report *models.FileReconcileReport, fix bool) error {
+	var links []models.OrderFile
+	if err := s.db.Model(&models.OrderFile{}).
+		Joins("LEFT JOIN files ON files.id = order_files.file_id").
+		Where("files.id IS NULL").
+		Order("order_files.order_id").
+		Find(&links).Error; err != nil {
+		return err
+	}
+
+	byOrder := make(map[uint][]uint)
+	orderIDs := make([]uint, 0)
+	for _, link := range links {
+		report.DanglingOrderFiles = append(report.DanglingOrderFiles, models.DanglingOrderFile{
+			OrderID: link.OrderID, Role: link.Role, FileID: link.FileID,
+		})
+		if _, ok := byOrder[link.OrderID]; !ok {
+			orderIDs = append(orderIDs, link.OrderID)
+		}
+		byOrder[link.OrderID] = append(byOrder[link.OrderID], link.ID)
+	}
+	if !fix {
+		return nil
+	}
+	for _, orderID := range orderIDs {
+		if err := s.removeDanglingOrderFiles(orderID, byOrder[orderID]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeDanglingOrderFiles 删除订单中失效的文件关联，并记录审计事件
+func (s *FileService) removeDanglingOrderFiles(orderID uint, linkIDs []uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		before, err := lockOrderWithFiles(tx, orderID)
+		if errors.Is(err, ErrResourceNotFound) {
+			// 订单已删除，只清理关联
+			return tx.Delete(&models.OrderFile{}, linkIDs).Error
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.OrderFile{}, linkIDs).Error; err != nil {
+			return err
+		}
+		_, err = NewOrderService(tx).WithActor(s.actor).auditOrderFiles(tx, before)
+		return err
+	})
+}
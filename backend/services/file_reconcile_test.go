@@ -0,0 +1,33 @@
+package services
+
+import (
+	"gongChang/models"
+	"testing"
+)
+
+func TestObjectReferencedAvatars(t *testing.T) {
+	db := openTestDB(t, &models.User{}, &models.DesignerProfile{})
+	if err := db.Create(&models.DesignerProfile{UserID: testDesignerID, Avatar: "/uploads/avatars/a.png"}).Error; err != nil {
+		t.Fatalf("seed profile: %v", err)
+	}
+	if err := db.Create(&models.DesignerProfile{UserID: "designer-2", Avatar: "https://cdn.example.com/uploads/avatars/b.webp"}).Error; err != nil {
+		t.Fatalf("seed profile: %v", err)
+	}
+	svc := &FileService{db: db}
+
+	cases := map[string]bool{
+		"avatars/a.png":  true,
+		"avatars/b.webp": true,
+		"avatars/c.jpg":  false,
+		"misc/other.bin": true, // 其他目录不由文件服务管理
+	}
+	for key, want := range cases {
+		got, err := svc.objectReferenced(key)
+		if err != nil {
+			t.Fatalf("objectReferenced(%q): %v", key, err)
+		}
+		if got != want {
+			t.Errorf("objectReferenced(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
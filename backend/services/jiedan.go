@@ -1,14 +1,25 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"time"
 	"gongChang/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrJiedanNotFound      = errors.New("接单记录不存在")
+	ErrJiedanNotPending    = errors.New("只能对待处理的接单进行操作")
+	ErrOrderAlreadyAwarded = errors.New("该订单已指派给工厂，不能重复授标")
+	ErrJiedanDuplicate     = errors.New("该工厂已对该订单进行过接单操作")
+	ErrOrderNotOpenForBids = errors.New("订单未处于发布状态，不能接单")
 )
 
 type JiedanService struct {
-	db *gorm.DB
+	db    *gorm.DB
+	actor models.Actor
 }
 
 func NewJiedanService(db *gorm.DB) *JiedanService {
@@ -17,24 +28,34 @@ func NewJiedanService(db *gorm.DB) *JiedanService {
 	}
 }
 
-// CreateJiedan 创建接单记录
-func (s *JiedanService) CreateJiedan(req *models.CreateJiedanRequest) (*models.Jiedan, error) {
-	// 检查订单是否存在
-	var order models.Order
-	if err := s.db.First(&order, req.OrderID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("订单不存在")
-		}
-		return nil, err
-	}
+// WithActor 返回绑定操作人的服务副本，写操作将以该操作人记录审计事件
+func (s *JiedanService) WithActor(actor models.Actor) *JiedanService {
+	c := *s
+	c.actor = actor
+	return &c
+}
 
-	// 检查是否已经存在该工厂对该订单的接单记录
-	var existingJiedan models.Jiedan
-	if err := s.db.Where("order_id = ? AND factory_id = ?", req.OrderID, req.FactoryID).First(&existingJiedan).Error; err == nil {
-		return nil, fmt.Errorf("该工厂已对该订单进行过接单操作")
+// auditJiedan 记录接单变更的审计事件
+func (s *JiedanService) auditJiedan(tx *gorm.DB, action string, before, after *models.Jiedan) error {
+	target := after
+	if target == nil {
+		target = before
 	}
+	orderID := target.OrderID
+	return recordAudit(tx, s.actor, auditEntry{
+		EntityType: models.AuditEntityJiedan,
+		EntityID:   target.ID,
+		Action:     action,
+		OrderID:    &orderID,
+		OwnerID:    target.FactoryID,
+		Before:     before,
+		After:      after,
+	})
+}
 
-	// 创建接单记录
+// CreateJiedan 创建接单记录
+// 订单行加锁后确认订单已发布且尚未指派工厂，同一工厂对同一订单只能接单一次。
+func (s *JiedanService) CreateJiedan(req *models.CreateJiedanRequest) (*models.Jiedan, error) {
 	now := time.Now()
 	jiedan := &models.Jiedan{
 		OrderID:    req.OrderID,
@@ -44,7 +65,67 @@ func (s *JiedanService) CreateJiedan(req *models.CreateJiedanRequest) (*models.J
 		JiedanTime: &now,
 	}
 
-	if err := s.db.Create(jiedan).Error; err != nil {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, req.OrderID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrOrderNotFound
+			}
+			return err
+		}
+		if order.FactoryID != nil && *order.FactoryID != "" {
+			return ErrOrderAlreadyAwarded
+		}
+		if order.Status != models.OrderStatusPublished {
+			return ErrOrderNotOpenForBids
+		}
+
+		// 已撤回的接单同样计入，与唯一索引保持一致
+		var existing int64
+		if err := tx.Unscoped().Model(&models.Jiedan{}).
+			Where("order_id = ? AND factory_id = ?", req.OrderID, req.FactoryID).
+			Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrJiedanDuplicate
+		}
+
+		if err := tx.Create(jiedan).Error; err != nil {
+			return err
+		}
+		if err := s.auditJiedan(tx, models.AuditActionCreate, nil, jiedan); err != nil {
+			return err
+		}
+		if err := publishOrderEvent(tx, jiedan.OrderID, models.RealtimeJiedanCreated, models.OrderAccessOwner, jiedanEventPayload(jiedan)); err != nil {
+			return err
+		}
+		if err := notify(tx, s.actor, notificationEvent{
+			Category:   models.NotificationJiedanNew,
+			Title:      "您的订单收到新的接单",
+			Content:    fmt.Sprintf("订单「%s」收到工厂的接单申请", order.Title),
+			EntityType: models.AuditEntityJiedan,
+			EntityID:   jiedan.ID,
+			OrderID:    &jiedan.OrderID,
+		}, order.DesignerID); err != nil {
+			return err
+		}
+
+		// 接单时给出的价格作为第一轮报价
+		if req.Price != nil {
+			quote, err := proposeQuote(tx, jiedan.ID, req.FactoryID, models.RoleFactory, &models.ProposeQuoteRequest{
+				UnitPrice: *req.Price,
+			}, false)
+			if err != nil {
+				return err
+			}
+			if err := s.auditQuote(tx, jiedan, models.AuditActionCreate, nil, quote); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -92,30 +173,166 @@ func (s *JiedanService) GetJiedansByFactoryID(factoryID string, page, pageSize i
 	return jiedans, total, nil
 }
 
-// AcceptJiedan 同意接单
-func (s *JiedanService) AcceptJiedan(id uint, req *models.AcceptJiedanRequest) (*models.Jiedan, error) {
+// AcceptJiedan 同意接单（授标）
+// 在同一事务中：确认该接单、将订单指派给该工厂并写入成交价、订单停止接单、
+// 自动拒绝该订单上其他待处理的接单。订单行加锁，保证并发授标时只有一个成功。
+// 订单在产前样批准后才进入生产，授标不直接开始大货生产。
+func (s *JiedanService) AcceptJiedan(id uint, req *models.AcceptJiedanRequest) (*models.AcceptJiedanResult, error) {
 	var jiedan models.Jiedan
 	if err := s.db.First(&jiedan, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("接单记录不存在")
+			return nil, ErrJiedanNotFound
 		}
 		return nil, err
 	}
 
-	// 检查状态
-	if jiedan.Status != models.JiedanStatusPending {
-		return nil, fmt.Errorf("只能对待处理的接单进行同意操作")
-	}
+	result := &models.AcceptJiedanResult{RejectedJiedans: make([]uint, 0)}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// 1. 先锁订单行，同一订单的授标操作串行执行
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, jiedan.OrderID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrOrderNotFound
+			}
+			return err
+		}
+		if order.FactoryID != nil && *order.FactoryID != "" {
+			return ErrOrderAlreadyAwarded
+		}
 
-	// 更新接单状态
-	now := time.Now()
-	updates := map[string]interface{}{
-		"status":        models.JiedanStatusAccepted,
-		"agree_time":    &now,
-		"agree_user_id": req.AgreeUserID,
-	}
+		// 2. 锁定后重新读取接单记录，确认仍为待处理
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&jiedan, id).Error; err != nil {
+			return err
+		}
+		if jiedan.Status != models.JiedanStatusPending {
+			return ErrJiedanNotPending
+		}
+
+		// 3. 更新接单状态
+		before := jiedan
+		now := time.Now()
+		if err := tx.Model(&jiedan).Updates(map[string]interface{}{
+			"status":        models.JiedanStatusAccepted,
+			"agree_time":    &now,
+			"agree_user_id": req.AgreeUserID,
+		}).Error; err != nil {
+			return err
+		}
+		if err := s.auditJiedan(tx, models.AuditActionAccept, &before, &jiedan); err != nil {
+			return err
+		}
+		if err := publishOrderEvent(tx, order.ID, models.RealtimeJiedanAccepted, models.OrderAccessOwner, jiedanEventPayload(&jiedan)); err != nil {
+			return err
+		}
+		if err := notify(tx, s.actor, notificationEvent{
+			Category:   models.NotificationJiedanAccepted,
+			Title:      "您的接单已被采纳",
+			Content:    fmt.Sprintf("订单「%s」已确认由您承接", order.Title),
+			EntityType: models.AuditEntityJiedan,
+			EntityID:   jiedan.ID,
+			OrderID:    &order.ID,
+		}, jiedan.FactoryID); err != nil {
+			return err
+		}
 
-	if err := s.db.Model(&jiedan).Updates(updates).Error; err != nil {
+		// 4. 指派工厂并写入成交价；带条件更新，防止绕过行锁的重复授标
+		orderUpdates := map[string]interface{}{
+			"factory_id": jiedan.FactoryID,
+		}
+		if jiedan.Price != nil {
+			// 有尺码 × 颜色明细时按明细报价汇总总价
+			lines, err := applyQuoteLinePrices(tx, jiedan.ID, order.ID)
+			if err != nil {
+				return err
+			}
+			orderUpdates["unit_price"] = *jiedan.Price
+			orderUpdates["total_price"] = *jiedan.Price * float64(order.Quantity)
+			if len(lines) > 0 {
+				_, orderUpdates["total_price"] = orderLineTotals(lines, *jiedan.Price)
+			}
+		}
+		res := tx.Model(&models.Order{}).
+			Where("id = ? AND (factory_id IS NULL OR factory_id = '')", order.ID).
+			Updates(orderUpdates)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrOrderAlreadyAwarded
+		}
+		orderID := order.ID
+		if err := recordAudit(tx, s.actor, auditEntry{
+			EntityType: models.AuditEntityOrder,
+			EntityID:   orderID,
+			Action:     models.AuditActionUpdate,
+			OrderID:    &orderID,
+			OwnerID:    order.DesignerID,
+			Before: map[string]interface{}{
+				"factory_id":  order.FactoryID,
+				"unit_price":  order.UnitPrice,
+				"total_price": order.TotalPrice,
+			},
+			After: orderUpdates,
+		}); err != nil {
+			return err
+		}
+
+		// 5. 订单停止接单，等待工厂打样
+		if order.Status == models.OrderStatusPublished {
+			if err := transitionOrderStatus(tx, s.actor, &order, StatusChange{
+				To:     models.OrderStatusBiddingClosed,
+				Reason: fmt.Sprintf("同意工厂 %s 的接单 #%d", jiedan.FactoryID, jiedan.ID),
+			}); err != nil {
+				return err
+			}
+		}
+
+		// 6. 自动拒绝其他待处理的接单
+		var competing []models.Jiedan
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("order_id = ? AND id <> ? AND status = ?", order.ID, jiedan.ID, models.JiedanStatusPending).
+			Find(&competing).Error; err != nil {
+			return err
+		}
+		for _, other := range competing {
+			result.RejectedJiedans = append(result.RejectedJiedans, other.ID)
+		}
+		if len(competing) > 0 {
+			const reason = "订单已由其他工厂承接"
+			if err := tx.Model(&models.Jiedan{}).
+				Where("id IN ?", result.RejectedJiedans).
+				Updates(map[string]interface{}{
+					"status":        models.JiedanStatusRejected,
+					"reject_reason": reason,
+				}).Error; err != nil {
+				return err
+			}
+			for i := range competing {
+				rejected := competing[i]
+				rejected.Status = models.JiedanStatusRejected
+				rejected.RejectReason = reason
+				if err := s.auditJiedan(tx, models.AuditActionReject, &competing[i], &rejected); err != nil {
+					return err
+				}
+				if err := publishOrderEvent(tx, order.ID, models.RealtimeJiedanRejected, models.OrderAccessOwner, jiedanEventPayload(&rejected)); err != nil {
+					return err
+				}
+				if err := notify(tx, s.actor, notificationEvent{
+					Category:   models.NotificationJiedanRejected,
+					Title:      "您的接单未被采纳",
+					Content:    fmt.Sprintf("订单「%s」%s", order.Title, reason),
+					EntityType: models.AuditEntityJiedan,
+					EntityID:   rejected.ID,
+					OrderID:    &order.ID,
+				}, rejected.FactoryID); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -123,31 +340,61 @@ func (s *JiedanService) AcceptJiedan(id uint, req *models.AcceptJiedanRequest) (
 	if err := s.db.Preload("Order").Preload("Factory").First(&jiedan, id).Error; err != nil {
 		return nil, err
 	}
+	result.Jiedan = &jiedan
+	result.Order = &jiedan.Order
 
-	return &jiedan, nil
+	return result, nil
 }
 
 // RejectJiedan 拒绝接单
+// 在事务内锁定接单行并确认仍为待处理，避免与并发的授标互相覆盖。
 func (s *JiedanService) RejectJiedan(id uint, req *models.RejectJiedanRequest) (*models.Jiedan, error) {
 	var jiedan models.Jiedan
-	if err := s.db.First(&jiedan, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("接单记录不存在")
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&jiedan, id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrJiedanNotFound
+			}
+			return err
+		}
+		if jiedan.Status != models.JiedanStatusPending {
+			return ErrJiedanNotPending
 		}
-		return nil, err
-	}
-
-	// 检查状态
-	if jiedan.Status != models.JiedanStatusPending {
-		return nil, fmt.Errorf("只能对待处理的接单进行拒绝操作")
-	}
-
-	// 更新接单状态
-	updates := map[string]interface{}{
-		"status": models.JiedanStatusRejected,
-	}
 
-	if err := s.db.Model(&jiedan).Updates(updates).Error; err != nil {
+		// 更新接单状态；带条件更新，防止绕过行锁覆盖已授标的接单
+		before := jiedan
+		res := tx.Model(&jiedan).
+			Where("status = ?", models.JiedanStatusPending).
+			Updates(map[string]interface{}{
+				"status":        models.JiedanStatusRejected,
+				"reject_reason": req.Reason,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrJiedanNotPending
+		}
+		if err := s.auditJiedan(tx, models.AuditActionReject, &before, &jiedan); err != nil {
+			return err
+		}
+		if err := publishOrderEvent(tx, jiedan.OrderID, models.RealtimeJiedanRejected, models.OrderAccessOwner, jiedanEventPayload(&jiedan)); err != nil {
+			return err
+		}
+		content := "设计师拒绝了您的接单"
+		if req.Reason != "" {
+			content += "：" + req.Reason
+		}
+		return notify(tx, s.actor, notificationEvent{
+			Category:   models.NotificationJiedanRejected,
+			Title:      "您的接单已被拒绝",
+			Content:    content,
+			EntityType: models.AuditEntityJiedan,
+			EntityID:   jiedan.ID,
+			OrderID:    &jiedan.OrderID,
+		}, jiedan.FactoryID)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -160,29 +407,28 @@ func (s *JiedanService) RejectJiedan(id uint, req *models.RejectJiedanRequest) (
 }
 
 // UpdateJiedan 更新接单记录
+// 工厂只能修改待处理接单的价格，价格变更记为新一轮报价；
+// 接单状态只能通过同意、拒绝或撤回接单变更。
 func (s *JiedanService) UpdateJiedan(id uint, req *models.UpdateJiedanRequest) (*models.Jiedan, error) {
 	var jiedan models.Jiedan
 	if err := s.db.First(&jiedan, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("接单记录不存在")
+			return nil, ErrJiedanNotFound
 		}
 		return nil, err
 	}
 
-	// 更新字段
-	updates := make(map[string]interface{})
-	if req.Status != "" {
-		updates["status"] = req.Status
-	}
-	if req.Price != nil {
-		updates["price"] = req.Price
-	}
-	if req.AgreeUserID != "" {
-		updates["agree_user_id"] = req.AgreeUserID
-	}
-
-	if len(updates) > 0 {
-		if err := s.db.Model(&jiedan).Updates(updates).Error; err != nil {
+	if req.Price != nil && (jiedan.Price == nil || *jiedan.Price != *req.Price) {
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			quote, err := proposeQuote(tx, jiedan.ID, jiedan.FactoryID, models.RoleFactory, &models.ProposeQuoteRequest{
+				UnitPrice: *req.Price,
+			}, true)
+			if err != nil {
+				return err
+			}
+			return s.auditQuote(tx, &jiedan, models.AuditActionCreate, nil, quote)
+		})
+		if err != nil {
 			return nil, err
 		}
 	}
@@ -195,9 +441,33 @@ func (s *JiedanService) UpdateJiedan(id uint, req *models.UpdateJiedanRequest) (
 	return &jiedan, nil
 }
 
+// jiedanEventPayload 接单实时事件的推送内容
+func jiedanEventPayload(jiedan *models.Jiedan) map[string]interface{} {
+	return map[string]interface{}{
+		"jiedan_id":     jiedan.ID,
+		"order_id":      jiedan.OrderID,
+		"factory_id":    jiedan.FactoryID,
+		"status":        jiedan.Status,
+		"price":         jiedan.Price,
+		"reject_reason": jiedan.RejectReason,
+	}
+}
+
 // DeleteJiedan 删除接单记录
 func (s *JiedanService) DeleteJiedan(id uint) error {
-	return s.db.Delete(&models.Jiedan{}, id).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var jiedan models.Jiedan
+		if err := tx.First(&jiedan, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrJiedanNotFound
+			}
+			return err
+		}
+		if err := tx.Delete(&jiedan).Error; err != nil {
+			return err
+		}
+		return s.auditJiedan(tx, models.AuditActionDelete, &jiedan, nil)
+	})
 }
 
 // GetJiedanStatistics 获取接单统计信息
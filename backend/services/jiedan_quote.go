@@ -0,0 +1,249 @@
+package services
+
+import (
+	"errors"
+	"gongChang/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var (
+	ErrQuoteNotFound     = errors.New("报价记录不存在")
+	ErrQuoteNotPending   = errors.New("只能接受待回应的报价")
+	ErrQuoteExpired      = errors.New("报价已过有效期")
+	ErrQuoteOutOfTurn    = errors.New("请等待对方回应后再报价")
+	ErrQuoteOwnProposal  = errors.New("不能接受自己提出的报价")
+	ErrNegotiationClosed = errors.New("议价已结束，不能继续报价")
+)
+
+// GetJiedanQuotes 获取接单的全部议价轮次
+func (s *JiedanService) GetJiedanQuotes(jiedanID uint) ([]models.JiedanQuote, error) {
+	var quotes []models.JiedanQuote
+	err := s.db.Preload("LinePrices").Where("jiedan_id = ?", jiedanID).Order("round ASC").Find(&quotes).Error
+	return quotes, err
+}
+
+// ProposeQuote 由操作人提交新一轮报价或还价，双方须交替报价
+func (s *JiedanService) ProposeQuote(jiedanID uint, req *models.ProposeQuoteRequest) (*models.JiedanQuote, error) {
+	role, err := NewPolicyService(s.db).JiedanPartyRole(s.actor, jiedanID)
+	if err != nil {
+		return nil, err
+	}
+	var quote *models.JiedanQuote
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		quote, err = proposeQuote(tx, jiedanID, s.actor.UserID, role, req, false)
+		if err != nil {
+			return err
+		}
+		var jiedan models.Jiedan
+		if err := tx.First(&jiedan, jiedanID).Error; err != nil {
+			return err
+		}
+		return s.auditQuote(tx, &jiedan, models.AuditActionCreate, nil, quote)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+// AcceptQuote 操作人接受对方指定轮次的报价，并以该轮单价作为接单最终价格
+func (s *JiedanService) AcceptQuote(jiedanID, quoteID uint) (*models.JiedanQuote, error) {
+	var quote models.JiedanQuote
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var jiedan models.Jiedan
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&jiedan, jiedanID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrJiedanNotFound
+			}
+			return err
+		}
+		// 已授标的接单价格已写入订单，不能再通过议价修改
+		if jiedan.Status != models.JiedanStatusPending {
+			return ErrNegotiationClosed
+		}
+
+		if err := tx.Where("id = ? AND jiedan_id = ?", quoteID, jiedanID).First(&quote).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrQuoteNotFound
+			}
+			return err
+		}
+		if quote.Status != models.QuoteStatusPending {
+			return ErrQuoteNotPending
+		}
+		if quote.IsExpired(time.Now()) {
+			return ErrQuoteExpired
+		}
+		if quote.ProposerID == s.actor.UserID {
+			return ErrQuoteOwnProposal
+		}
+
+		before := quote
+		if err := tx.Model(&quote).Update("status", models.QuoteStatusAccepted).Error; err != nil {
+			return err
+		}
+		quote.Status = models.QuoteStatusAccepted
+		if err := s.auditQuote(tx, &jiedan, models.AuditActionAccept, &before, &quote); err != nil {
+			return err
+		}
+
+		jiedanBefore := jiedan
+		if err := tx.Model(&jiedan).Update("price", quote.UnitPrice).Error; err != nil {
+			return err
+		}
+		return s.auditJiedan(tx, models.AuditActionUpdate, &jiedanBefore, &jiedan)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &quote, nil
+}
+
+// applyQuoteLinePrices 授标时把接单已接受报价中的明细行单价写入订单明细，返回订单的全部明细
+func applyQuoteLinePrices(tx *gorm.DB, jiedanID, orderID uint) ([]models.OrderLine, error) {
+	var quote models.JiedanQuote
+	err := tx.Preload("LinePrices").
+		Where("jiedan_id = ? AND status = ?", jiedanID, models.QuoteStatusAccepted).
+		Order("round DESC").First(&quote).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	for _, linePrice := range quote.LinePrices {
+		price := linePrice.UnitPrice
+		if err := tx.Model(&models.OrderLine{}).
+			Where("id = ? AND order_id = ?", linePrice.OrderLineID, orderID).
+			Update("unit_price", &price).Error; err != nil {
+			return nil, err
+		}
+	}
+	return loadOrderLines(tx, orderID)
+}
+
+// auditQuote 记录议价轮次变更的审计事件，归属于接单工厂
+func (s *JiedanService) auditQuote(tx *gorm.DB, jiedan *models.Jiedan, action string, before, after *models.JiedanQuote) error {
+	target := after
+	if target == nil {
+		target = before
+	}
+	orderID := jiedan.OrderID
+	return recordAudit(tx, s.actor, auditEntry{
+		EntityType: models.AuditEntityJiedanQuote,
+		EntityID:   target.ID,
+		Action:     action,
+		OrderID:    &orderID,
+		OwnerID:    jiedan.FactoryID,
+		Before:     before,
+		After:      after,
+	})
+}
+
+// proposeQuote 在事务内追加议价轮次，上一轮待回应的报价被取代
+// revise 为 true 时允许报价方修改自己尚未被回应的报价，新一轮取代原报价
+func proposeQuote(tx *gorm.DB, jiedanID uint, proposerID string, role models.UserRole, req *models.ProposeQuoteRequest, revise bool) (*models.JiedanQuote, error) {
+	var jiedan models.Jiedan
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&jiedan, jiedanID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrJiedanNotFound
+		}
+		return nil, err
+	}
+	if jiedan.Status != models.JiedanStatusPending {
+		return nil, ErrNegotiationClosed
+	}
+
+	var last models.JiedanQuote
+	round := 1
+	err := tx.Where("jiedan_id = ?", jiedanID).Order("round DESC").First(&last).Error
+	switch {
+	case err == nil:
+		if last.Status == models.QuoteStatusAccepted {
+			return nil, ErrNegotiationClosed
+		}
+		if last.ProposerRole == role && last.Status == models.QuoteStatusPending && !revise {
+			return nil, ErrQuoteOutOfTurn
+		}
+		round = last.Round + 1
+		if err := tx.Model(&models.JiedanQuote{}).
+			Where("jiedan_id = ? AND status = ?", jiedanID, models.QuoteStatusPending).
+			Update("status", models.QuoteStatusSuperseded).Error; err != nil {
+			return nil, err
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// 第一轮必须由工厂报价
+		if role != models.RoleFactory {
+			return nil, ErrQuoteOutOfTurn
+		}
+	default:
+		return nil, err
+	}
+
+	// 明细行报价只能针对该订单的明细行
+	linePrices := make([]models.JiedanQuoteLine, 0, len(req.LinePrices))
+	if len(req.LinePrices) > 0 {
+		lines, err := loadOrderLines(tx, jiedan.OrderID)
+		if err != nil {
+			return nil, err
+		}
+		known := make(map[uint]bool, len(lines))
+		for _, line := range lines {
+			known[line.ID] = true
+		}
+		priced := make(map[uint]bool, len(req.LinePrices))
+		for _, linePrice := range req.LinePrices {
+			if !known[linePrice.OrderLineID] {
+				return nil, ErrOrderLineNotFound
+			}
+			if priced[linePrice.OrderLineID] {
+				return nil, ErrOrderLineDuplicate
+			}
+			priced[linePrice.OrderLineID] = true
+			linePrices = append(linePrices, models.JiedanQuoteLine{
+				OrderLineID: linePrice.OrderLineID,
+				UnitPrice:   linePrice.UnitPrice,
+			})
+		}
+	}
+
+	quote := &models.JiedanQuote{
+		JiedanID:     jiedanID,
+		Round:        round,
+		ProposerID:   proposerID,
+		ProposerRole: role,
+		UnitPrice:    req.UnitPrice,
+		LeadTimeDays: req.LeadTimeDays,
+		MOQ:          req.MOQ,
+		ValidUntil:   req.ValidUntil,
+		Message:      req.Message,
+		Status:       models.QuoteStatusPending,
+		LinePrices:   linePrices,
+	}
+	if err := tx.Create(quote).Error; err != nil {
+		return nil, err
+	}
+
+	// 设计师的还价同时推送到接单工厂的个人频道
+	payload := map[string]interface{}{
+		"jiedan_id":      jiedanID,
+		"order_id":       jiedan.OrderID,
+		"quote_id":       quote.ID,
+		"round":          quote.Round,
+		"proposer_role":  quote.ProposerRole,
+		"unit_price":     quote.UnitPrice,
+		"lead_time_days": quote.LeadTimeDays,
+		"moq":            quote.MOQ,
+		"valid_until":    quote.ValidUntil,
+		"line_prices":    quote.LinePrices,
+	}
+	if err := publishOrderEvent(tx, jiedan.OrderID, models.RealtimeQuoteProposed, models.OrderAccessOwner, payload); err != nil {
+		return nil, err
+	}
+	if role != models.RoleFactory {
+		if err := publishEvent(tx, models.UserChannel(jiedan.FactoryID), models.RealtimeQuoteProposed, models.OrderAccessNone, payload); err != nil {
+			return nil, err
+		}
+	}
+	return quote, nil
+}
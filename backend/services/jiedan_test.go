@@ -0,0 +1,277 @@
+package services
+
+import (
+	"errors"
+	"gongChang/models"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+const otherFactoryID = "factory-2"
+
+var otherFactory = models.Actor{UserID: otherFactoryID, Role: models.RoleFactory}
+
+func newJiedanTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return openTestDB(t,
+		&models.User{},
+		&models.FactoryProfile{},
+		&models.Order{},
+		&models.OrderLine{},
+		&models.OrderStatusHistory{},
+		&models.OrderSample{},
+		&models.TechPack{},
+		&models.Jiedan{},
+		&models.JiedanQuote{},
+		&models.JiedanQuoteLine{},
+		&models.AuditEvent{},
+		&models.Notification{},
+		&models.NotificationPreference{},
+		&models.RealtimeEvent{},
+	)
+}
+
+// seedPublishedOrder 创建已发布、尚未指派工厂的订单
+func seedPublishedOrder(t *testing.T, db *gorm.DB) *models.Order {
+	t.Helper()
+	order := &models.Order{
+		Title:      "衬衫",
+		Quantity:   100,
+		Status:     models.OrderStatusPublished,
+		DesignerID: testDesignerID,
+		CustomerID: testCustomerID,
+	}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("seed order: %v", err)
+	}
+	return order
+}
+
+func seedJiedan(t *testing.T, db *gorm.DB, orderID uint, factoryID string, price float64) *models.Jiedan {
+	t.Helper()
+	jiedan := &models.Jiedan{OrderID: orderID, FactoryID: factoryID, Status: models.JiedanStatusPending, Price: &price}
+	if err := db.Create(jiedan).Error; err != nil {
+		t.Fatalf("seed jiedan: %v", err)
+	}
+	return jiedan
+}
+
+func reloadJiedanStatus(t *testing.T, db *gorm.DB, id uint) models.JiedanStatus {
+	t.Helper()
+	var jiedan models.Jiedan
+	if err := db.Select("id", "status").First(&jiedan, id).Error; err != nil {
+		t.Fatalf("reload jiedan: %v", err)
+	}
+	return jiedan.Status
+}
+
+func TestAcceptJiedanAwardsOrder(t *testing.T) {
+	db := newJiedanTestDB(t)
+	order := seedPublishedOrder(t, db)
+	winner := seedJiedan(t, db, order.ID, testFactoryID, 48)
+	loser := seedJiedan(t, db, order.ID, otherFactoryID, 45)
+	svc := NewJiedanService(db).WithActor(testDesigner)
+
+	result, err := svc.AcceptJiedan(winner.ID, &models.AcceptJiedanRequest{})
+	if err != nil {
+		t.Fatalf("AcceptJiedan: %v", err)
+	}
+	if len(result.RejectedJiedans) != 1 || result.RejectedJiedans[0] != loser.ID {
+		t.Fatalf("rejected jiedans = %v, want [%d]", result.RejectedJiedans, loser.ID)
+	}
+	var awarded models.Order
+	if err := db.First(&awarded, order.ID).Error; err != nil {
+		t.Fatalf("reload order: %v", err)
+	}
+	if awarded.FactoryID == nil || *awarded.FactoryID != testFactoryID || awarded.UnitPrice != 48 || awarded.TotalPrice != 4800 {
+		t.Fatalf("awarded order factory %v unit %v total %v", awarded.FactoryID, awarded.UnitPrice, awarded.TotalPrice)
+	}
+	// 授标只停止接单，产前样批准后才进入生产
+	if awarded.Status != models.OrderStatusBiddingClosed {
+		t.Fatalf("awarded order status = %s, want bidding_closed", awarded.Status)
+	}
+	if got := reloadJiedanStatus(t, db, loser.ID); got != models.JiedanStatusRejected {
+		t.Fatalf("competing jiedan status = %s, want rejected", got)
+	}
+
+	// 已授标后不能再次授标，也不能拒绝已采纳的接单
+	if _, err := svc.AcceptJiedan(loser.ID, &models.AcceptJiedanRequest{}); !errors.Is(err, ErrOrderAlreadyAwarded) {
+		t.Fatalf("second AcceptJiedan = %v, want ErrOrderAlreadyAwarded", err)
+	}
+	if _, err := svc.RejectJiedan(winner.ID, &models.RejectJiedanRequest{Reason: "改选其他工厂"}); !errors.Is(err, ErrJiedanNotPending) {
+		t.Fatalf("RejectJiedan after award = %v, want ErrJiedanNotPending", err)
+	}
+	if got := reloadJiedanStatus(t, db, winner.ID); got != models.JiedanStatusAccepted {
+		t.Fatalf("awarded jiedan status = %s, want accepted", got)
+	}
+}
+
+func TestRejectJiedan(t *testing.T) {
+	db := newJiedanTestDB(t)
+	order := seedPublishedOrder(t, db)
+	jiedan := seedJiedan(t, db, order.ID, testFactoryID, 48)
+	svc := NewJiedanService(db).WithActor(testDesigner)
+
+	rejected, err := svc.RejectJiedan(jiedan.ID, &models.RejectJiedanRequest{Reason: "报价过高"})
+	if err != nil {
+		t.Fatalf("RejectJiedan: %v", err)
+	}
+	if rejected.Status != models.JiedanStatusRejected || rejected.RejectReason != "报价过高" {
+		t.Fatalf("rejected jiedan = %+v", rejected)
+	}
+	if _, err := svc.RejectJiedan(jiedan.ID, &models.RejectJiedanRequest{}); !errors.Is(err, ErrJiedanNotPending) {
+		t.Fatalf("repeat RejectJiedan = %v, want ErrJiedanNotPending", err)
+	}
+	if _, err := svc.RejectJiedan(999, &models.RejectJiedanRequest{}); !errors.Is(err, ErrJiedanNotFound) {
+		t.Fatalf("RejectJiedan missing = %v, want ErrJiedanNotFound", err)
+	}
+}
+
+func TestUpdateJiedanOnlyRevisesPendingPrice(t *testing.T) {
+	db := newJiedanTestDB(t)
+	order := seedPublishedOrder(t, db)
+	jiedan := seedJiedan(t, db, order.ID, testFactoryID, 48)
+	svc := NewJiedanService(db).WithActor(testFactory)
+
+	price := 46.0
+	if _, err := svc.UpdateJiedan(jiedan.ID, &models.UpdateJiedanRequest{Price: &price}); err != nil {
+		t.Fatalf("UpdateJiedan: %v", err)
+	}
+	var quotes []models.JiedanQuote
+	if err := db.Where("jiedan_id = ?", jiedan.ID).Find(&quotes).Error; err != nil {
+		t.Fatalf("load quotes: %v", err)
+	}
+	if len(quotes) != 1 || quotes[0].UnitPrice != 46 || quotes[0].ProposerRole != models.RoleFactory {
+		t.Fatalf("quotes after price change = %+v", quotes)
+	}
+
+	if _, err := NewJiedanService(db).WithActor(testDesigner).AcceptJiedan(jiedan.ID, &models.AcceptJiedanRequest{}); err != nil {
+		t.Fatalf("AcceptJiedan: %v", err)
+	}
+	price = 60
+	if _, err := svc.UpdateJiedan(jiedan.ID, &models.UpdateJiedanRequest{Price: &price}); !errors.Is(err, ErrNegotiationClosed) {
+		t.Fatalf("UpdateJiedan after award = %v, want ErrNegotiationClosed", err)
+	}
+	if got := reloadJiedanStatus(t, db, jiedan.ID); got != models.JiedanStatusAccepted {
+		t.Fatalf("jiedan status = %s, want accepted", got)
+	}
+}
+
+func TestCreateJiedanRequiresOpenOrder(t *testing.T) {
+	db := newJiedanTestDB(t)
+	order := seedPublishedOrder(t, db)
+	price := 50.0
+	bid := func(actor models.Actor, orderID uint) (*models.Jiedan, error) {
+		return NewJiedanService(db).WithActor(actor).CreateJiedan(&models.CreateJiedanRequest{
+			OrderID: orderID, FactoryID: actor.UserID, Price: &price,
+		})
+	}
+
+	jiedan, err := bid(testFactory, order.ID)
+	if err != nil {
+		t.Fatalf("CreateJiedan: %v", err)
+	}
+	if jiedan.Status != models.JiedanStatusPending {
+		t.Fatalf("jiedan status = %s, want pending", jiedan.Status)
+	}
+	if _, err := bid(testFactory, order.ID); !errors.Is(err, ErrJiedanDuplicate) {
+		t.Fatalf("duplicate CreateJiedan = %v, want ErrJiedanDuplicate", err)
+	}
+
+	// 撤回后不能再次接单，唯一索引同样拦截绕过服务的重复插入
+	if err := NewJiedanService(db).WithActor(testFactory).DeleteJiedan(jiedan.ID); err != nil {
+		t.Fatalf("DeleteJiedan: %v", err)
+	}
+	if _, err := bid(testFactory, order.ID); !errors.Is(err, ErrJiedanDuplicate) {
+		t.Fatalf("CreateJiedan after withdrawal = %v, want ErrJiedanDuplicate", err)
+	}
+	if err := db.Create(&models.Jiedan{OrderID: order.ID, FactoryID: testFactoryID, Status: models.JiedanStatusPending}).Error; err == nil {
+		t.Fatalf("duplicate insert succeeded, want unique index violation")
+	}
+
+	draft := &models.Order{Title: "草稿", Quantity: 10, Status: models.OrderStatusDraft, DesignerID: testDesignerID}
+	if err := db.Create(draft).Error; err != nil {
+		t.Fatalf("seed draft: %v", err)
+	}
+	if _, err := bid(testFactory, draft.ID); !errors.Is(err, ErrOrderNotOpenForBids) {
+		t.Fatalf("CreateJiedan on draft = %v, want ErrOrderNotOpenForBids", err)
+	}
+	if _, err := bid(testFactory, 999); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("CreateJiedan on missing order = %v, want ErrOrderNotFound", err)
+	}
+
+	awarded, err := bid(otherFactory, order.ID)
+	if err != nil {
+		t.Fatalf("CreateJiedan: %v", err)
+	}
+	if _, err := NewJiedanService(db).WithActor(testDesigner).AcceptJiedan(awarded.ID, &models.AcceptJiedanRequest{}); err != nil {
+		t.Fatalf("AcceptJiedan: %v", err)
+	}
+	third := models.Actor{UserID: "factory-3", Role: models.RoleFactory}
+	if _, err := bid(third, order.ID); !errors.Is(err, ErrOrderAlreadyAwarded) {
+		t.Fatalf("CreateJiedan after award = %v, want ErrOrderAlreadyAwarded", err)
+	}
+}
+
+func TestQuoteNegotiationParties(t *testing.T) {
+	db := newJiedanTestDB(t)
+	order := seedPublishedOrder(t, db)
+	jiedan := seedJiedan(t, db, order.ID, testFactoryID, 50)
+	factory := NewJiedanService(db).WithActor(testFactory)
+	designer := NewJiedanService(db).WithActor(testDesigner)
+	policy := NewPolicyService(db)
+
+	for actor, want := range map[models.Actor]models.UserRole{testFactory: models.RoleFactory, testDesigner: models.RoleDesigner} {
+		if role, err := policy.JiedanPartyRole(actor, jiedan.ID); err != nil || role != want {
+			t.Errorf("JiedanPartyRole(%s) = %s, %v, want %s", actor.UserID, role, err, want)
+		}
+	}
+	var forbiddenErr *ForbiddenError
+	for _, outsider := range []models.Actor{otherFactory, testCustomer, {}} {
+		if err := policy.CanNegotiateJiedan(outsider, jiedan.ID); !errors.As(err, &forbiddenErr) {
+			t.Errorf("CanNegotiateJiedan(%q) = %v, want ForbiddenError", outsider.UserID, err)
+		}
+	}
+	if err := policy.CanNegotiateJiedan(testFactory, 999); !errors.Is(err, ErrResourceNotFound) {
+		t.Errorf("CanNegotiateJiedan missing = %v, want ErrResourceNotFound", err)
+	}
+
+	if _, err := NewJiedanService(db).WithActor(otherFactory).ProposeQuote(jiedan.ID, &models.ProposeQuoteRequest{UnitPrice: 40}); !errors.As(err, &forbiddenErr) {
+		t.Fatalf("outsider ProposeQuote = %v, want ForbiddenError", err)
+	}
+	if _, err := designer.ProposeQuote(jiedan.ID, &models.ProposeQuoteRequest{UnitPrice: 40}); !errors.Is(err, ErrQuoteOutOfTurn) {
+		t.Fatalf("designer opening quote = %v, want ErrQuoteOutOfTurn", err)
+	}
+	offer, err := factory.ProposeQuote(jiedan.ID, &models.ProposeQuoteRequest{UnitPrice: 50})
+	if err != nil {
+		t.Fatalf("factory ProposeQuote: %v", err)
+	}
+	if offer.ProposerRole != models.RoleFactory || offer.ProposerID != testFactoryID {
+		t.Fatalf("factory quote proposer = %s/%s", offer.ProposerRole, offer.ProposerID)
+	}
+	counter, err := designer.ProposeQuote(jiedan.ID, &models.ProposeQuoteRequest{UnitPrice: 45})
+	if err != nil {
+		t.Fatalf("designer ProposeQuote: %v", err)
+	}
+	if _, err := designer.AcceptQuote(jiedan.ID, counter.ID); !errors.Is(err, ErrQuoteOwnProposal) {
+		t.Fatalf("designer accepting own quote = %v, want ErrQuoteOwnProposal", err)
+	}
+	if _, err := factory.AcceptQuote(jiedan.ID, offer.ID); !errors.Is(err, ErrQuoteNotPending) {
+		t.Fatalf("accepting superseded quote = %v, want ErrQuoteNotPending", err)
+	}
+	accepted, err := factory.AcceptQuote(jiedan.ID, counter.ID)
+	if err != nil {
+		t.Fatalf("factory AcceptQuote: %v", err)
+	}
+	if accepted.Status != models.QuoteStatusAccepted {
+		t.Fatalf("accepted quote status = %s", accepted.Status)
+	}
+	var agreed models.Jiedan
+	if err := db.First(&agreed, jiedan.ID).Error; err != nil {
+		t.Fatalf("reload jiedan: %v", err)
+	}
+	if agreed.Price == nil || *agreed.Price != 45 {
+		t.Fatalf("jiedan price = %v, want 45", agreed.Price)
+	}
+}
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"errors"
+	"gongChang/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	messagePageSize    = 30
+	messageMaxPageSize = 100
+)
+
+var (
+	ErrThreadNotFound        = errors.New("会话不存在")
+	ErrThreadRequiresJiedan  = errors.New("该工厂尚未对订单接单，无法发起会话")
+	ErrThreadFactoryRequired = errors.New("请指定会话的工厂")
+	ErrMessageEmpty          = errors.New("消息内容和附件不能同时为空")
+	ErrMessageNotInThread    = errors.New("消息不属于该会话")
+	ErrAttachmentNotOwned    = errors.New("只能引用自己上传的文件作为附件")
+)
+
+// MessageService 订单会话：设计师与每个接单工厂之间的一对一消息
+type MessageService struct {
+	db    *gorm.DB
+	actor models.Actor
+}
+
+func NewMessageService(db *gorm.DB) *MessageService {
+	return &MessageService{db: db}
+}
+
+// WithActor 返回绑定操作人的服务副本
+func (s *MessageService) WithActor(actor models.Actor) *MessageService {
+	c := *s
+	c.actor = actor
+	return &c
+}
+
+// OpenThread 打开订单上与某工厂的会话，不存在时创建；要求该工厂已对订单接单
+// 设计师需通过 factoryID 指定工厂，工厂只能打开自己的会话。
+func (s *MessageService) OpenThread(orderID uint, factoryID string) (*models.MessageThread, error) {
+	var order models.Order
+	if err := s.db.Select("id", "designer_id").First(&order, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+
+	switch {
+	case s.actor.UserID != "" && order.DesignerID == s.actor.UserID:
+		if factoryID == "" {
+			return nil, ErrThreadFactoryRequired
+		}
+	case s.actor.IsFactory():
+		if factoryID != "" && factoryID != s.actor.UserID {
+			return nil, forbidden("只能打开自己工厂的会话")
+		}
+		factoryID = s.actor.UserID
+	default:
+		return nil, forbidden("只有订单设计师和接单工厂可以发起会话")
+	}
+
+	var jiedan models.Jiedan
+	if err := s.db.Select("id").Where("order_id = ? AND factory_id = ?", orderID, factoryID).
+		Order("id DESC").First(&jiedan).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrThreadRequiresJiedan
+		}
+		return nil, err
+	}
+
+	thread := models.MessageThread{
+		OrderID:    orderID,
+		JiedanID:   jiedan.ID,
+		DesignerID: order.DesignerID,
+		FactoryID:  factoryID,
+	}
+	// 同一接单只有一个会话，并发打开时以先创建的为准
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&thread).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Where("jiedan_id = ?", jiedan.ID).First(&thread).Error; err != nil {
+		return nil, err
+	}
+	return &thread, nil
+}
+
+// ListThreads 获取订单上当前用户参与的会话及未读数量
+func (s *MessageService) ListThreads(orderID uint) ([]models.ThreadSummary, error) {
+	var threads []models.MessageThread
+	err := s.db.Where("order_id = ? AND (designer_id = ? OR factory_id = ?)", orderID, s.actor.UserID, s.actor.UserID).
+		Order("last_message_at DESC, id DESC").Find(&threads).Error
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]models.ThreadSummary, 0, len(threads))
+	for _, thread := range threads {
+		var unread int64
+		if err := s.db.Model(&models.Message{}).
+			Where("thread_id = ? AND id > ? AND sender_id <> ?", thread.ID, thread.LastReadIDOf(s.actor.UserID), s.actor.UserID).
+			Count(&unread).Error; err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, models.ThreadSummary{MessageThread: thread, UnreadCount: unread})
+	}
+	return summaries, nil
+}
+
+// GetThread 获取会话详情
+func (s *MessageService) GetThread(threadID uint) (*models.MessageThread, error) {
+	var thread models.MessageThread
+	if err := s.db.First(&thread, threadID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrThreadNotFound
+		}
+		return nil, err
+	}
+	return &thread, nil
+}
+
+// ListMessages 按ID倒序分页获取会话消息，beforeID 为 0 时从最新一条开始
+func (s *MessageService) ListMessages(threadID, beforeID uint, limit int) ([]models.MessageView, bool, error) {
+	thread, err := s.GetThread(threadID)
+	if err != nil {
+		return nil, false, err
+	}
+	if limit <= 0 {
+		limit = messagePageSize
+	}
+	if limit > messageMaxPageSize {
+		limit = messageMaxPageSize
+	}
+
+	query := s.db.Preload("Attachments.File").Where("thread_id = ?", threadID)
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+	var messages []models.Message
+	// 多取一条用于判断是否还有更早的消息
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&messages).Error; err != nil {
+		return nil, false, err
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	views := make([]models.MessageView, 0, len(messages))
+	for _, message := range messages {
+		counterpart := thread.Counterpart(message.SenderID)
+		views = append(views, models.MessageView{
+			Message:           message,
+			ReadByCounterpart: thread.LastReadIDOf(counterpart) >= message.ID,
+		})
+	}
+	return views, hasMore, nil
+}
+
+// PostMessage 在会话中发送消息；附件须为发送人自己上传的文件
+func (s *MessageService) PostMessage(threadID uint, content string, attachmentIDs []string) (*models.Message, error) {
+	content = strings.TrimSpace(content)
+	attachmentIDs = uniqueStrings(attachmentIDs)
+	if content == "" && len(attachmentIDs) == 0 {
+		return nil, ErrMessageEmpty
+	}
+
+	var message models.Message
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var thread models.MessageThread
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&thread, threadID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrThreadNotFound
+			}
+			return err
+		}
+		if !thread.IsParty(s.actor.UserID) {
+			return forbidden("只有会话双方可以发送消息")
+		}
+
+		if len(attachmentIDs) > 0 {
+			var owned int64
+			if err := tx.Model(&models.File{}).
+				Where("id IN ? AND uploader_id = ?", attachmentIDs, s.actor.UserID).
+				Count(&owned).Error; err != nil {
+				return err
+			}
+			if owned != int64(len(attachmentIDs)) {
+				return ErrAttachmentNotOwned
+			}
+		}
+
+		message = models.Message{
+			ThreadID:   thread.ID,
+			SenderID:   s.actor.UserID,
+			SenderRole: s.actor.Role,
+			Content:    content,
+		}
+		if err := tx.Create(&message).Error; err != nil {
+			return err
+		}
+		for _, fileID := range attachmentIDs {
+			attachment := models.MessageAttachment{MessageID: message.ID, ThreadID: thread.ID, FileID: fileID}
+			if err := tx.Create(&attachment).Error; err != nil {
+				return err
+			}
+		}
+
+		// 发送即视为发送人已读到该消息
+		now := time.Now()
+		updates := map[string]interface{}{"last_message_at": now}
+		if thread.DesignerID == s.actor.UserID {
+			updates["designer_last_read_id"] = message.ID
+		} else {
+			updates["factory_last_read_id"] = message.ID
+		}
+		if err := tx.Model(&thread).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Preload("Attachments.File").First(&message, message.ID).Error; err != nil {
+			return err
+		}
+		return publishEvent(tx, models.UserChannel(thread.Counterpart(s.actor.UserID)), models.RealtimeMessageCreated, models.OrderAccessNone, message)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// MarkRead 将会话标记为已读到指定消息，messageID 为 0 时标记到最新一条；已读位置只前进不后退
+func (s *MessageService) MarkRead(threadID, messageID uint) (*models.MessageThread, error) {
+	var thread models.MessageThread
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&thread, threadID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrThreadNotFound
+			}
+			return err
+		}
+		if !thread.IsParty(s.actor.UserID) {
+			return forbidden("只有会话双方可以标记已读")
+		}
+
+		if messageID == 0 {
+			if err := tx.Model(&models.Message{}).Where("thread_id = ?", thread.ID).
+				Select("COALESCE(MAX(id), 0)").Scan(&messageID).Error; err != nil {
+				return err
+			}
+		} else {
+			var count int64
+			if err := tx.Model(&models.Message{}).Where("id = ? AND thread_id = ?", messageID, thread.ID).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return ErrMessageNotInThread
+			}
+		}
+		if messageID <= thread.LastReadIDOf(s.actor.UserID) {
+			return nil
+		}
+
+		column := "factory_last_read_id"
+		if thread.DesignerID == s.actor.UserID {
+			column = "designer_last_read_id"
+		}
+		if err := tx.Model(&thread).Update(column, messageID).Error; err != nil {
+			return err
+		}
+
+		// 已读回执推送给对方
+		return publishEvent(tx, models.UserChannel(thread.Counterpart(s.actor.UserID)), models.RealtimeMessageRead, models.OrderAccessNone, map[string]interface{}{
+			"thread_id":    thread.ID,
+			"reader_id":    s.actor.UserID,
+			"last_read_id": messageID,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &thread, nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	return result
+}
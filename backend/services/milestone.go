@@ -0,0 +1,401 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gongChang/models"
+	"log"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrMilestoneInvalidType   = errors.New("无效的进度阶段类型")
+	ErrMilestoneDuplicateType = errors.New("同一进度阶段只能出现一次")
+	ErrMilestoneInvalidRange  = errors.New("计划完成日期不能早于计划开始日期")
+	ErrOrderNotAwarded        = errors.New("订单尚未确定承接工厂")
+)
+
+// 可以纳入生产计划的进度阶段，按默认先后顺序排列
+var milestoneTypes = []models.ProgressType{
+	models.ProgressTypeDesign,
+	models.ProgressTypeMaterial,
+	models.ProgressTypeProduction,
+	models.ProgressTypeQuality,
+	models.ProgressTypePackaging,
+	models.ProgressTypeShipping,
+	models.ProgressTypeCustom,
+}
+
+// MilestoneService 生产计划：计划日期发布、实际进度同步和延期检测
+type MilestoneService struct {
+	db    *gorm.DB
+	actor models.Actor
+}
+
+func NewMilestoneService(db *gorm.DB) *MilestoneService {
+	return &MilestoneService{db: db}
+}
+
+// WithActor 返回绑定操作人的服务副本，写操作将以该操作人记录审计事件
+func (s *MilestoneService) WithActor(actor models.Actor) *MilestoneService {
+	c := *s
+	c.actor = actor
+	return &c
+}
+
+// auditMilestone 记录计划阶段变更的审计事件，归属于承接工厂
+func auditMilestone(tx *gorm.DB, actor models.Actor, action string, before, after *models.ProgressMilestone) error {
+	target := after
+	if target == nil {
+		target = before
+	}
+	orderID := target.OrderID
+	return recordAudit(tx, actor, auditEntry{
+		EntityType: models.AuditEntityMilestone,
+		EntityID:   target.ID,
+		Action:     action,
+		OrderID:    &orderID,
+		OwnerID:    target.FactoryID,
+		Before:     before,
+		After:      after,
+	})
+}
+
+// PublishPlan 承接工厂发布或替换订单的生产计划；计划中未出现的阶段将被移除
+func (s *MilestoneService) PublishPlan(orderID uint, items []models.MilestonePlanItem) ([]models.ProgressMilestone, error) {
+	seen := make(map[models.ProgressType]bool, len(items))
+	for _, item := range items {
+		if milestoneSequence(item.Type) < 0 {
+			return nil, ErrMilestoneInvalidType
+		}
+		if seen[item.Type] {
+			return nil, ErrMilestoneDuplicateType
+		}
+		seen[item.Type] = true
+		if item.PlannedDue.Before(item.PlannedStart) {
+			return nil, ErrMilestoneInvalidRange
+		}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "factory_id").First(&order, orderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOrderNotFound
+			}
+			return err
+		}
+		if order.FactoryID == nil || *order.FactoryID == "" {
+			return ErrOrderNotAwarded
+		}
+		if *order.FactoryID != s.actor.UserID {
+			return forbidden("只有承接订单的工厂可以发布生产计划")
+		}
+
+		var existing []models.ProgressMilestone
+		if err := tx.Where("order_id = ?", orderID).Find(&existing).Error; err != nil {
+			return err
+		}
+		byType := make(map[models.ProgressType]models.ProgressMilestone, len(existing))
+		for _, m := range existing {
+			if !seen[m.Type] {
+				before := m
+				if err := tx.Delete(&m).Error; err != nil {
+					return err
+				}
+				if err := auditMilestone(tx, s.actor, models.AuditActionDelete, &before, nil); err != nil {
+					return err
+				}
+				continue
+			}
+			byType[m.Type] = m
+		}
+
+		for _, item := range items {
+			milestone, exists := byType[item.Type]
+			before := milestone
+			milestone.OrderID = orderID
+			milestone.FactoryID = *order.FactoryID
+			milestone.Type = item.Type
+			milestone.Sequence = milestoneSequence(item.Type)
+			milestone.PlannedStart = item.PlannedStart
+			milestone.PlannedDue = item.PlannedDue
+			milestone.Note = item.Note
+			// 调整到未来的计划日期需要重新检测延期
+			if milestone.DelayedAt != nil && milestone.PlannedDue.After(time.Now()) {
+				milestone.DelayedAt = nil
+			}
+			if err := loadMilestoneActuals(tx, &milestone); err != nil {
+				return err
+			}
+			milestone.Status = milestoneStatus(&milestone, time.Now())
+
+			if err := tx.Save(&milestone).Error; err != nil {
+				return err
+			}
+			if exists {
+				if err := auditMilestone(tx, s.actor, models.AuditActionUpdate, &before, &milestone); err != nil {
+					return err
+				}
+			} else if err := auditMilestone(tx, s.actor, models.AuditActionCreate, nil, &milestone); err != nil {
+				return err
+			}
+		}
+
+		return publishOrderEvent(tx, orderID, models.RealtimeMilestonePlanned, models.OrderAccessViewer, map[string]interface{}{
+			"order_id":   orderID,
+			"factory_id": *order.FactoryID,
+			"count":      len(items),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPlan(orderID)
+}
+
+// GetPlan 获取订单的生产计划
+func (s *MilestoneService) GetPlan(orderID uint) ([]models.ProgressMilestone, error) {
+	var milestones []models.ProgressMilestone
+	err := s.db.Where("order_id = ?", orderID).Order("sequence ASC, planned_start ASC").Find(&milestones).Error
+	return milestones, err
+}
+
+// GetScheduleVariance 对比计划与实际进度，给出每个阶段的开始、完成偏差和整体预计完成时间
+func (s *MilestoneService) GetScheduleVariance(orderID uint) (*models.ScheduleVariance, error) {
+	milestones, err := s.GetPlan(orderID)
+	if err != nil {
+		return nil, err
+	}
+	var progress []models.OrderProgress
+	if err := s.db.Where("order_id = ?", orderID).Order("created_at DESC").Find(&progress).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	view := &models.ScheduleVariance{
+		OrderID:    orderID,
+		Milestones: make([]models.MilestoneVariance, 0, len(milestones)),
+		Progress:   progress,
+	}
+	allCompleted := true
+	for _, m := range milestones {
+		v := models.MilestoneVariance{ProgressMilestone: m}
+		switch {
+		case m.ActualStart != nil:
+			v.StartVarianceDays = varianceDays(*m.ActualStart, m.PlannedStart)
+		case now.After(m.PlannedStart):
+			v.StartVarianceDays = varianceDays(now, m.PlannedStart)
+		}
+		switch {
+		case m.ActualCompleted != nil:
+			v.FinishVarianceDays = varianceDays(*m.ActualCompleted, m.PlannedDue)
+			view.CompletedCount++
+		case now.After(m.PlannedDue):
+			v.FinishVarianceDays = varianceDays(now, m.PlannedDue)
+			v.Overdue = true
+		}
+		if m.ActualCompleted == nil {
+			allCompleted = false
+		}
+		if m.Status == models.ProgressStatusDelayed {
+			view.DelayedCount++
+		}
+		if v.FinishVarianceDays != nil && *v.FinishVarianceDays > view.MaxDelayDays {
+			view.MaxDelayDays = *v.FinishVarianceDays
+		}
+		if view.PlannedFinish == nil || m.PlannedDue.After(*view.PlannedFinish) {
+			due := m.PlannedDue
+			view.PlannedFinish = &due
+		}
+		view.Milestones = append(view.Milestones, v)
+	}
+
+	if view.PlannedFinish != nil && !allCompleted {
+		forecast := view.PlannedFinish.Add(time.Duration(view.MaxDelayDays * float64(24*time.Hour)))
+		view.ForecastFinish = &forecast
+	}
+	return view, nil
+}
+
+// DetectDelays 将已过计划完成日期但尚未完成的阶段标记为延期，并通知订单设计师；返回本次标记的数量
+func (s *MilestoneService) DetectDelays(now time.Time) (int, error) {
+	var candidates []uint
+	if err := s.db.Model(&models.ProgressMilestone{}).
+		Where("planned_due < ? AND actual_completed IS NULL AND delayed_at IS NULL", now).
+		Pluck("id", &candidates).Error; err != nil {
+		return 0, err
+	}
+
+	flagged := 0
+	for _, id := range candidates {
+		marked := false
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			var milestone models.ProgressMilestone
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&milestone, id).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil
+				}
+				return err
+			}
+			// 加锁后复核，期间可能已完成或计划已调整
+			if milestone.ActualCompleted != nil || milestone.DelayedAt != nil || !milestone.PlannedDue.Before(now) {
+				return nil
+			}
+
+			var order models.Order
+			if err := tx.Select("id", "title", "designer_id").First(&order, milestone.OrderID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil
+				}
+				return err
+			}
+
+			before := milestone
+			milestone.Status = models.ProgressStatusDelayed
+			milestone.DelayedAt = &now
+			if err := tx.Model(&milestone).Updates(map[string]interface{}{
+				"status":     milestone.Status,
+				"delayed_at": milestone.DelayedAt,
+			}).Error; err != nil {
+				return err
+			}
+			if err := auditMilestone(tx, models.SystemActor, models.AuditActionDelay, &before, &milestone); err != nil {
+				return err
+			}
+			if err := publishOrderEvent(tx, milestone.OrderID, models.RealtimeMilestoneDelayed, models.OrderAccessViewer, milestone); err != nil {
+				return err
+			}
+			marked = true
+			return notify(tx, models.SystemActor, notificationEvent{
+				Category:   models.NotificationMilestoneDelayed,
+				Title:      "生产计划阶段已逾期",
+				Content:    fmt.Sprintf("订单「%s」的%s阶段已超过计划完成日期 %s", order.Title, milestone.Type, milestone.PlannedDue.Format("2006-01-02")),
+				EntityType: models.AuditEntityMilestone,
+				EntityID:   milestone.ID,
+				OrderID:    &milestone.OrderID,
+			}, order.DesignerID)
+		})
+		if err != nil {
+			return flagged, err
+		}
+		if marked {
+			flagged++
+		}
+	}
+	return flagged, nil
+}
+
+// RunDelayMonitor 定期执行延期检测直到 ctx 结束
+func (s *MilestoneService) RunDelayMonitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			count, err := s.DetectDelays(time.Now())
+			if err != nil {
+				log.Printf("Milestone delay detection failed: %v", err)
+			} else if count > 0 {
+				log.Printf("Milestone delay detection flagged %d milestones", count)
+			}
+		}
+	}
+}
+
+// syncMilestone 进度记录变更后，在同一事务内同步对应计划阶段的实际时间和状态
+func syncMilestone(tx *gorm.DB, orderID uint, progressType models.ProgressType) error {
+	var milestone models.ProgressMilestone
+	if err := tx.Where("order_id = ? AND type = ?", orderID, progressType).First(&milestone).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if err := loadMilestoneActuals(tx, &milestone); err != nil {
+		return err
+	}
+	return tx.Model(&milestone).Updates(map[string]interface{}{
+		"actual_start":     milestone.ActualStart,
+		"actual_completed": milestone.ActualCompleted,
+		"status":           milestoneStatus(&milestone, time.Now()),
+	}).Error
+}
+
+// loadMilestoneActuals 根据同类型的进度记录计算阶段的实际开始和完成时间
+// 最早开始的记录视为阶段开始；全部记录都已完成时，最晚的完成时间视为阶段完成。
+func loadMilestoneActuals(tx *gorm.DB, milestone *models.ProgressMilestone) error {
+	var records []models.OrderProgress
+	if err := tx.Select("id", "status", "start_time", "completed_time", "created_at").
+		Where("order_id = ? AND type = ?", milestone.OrderID, milestone.Type).
+		Find(&records).Error; err != nil {
+		return err
+	}
+
+	milestone.ActualStart = nil
+	milestone.ActualCompleted = nil
+	allCompleted := len(records) > 0
+	for _, record := range records {
+		started := record.StartTime
+		if started == nil && record.Status != models.ProgressStatusNotStarted {
+			started = record.CreatedAt
+		}
+		if started != nil && (milestone.ActualStart == nil || started.Before(*milestone.ActualStart)) {
+			milestone.ActualStart = started
+		}
+
+		if record.Status != models.ProgressStatusCompleted {
+			allCompleted = false
+			continue
+		}
+		completed := record.CompletedTime
+		if completed == nil {
+			completed = record.CreatedAt
+		}
+		if completed != nil && (milestone.ActualCompleted == nil || completed.After(*milestone.ActualCompleted)) {
+			milestone.ActualCompleted = completed
+		}
+	}
+	if !allCompleted {
+		milestone.ActualCompleted = nil
+	}
+	if milestone.ActualCompleted != nil && milestone.ActualStart == nil {
+		milestone.ActualStart = milestone.ActualCompleted
+	}
+	return nil
+}
+
+// milestoneStatus 根据实际进度与计划日期推导阶段状态
+func milestoneStatus(milestone *models.ProgressMilestone, now time.Time) models.ProgressStatus {
+	switch {
+	case milestone.ActualCompleted != nil:
+		return models.ProgressStatusCompleted
+	case now.After(milestone.PlannedDue):
+		return models.ProgressStatusDelayed
+	case milestone.ActualStart != nil:
+		return models.ProgressStatusInProgress
+	}
+	return models.ProgressStatusNotStarted
+}
+
+func milestoneSequence(progressType models.ProgressType) int {
+	for i, t := range milestoneTypes {
+		if t == progressType {
+			return i
+		}
+	}
+	return -1
+}
+
+func varianceDays(actual, planned time.Time) *float64 {
+	days := math.Round(actual.Sub(planned).Hours()/24*10) / 10
+	return &days
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gongChang/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrUnknownNotificationCategory = errors.New("未知的通知类别")
+
+// notificationEvent 一次需要通知的领域事件
+type notificationEvent struct {
+	Category   models.NotificationCategory
+	Title      string
+	Content    string
+	EntityType string
+	EntityID   interface{}
+	OrderID    *uint
+}
+
+// notify 在调用方事务内为每个接收人生成通知；跳过操作人本人和静音该类别的用户
+func notify(tx *gorm.DB, actor models.Actor, event notificationEvent, recipients ...string) error {
+	seen := make(map[string]bool, len(recipients))
+	targets := make([]string, 0, len(recipients))
+	for _, userID := range recipients {
+		if userID == "" || userID == actor.UserID || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		targets = append(targets, userID)
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	var muted []string
+	if err := tx.Model(&models.NotificationPreference{}).
+		Where("user_id IN ? AND category = ? AND muted = ?", targets, event.Category, true).
+		Pluck("user_id", &muted).Error; err != nil {
+		return err
+	}
+	mutedSet := make(map[string]bool, len(muted))
+	for _, userID := range muted {
+		mutedSet[userID] = true
+	}
+
+	entityID := ""
+	if event.EntityID != nil {
+		entityID = fmt.Sprint(event.EntityID)
+	}
+	notifications := make([]models.Notification, 0, len(targets))
+	for _, userID := range targets {
+		if mutedSet[userID] {
+			continue
+		}
+		notifications = append(notifications, models.Notification{
+			UserID:     userID,
+			Category:   event.Category,
+			Title:      event.Title,
+			Content:    event.Content,
+			EntityType: event.EntityType,
+			EntityID:   entityID,
+			OrderID:    event.OrderID,
+		})
+	}
+	if len(notifications) == 0 {
+		return nil
+	}
+	if err := tx.Create(&notifications).Error; err != nil {
+		return err
+	}
+
+	// 通知同时推送到接收人的个人频道
+	for i := range notifications {
+		if err := publishEvent(tx, models.UserChannel(notifications[i].UserID), models.RealtimeNotificationCreated, models.OrderAccessNone, notifications[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NotificationService 站内通知查询与订阅管理
+type NotificationService struct {
+	db *gorm.DB
+}
+
+func NewNotificationService(db *gorm.DB) *NotificationService {
+	return &NotificationService{db: db}
+}
+
+// ListNotifications 获取用户的通知列表，按时间倒序
+func (s *NotificationService) ListNotifications(userID string, q *models.NotificationListQuery) ([]models.Notification, int64, error) {
+	query := s.db.Model(&models.Notification{}).Where("user_id = ?", userID)
+	if q.UnreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+	if q.Category != "" {
+		query = query.Where("category = ?", q.Category)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.PageSize <= 0 || q.PageSize > 100 {
+		q.PageSize = 20
+	}
+
+	var notifications []models.Notification
+	err := query.Order("id DESC").Offset((q.Page - 1) * q.PageSize).Limit(q.PageSize).Find(&notifications).Error
+	return notifications, total, err
+}
+
+// GetUnreadCount 获取用户未读通知数量，含按类别统计
+func (s *NotificationService) GetUnreadCount(userID string) (*models.UnreadNotificationCount, error) {
+	var rows []struct {
+		Category models.NotificationCategory
+		Count    int64
+	}
+	if err := s.db.Model(&models.Notification{}).
+		Select("category, COUNT(*) AS count").
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Group("category").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result := &models.UnreadNotificationCount{ByCategory: make(map[models.NotificationCategory]int64)}
+	for _, row := range rows {
+		result.ByCategory[row.Category] = row.Count
+		result.Total += row.Count
+	}
+	return result, nil
+}
+
+// MarkNotifications 将用户的指定通知标记为已读或未读，返回实际更新的数量
+func (s *NotificationService) MarkNotifications(userID string, ids []uint, read bool) (int64, error) {
+	var readAt interface{}
+	if read {
+		readAt = time.Now()
+	}
+	query := s.db.Model(&models.Notification{}).Where("user_id = ? AND id IN ?", userID, ids)
+	if read {
+		query = query.Where("read_at IS NULL")
+	} else {
+		query = query.Where("read_at IS NOT NULL")
+	}
+	res := query.Update("read_at", readAt)
+	return res.RowsAffected, res.Error
+}
+
+// MarkAllRead 将用户全部未读通知标记为已读
+func (s *NotificationService) MarkAllRead(userID string) (int64, error) {
+	res := s.db.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", time.Now())
+	return res.RowsAffected, res.Error
+}
+
+// GetPreferences 获取用户对所有通知类别的订阅设置，未设置的类别默认不静音
+func (s *NotificationService) GetPreferences(userID string) ([]models.NotificationPreference, error) {
+	var saved []models.NotificationPreference
+	if err := s.db.Where("user_id = ?", userID).Find(&saved).Error; err != nil {
+		return nil, err
+	}
+	byCategory := make(map[models.NotificationCategory]models.NotificationPreference, len(saved))
+	for _, pref := range saved {
+		byCategory[pref.Category] = pref
+	}
+
+	prefs := make([]models.NotificationPreference, 0, len(models.AllNotificationCategories))
+	for _, category := range models.AllNotificationCategories {
+		pref, ok := byCategory[category]
+		if !ok {
+			pref = models.NotificationPreference{UserID: userID, Category: category}
+		}
+		prefs = append(prefs, pref)
+	}
+	return prefs, nil
+}
+
+// UpdatePreferences 更新用户的通知静音设置
+func (s *NotificationService) UpdatePreferences(userID string, muted map[models.NotificationCategory]bool) ([]models.NotificationPreference, error) {
+	for category := range muted {
+		if !category.IsValid() {
+			return nil, ErrUnknownNotificationCategory
+		}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for category, isMuted := range muted {
+			pref := models.NotificationPreference{UserID: userID, Category: category, Muted: isMuted}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}, {Name: "category"}},
+				DoUpdates: clause.AssignmentColumns([]string{"muted", "updated_at"}),
+			}).Create(&pref).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPreferences(userID)
+}
@@ -1,15 +1,16 @@
 package services
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"gongChang/models"
-	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type OrderService struct {
-	db *gorm.DB
+	db    *gorm.DB
+	actor models.Actor
 }
 
 func NewOrderService(db *gorm.DB) *OrderService {
@@ -18,7 +19,44 @@ func NewOrderService(db *gorm.DB) *OrderService {
 	}
 }
 
+// WithActor 返回绑定操作人的服务副本，写操作将以该操作人记录审计事件
+func (s *OrderService) WithActor(actor models.Actor) *OrderService {
+	c := *s
+	c.actor = actor
+	return &c
+}
+
+// auditOrder 记录订单变更的审计事件
+func (s *OrderService) auditOrder(tx *gorm.DB, action string, before, after *models.Order) error {
+	target := after
+	if target == nil {
+		target = before
+	}
+	orderID := target.ID
+	return recordAudit(tx, s.actor, auditEntry{
+		EntityType: models.AuditEntityOrder,
+		EntityID:   orderID,
+		Action:     action,
+		OrderID:    &orderID,
+		OwnerID:    target.DesignerID,
+		Before:     before,
+		After:      after,
+	})
+}
+
 func (s *OrderService) CreateOrder(order *models.Order) error {
+	// 新订单只能以草稿或已发布状态创建，后续变更必须经过状态机
+	if order.Status == "" {
+		order.Status = models.OrderStatusDraft
+	}
+	if order.Status != models.OrderStatusDraft && order.Status != models.OrderStatusPublished {
+		return &InvalidStatusTransitionError{From: "", To: order.Status}
+	}
+	// 有尺码 × 颜色明细时数量和总价由明细汇总，明细随订单一起创建
+	if len(order.Lines) > 0 {
+		order.Quantity, order.TotalPrice = orderLineTotals(order.Lines, order.UnitPrice)
+	}
+
 	// 使用事务确保数据一致性
 	return s.db.Transaction(func(tx *gorm.DB) error {
 		// 创建订单
@@ -26,86 +64,42 @@ func (s *OrderService) CreateOrder(order *models.Order) error {
 			return err
 		}
 
-		// 如果有文件ID，创建文件关联
-		if order.Attachments != nil || order.Models != nil || order.Images != nil || order.Videos != nil {
-			// 获取所有文件ID
-			var fileIDs []string
-			if order.Attachments != nil {
-				var attachments []string
-				if err := json.Unmarshal(*order.Attachments, &attachments); err == nil {
-					fileIDs = append(fileIDs, attachments...)
-				}
-			}
-			if order.Models != nil {
-				var models []string
-				if err := json.Unmarshal(*order.Models, &models); err == nil {
-					fileIDs = append(fileIDs, models...)
-				}
-			}
-			if order.Images != nil {
-				var images []string
-				if err := json.Unmarshal(*order.Images, &images); err == nil {
-					fileIDs = append(fileIDs, images...)
-				}
-			}
-			if order.Videos != nil {
-				var videos []string
-				if err := json.Unmarshal(*order.Videos, &videos); err == nil {
-					fileIDs = append(fileIDs, videos...)
-				}
-			}
+		// 记录初始状态
+		if err := tx.Create(&models.OrderStatusHistory{
+			OrderID:      order.ID,
+			ToStatus:     order.Status,
+			OperatorID:   order.DesignerID,
+			OperatorRole: string(models.RoleDesigner),
+			Reason:       "创建订单",
+		}).Error; err != nil {
+			return err
+		}
 
-			// 更新文件记录，设置OrderID
-			if len(fileIDs) > 0 {
-				if err := tx.Model(&models.File{}).Where("id IN ?", fileIDs).Update("order_id", order.ID).Error; err != nil {
-					return err
-				}
+		// 文件关联统一保存在 order_files
+		for _, role := range models.OrderFileRoles {
+			if err := setOrderFiles(tx, order.ID, role, order.FileIDs(role)); err != nil {
+				return err
 			}
 		}
+		if err := LoadOrderFiles(tx, order); err != nil {
+			return err
+		}
 
-		return nil
+		return s.auditOrder(tx, models.AuditActionCreate, nil, order)
 	})
 }
 
 func (s *OrderService) GetOrderByID(orderID uint) (*models.Order, error) {
 	var order models.Order
-	err := s.db.Preload("Files").First(&order, orderID).Error
-	if err != nil {
+	if err := s.db.First(&order, orderID).Error; err != nil {
 		return nil, err
 	}
-
-	// 如果数据库中的JSON字段为空，则设置为空数组
-	if order.Attachments == nil {
-		emptyArray := []string{}
-		jsonData, _ := json.Marshal(emptyArray)
-		order.Attachments = (*datatypes.JSON)(&jsonData)
-	}
-
-	if order.Models == nil {
-		emptyArray := []string{}
-		jsonData, _ := json.Marshal(emptyArray)
-		order.Models = (*datatypes.JSON)(&jsonData)
-	}
-
-	if order.Images == nil {
-		emptyArray := []string{}
-		jsonData, _ := json.Marshal(emptyArray)
-		order.Images = (*datatypes.JSON)(&jsonData)
-	}
-
-	if order.Videos == nil {
-		emptyArray := []string{}
-		jsonData, _ := json.Marshal(emptyArray)
-		order.Videos = (*datatypes.JSON)(&jsonData)
+	if err := LoadOrderFiles(s.db, &order); err != nil {
+		return nil, err
 	}
-
 	return &order, nil
 }
 
-func (s *OrderService) UpdateOrderStatus(orderID uint, status models.OrderStatus) error {
-	return s.db.Model(&models.Order{}).Where("id = ?", orderID).Update("status", status).Error
-}
-
 func (s *OrderService) SearchOrders(query string, factoryID string) ([]models.Order, error) {
 	var orders []models.Order
 	err := s.db.Where("factory_id = ? AND (description LIKE ? OR title LIKE ?)", 
@@ -144,7 +138,7 @@ func (s *OrderService) GetOrderStatistics(factoryID string) (*models.OrderStatis
 
 	// 获取各状态订单数量
 	stats.StatusCounts = make(map[string]int64)
-	for _, status := range []models.OrderStatus{models.OrderStatusDraft, models.OrderStatusPublished, models.OrderStatusCompleted, models.OrderStatusCancelled} {
+	for _, status := range models.AllOrderStatuses {
 		var count int64
 		err = s.db.Model(&models.Order{}).Where("factory_id = ? AND status = ?", factoryID, status).Count(&count).Error
 		if err != nil {
@@ -181,7 +175,14 @@ func (s *OrderService) GetOrdersByUserID(userID string, status string, page int,
 		Offset((page - 1) * pageSize).Limit(pageSize).
 		Order("id desc").
 		Find(&orders).Error
-	return orders, err
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]*models.Order, len(orders))
+	for i := range orders {
+		refs[i] = &orders[i]
+	}
+	return orders, LoadOrderFiles(s.db, refs...)
 }
 
 func (s *OrderService) GetOrdersCount(userID string, status string) (int64, error) {
@@ -195,12 +196,6 @@ func (s *OrderService) GetOrdersCount(userID string, status string) (int64, erro
 }
 
 func (s *OrderService) UpdateOrder(orderID uint, req *models.OrderUpdateRequest) error {
-	// 首先获取现有订单数据
-	var existingOrder models.Order
-	if err := s.db.First(&existingOrder, orderID).Error; err != nil {
-		return err
-	}
-
 	order := &models.Order{
 		Title:             req.Title,
 		Description:       req.Description,
@@ -214,84 +209,99 @@ func (s *OrderService) UpdateOrder(orderID uint, req *models.OrderUpdateRequest)
 		OrderDate:         req.OrderDate,
 		SpecialRequirements: req.SpecialRequirements,
 	}
+	// 状态字段不直接写入，请求中给出新状态时在同一事务内经状态机变更
 
-	if req.Status != "" {
-		order.Status = models.OrderStatus(req.Status)
-	}
-
-	// 处理文件关联 - 总是更新这些字段，即使为空
-	if req.Attachments != nil {
-		attachmentsJSON, _ := json.Marshal(req.Attachments)
-		jsonData := datatypes.JSON(attachmentsJSON)
-		order.Attachments = &jsonData
-	} else {
-		// 如果请求中没有attachments字段，设置为空数组
-		emptyArray := []string{}
-		attachmentsJSON, _ := json.Marshal(emptyArray)
-		jsonData := datatypes.JSON(attachmentsJSON)
-		order.Attachments = &jsonData
-	}
-
-	if req.Models != nil {
-		modelsJSON, _ := json.Marshal(req.Models)
-		jsonData := datatypes.JSON(modelsJSON)
-		order.Models = &jsonData
-	} else {
-		// 如果请求中没有models字段，设置为空数组
-		emptyArray := []string{}
-		modelsJSON, _ := json.Marshal(emptyArray)
-		jsonData := datatypes.JSON(modelsJSON)
-		order.Models = &jsonData
-	}
-
-	// 处理Images字段 - 实现合并逻辑而不是覆盖
-	if req.Images != nil {
-		// 获取现有的图片ID列表
-		var existingImages []string
-		if existingOrder.Images != nil {
-			json.Unmarshal(*existingOrder.Images, &existingImages)
-		}
-		
-		// 合并现有图片ID和新图片ID，去重
-		imageMap := make(map[string]bool)
-		for _, img := range existingImages {
-			imageMap[img] = true
-		}
-		for _, img := range req.Images {
-			imageMap[img] = true
-		}
-		
-		// 转换回切片
-		mergedImages := make([]string, 0, len(imageMap))
-		for img := range imageMap {
-			mergedImages = append(mergedImages, img)
-		}
-		
-		imagesJSON, _ := json.Marshal(mergedImages)
-		jsonData := datatypes.JSON(imagesJSON)
-		order.Images = &jsonData
-	} else {
-		// 如果请求中没有images字段，保持现有图片不变
-		order.Images = existingOrder.Images
+	// 请求中给出的文件列表替换订单对应用途的文件，未给出的保持不变；图片在现有图片后追加
+	fileLists := map[models.OrderFileRole][]string{
+		models.OrderFileRoleAttachment: req.Attachments,
+		models.OrderFileRoleModel:      req.Models,
+		models.OrderFileRoleVideo:      req.Videos,
 	}
 
-	if req.Videos != nil {
-		videosJSON, _ := json.Marshal(req.Videos)
-		jsonData := datatypes.JSON(videosJSON)
-		order.Videos = &jsonData
-	} else {
-		// 如果请求中没有videos字段，设置为空数组
-		emptyArray := []string{}
-		videosJSON, _ := json.Marshal(emptyArray)
-		jsonData := datatypes.JSON(videosJSON)
-		order.Videos = &jsonData
+	// 请求中给出明细时数量和总价由明细汇总，忽略请求中的数量
+	var lines []models.OrderLine
+	if req.Lines != nil {
+		var err error
+		if lines, err = NewOrderLines(req.Lines); err != nil {
+			return err
+		}
+		order.Quantity = 0
 	}
 
-	return s.db.Model(&models.Order{}).Where("id = ?", orderID).Updates(order).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		before, err := lockOrderWithFiles(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if req.Lines == nil && order.Quantity != 0 && order.Quantity != before.Quantity {
+			var lineCount int64
+			if err := tx.Model(&models.OrderLine{}).Where("order_id = ?", orderID).Count(&lineCount).Error; err != nil {
+				return err
+			}
+			if lineCount > 0 {
+				return ErrOrderLineQuantityLocked
+			}
+		}
+		if req.Status != "" && models.OrderStatus(req.Status) != before.Status {
+			current := *before
+			if err := manualStatusChange(tx, s.actor, &current, StatusChange{
+				To:     models.OrderStatus(req.Status),
+				Reason: "更新订单",
+			}); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.Order{}).Where("id = ?", orderID).Updates(order).Error; err != nil {
+			return err
+		}
+		if lines != nil {
+			current := *before
+			if err := replaceOrderLines(tx, &current, lines); err != nil {
+				return err
+			}
+		}
+		if req.Images != nil {
+			fileLists[models.OrderFileRoleImage] = append(append([]string{}, before.Images...), req.Images...)
+		}
+		for role, ids := range fileLists {
+			if ids == nil {
+				continue
+			}
+			if err := setOrderFiles(tx, orderID, role, ids); err != nil {
+				return err
+			}
+		}
+		var updated models.Order
+		if err := tx.First(&updated, orderID).Error; err != nil {
+			return err
+		}
+		if err := LoadOrderFiles(tx, &updated); err != nil {
+			return err
+		}
+		// 订单数量变化后，已按物料清单预留的布料跟随调整
+		if updated.Quantity != before.Quantity && !orderClosed(updated.Status) {
+			if err := s.syncBOMReservations(tx, &updated, nil, true); err != nil {
+				return err
+			}
+		}
+		return s.auditOrder(tx, models.AuditActionUpdate, before, &updated)
+	})
 }
 
 func (s *OrderService) DeleteOrder(orderID uint) error {
-	return s.db.Delete(&models.Order{}, orderID).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.First(&order, orderID).Error; err != nil {
+			return err
+		}
+		if err := NewFabricService(tx).WithActor(s.actor).ReleaseOrderReservations(tx, orderID, 0, "订单已删除"); err != nil {
+			return err
+		}
+		if err := tx.Delete(&order).Error; err != nil {
+			return err
+		}
+		return s.auditOrder(tx, models.AuditActionDelete, &order, nil)
+	})
 }
 
 func (s *OrderService) GetPublicOrders(page, pageSize int) ([]models.PublicOrder, error) {
@@ -318,64 +328,95 @@ func (s *OrderService) GetPublicOrdersCount() (int64, error) {
 	return count, err
 }
 
-// AddFabricToOrder 添加布料到订单
-func (s *OrderService) AddFabricToOrder(orderID uint, req *models.AddFabricToOrderRequest, fabricService *FabricService) (*models.AddFabricToOrderResponse, error) {
+// AddFabricToOrder 添加布料到订单，FabricID 为空时按请求创建新布料；Quantity 大于 0 时同时为订单预留该数量
+func (s *OrderService) AddFabricToOrder(orderID uint, req *models.AddFabricToOrderRequest) (*models.AddFabricToOrderResponse, error) {
 	// 使用事务确保数据一致性
 	var response *models.AddFabricToOrderResponse
 	err := s.db.Transaction(func(tx *gorm.DB) error {
-		// 1. 验证订单是否存在
+		// 1. 锁定订单，避免并发修改布料列表
 		var order models.Order
-		if err := tx.First(&order, orderID).Error; err != nil {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOrderNotFound
+			}
 			return err
 		}
-
-		// 2. 创建布料请求
-		fabricReq := &models.FabricRequest{
-			Name:         req.Name,
-			Category:     req.Category,
-			Material:     req.Material,
-			Color:        req.Color,
-			Pattern:      req.Pattern,
-			Weight:       req.Weight,
-			Width:        req.Width,
-			Price:        req.Price,
-			Unit:         req.Unit,
-			Stock:        req.Stock,
-			MinOrder:     req.MinOrder,
-			Description:  req.Description,
-			ImageURL:     req.ImageURL,
-			ThumbnailURL: req.ThumbnailURL,
-			Tags:         req.Tags,
-		}
-
-		// 3. 创建布料
-		fabric, err := fabricService.CreateFabric(fabricReq)
-		if err != nil {
-			return err
+		fabricService := NewFabricService(tx).WithActor(s.actor)
+
+		// 2. 关联已有布料，或创建新布料
+		var fabric *models.Fabric
+		if req.FabricID != 0 {
+			existing, err := fabricService.GetFabricByID(req.FabricID)
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return ErrFabricNotFound
+				}
+				return err
+			}
+			fabric = existing
+		} else {
+			fabricReq := &models.FabricRequest{
+				Name:         req.Name,
+				Category:     req.Category,
+				Material:     req.Material,
+				Color:        req.Color,
+				Pattern:      req.Pattern,
+				Weight:       req.Weight,
+				Width:        req.Width,
+				Price:        req.Price,
+				Unit:         req.Unit,
+				Stock:        req.Stock,
+				MinOrder:     req.MinOrder,
+				Description:  req.Description,
+				ImageURL:     req.ImageURL,
+				ThumbnailURL: req.ThumbnailURL,
+				Tags:         req.Tags,
+			}
+			created, err := fabricService.CreateFabric(fabricReq)
+			if err != nil {
+				return err
+			}
+			fabric = created
 		}
 
-		// 4. 更新订单的Fabrics字段
+		// 3. 更新订单的Fabrics字段
 		var fabricIDList models.FabricIDList
 		if err := fabricIDList.FromCommaString(order.Fabrics); err != nil {
 			// 如果解析失败，创建空列表
 			fabricIDList = make(models.FabricIDList, 0)
 		}
+		associationCreated := false
+		if !fabricIDList.ContainsFabricID(fabric.ID) {
+			fabricIDList.AddFabricID(fabric.ID)
+			before := order
+			if err := tx.Model(&order).Update("fabrics", fabricIDList.ToCommaString()).Error; err != nil {
+				return err
+			}
+			if err := s.auditOrder(tx, models.AuditActionUpdate, &before, &order); err != nil {
+				return err
+			}
+			associationCreated = true
+		}
 
-		// 添加新布料ID
-		fabricIDList.AddFabricID(fabric.ID)
-
-		// 更新订单的Fabrics字段
-		newFabricsStr := fabricIDList.ToCommaString()
-		if err := tx.Model(&order).Update("fabrics", newFabricsStr).Error; err != nil {
-			return err
+		// 4. 为订单预留布料，可用库存不足时整个操作回滚
+		var reservation *models.FabricLedgerEntry
+		if req.Quantity > 0 {
+			entry, err := fabricService.ReserveForOrder(tx, fabric.ID, orderID, req.Quantity)
+			if err != nil {
+				return err
+			}
+			reservation = entry
+			fabric.Stock = entry.StockAfter
+			fabric.Reserved = entry.ReservedAfter
 		}
 
 		// 5. 构建响应
 		response = &models.AddFabricToOrderResponse{
-			Message:           "布料添加成功",
-			Fabric:            fabric,
-			OrderID:           orderID,
-			AssociationCreated: true,
+			Message:            "布料添加成功",
+			Fabric:             fabric,
+			OrderID:            orderID,
+			AssociationCreated: associationCreated,
+			Reservation:        reservation,
 		}
 
 		return nil
@@ -415,13 +456,14 @@ func (s *OrderService) GetOrderFabrics(orderID uint) ([]models.Fabric, error) {
 }
 
 // RemoveFabricFromOrder 从订单移除布料
-func (s *OrderService) RemoveFabricFromOrder(orderID uint, req *models.RemoveFabricFromOrderRequest, fabricService *FabricService) (*models.RemoveFabricFromOrderResponse, error) {
+// 订单对该布料的预留同时释放。
+func (s *OrderService) RemoveFabricFromOrder(orderID uint, req *models.RemoveFabricFromOrderRequest) (*models.RemoveFabricFromOrderResponse, error) {
 	var response *models.RemoveFabricFromOrderResponse
 
 	err := s.db.Transaction(func(tx *gorm.DB) error {
 		// 1. 检查订单是否存在
 		var order models.Order
-		if err := tx.First(&order, orderID).Error; err != nil {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
 				return fmt.Errorf("订单不存在")
 			}
@@ -453,12 +495,21 @@ func (s *OrderService) RemoveFabricFromOrder(orderID uint, req *models.RemoveFab
 		fabricIDList.RemoveFabricID(req.FabricID)
 
 		// 6. 更新订单的布料字段
+		before := order
 		newFabricsStr := fabricIDList.ToCommaString()
 		if err := tx.Model(&order).Update("fabrics", newFabricsStr).Error; err != nil {
 			return err
 		}
+		if err := s.auditOrder(tx, models.AuditActionUpdate, &before, &order); err != nil {
+			return err
+		}
+
+		// 7. 释放订单对该布料的预留
+		if err := NewFabricService(tx).WithActor(s.actor).ReleaseOrderReservations(tx, orderID, req.FabricID, "从订单移除布料"); err != nil {
+			return err
+		}
 
-		// 7. 构建响应
+		// 8. 构建响应
 		response = &models.RemoveFabricFromOrderResponse{
 			Success: true,
 			Message: "布料已从订单中移除",
@@ -477,111 +528,15 @@ func (s *OrderService) RemoveFabricFromOrder(orderID uint, req *models.RemoveFab
 
 // RemoveFileFromOrder 从订单移除文件
 func (s *OrderService) RemoveFileFromOrder(orderID uint, req *models.RemoveFileFromOrderRequest) (*models.RemoveFileFromOrderResponse, error) {
-	var response *models.RemoveFileFromOrderResponse
-
-	err := s.db.Transaction(func(tx *gorm.DB) error {
-		// 1. 检查订单是否存在
-		var order models.Order
-		if err := tx.First(&order, orderID).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				return fmt.Errorf("订单不存在")
-			}
-			return err
-		}
-
-		// 2. 检查文件是否存在
-		var file models.File
-		if err := tx.Where("id = ?", req.FileID).First(&file).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				return fmt.Errorf("文件不存在")
-			}
-			return err
-		}
-
-		// 3. 根据文件类型更新订单的相应字段
-		var existingFiles []string
-		var fieldName string
-
-		switch req.FileType {
-		case "image":
-			if order.Images != nil {
-				json.Unmarshal(*order.Images, &existingFiles)
-			}
-			fieldName = "images"
-		case "attachment":
-			if order.Attachments != nil {
-				json.Unmarshal(*order.Attachments, &existingFiles)
-			}
-			fieldName = "attachments"
-		case "model":
-			if order.Models != nil {
-				json.Unmarshal(*order.Models, &existingFiles)
-			}
-			fieldName = "models"
-		case "video":
-			if order.Videos != nil {
-				json.Unmarshal(*order.Videos, &existingFiles)
-			}
-			fieldName = "videos"
-		default:
-			return fmt.Errorf("不支持的文件类型: %s", req.FileType)
-		}
-
-		// 4. 从数组中移除指定的文件ID
-		var newFiles []string
-		found := false
-		for _, fileID := range existingFiles {
-			if fileID == req.FileID {
-				found = true
-			} else {
-				newFiles = append(newFiles, fileID)
-			}
-		}
-
-		if !found {
-			return fmt.Errorf("订单中不包含该文件")
-		}
-
-		// 5. 更新订单的相应字段
-		var jsonData datatypes.JSON
-		if len(newFiles) > 0 {
-			jsonBytes, _ := json.Marshal(newFiles)
-			jsonData = datatypes.JSON(jsonBytes)
-		} else {
-			// 如果数组为空，设置为空数组
-			emptyArray := []string{}
-			jsonBytes, _ := json.Marshal(emptyArray)
-			jsonData = datatypes.JSON(jsonBytes)
-		}
-
-		// 6. 更新订单
-		updateData := map[string]interface{}{
-			fieldName: jsonData,
-		}
-		if err := tx.Model(&order).Updates(updateData).Error; err != nil {
-			return err
-		}
-
-		// 7. 重新获取更新后的订单
-		if err := tx.First(&order, orderID).Error; err != nil {
-			return err
-		}
-
-		// 8. 构建响应
-		response = &models.RemoveFileFromOrderResponse{
-			Success: true,
-			Message: fmt.Sprintf("文件已从订单的%s中移除", req.FileType),
-			Order:   &order,
-		}
-
-		return nil
-	})
-
+	order, err := s.DetachOrderFile(orderID, req.FileID, models.OrderFileRole(req.FileType))
 	if err != nil {
 		return nil, err
 	}
-
-	return response, nil
+	return &models.RemoveFileFromOrderResponse{
+		Success: true,
+		Message: fmt.Sprintf("文件已从订单的%s中移除", req.FileType),
+		Order:   order,
+	}, nil
 }
 
 // GetDB 获取数据库连接
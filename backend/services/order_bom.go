@@ -0,0 +1,287 @@
+package services
+
+import (
+	"errors"
+	"gongChang/models"
+	"math"
+	"sort"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrBOMFabricRequired   = errors.New("布料行必须指定布料")
+	ErrBOMDuplicateFabric  = errors.New("同一布料在物料清单中只能出现一次")
+	ErrBOMTrimNameRequired = errors.New("辅料行必须填写名称")
+)
+
+// bomReservationNote 按物料清单调整预留时的流水备注
+const bomReservationNote = "按物料清单调整预留"
+
+// bomRequired 订单数量 × 每件用量 × (1 + 损耗率)，保留三位小数
+func bomRequired(quantity int, item *models.OrderBOMItem) float64 {
+	required := float64(quantity) * item.UsagePerGarment * (1 + item.WastagePercent/100)
+	return math.Round(required*1000) / 1000
+}
+
+// bomReserveQuantity 布料库存按整数单位记录，需求向上取整
+func bomReserveQuantity(required float64) int {
+	return int(math.Ceil(required))
+}
+
+// roundMoney 金额保留两位小数
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// orderClosed 已完成或已取消的订单不再调整预留
+func orderClosed(status models.OrderStatus) bool {
+	return status == models.OrderStatusCompleted || status == models.OrderStatusCancelled
+}
+
+// loadOrderBOMItems 订单的物料清单行，按清单顺序排列并带出布料
+func loadOrderBOMItems(tx *gorm.DB, orderID uint) ([]models.OrderBOMItem, error) {
+	items := make([]models.OrderBOMItem, 0)
+	err := tx.Preload("Fabric").Where("order_id = ?", orderID).Order("sort_order, id").Find(&items).Error
+	return items, err
+}
+
+// buildOrderBOM 按订单数量计算物料清单每行的需求、预留和成本并汇总
+func buildOrderBOM(tx *gorm.DB, order *models.Order) (*models.OrderBOM, error) {
+	items, err := loadOrderBOMItems(tx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		FabricID uint
+		Reserved int
+	}
+	if err := tx.Model(&models.FabricLedgerEntry{}).
+		Select("fabric_id, SUM(reserved_delta) AS reserved").
+		Where("order_id = ?", order.ID).
+		Group("fabric_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	reserved := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		reserved[row.FabricID] = row.Reserved
+	}
+
+	bom := &models.OrderBOM{
+		OrderID:  order.ID,
+		Quantity: order.Quantity,
+		Items:    make([]models.OrderBOMLine, 0, len(items)),
+	}
+	for _, item := range items {
+		line := models.OrderBOMLine{
+			OrderBOMItem:     item,
+			RequiredQuantity: bomRequired(order.Quantity, &item),
+			UnitPrice:        item.UnitCost,
+		}
+		if item.Type == models.OrderBOMFabric && item.Fabric != nil {
+			line.UnitPrice = item.Fabric.Price
+			line.ReserveQuantity = bomReserveQuantity(line.RequiredQuantity)
+			line.Reserved = reserved[item.Fabric.ID]
+			if line.Name == "" {
+				line.Name = item.Fabric.Name
+			}
+			line.Unit = item.Fabric.Unit
+		}
+		line.Cost = roundMoney(line.RequiredQuantity * line.UnitPrice)
+		if item.Type == models.OrderBOMFabric {
+			bom.FabricCost += line.Cost
+		} else {
+			bom.TrimCost += line.Cost
+		}
+		bom.Items = append(bom.Items, line)
+	}
+	bom.FabricCost = roundMoney(bom.FabricCost)
+	bom.TrimCost = roundMoney(bom.TrimCost)
+	bom.MaterialCost = roundMoney(bom.FabricCost + bom.TrimCost)
+	if order.Quantity > 0 {
+		bom.MaterialCostPerUnit = roundMoney(bom.MaterialCost / float64(order.Quantity))
+	}
+	return bom, nil
+}
+
+// GetOrderBOM 订单的物料清单及成本汇总
+func (s *OrderService) GetOrderBOM(orderID uint) (*models.OrderBOM, error) {
+	var order models.Order
+	if err := s.db.First(&order, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	return buildOrderBOM(s.db, &order)
+}
+
+// SaveOrderBOM 整体替换订单的物料清单，把清单中的布料加入订单的布料列表，
+// 并按清单需求调整订单对布料的预留；从清单移除的布料释放预留。可用库存不足时整个操作回滚。
+func (s *OrderService) SaveOrderBOM(orderID uint, req *models.SaveOrderBOMRequest) (*models.OrderBOM, error) {
+	var bom *models.OrderBOM
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOrderNotFound
+			}
+			return err
+		}
+
+		items := make([]models.OrderBOMItem, 0, len(req.Items))
+		seen := make(map[uint]bool)
+		for i, itemReq := range req.Items {
+			item := models.OrderBOMItem{
+				OrderID:         orderID,
+				Type:            itemReq.Type,
+				Name:            itemReq.Name,
+				Unit:            itemReq.Unit,
+				UsagePerGarment: itemReq.UsagePerGarment,
+				WastagePercent:  itemReq.WastagePercent,
+				UnitCost:        itemReq.UnitCost,
+				Note:            itemReq.Note,
+				SortOrder:       i,
+			}
+			if itemReq.Type == models.OrderBOMFabric {
+				if itemReq.FabricID == nil || *itemReq.FabricID == 0 {
+					return ErrBOMFabricRequired
+				}
+				if seen[*itemReq.FabricID] {
+					return ErrBOMDuplicateFabric
+				}
+				seen[*itemReq.FabricID] = true
+				var count int64
+				if err := tx.Model(&models.Fabric{}).Where("id = ?", *itemReq.FabricID).Count(&count).Error; err != nil {
+					return err
+				}
+				if count == 0 {
+					return ErrFabricNotFound
+				}
+				fabricID := *itemReq.FabricID
+				item.FabricID = &fabricID
+				// 布料的单价和单位以布料为准
+				item.UnitCost = 0
+				item.Unit = ""
+			} else if itemReq.Name == "" {
+				return ErrBOMTrimNameRequired
+			}
+			items = append(items, item)
+		}
+
+		previous, err := loadOrderBOMItems(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("order_id = ?", orderID).Delete(&models.OrderBOMItem{}).Error; err != nil {
+			return err
+		}
+		if len(items) > 0 {
+			if err := tx.Create(&items).Error; err != nil {
+				return err
+			}
+		}
+
+		// 清单中的布料同时出现在订单的布料列表中
+		var fabricIDList models.FabricIDList
+		if err := fabricIDList.FromCommaString(order.Fabrics); err != nil {
+			fabricIDList = make(models.FabricIDList, 0)
+		}
+		before := order
+		for _, item := range items {
+			if item.FabricID != nil && !fabricIDList.ContainsFabricID(*item.FabricID) {
+				fabricIDList.AddFabricID(*item.FabricID)
+			}
+		}
+		if fabrics := fabricIDList.ToCommaString(); fabrics != order.Fabrics {
+			if err := tx.Model(&order).Update("fabrics", fabrics).Error; err != nil {
+				return err
+			}
+		}
+
+		if !req.SkipReservation && !orderClosed(order.Status) {
+			dropped := make([]uint, 0)
+			for _, item := range previous {
+				if item.FabricID != nil && !seen[*item.FabricID] {
+					dropped = append(dropped, *item.FabricID)
+				}
+			}
+			if err := s.syncBOMReservations(tx, &order, dropped, false); err != nil {
+				return err
+			}
+		}
+
+		if err := recordAudit(tx, s.actor, auditEntry{
+			EntityType: models.AuditEntityOrder,
+			EntityID:   orderID,
+			Action:     models.AuditActionUpdate,
+			OrderID:    &orderID,
+			OwnerID:    order.DesignerID,
+			Before:     map[string]interface{}{"fabrics": before.Fabrics, "bom": previous},
+			After:      map[string]interface{}{"fabrics": order.Fabrics, "bom": items},
+		}); err != nil {
+			return err
+		}
+
+		bom, err = buildOrderBOM(tx, &order)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bom, nil
+}
+
+// syncBOMReservations 把订单对清单中布料的预留调整为清单需求，dropped 中的布料释放全部预留
+// onlyReserved 为 true 时只调整已有预留的布料，用于订单数量变化后跟随调整。
+// 按布料 ID 顺序加锁，避免与其他订单的预留互相等待。
+func (s *OrderService) syncBOMReservations(tx *gorm.DB, order *models.Order, dropped []uint, onlyReserved bool) error {
+	items, err := loadOrderBOMItems(tx, order.ID)
+	if err != nil {
+		return err
+	}
+	targets := make(map[uint]int)
+	for _, fabricID := range dropped {
+		targets[fabricID] = 0
+	}
+	for _, item := range items {
+		if item.Type == models.OrderBOMFabric && item.FabricID != nil {
+			targets[*item.FabricID] = bomReserveQuantity(bomRequired(order.Quantity, &item))
+		}
+	}
+	fabricIDs := make([]uint, 0, len(targets))
+	for fabricID := range targets {
+		fabricIDs = append(fabricIDs, fabricID)
+	}
+	sort.Slice(fabricIDs, func(i, j int) bool { return fabricIDs[i] < fabricIDs[j] })
+
+	fabricService := NewFabricService(tx).WithActor(s.actor)
+	for _, fabricID := range fabricIDs {
+		current, err := orderFabricReserved(tx, fabricID, order.ID)
+		if err != nil {
+			return err
+		}
+		if onlyReserved && current == 0 {
+			continue
+		}
+		diff := targets[fabricID] - current
+		entry := models.FabricLedgerEntry{OrderID: &order.ID, Note: bomReservationNote}
+		switch {
+		case diff > 0:
+			entry.Type = models.FabricLedgerReservation
+			entry.Quantity = diff
+		case diff < 0:
+			entry.Type = models.FabricLedgerRelease
+			entry.Quantity = -diff
+		default:
+			continue
+		}
+		if _, err := fabricService.postLedger(tx, fabricID, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
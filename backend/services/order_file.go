@@ -0,0 +1,289 @@
+package services
+
+import (
+	"errors"
+	"gongChang/models"
+	"path/filepath"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrOrderFileNotFound 订单中没有该用途的文件
+	ErrOrderFileNotFound = errors.New("订单中不包含该文件")
+	// ErrOrderFileMissing 关联的文件不存在
+	ErrOrderFileMissing = errors.New("文件不存在")
+	// ErrOrderFileRoleInvalid 不支持的文件用途
+	ErrOrderFileRoleInvalid = errors.New("无效的文件类型，支持的类型：image, attachment, model, video")
+)
+
+// LoadOrderFiles 从 order_files 填充订单的文件ID列表、关联记录和文件详情
+// 同一用途内按 sort_order 排序；没有文件的用途返回空数组，与原来的 JSON 字段保持一致。
+func LoadOrderFiles(db *gorm.DB, orders ...*models.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	orderIDs := make([]uint, 0, len(orders))
+	byID := make(map[uint][]*models.Order, len(orders))
+	for _, order := range orders {
+		order.Attachments = []string{}
+		order.Models = []string{}
+		order.Images = []string{}
+		order.Videos = []string{}
+		order.OrderFiles = []models.OrderFile{}
+		order.Files = []models.File{}
+		if _, ok := byID[order.ID]; !ok {
+			orderIDs = append(orderIDs, order.ID)
+		}
+		byID[order.ID] = append(byID[order.ID], order)
+	}
+
+	var links []models.OrderFile
+	if err := db.Preload("File").Where("order_id IN ?", orderIDs).
+		Order("order_id, role, sort_order, id").Find(&links).Error; err != nil {
+		return err
+	}
+	for _, link := range links {
+		file := link.File
+		link.File = nil
+		for _, order := range byID[link.OrderID] {
+			switch link.Role {
+			case models.OrderFileRoleImage:
+				order.Images = append(order.Images, link.FileID)
+			case models.OrderFileRoleAttachment:
+				order.Attachments = append(order.Attachments, link.FileID)
+			case models.OrderFileRoleModel:
+				order.Models = append(order.Models, link.FileID)
+			case models.OrderFileRoleVideo:
+				order.Videos = append(order.Videos, link.FileID)
+			}
+			order.OrderFiles = append(order.OrderFiles, link)
+			if file != nil && !containsFile(order.Files, file.ID) {
+				order.Files = append(order.Files, *file)
+			}
+		}
+	}
+	return nil
+}
+
+func containsFile(files []models.File, fileID string) bool {
+	for _, f := range files {
+		if f.ID == fileID {
+			return true
+		}
+	}
+	return false
+}
+
+// setOrderFiles 将订单某一用途的文件替换为 fileIDs，按列表顺序排序，已有关联保留说明
+func setOrderFiles(tx *gorm.DB, orderID uint, role models.OrderFileRole, fileIDs []string) error {
+	ids := make([]string, 0, len(fileIDs))
+	seen := make(map[string]bool, len(fileIDs))
+	for _, id := range fileIDs {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) > 0 {
+		var count int64
+		if err := tx.Model(&models.File{}).Where("id IN ?", ids).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(ids) {
+			return ErrOrderFileMissing
+		}
+	}
+
+	remove := tx.Where("order_id = ? AND role = ?", orderID, role)
+	if len(ids) > 0 {
+		remove = remove.Where("file_id NOT IN ?", ids)
+	}
+	if err := remove.Delete(&models.OrderFile{}).Error; err != nil {
+		return err
+	}
+
+	for i, id := range ids {
+		link := models.OrderFile{OrderID: orderID, FileID: id, Role: role, SortOrder: i}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "order_id"}, {Name: "file_id"}, {Name: "role"}},
+			DoUpdates: clause.AssignmentColumns([]string{"sort_order", "updated_at"}),
+		}).Create(&link).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockOrderWithFiles 加锁读取订单并填充文件列表，用于记录变更前的审计快照
+func lockOrderWithFiles(tx *gorm.DB, orderID uint) (*models.Order, error) {
+	var order models.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrResourceNotFound
+		}
+		return nil, err
+	}
+	if err := LoadOrderFiles(tx, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// auditOrderFiles 重新读取订单文件列表并记录订单变更
+func (s *OrderService) auditOrderFiles(tx *gorm.DB, before *models.Order) (*models.Order, error) {
+	after := *before
+	if err := LoadOrderFiles(tx, &after); err != nil {
+		return nil, err
+	}
+	if err := s.auditOrder(tx, models.AuditActionUpdate, before, &after); err != nil {
+		return nil, err
+	}
+	return &after, nil
+}
+
+// AttachOrderFile 将文件加入订单某一用途的末尾；文件已在该用途中时只更新非空的说明，便于客户端重试
+func (s *OrderService) AttachOrderFile(orderID uint, fileID string, role models.OrderFileRole, caption string) (*models.Order, error) {
+	if !role.IsValid() {
+		return nil, ErrOrderFileRoleInvalid
+	}
+	var updated *models.Order
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrderWithFiles(tx, orderID)
+		if err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.File{}).Where("id = ?", fileID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrOrderFileMissing
+		}
+		for _, link := range order.OrderFiles {
+			if link.FileID != fileID || link.Role != role {
+				continue
+			}
+			if caption == "" || caption == link.Caption {
+				updated = order
+				return nil
+			}
+			if err := tx.Model(&models.OrderFile{}).Where("id = ?", link.ID).Update("caption", caption).Error; err != nil {
+				return err
+			}
+			updated, err = s.auditOrderFiles(tx, order)
+			return err
+		}
+
+		var maxSort *int
+		if err := tx.Model(&models.OrderFile{}).Where("order_id = ? AND role = ?", orderID, role).
+			Select("MAX(sort_order)").Scan(&maxSort).Error; err != nil {
+			return err
+		}
+		link := models.OrderFile{OrderID: orderID, FileID: fileID, Role: role, Caption: caption}
+		if maxSort != nil {
+			link.SortOrder = *maxSort + 1
+		}
+		if err := tx.Create(&link).Error; err != nil {
+			return err
+		}
+		updated, err = s.auditOrderFiles(tx, order)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DetachOrderFile 从订单的某一用途中移除文件，文件本身不删除
+func (s *OrderService) DetachOrderFile(orderID uint, fileID string, role models.OrderFileRole) (*models.Order, error) {
+	if !role.IsValid() {
+		return nil, ErrOrderFileRoleInvalid
+	}
+	var updated *models.Order
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrderWithFiles(tx, orderID)
+		if err != nil {
+			return err
+		}
+		result := tx.Where("order_id = ? AND file_id = ? AND role = ?", orderID, fileID, role).Delete(&models.OrderFile{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrderFileNotFound
+		}
+		updated, err = s.auditOrderFiles(tx, order)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// UpdateOrderFile 修改订单文件的说明或排序
+func (s *OrderService) UpdateOrderFile(orderID uint, fileID string, req *models.UpdateOrderFileRequest) (*models.OrderFile, error) {
+	if !req.Role.IsValid() {
+		return nil, ErrOrderFileRoleInvalid
+	}
+	var link models.OrderFile
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrderWithFiles(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("order_id = ? AND file_id = ? AND role = ?", orderID, fileID, req.Role).First(&link).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOrderFileNotFound
+			}
+			return err
+		}
+		updates := make(map[string]interface{})
+		if req.Caption != nil {
+			updates["caption"] = *req.Caption
+		}
+		if req.SortOrder != nil {
+			updates["sort_order"] = *req.SortOrder
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := tx.Model(&link).Updates(updates).Error; err != nil {
+			return err
+		}
+		_, err = s.auditOrderFiles(tx, order)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// orderFileRoleFor 上传时未指定用途的文件按扩展名归类，无法识别时作为附件
+func orderFileRoleFor(fileType, filename string) models.OrderFileRole {
+	if role := models.OrderFileRole(fileType); role.IsValid() {
+		return role
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, role := range models.OrderFileRoles {
+		for _, supported := range SupportedFileTypes[string(role)] {
+			if ext == supported {
+				return role
+			}
+		}
+	}
+	return models.OrderFileRoleAttachment
+}
+
+// ordersReferencingFile 关联了该文件的订单
+func ordersReferencingFile(db *gorm.DB, fileID string) ([]uint, error) {
+	var orderIDs []uint
+	err := db.Model(&models.OrderFile{}).Where("file_id = ?", fileID).Distinct().Pluck("order_id", &orderIDs).Error
+	return orderIDs, err
+}
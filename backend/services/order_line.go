@@ -0,0 +1,308 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gongChang/models"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrOrderLineNotFound       = errors.New("订单明细行不存在")
+	ErrOrderLineDuplicate      = errors.New("同一尺码和颜色在订单明细中只能出现一次")
+	ErrOrderLineHasProgress    = errors.New("已上报生产数量的明细行不能删除")
+	ErrOrderLineInUse          = errors.New("已有报价或发货记录的明细行不能删除")
+	ErrOrderLineBelowFulfilled = errors.New("明细行数量不能低于已完成或已发货的数量")
+	ErrOrderLineQuantityLocked = errors.New("订单数量由尺码颜色明细汇总，请修改明细")
+	ErrLineQuantityExceeded    = errors.New("完成数量不能超过明细行的订单数量")
+)
+
+// NewOrderLines 把请求中的明细行转换为模型，尺码和颜色去除首尾空格后不能重复
+func NewOrderLines(reqs []models.OrderLineRequest) ([]models.OrderLine, error) {
+	lines := make([]models.OrderLine, 0, len(reqs))
+	seen := make(map[string]bool, len(reqs))
+	for i, req := range reqs {
+		line := models.OrderLine{
+			Size:      strings.TrimSpace(req.Size),
+			Color:     strings.TrimSpace(req.Color),
+			SKU:       strings.TrimSpace(req.SKU),
+			Quantity:  req.Quantity,
+			UnitPrice: req.UnitPrice,
+			SortOrder: i,
+		}
+		key := line.Size + "\x00" + line.Color
+		if seen[key] {
+			return nil, ErrOrderLineDuplicate
+		}
+		seen[key] = true
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// orderLineTotals 明细行的数量之和及按实际单价汇总的总价
+func orderLineTotals(lines []models.OrderLine, orderUnitPrice float64) (int, float64) {
+	quantity := 0
+	total := 0.0
+	for i := range lines {
+		quantity += lines[i].Quantity
+		total += float64(lines[i].Quantity) * lines[i].EffectiveUnitPrice(orderUnitPrice)
+	}
+	return quantity, roundMoney(total)
+}
+
+// loadOrderLines 订单的明细行，按录入顺序排列
+func loadOrderLines(tx *gorm.DB, orderID uint) ([]models.OrderLine, error) {
+	lines := make([]models.OrderLine, 0)
+	err := tx.Where("order_id = ?", orderID).Order("sort_order, id").Find(&lines).Error
+	return lines, err
+}
+
+// completedLineQuantities 明细行最近一次生产上报的累计完成数量，已删除的进度不计
+func completedLineQuantities(tx *gorm.DB, lineIDs []uint) (map[uint]int, error) {
+	completed := make(map[uint]int, len(lineIDs))
+	if len(lineIDs) == 0 {
+		return completed, nil
+	}
+	var reports []models.ProgressLineQuantity
+	if err := tx.Table("progress_line_quantities AS q").
+		Select("q.*").
+		Joins("JOIN order_progress p ON p.id = q.progress_id AND p.deleted_at IS NULL").
+		Where("q.order_line_id IN ?", lineIDs).
+		Order("q.id").
+		Find(&reports).Error; err != nil {
+		return nil, err
+	}
+	// 上报的是累计数量，以最近一次为准
+	for _, report := range reports {
+		completed[report.OrderLineID] = report.CompletedQuantity
+	}
+	return completed, nil
+}
+
+// replaceOrderLines 按尺码和颜色对齐替换订单明细：已有的行原地更新以保留生产上报，
+// 新行创建，未再出现的行删除；随后按明细重新汇总订单的数量和总价。lines 为空时清除明细，数量和总价保持不变。
+// 有生产上报、报价或发货记录的行不能删除，已有的行数量不能低于已完成或已发货的数量。
+func replaceOrderLines(tx *gorm.DB, order *models.Order, lines []models.OrderLine) error {
+	existing, err := loadOrderLines(tx, order.ID)
+	if err != nil {
+		return err
+	}
+	byKey := make(map[string]models.OrderLine, len(existing))
+	existingIDs := make([]uint, 0, len(existing))
+	for _, line := range existing {
+		byKey[line.Size+"\x00"+line.Color] = line
+		existingIDs = append(existingIDs, line.ID)
+	}
+	completed, err := completedLineQuantities(tx, existingIDs)
+	if err != nil {
+		return err
+	}
+	shipped, _, err := shippedQuantities(tx, order.ID)
+	if err != nil {
+		return err
+	}
+
+	for i := range lines {
+		lines[i].OrderID = order.ID
+		key := lines[i].Size + "\x00" + lines[i].Color
+		if current, ok := byKey[key]; ok {
+			delete(byKey, key)
+			if lines[i].Quantity < completed[current.ID] || lines[i].Quantity < shipped[current.ID] {
+				return fmt.Errorf("%w：%s / %s 已完成 %d 件，已发货 %d 件", ErrOrderLineBelowFulfilled,
+					current.Size, current.Color, completed[current.ID], shipped[current.ID])
+			}
+			lines[i].ID = current.ID
+			lines[i].CreatedAt = current.CreatedAt
+			if err := tx.Model(&lines[i]).Select("sku", "quantity", "unit_price", "sort_order").Updates(&lines[i]).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if err := tx.Create(&lines[i]).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(byKey) > 0 {
+		removed := make([]uint, 0, len(byKey))
+		for _, line := range byKey {
+			removed = append(removed, line.ID)
+		}
+		var reported int64
+		if err := tx.Model(&models.ProgressLineQuantity{}).Where("order_line_id IN ?", removed).Count(&reported).Error; err != nil {
+			return err
+		}
+		if reported > 0 {
+			return ErrOrderLineHasProgress
+		}
+		var quoted, shippedItems int64
+		if err := tx.Model(&models.JiedanQuoteLine{}).Where("order_line_id IN ?", removed).Count(&quoted).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ShipmentItem{}).Where("order_line_id IN ?", removed).Count(&shippedItems).Error; err != nil {
+			return err
+		}
+		if quoted > 0 || shippedItems > 0 {
+			return ErrOrderLineInUse
+		}
+		if err := tx.Where("id IN ?", removed).Delete(&models.OrderLine{}).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+	quantity, total := orderLineTotals(lines, order.UnitPrice)
+	if err := tx.Model(order).UpdateColumns(map[string]interface{}{
+		"quantity":    quantity,
+		"total_price": total,
+	}).Error; err != nil {
+		return err
+	}
+	order.Quantity = quantity
+	order.TotalPrice = total
+	return nil
+}
+
+// recalculateOrderTotal 订单单价或明细单价变化后按明细重新汇总总价，没有明细时按数量计算
+func recalculateOrderTotal(tx *gorm.DB, order *models.Order) error {
+	lines, err := loadOrderLines(tx, order.ID)
+	if err != nil {
+		return err
+	}
+	total := roundMoney(order.UnitPrice * float64(order.Quantity))
+	if len(lines) > 0 {
+		_, total = orderLineTotals(lines, order.UnitPrice)
+	}
+	if err := tx.Model(order).UpdateColumn("total_price", total).Error; err != nil {
+		return err
+	}
+	order.TotalPrice = total
+	return nil
+}
+
+// GetOrderLines 订单的尺码 × 颜色明细，含每行金额和最近一次生产上报的完成数量
+func (s *OrderService) GetOrderLines(orderID uint) (*models.OrderLinesResponse, error) {
+	var order models.Order
+	if err := s.db.First(&order, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	lines, err := loadOrderLines(s.db, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, len(lines))
+	for i, line := range lines {
+		ids[i] = line.ID
+	}
+	completed, err := completedLineQuantities(s.db, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.OrderLinesResponse{
+		OrderID:    order.ID,
+		Quantity:   order.Quantity,
+		UnitPrice:  order.UnitPrice,
+		TotalPrice: order.TotalPrice,
+		Lines:      make([]models.OrderLineView, 0, len(lines)),
+	}
+	for _, line := range lines {
+		price := line.EffectiveUnitPrice(order.UnitPrice)
+		view := models.OrderLineView{
+			OrderLine:          line,
+			EffectiveUnitPrice: price,
+			Amount:             roundMoney(price * float64(line.Quantity)),
+			CompletedQuantity:  completed[line.ID],
+		}
+		response.CompletedQuantity += view.CompletedQuantity
+		response.Lines = append(response.Lines, view)
+	}
+	return response, nil
+}
+
+// SetOrderLines 整体替换订单的尺码 × 颜色明细并重新汇总数量和总价；
+// 数量变化时，已按物料清单预留的布料跟随调整。
+func (s *OrderService) SetOrderLines(orderID uint, req *models.SaveOrderLinesRequest) (*models.OrderLinesResponse, error) {
+	lines, err := NewOrderLines(req.Lines)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOrderNotFound
+			}
+			return err
+		}
+		before, err := loadOrderLines(tx, orderID)
+		if err != nil {
+			return err
+		}
+		previousQuantity := order.Quantity
+		previousTotal := order.TotalPrice
+		if err := replaceOrderLines(tx, &order, lines); err != nil {
+			return err
+		}
+		if order.Quantity != previousQuantity && !orderClosed(order.Status) {
+			if err := s.syncBOMReservations(tx, &order, nil, true); err != nil {
+				return err
+			}
+		}
+		return recordAudit(tx, s.actor, auditEntry{
+			EntityType: models.AuditEntityOrder,
+			EntityID:   orderID,
+			Action:     models.AuditActionUpdate,
+			OrderID:    &orderID,
+			OwnerID:    order.DesignerID,
+			Before:     map[string]interface{}{"quantity": previousQuantity, "total_price": previousTotal, "lines": before},
+			After:      map[string]interface{}{"quantity": order.Quantity, "total_price": order.TotalPrice, "lines": lines},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetOrderLines(orderID)
+}
+
+// validateProgressLines 校验进度上报的明细行属于订单且累计完成数量不超过明细行数量
+func validateProgressLines(tx *gorm.DB, orderID uint, reqs []models.ProgressLineQuantityRequest) ([]models.ProgressLineQuantity, error) {
+	lines, err := loadOrderLines(tx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.OrderLine, len(lines))
+	for _, line := range lines {
+		byID[line.ID] = line
+	}
+	quantities := make([]models.ProgressLineQuantity, 0, len(reqs))
+	seen := make(map[uint]bool, len(reqs))
+	for _, req := range reqs {
+		line, ok := byID[req.OrderLineID]
+		if !ok {
+			return nil, ErrOrderLineNotFound
+		}
+		if seen[req.OrderLineID] {
+			return nil, ErrOrderLineDuplicate
+		}
+		seen[req.OrderLineID] = true
+		if req.CompletedQuantity > line.Quantity {
+			return nil, ErrLineQuantityExceeded
+		}
+		quantities = append(quantities, models.ProgressLineQuantity{
+			OrderLineID:       req.OrderLineID,
+			CompletedQuantity: req.CompletedQuantity,
+		})
+	}
+	return quantities, nil
+}
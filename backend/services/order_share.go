@@ -0,0 +1,344 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"gongChang/models"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// DefaultShareTTL 分享令牌默认有效期
+	DefaultShareTTL = 7 * 24 * time.Hour
+	// DefaultShareRateLimit 分享令牌默认每分钟请求数上限
+	DefaultShareRateLimit = 60
+	// MaxSharePinFailures 连续输错 PIN 达到该次数后令牌被锁定，需要设计师重新创建分享链接
+	MaxSharePinFailures = 5
+)
+
+var (
+	ErrShareTokenInvalid = errors.New("分享链接无效")
+	ErrShareTokenExpired = errors.New("分享链接已过期")
+	ErrShareTokenRevoked = errors.New("分享链接已被撤销")
+	ErrShareScopeDenied  = errors.New("分享链接没有该操作权限")
+	ErrShareRateLimited  = errors.New("请求过于频繁，请稍后再试")
+	ErrSharePinRequired  = errors.New("请输入分享链接的 PIN")
+	ErrSharePinInvalid   = errors.New("PIN 不正确")
+	ErrSharePinLocked    = errors.New("PIN 输错次数过多，分享链接已锁定")
+)
+
+// OrderShareService 订单分享令牌的签发、校验与撤销
+type OrderShareService struct {
+	db    *gorm.DB
+	actor models.Actor
+}
+
+func NewOrderShareService(db *gorm.DB) *OrderShareService {
+	return &OrderShareService{db: db}
+}
+
+// WithActor 返回绑定操作人的服务副本，写操作将以该操作人记录审计事件
+func (s *OrderShareService) WithActor(actor models.Actor) *OrderShareService {
+	c := *s
+	c.actor = actor
+	return &c
+}
+
+// auditShareToken 记录分享令牌变更的审计事件，归属于订单设计师
+func (s *OrderShareService) auditShareToken(tx *gorm.DB, action string, order *models.Order, before, after *models.OrderShareToken) error {
+	target := after
+	if target == nil {
+		target = before
+	}
+	orderID := order.ID
+	return recordAudit(tx, s.actor, auditEntry{
+		EntityType: models.AuditEntityOrderShare,
+		EntityID:   target.ID,
+		Action:     action,
+		OrderID:    &orderID,
+		OwnerID:    order.DesignerID,
+		Before:     before,
+		After:      after,
+	})
+}
+
+// CreateShareToken 为订单签发分享令牌，明文令牌只在返回值中出现一次
+func (s *OrderShareService) CreateShareToken(orderID uint, req *models.CreateShareTokenRequest) (*models.CreateShareTokenResponse, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+
+	ttl := DefaultShareTTL
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+	rateLimit := req.RateLimit
+	if rateLimit <= 0 {
+		rateLimit = DefaultShareRateLimit
+	}
+	token := models.OrderShareToken{
+		OrderID:   orderID,
+		TokenHash: hashRefreshToken(raw),
+		Scope:     req.Scope,
+		Label:     req.Label,
+		RateLimit: rateLimit,
+		ExpiresAt: time.Now().Add(ttl),
+		CreatedBy: s.actor.UserID,
+	}
+	if req.Pin != "" {
+		pinHash, err := bcrypt.GenerateFromPassword([]byte(req.Pin), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		token.PinHash = string(pinHash)
+		token.PinRequired = true
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Select("id", "designer_id").First(&order, orderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrResourceNotFound
+			}
+			return err
+		}
+		if err := tx.Create(&token).Error; err != nil {
+			return err
+		}
+		return s.auditShareToken(tx, models.AuditActionCreate, &order, nil, &token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.CreateShareTokenResponse{OrderShareToken: token, Token: raw}, nil
+}
+
+// ListShareTokens 订单的全部分享令牌，包括已过期和已撤销的
+func (s *OrderShareService) ListShareTokens(orderID uint) ([]models.OrderShareToken, error) {
+	tokens := make([]models.OrderShareToken, 0)
+	err := s.db.Where("order_id = ?", orderID).Order("id desc").Find(&tokens).Error
+	return tokens, err
+}
+
+// RevokeShareToken 撤销分享令牌，已撤销的令牌保持不变
+func (s *OrderShareService) RevokeShareToken(orderID, tokenID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var token models.OrderShareToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND order_id = ?", tokenID, orderID).First(&token).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrResourceNotFound
+			}
+			return err
+		}
+		if token.RevokedAt != nil {
+			return nil
+		}
+		var order models.Order
+		if err := tx.Select("id", "designer_id").First(&order, orderID).Error; err != nil {
+			return err
+		}
+		before := token
+		now := time.Now()
+		if err := tx.Model(&token).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return s.auditShareToken(tx, models.AuditActionUpdate, &order, &before, &token)
+	})
+}
+
+// Authorize 校验分享令牌是否可以对订单执行 scope 范围内的操作，计入频率限制和访问次数
+// orderID 为 0 时不限定订单，由调用方再检查资源是否属于令牌的订单。设置了 PIN 的令牌需要提供正确的 pin。
+func (s *OrderShareService) Authorize(raw, pin string, orderID uint, scope models.ShareScope) (*models.OrderShareToken, error) {
+	if raw == "" {
+		return nil, ErrShareTokenInvalid
+	}
+	var token models.OrderShareToken
+	if err := s.db.Where("token_hash = ?", hashRefreshToken(raw)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrShareTokenInvalid
+		}
+		return nil, err
+	}
+	if orderID != 0 && token.OrderID != orderID {
+		return nil, ErrShareTokenInvalid
+	}
+	if token.RevokedAt != nil {
+		return nil, ErrShareTokenRevoked
+	}
+	now := time.Now()
+	if now.After(token.ExpiresAt) {
+		return nil, ErrShareTokenExpired
+	}
+	if !token.Scope.Allows(scope) {
+		return nil, ErrShareScopeDenied
+	}
+	// 频率限制在校验 PIN 之前，同时限制 PIN 的尝试速度
+	if !shareLimiter.allow(token.ID, token.RateLimit, now) {
+		return nil, ErrShareRateLimited
+	}
+	if err := s.checkSharePin(&token, pin); err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"last_used_at": now,
+		"access_count": gorm.Expr("access_count + 1"),
+	}
+	if token.PinFailures > 0 {
+		updates["pin_failures"] = 0
+	}
+	if err := s.db.Model(&token).UpdateColumns(updates).Error; err != nil {
+		return nil, err
+	}
+	token.LastUsedAt = &now
+	token.AccessCount++
+	token.PinFailures = 0
+	return &token, nil
+}
+
+// checkSharePin 校验令牌的 PIN，输错时累计失败次数
+func (s *OrderShareService) checkSharePin(token *models.OrderShareToken, pin string) error {
+	if !token.PinRequired {
+		return nil
+	}
+	if token.PinFailures >= MaxSharePinFailures {
+		return ErrSharePinLocked
+	}
+	if pin == "" {
+		return ErrSharePinRequired
+	}
+	if bcrypt.CompareHashAndPassword([]byte(token.PinHash), []byte(pin)) == nil {
+		return nil
+	}
+	if err := s.db.Model(token).UpdateColumn("pin_failures", gorm.Expr("pin_failures + 1")).Error; err != nil {
+		return err
+	}
+	if token.PinFailures+1 >= MaxSharePinFailures {
+		return ErrSharePinLocked
+	}
+	return ErrSharePinInvalid
+}
+
+// SharedOrder 分享链接中的订单信息和进度时间线，不含价格等敏感字段；图片由调用方通过 FileService 补充
+func (s *OrderShareService) SharedOrder(token *models.OrderShareToken) (*models.SharedOrderView, error) {
+	var order models.Order
+	if err := s.db.Preload("Factory").First(&order, token.OrderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrResourceNotFound
+		}
+		return nil, err
+	}
+
+	var milestones []models.ProgressMilestone
+	if err := s.db.Where("order_id = ?", order.ID).Order("sequence, planned_start").Find(&milestones).Error; err != nil {
+		return nil, err
+	}
+	var records []models.OrderProgress
+	if err := s.db.Where("order_id = ?", order.ID).Order("created_at, id").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	// 有生产计划时按计划阶段排列，并用最新的进度记录补充实际状态；没有计划时直接使用进度记录
+	latest := make(map[models.ProgressType]*models.OrderProgress, len(records))
+	for i := range records {
+		latest[records[i].Type] = &records[i]
+	}
+	progress := make([]models.SharedOrderProgress, 0, len(milestones)+len(records))
+	planned := make(map[models.ProgressType]bool, len(milestones))
+	for _, m := range milestones {
+		planned[m.Type] = true
+		due := m.PlannedDue
+		item := models.SharedOrderProgress{
+			Type:          m.Type,
+			Status:        m.Status,
+			PlannedDue:    &due,
+			StartTime:     m.ActualStart,
+			CompletedTime: m.ActualCompleted,
+		}
+		if record := latest[m.Type]; record != nil {
+			item.Description = record.Description
+			if item.StartTime == nil {
+				item.StartTime = record.StartTime
+			}
+			if item.CompletedTime == nil {
+				item.CompletedTime = record.CompletedTime
+			}
+		}
+		progress = append(progress, item)
+	}
+	for _, record := range records {
+		if planned[record.Type] {
+			continue
+		}
+		progress = append(progress, models.SharedOrderProgress{
+			Type:          record.Type,
+			Status:        record.Status,
+			Description:   record.Description,
+			StartTime:     record.StartTime,
+			CompletedTime: record.CompletedTime,
+		})
+	}
+
+	return &models.SharedOrderView{
+		ID:           order.ID,
+		Title:        order.Title,
+		Status:       string(order.Status),
+		Quantity:     order.Quantity,
+		Factory:      order.Factory.CompanyName,
+		DeliveryDate: order.DeliveryDate,
+		Images:       []models.SharedFile{},
+		Progress:     progress,
+		ExpiresAt:    token.ExpiresAt,
+	}, nil
+}
+
+// shareLimiter 进程内的分享令牌频率限制，多副本部署时每个副本分别计数
+var shareLimiter = &shareRateLimiter{windows: make(map[uint]*shareWindow)}
+
+type shareWindow struct {
+	start time.Time
+	count int
+}
+
+// shareRateLimiter 按令牌统计固定一分钟窗口内的请求数
+type shareRateLimiter struct {
+	mu      sync.Mutex
+	windows map[uint]*shareWindow
+}
+
+func (l *shareRateLimiter) allow(tokenID uint, limit int, now time.Time) bool {
+	if limit <= 0 {
+		limit = DefaultShareRateLimit
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// 清理已结束的窗口，避免长期运行后占用过多内存
+	if len(l.windows) > 1024 {
+		for id, w := range l.windows {
+			if now.Sub(w.start) >= time.Minute {
+				delete(l.windows, id)
+			}
+		}
+	}
+
+	w := l.windows[tokenID]
+	if w == nil || now.Sub(w.start) >= time.Minute {
+		w = &shareWindow{start: now}
+		l.windows[tokenID] = w
+	}
+	if w.count >= limit {
+		return false
+	}
+	w.count++
+	return true
+}
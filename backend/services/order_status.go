@@ -0,0 +1,150 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gongChang/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrOrderNotFound       = errors.New("订单不存在")
+	ErrUnknownOrderStatus  = errors.New("未知的订单状态")
+	ErrStatusChangeDenied  = errors.New("当前角色不能把订单变更为该状态")
+	ErrStatusNeedsFactory  = errors.New("订单还没有承接工厂，不能进入生产")
+	ErrStatusNeedsShipment = errors.New("订单还没有发货记录，请通过创建发货单标记发货")
+)
+
+// InvalidStatusTransitionError 非法的订单状态流转
+type InvalidStatusTransitionError struct {
+	From models.OrderStatus
+	To   models.OrderStatus
+}
+
+func (e *InvalidStatusTransitionError) Error() string {
+	return fmt.Sprintf("订单状态不能从 %s 变更为 %s", e.From, e.To)
+}
+
+// StatusChange 一次订单状态变更，操作人取自服务绑定的 Actor
+type StatusChange struct {
+	To     models.OrderStatus
+	Reason string
+}
+
+// UpdateOrderStatus 按状态机变更订单状态并记录流转历史
+func (s *OrderService) UpdateOrderStatus(orderID uint, change StatusChange) (*models.Order, error) {
+	var order models.Order
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOrderNotFound
+			}
+			return err
+		}
+		return manualStatusChange(tx, s.actor, &order, change)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// GetOrderStatusHistory 获取订单状态流转历史
+func (s *OrderService) GetOrderStatusHistory(orderID uint) ([]models.OrderStatusHistory, error) {
+	var history []models.OrderStatusHistory
+	err := s.db.Where("order_id = ?", orderID).Order("id ASC").Find(&history).Error
+	return history, err
+}
+
+// manualStatusChange 用户手动变更订单状态：工厂只能发起争议，其余变更由设计师完成
+// 进入生产和发货通常由产前样批准和创建发货单完成，手动设置（如争议解决后恢复）时要求已有承接工厂或发货记录。
+func manualStatusChange(tx *gorm.DB, actor models.Actor, order *models.Order, change StatusChange) error {
+	if change.To.IsValid() && !change.To.CanBeSetBy(actor.Role) {
+		return ErrStatusChangeDenied
+	}
+	switch change.To {
+	case models.OrderStatusInProduction:
+		if order.FactoryID == nil || *order.FactoryID == "" {
+			return ErrStatusNeedsFactory
+		}
+	case models.OrderStatusShipped:
+		var shipments int64
+		if err := tx.Model(&models.Shipment{}).Where("order_id = ?", order.ID).Count(&shipments).Error; err != nil {
+			return err
+		}
+		if shipments == 0 {
+			return ErrStatusNeedsShipment
+		}
+	}
+	return transitionOrderStatus(tx, actor, order, change)
+}
+
+// transitionOrderStatus 在事务内校验并执行状态流转，调用方需已锁定订单行
+func transitionOrderStatus(tx *gorm.DB, actor models.Actor, order *models.Order, change StatusChange) error {
+	if !change.To.IsValid() {
+		return ErrUnknownOrderStatus
+	}
+
+	from := order.Status
+	if from == "" {
+		from = models.OrderStatusDraft
+	}
+	if !from.CanTransitionTo(change.To) {
+		return &InvalidStatusTransitionError{From: from, To: change.To}
+	}
+	switch change.To {
+	case models.OrderStatusInProduction:
+		if err := requirePPSampleApproved(tx, order.ID); err != nil {
+			return err
+		}
+	case models.OrderStatusShipped:
+		if err := requireQCPassed(tx, order.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Model(order).Update("status", change.To).Error; err != nil {
+		return err
+	}
+	order.Status = change.To
+
+	// 取消的订单不再需要布料，释放全部预留
+	if change.To == models.OrderStatusCancelled {
+		if err := NewFabricService(tx).WithActor(actor).ReleaseOrderReservations(tx, order.ID, 0, "订单已取消"); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Create(&models.OrderStatusHistory{
+		OrderID:      order.ID,
+		FromStatus:   from,
+		ToStatus:     change.To,
+		OperatorID:   actor.UserID,
+		OperatorRole: string(actor.Role),
+		Reason:       change.Reason,
+	}).Error; err != nil {
+		return err
+	}
+
+	orderID := order.ID
+	if err := recordAudit(tx, actor, auditEntry{
+		EntityType: models.AuditEntityOrder,
+		EntityID:   orderID,
+		Action:     models.AuditActionStatusChange,
+		OrderID:    &orderID,
+		OwnerID:    order.DesignerID,
+		Before:     map[string]interface{}{"status": from},
+		After:      map[string]interface{}{"status": change.To, "reason": change.Reason},
+	}); err != nil {
+		return err
+	}
+
+	return publishOrderEvent(tx, orderID, models.RealtimeOrderStatusChanged, models.OrderAccessViewer, map[string]interface{}{
+		"order_id":      orderID,
+		"from":          from,
+		"to":            change.To,
+		"reason":        change.Reason,
+		"next_statuses": change.To.NextStatuses(),
+	})
+}
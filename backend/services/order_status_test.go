@@ -0,0 +1,98 @@
+package services
+
+import (
+	"errors"
+	"gongChang/models"
+	"gongChang/tracking"
+	"testing"
+)
+
+func TestManualStatusChanges(t *testing.T) {
+	db := newShipmentTestDB(t)
+	order := &models.Order{Title: "外套", Quantity: 10, Status: models.OrderStatusDraft, DesignerID: testDesignerID}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("seed order: %v", err)
+	}
+	designer := NewOrderService(db).WithActor(testDesigner)
+	factory := NewOrderService(db).WithActor(testFactory)
+
+	for _, to := range []models.OrderStatus{models.OrderStatusPublished, models.OrderStatusBiddingClosed} {
+		if _, err := designer.UpdateOrderStatus(order.ID, StatusChange{To: to}); err != nil {
+			t.Fatalf("designer → %s: %v", to, err)
+		}
+	}
+
+	var transitionErr *InvalidStatusTransitionError
+	cases := []struct {
+		name    string
+		svc     *OrderService
+		to      models.OrderStatus
+		wantErr func(error) bool
+	}{
+		{"unknown status", designer, "archived", func(err error) bool { return errors.Is(err, ErrUnknownOrderStatus) }},
+		{"skip lifecycle", designer, models.OrderStatusDelivered, func(err error) bool { return errors.As(err, &transitionErr) }},
+		{"factory reopens bidding", factory, models.OrderStatusPublished, func(err error) bool { return errors.Is(err, ErrStatusChangeDenied) }},
+		{"production without factory", designer, models.OrderStatusInProduction, func(err error) bool { return errors.Is(err, ErrStatusNeedsFactory) }},
+	}
+	for _, tc := range cases {
+		if _, err := tc.svc.UpdateOrderStatus(order.ID, StatusChange{To: tc.to}); !tc.wantErr(err) {
+			t.Errorf("%s: UpdateOrderStatus = %v", tc.name, err)
+		}
+	}
+	if status := reloadOrderStatus(t, db, order.ID); status != models.OrderStatusBiddingClosed {
+		t.Fatalf("order status = %s, want bidding_closed", status)
+	}
+}
+
+func TestManualShippedRequiresShipment(t *testing.T) {
+	db := newShipmentTestDB(t)
+	order := seedShipmentOrder(t, db)
+	designer := NewOrderService(db).WithActor(testDesigner)
+	factory := NewOrderService(db).WithActor(testFactory)
+
+	if _, err := factory.UpdateOrderStatus(order.ID, StatusChange{To: models.OrderStatusShipped}); !errors.Is(err, ErrStatusChangeDenied) {
+		t.Fatalf("factory → shipped = %v, want ErrStatusChangeDenied", err)
+	}
+	if _, err := designer.UpdateOrderStatus(order.ID, StatusChange{To: models.OrderStatusShipped}); !errors.Is(err, ErrStatusNeedsShipment) {
+		t.Fatalf("designer → shipped without shipment = %v, want ErrStatusNeedsShipment", err)
+	}
+
+	// 工厂可以发起争议，争议解决后设计师可恢复到生产或已发货
+	if _, err := factory.UpdateOrderStatus(order.ID, StatusChange{To: models.OrderStatusDisputed, Reason: "面料色差"}); err != nil {
+		t.Fatalf("factory → disputed: %v", err)
+	}
+	if _, err := designer.UpdateOrderStatus(order.ID, StatusChange{To: models.OrderStatusInProduction}); !errors.Is(err, ErrPPSampleNotApproved) {
+		t.Fatalf("designer → in_production without PP sample = %v, want ErrPPSampleNotApproved", err)
+	}
+	seedApprovedPPSample(t, db, order.ID)
+	if _, err := designer.UpdateOrderStatus(order.ID, StatusChange{To: models.OrderStatusInProduction}); err != nil {
+		t.Fatalf("designer → in_production: %v", err)
+	}
+	if _, err := NewShipmentService(db, tracking.NewFakeProvider()).WithActor(testFactory).CreateShipment(order.ID, shipmentRequest("SF400",
+		models.ShipmentItemRequest{Size: "S", Color: "红", Quantity: 60})); err != nil {
+		t.Fatalf("CreateShipment: %v", err)
+	}
+	if _, err := factory.UpdateOrderStatus(order.ID, StatusChange{To: models.OrderStatusDisputed}); err != nil {
+		t.Fatalf("factory → disputed: %v", err)
+	}
+	if _, err := designer.UpdateOrderStatus(order.ID, StatusChange{To: models.OrderStatusShipped}); err != nil {
+		t.Fatalf("designer → shipped with shipment: %v", err)
+	}
+
+	history, err := designer.GetOrderStatusHistory(order.ID)
+	if err != nil {
+		t.Fatalf("GetOrderStatusHistory: %v", err)
+	}
+	want := []models.OrderStatus{
+		models.OrderStatusDisputed, models.OrderStatusInProduction, models.OrderStatusShipped,
+		models.OrderStatusDisputed, models.OrderStatusShipped,
+	}
+	if len(history) != len(want) {
+		t.Fatalf("history = %d entries, want %d", len(history), len(want))
+	}
+	for i, entry := range history {
+		if entry.ToStatus != want[i] {
+			t.Errorf("history[%d] = %s, want %s", i, entry.ToStatus, want[i])
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gongChang/models"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// GetOrderTimeline 汇总订单的状态流转、生产进度、样衣提交与审批、工艺单发布、质量检验、发货、物流轨迹和确认收货，按时间先后排列
+func (s *OrderService) GetOrderTimeline(orderID uint) ([]models.OrderTimelineEntry, error) {
+	if err := s.db.Select("id").First(&models.Order{}, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+
+	entries := make([]models.OrderTimelineEntry, 0)
+
+	var history []models.OrderStatusHistory
+	if err := s.db.Where("order_id = ?", orderID).Find(&history).Error; err != nil {
+		return nil, err
+	}
+	for _, h := range history {
+		entries = append(entries, models.OrderTimelineEntry{
+			Time:       h.CreatedAt,
+			Kind:       models.TimelineStatusChange,
+			Title:      fmt.Sprintf("订单状态变更为 %s", h.ToStatus),
+			Detail:     h.Reason,
+			ActorID:    h.OperatorID,
+			EntityType: models.AuditEntityOrder,
+			EntityID:   orderID,
+			Data:       map[string]interface{}{"from": h.FromStatus, "to": h.ToStatus},
+		})
+	}
+
+	var progress []models.OrderProgress
+	if err := s.db.Where("order_id = ?", orderID).Find(&progress).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range progress {
+		if p.CreatedAt == nil {
+			continue
+		}
+		entries = append(entries, models.OrderTimelineEntry{
+			Time:       *p.CreatedAt,
+			Kind:       models.TimelineProgress,
+			Title:      fmt.Sprintf("生产进度：%s %s", p.Type, p.Status),
+			Detail:     p.Description,
+			ActorID:    p.FactoryID,
+			EntityType: models.AuditEntityProgress,
+			EntityID:   p.ID,
+			Data:       map[string]interface{}{"type": p.Type, "status": p.Status},
+		})
+	}
+
+	var samples []models.OrderSample
+	if err := s.db.Where("order_id = ?", orderID).Find(&samples).Error; err != nil {
+		return nil, err
+	}
+	for _, sample := range samples {
+		label := fmt.Sprintf("第 %d 轮%s", sample.Round, sampleTypeLabels[sample.Type])
+		data := map[string]interface{}{"type": sample.Type, "round": sample.Round, "photos": sample.Photos}
+		entries = append(entries, models.OrderTimelineEntry{
+			Time:       sample.SubmittedAt,
+			Kind:       models.TimelineSampleSubmitted,
+			Title:      "工厂提交" + label,
+			Detail:     sample.Description,
+			ActorID:    sample.FactoryID,
+			EntityType: models.AuditEntitySample,
+			EntityID:   sample.ID,
+			Data:       data,
+		})
+		if sample.ReviewedAt == nil {
+			continue
+		}
+		verdict := "批准"
+		if sample.Status == models.SampleStatusRejected {
+			verdict = "驳回"
+		}
+		entries = append(entries, models.OrderTimelineEntry{
+			Time:       *sample.ReviewedAt,
+			Kind:       models.TimelineSampleReviewed,
+			Title:      fmt.Sprintf("设计师%s%s", verdict, label),
+			Detail:     sample.ReviewComment,
+			ActorID:    sample.ReviewedBy,
+			EntityType: models.AuditEntitySample,
+			EntityID:   sample.ID,
+			Data:       map[string]interface{}{"type": sample.Type, "round": sample.Round, "status": sample.Status},
+		})
+	}
+
+	var packs []models.TechPack
+	if err := s.db.Select("id", "version", "change_note", "released_by", "released_at").
+		Where("order_id = ? AND released_at IS NOT NULL", orderID).Find(&packs).Error; err != nil {
+		return nil, err
+	}
+	for _, pack := range packs {
+		entries = append(entries, models.OrderTimelineEntry{
+			Time:       *pack.ReleasedAt,
+			Kind:       models.TimelineTechPackReleased,
+			Title:      fmt.Sprintf("发布第 %d 版工艺单", pack.Version),
+			Detail:     pack.ChangeNote,
+			ActorID:    pack.ReleasedBy,
+			EntityType: models.AuditEntityTechPack,
+			EntityID:   pack.ID,
+			Data:       map[string]interface{}{"version": pack.Version},
+		})
+	}
+
+	var inspections []models.QCInspection
+	if err := s.db.Where("order_id = ?", orderID).Find(&inspections).Error; err != nil {
+		return nil, err
+	}
+	for _, inspection := range inspections {
+		verdict := "合格"
+		if inspection.Result == models.QCResultFail {
+			verdict = "不合格"
+		}
+		entries = append(entries, models.OrderTimelineEntry{
+			Time:       inspection.InspectedAt,
+			Kind:       models.TimelineQCInspection,
+			Title:      fmt.Sprintf("质量检验%s：抽检 %d 件", verdict, inspection.SampleSize),
+			Detail:     inspection.Note,
+			ActorID:    inspection.InspectorID,
+			EntityType: models.AuditEntityQCInspection,
+			EntityID:   inspection.ID,
+			Data: map[string]interface{}{
+				"result":   inspection.Result,
+				"critical": inspection.CriticalFound,
+				"major":    inspection.MajorFound,
+				"minor":    inspection.MinorFound,
+			},
+		})
+	}
+
+	var shipments []models.Shipment
+	if err := s.db.Where("order_id = ?", orderID).Find(&shipments).Error; err != nil {
+		return nil, err
+	}
+	shipmentByID := make(map[uint]models.Shipment, len(shipments))
+	for _, shipment := range shipments {
+		shipmentByID[shipment.ID] = shipment
+		entries = append(entries, models.OrderTimelineEntry{
+			Time:       shipment.ShipDate,
+			Kind:       models.TimelineShipment,
+			Title:      fmt.Sprintf("发货 %d 件（%d 箱）：%s %s", shipment.Quantity, shipment.Cartons, shipment.Carrier, shipment.TrackingNumber),
+			Detail:     shipment.Note,
+			ActorID:    shipment.CreatedBy,
+			EntityType: models.AuditEntityShipment,
+			EntityID:   shipment.ID,
+			Data:       map[string]interface{}{"carrier": shipment.Carrier, "tracking_number": shipment.TrackingNumber, "quantity": shipment.Quantity, "eta": shipment.ETA},
+		})
+		if shipment.ConfirmedAt == nil {
+			continue
+		}
+		entries = append(entries, models.OrderTimelineEntry{
+			Time:       *shipment.ConfirmedAt,
+			Kind:       models.TimelineDeliveryConfirm,
+			Title:      fmt.Sprintf("确认收货 %d 件：%s %s", shipment.Quantity, shipment.Carrier, shipment.TrackingNumber),
+			ActorID:    shipment.ConfirmedBy,
+			EntityType: models.AuditEntityShipment,
+			EntityID:   shipment.ID,
+			Data:       map[string]interface{}{"quantity": shipment.Quantity},
+		})
+	}
+
+	var events []models.ShipmentEvent
+	if err := s.db.Where("order_id = ?", orderID).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		shipment := shipmentByID[event.ShipmentID]
+		entries = append(entries, models.OrderTimelineEntry{
+			Time:       event.Time,
+			Kind:       models.TimelineTrackingEvent,
+			Title:      fmt.Sprintf("物流轨迹：%s %s", shipment.TrackingNumber, event.Description),
+			Detail:     event.Location,
+			EntityType: models.AuditEntityShipment,
+			EntityID:   event.ShipmentID,
+			Data:       map[string]interface{}{"status": event.Status, "location": event.Location, "carrier": shipment.Carrier},
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return entries, nil
+}
@@ -0,0 +1,353 @@
+package services
+
+import (
+	"errors"
+	"gongChang/models"
+	"gorm.io/gorm"
+)
+
+// ErrResourceNotFound 授权检查时目标资源不存在
+var ErrResourceNotFound = errors.New("资源不存在")
+
+// ForbiddenError 无权访问，Reason 为返回给客户端的说明
+type ForbiddenError struct {
+	Reason string
+}
+
+func (e *ForbiddenError) Error() string {
+	return e.Reason
+}
+
+func forbidden(reason string) error {
+	return &ForbiddenError{Reason: reason}
+}
+
+// PolicyService 基于资源归属的统一授权策略
+// 设计师只能管理自己的订单，工厂只能管理自己的接单和进度，
+// 文件只能由其所属订单的参与方访问。
+type PolicyService struct {
+	db *gorm.DB
+}
+
+func NewPolicyService(db *gorm.DB) *PolicyService {
+	return &PolicyService{db: db}
+}
+
+// RequireRole 要求操作人具有指定角色之一
+func (s *PolicyService) RequireRole(actor models.Actor, roles ...models.UserRole) error {
+	for _, role := range roles {
+		if actor.Role == role {
+			return nil
+		}
+	}
+	return forbidden("当前角色无权执行此操作")
+}
+
+// RequireSelf 要求操作人就是目标用户本人
+func (s *PolicyService) RequireSelf(actor models.Actor, userID string) error {
+	if actor.UserID == "" || actor.UserID != userID {
+		return forbidden("只能操作自己的账号数据")
+	}
+	return nil
+}
+
+// CanViewOrder 订单设计师、客户、承接工厂、参与接单的工厂可查看订单；已发布订单对所有工厂可见
+func (s *PolicyService) CanViewOrder(actor models.Actor, orderID uint) error {
+	order, err := s.loadOrder(orderID)
+	if err != nil {
+		return err
+	}
+	party, err := s.isOrderParty(actor, order)
+	if err != nil {
+		return err
+	}
+	if party {
+		return nil
+	}
+	if actor.IsFactory() && order.Status == models.OrderStatusPublished {
+		return nil
+	}
+	return forbidden("无权查看该订单")
+}
+
+// CanManageOrder 只有订单的设计师可以修改或删除订单
+func (s *PolicyService) CanManageOrder(actor models.Actor, orderID uint) error {
+	order, err := s.loadOrder(orderID)
+	if err != nil {
+		return err
+	}
+	if actor.UserID != "" && order.DesignerID == actor.UserID {
+		return nil
+	}
+	return forbidden("只能管理自己的订单")
+}
+
+// CanOperateOrder 订单设计师或已承接订单的工厂可以推进订单（如变更状态、上传文件）
+func (s *PolicyService) CanOperateOrder(actor models.Actor, orderID uint) error {
+	order, err := s.loadOrder(orderID)
+	if err != nil {
+		return err
+	}
+	if actor.UserID == "" {
+		return forbidden("无权操作该订单")
+	}
+	if order.DesignerID == actor.UserID {
+		return nil
+	}
+	if order.FactoryID != nil && *order.FactoryID == actor.UserID {
+		return nil
+	}
+	return forbidden("只有订单设计师或承接工厂可以操作该订单")
+}
+
+// CanProduceOrder 只有已承接订单的工厂可以上报生产进度
+func (s *PolicyService) CanProduceOrder(actor models.Actor, orderID uint) error {
+	order, err := s.loadOrder(orderID)
+	if err != nil {
+		return err
+	}
+	if actor.IsFactory() && order.FactoryID != nil && *order.FactoryID == actor.UserID {
+		return nil
+	}
+	return forbidden("只有承接订单的工厂可以上报生产进度")
+}
+
+// OrderAccessLevel 计算操作人对订单的访问级别，用于实时事件按 REST 同样的规则过滤
+func (s *PolicyService) OrderAccessLevel(actor models.Actor, orderID uint) (models.OrderAccess, error) {
+	order, err := s.loadOrder(orderID)
+	if err != nil {
+		return models.OrderAccessNone, err
+	}
+	switch {
+	case actor.UserID == "":
+		return models.OrderAccessNone, nil
+	case order.DesignerID == actor.UserID:
+		return models.OrderAccessOwner, nil
+	case order.FactoryID != nil && *order.FactoryID == actor.UserID:
+		return models.OrderAccessOperator, nil
+	case actor.IsFactory() && order.Status == models.OrderStatusPublished:
+		return models.OrderAccessViewer, nil
+	}
+	party, err := s.isOrderParty(actor, order)
+	if err != nil {
+		return models.OrderAccessNone, err
+	}
+	if party {
+		return models.OrderAccessViewer, nil
+	}
+	return models.OrderAccessNone, nil
+}
+
+// CanViewJiedan 接单工厂和订单设计师可以查看接单
+func (s *PolicyService) CanViewJiedan(actor models.Actor, jiedanID uint) error {
+	jiedan, err := s.loadJiedan(jiedanID)
+	if err != nil {
+		return err
+	}
+	if actor.UserID != "" && (jiedan.FactoryID == actor.UserID || jiedan.Order.DesignerID == actor.UserID) {
+		return nil
+	}
+	return forbidden("无权查看该接单记录")
+}
+
+// CanNegotiateJiedan 只有接单工厂和订单设计师可以查看议价记录、报价和接受报价
+func (s *PolicyService) CanNegotiateJiedan(actor models.Actor, jiedanID uint) error {
+	_, err := s.JiedanPartyRole(actor, jiedanID)
+	return err
+}
+
+// JiedanPartyRole 操作人在议价中的角色：接单工厂报价，订单设计师还价
+func (s *PolicyService) JiedanPartyRole(actor models.Actor, jiedanID uint) (models.UserRole, error) {
+	jiedan, err := s.loadJiedan(jiedanID)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case actor.UserID == "":
+	case jiedan.FactoryID == actor.UserID:
+		return models.RoleFactory, nil
+	case jiedan.Order.DesignerID == actor.UserID:
+		return models.RoleDesigner, nil
+	}
+	return "", forbidden("只有接单工厂和订单设计师可以参与议价")
+}
+
+// CanManageJiedan 只有接单工厂本身可以修改或撤回接单
+func (s *PolicyService) CanManageJiedan(actor models.Actor, jiedanID uint) error {
+	jiedan, err := s.loadJiedan(jiedanID)
+	if err != nil {
+		return err
+	}
+	if actor.IsFactory() && jiedan.FactoryID == actor.UserID {
+		return nil
+	}
+	return forbidden("只能管理自己工厂的接单")
+}
+
+// CanDecideJiedan 只有订单的设计师可以同意或拒绝接单
+func (s *PolicyService) CanDecideJiedan(actor models.Actor, jiedanID uint) error {
+	jiedan, err := s.loadJiedan(jiedanID)
+	if err != nil {
+		return err
+	}
+	if actor.UserID != "" && jiedan.Order.DesignerID == actor.UserID {
+		return nil
+	}
+	return forbidden("只有订单的设计师可以处理接单")
+}
+
+// CanManageProgress 只有创建进度的工厂可以修改或删除进度
+func (s *PolicyService) CanManageProgress(actor models.Actor, progressID uint) error {
+	var progress models.OrderProgress
+	if err := s.db.Select("id", "factory_id").First(&progress, progressID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrResourceNotFound
+		}
+		return err
+	}
+	if actor.IsFactory() && progress.FactoryID == actor.UserID {
+		return nil
+	}
+	return forbidden("只能管理自己工厂的进度记录")
+}
+
+// CanAccessFile 文件所属或关联订单的参与方、文件上传人或所属工厂可访问文件；write 为 true 时表示修改或删除
+func (s *PolicyService) CanAccessFile(actor models.Actor, fileID string, write bool) error {
+	var file models.File
+	if err := s.db.First(&file, "id = ?", fileID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrResourceNotFound
+		}
+		return err
+	}
+	if actor.UserID == "" {
+		return forbidden("无权访问该文件")
+	}
+	if file.UploaderID == actor.UserID || (file.FactoryID != "" && file.FactoryID == actor.UserID) {
+		return nil
+	}
+	if !write {
+		// 会话附件对会话双方可读
+		var shared int64
+		if err := s.db.Model(&models.MessageAttachment{}).
+			Joins("JOIN message_threads ON message_threads.id = message_attachments.thread_id").
+			Where("message_attachments.file_id = ? AND (message_threads.designer_id = ? OR message_threads.factory_id = ?)", file.ID, actor.UserID, actor.UserID).
+			Count(&shared).Error; err != nil {
+			return err
+		}
+		if shared > 0 {
+			return nil
+		}
+	}
+	// 上传到的订单和通过 order_files 关联的订单
+	orderIDs, err := ordersReferencingFile(s.db, file.ID)
+	if err != nil {
+		return err
+	}
+	if file.OrderID != nil {
+		orderIDs = append(orderIDs, *file.OrderID)
+	}
+	if len(orderIDs) > 0 {
+		for _, orderID := range orderIDs {
+			order, err := s.loadOrder(orderID)
+			if errors.Is(err, ErrResourceNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if write {
+				if order.DesignerID == actor.UserID || (order.FactoryID != nil && *order.FactoryID == actor.UserID) {
+					return nil
+				}
+			} else if party, err := s.isOrderParty(actor, order); err != nil {
+				return err
+			} else if party {
+				return nil
+			}
+		}
+		return forbidden("只有订单参与方可以访问该文件")
+	}
+	// 未关联订单且无上传人记录的历史文件只允许读取
+	if file.UploaderID == "" && file.FactoryID == "" && !write {
+		return nil
+	}
+	return forbidden("无权访问该文件")
+}
+
+// CanManageFabric 只有布料的设计师、供应商或工厂可以查看库存流水和变更库存
+func (s *PolicyService) CanManageFabric(actor models.Actor, fabricID uint) error {
+	var fabric models.Fabric
+	if err := s.db.Select("id", "designer_id", "supplier_id", "factory_id").First(&fabric, fabricID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrResourceNotFound
+		}
+		return err
+	}
+	if actor.UserID != "" {
+		for _, owner := range fabricOwners(&fabric) {
+			if owner == actor.UserID {
+				return nil
+			}
+		}
+	}
+	return forbidden("只能管理自己名下的布料")
+}
+
+// CanAccessThread 只有会话双方（订单设计师和对应工厂）可以查看会话和发送消息
+func (s *PolicyService) CanAccessThread(actor models.Actor, threadID uint) error {
+	var thread models.MessageThread
+	if err := s.db.Select("id", "designer_id", "factory_id").First(&thread, threadID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrResourceNotFound
+		}
+		return err
+	}
+	if thread.IsParty(actor.UserID) {
+		return nil
+	}
+	return forbidden("只有会话双方可以访问该会话")
+}
+
+// isOrderParty 是否为订单的参与方：设计师、客户、承接工厂或对该订单接过单的工厂
+func (s *PolicyService) isOrderParty(actor models.Actor, order *models.Order) (bool, error) {
+	if actor.UserID == "" {
+		return false, nil
+	}
+	if order.DesignerID == actor.UserID || order.CustomerID == actor.UserID {
+		return true, nil
+	}
+	if order.FactoryID != nil && *order.FactoryID == actor.UserID {
+		return true, nil
+	}
+	if actor.IsFactory() {
+		var count int64
+		if err := s.db.Model(&models.Jiedan{}).Where("order_id = ? AND factory_id = ?", order.ID, actor.UserID).Count(&count).Error; err != nil {
+			return false, err
+		}
+		return count > 0, nil
+	}
+	return false, nil
+}
+
+func (s *PolicyService) loadOrder(orderID uint) (*models.Order, error) {
+	var order models.Order
+	if err := s.db.Select("id", "designer_id", "customer_id", "factory_id", "status").First(&order, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrResourceNotFound
+		}
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (s *PolicyService) loadJiedan(jiedanID uint) (*models.Jiedan, error) {
+	var jiedan models.Jiedan
+	if err := s.db.Preload("Order").First(&jiedan, jiedanID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrResourceNotFound
+		}
+		return nil, err
+	}
+	return &jiedan, nil
+}
@@ -3,13 +3,14 @@ package services
 import (
 	"encoding/json"
 	"fmt"
-	"time"
 	"gongChang/models"
 	"gorm.io/gorm"
+	"time"
 )
 
 type ProgressService struct {
-	db *gorm.DB
+	db    *gorm.DB
+	actor models.Actor
 }
 
 func NewProgressService(db *gorm.DB) *ProgressService {
@@ -18,6 +19,31 @@ func NewProgressService(db *gorm.DB) *ProgressService {
 	}
 }
 
+// WithActor 返回绑定操作人的服务副本，写操作将以该操作人记录审计事件
+func (s *ProgressService) WithActor(actor models.Actor) *ProgressService {
+	c := *s
+	c.actor = actor
+	return &c
+}
+
+// auditProgress 记录进度变更的审计事件
+func (s *ProgressService) auditProgress(tx *gorm.DB, action string, before, after *models.OrderProgress) error {
+	target := after
+	if target == nil {
+		target = before
+	}
+	orderID := target.OrderID
+	return recordAudit(tx, s.actor, auditEntry{
+		EntityType: models.AuditEntityProgress,
+		EntityID:   target.ID,
+		Action:     action,
+		OrderID:    &orderID,
+		OwnerID:    target.FactoryID,
+		Before:     before,
+		After:      after,
+	})
+}
+
 // CreateProgress 创建进度记录
 func (s *ProgressService) CreateProgress(req *models.CreateProgressRequest) (*models.OrderProgress, error) {
 	// 检查订单是否存在
@@ -67,7 +93,52 @@ func (s *ProgressService) CreateProgress(req *models.CreateProgressRequest) (*mo
 		CreatedAt:     &now,
 	}
 
-	if err := s.db.Create(progress).Error; err != nil {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// 开始大货生产前产前样必须已批准，工厂必须确认当前发布的工艺单
+		if req.Type == models.ProgressTypeProduction {
+			if err := requirePPSampleApproved(tx, req.OrderID); err != nil {
+				return err
+			}
+			if err := requireTechPackAcknowledged(tx, req.OrderID, req.FactoryID); err != nil {
+				return err
+			}
+		}
+		// 最近一次质量检验不合格时不能进入发货阶段
+		if req.Type == models.ProgressTypeShipping {
+			if err := requireQCPassed(tx, req.OrderID); err != nil {
+				return err
+			}
+		}
+		// 按尺码 × 颜色明细上报的累计完成数量随进度一起保存
+		if len(req.LineQuantities) > 0 {
+			quantities, err := validateProgressLines(tx, req.OrderID, req.LineQuantities)
+			if err != nil {
+				return err
+			}
+			progress.LineQuantities = quantities
+		}
+		if err := tx.Create(progress).Error; err != nil {
+			return err
+		}
+		if err := s.auditProgress(tx, models.AuditActionCreate, nil, progress); err != nil {
+			return err
+		}
+		if err := syncMilestone(tx, progress.OrderID, progress.Type); err != nil {
+			return err
+		}
+		if err := publishOrderEvent(tx, progress.OrderID, models.RealtimeProgressCreated, models.OrderAccessViewer, progressEventPayload(progress)); err != nil {
+			return err
+		}
+		return notify(tx, s.actor, notificationEvent{
+			Category:   models.NotificationProgressNew,
+			Title:      "订单有新的生产进度",
+			Content:    fmt.Sprintf("订单「%s」更新了进度：%s", order.Title, progress.Description),
+			EntityType: models.AuditEntityProgress,
+			EntityID:   progress.ID,
+			OrderID:    &progress.OrderID,
+		}, order.DesignerID, order.CustomerID)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -77,7 +148,7 @@ func (s *ProgressService) CreateProgress(req *models.CreateProgressRequest) (*mo
 // GetProgressByID 根据ID获取进度记录
 func (s *ProgressService) GetProgressByID(id uint) (*models.OrderProgress, error) {
 	var progress models.OrderProgress
-	if err := s.db.Preload("Order").Preload("Factory").First(&progress, id).Error; err != nil {
+	if err := s.db.Preload("Order").Preload("Factory").Preload("LineQuantities").First(&progress, id).Error; err != nil {
 		return nil, err
 	}
 	return &progress, nil
@@ -87,7 +158,7 @@ func (s *ProgressService) GetProgressByID(id uint) (*models.OrderProgress, error
 func (s *ProgressService) GetProgressByOrderID(orderID uint) ([]models.OrderProgress, error) {
 	var progress []models.OrderProgress
 	if err := s.db.Where("order_id = ?", orderID).
-		Preload("Order").Preload("Factory").
+		Preload("Order").Preload("Factory").Preload("LineQuantities").
 		Order("created_at DESC").
 		Find(&progress).Error; err != nil {
 		return nil, err
@@ -108,7 +179,7 @@ func (s *ProgressService) GetProgressByFactoryID(factoryID string, page, pageSiz
 	// 获取分页数据
 	offset := (page - 1) * pageSize
 	if err := s.db.Where("factory_id = ?", factoryID).
-		Preload("Order").Preload("Factory").
+		Preload("Order").Preload("Factory").Preload("LineQuantities").
 		Offset(offset).Limit(pageSize).
 		Order("created_at DESC").
 		Find(&progress).Error; err != nil {
@@ -145,7 +216,7 @@ func (s *ProgressService) UpdateProgress(id uint, req *models.UpdateProgressRequ
 	if req.CompletedTime != nil {
 		updates["completed_time"] = req.CompletedTime
 	}
-	
+
 	// 处理图片数组
 	if req.Images != nil {
 		imagesJSON := ""
@@ -159,29 +230,117 @@ func (s *ProgressService) UpdateProgress(id uint, req *models.UpdateProgressRequ
 		updates["images"] = imagesJSON
 	}
 
-	if len(updates) > 0 {
-		if err := s.db.Model(&progress).Updates(updates).Error; err != nil {
+	if len(updates) > 0 || req.LineQuantities != nil {
+		before := progress
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if req.Type == models.ProgressTypeProduction && before.Type != models.ProgressTypeProduction {
+				if err := requirePPSampleApproved(tx, progress.OrderID); err != nil {
+					return err
+				}
+				if err := requireTechPackAcknowledged(tx, progress.OrderID, progress.FactoryID); err != nil {
+					return err
+				}
+			}
+			if req.Type == models.ProgressTypeShipping && before.Type != models.ProgressTypeShipping {
+				if err := requireQCPassed(tx, progress.OrderID); err != nil {
+					return err
+				}
+			}
+			if len(updates) > 0 {
+				if err := tx.Model(&progress).Updates(updates).Error; err != nil {
+					return err
+				}
+			}
+			// 给出明细数量时整体替换本次上报的数量
+			if req.LineQuantities != nil {
+				quantities, err := validateProgressLines(tx, progress.OrderID, req.LineQuantities)
+				if err != nil {
+					return err
+				}
+				if err := tx.Where("progress_id = ?", progress.ID).Delete(&models.ProgressLineQuantity{}).Error; err != nil {
+					return err
+				}
+				for i := range quantities {
+					quantities[i].ProgressID = progress.ID
+				}
+				if len(quantities) > 0 {
+					if err := tx.Create(&quantities).Error; err != nil {
+						return err
+					}
+				}
+				progress.LineQuantities = quantities
+			}
+			if err := s.auditProgress(tx, models.AuditActionUpdate, &before, &progress); err != nil {
+				return err
+			}
+			if err := syncMilestone(tx, progress.OrderID, progress.Type); err != nil {
+				return err
+			}
+			if before.Type != progress.Type {
+				if err := syncMilestone(tx, progress.OrderID, before.Type); err != nil {
+					return err
+				}
+			}
+			return publishOrderEvent(tx, progress.OrderID, models.RealtimeProgressUpdated, models.OrderAccessViewer, progressEventPayload(&progress))
+		})
+		if err != nil {
 			return nil, err
 		}
 	}
 
 	// 重新获取更新后的记录
-	if err := s.db.Preload("Order").Preload("Factory").First(&progress, id).Error; err != nil {
+	if err := s.db.Preload("Order").Preload("Factory").Preload("LineQuantities").First(&progress, id).Error; err != nil {
 		return nil, err
 	}
 
 	return &progress, nil
 }
 
+// progressEventPayload 进度实时事件的推送内容
+func progressEventPayload(progress *models.OrderProgress) map[string]interface{} {
+	return map[string]interface{}{
+		"progress_id":     progress.ID,
+		"order_id":        progress.OrderID,
+		"factory_id":      progress.FactoryID,
+		"type":            progress.Type,
+		"status":          progress.Status,
+		"description":     progress.Description,
+		"start_time":      progress.StartTime,
+		"completed_time":  progress.CompletedTime,
+		"line_quantities": progress.LineQuantities,
+	}
+}
+
 // DeleteProgress 删除进度记录
 func (s *ProgressService) DeleteProgress(id uint) error {
-	return s.db.Delete(&models.OrderProgress{}, id).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var progress models.OrderProgress
+		if err := tx.First(&progress, id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("进度记录不存在")
+			}
+			return err
+		}
+		if err := tx.Delete(&progress).Error; err != nil {
+			return err
+		}
+		if err := s.auditProgress(tx, models.AuditActionDelete, &progress, nil); err != nil {
+			return err
+		}
+		if err := syncMilestone(tx, progress.OrderID, progress.Type); err != nil {
+			return err
+		}
+		return publishOrderEvent(tx, progress.OrderID, models.RealtimeProgressDeleted, models.OrderAccessViewer, map[string]interface{}{
+			"progress_id": progress.ID,
+			"order_id":    progress.OrderID,
+		})
+	})
 }
 
 // GetProgressStatistics 获取进度统计信息
 func (s *ProgressService) GetProgressStatistics(factoryID string) (map[string]int64, error) {
 	stats := make(map[string]int64)
-	
+
 	// 统计各状态的进度数量
 	statuses := []models.ProgressStatus{
 		models.ProgressStatusNotStarted,
@@ -200,4 +359,4 @@ func (s *ProgressService) GetProgressStatistics(factoryID string) (map[string]in
 	}
 
 	return stats, nil
-} 
\ No newline at end of file
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"errors"
+	"gongChang/models"
+	"math"
+	"strings"
+)
+
+var (
+	ErrInvalidInspectionLevel = errors.New("检验水平应为 I、II、III 或 S-1 至 S-4")
+	ErrUnsupportedAQL         = errors.New("不支持的 AQL 值，可选 0、0.065、0.1、0.15、0.25、0.4、0.65、1.0、1.5、2.5、4.0、6.5")
+	ErrInvalidLotSize         = errors.New("批量至少为 2 件")
+)
+
+// DefaultInspectionLevel 未指定时使用一般检验水平 II
+const DefaultInspectionLevel = "II"
+
+// ISO 2859-1 表 1：批量范围的上限，超过最后一档的批量归入 500001 以上
+var aqlLotSizeLimits = []int{8, 15, 25, 50, 90, 150, 280, 500, 1200, 3200, 10000, 35000, 150000, 500000}
+
+// 各检验水平在每个批量范围对应的样本量字码
+var aqlCodeLetters = map[string]string{
+	"S-1": "AAAABBBBCCCCDDD",
+	"S-2": "AAABBBCCCDDDEEE",
+	"S-3": "AABBCCDDEEFFGGH",
+	"S-4": "AABCCDEEFGGHJJK",
+	"I":   "AABCCDEFGHJKLMN",
+	"II":  "ABCDEFGHJKLMNPQ",
+	"III": "BCDEFGHJKLMNPQR",
+}
+
+// ISO 2859-1 表 2-A：一次正常抽样的样本量字码和样本量
+const aqlSampleLetters = "ABCDEFGHJKLMNPQR"
+
+var aqlSampleSizes = []int{2, 3, 5, 8, 13, 20, 32, 50, 80, 125, 200, 315, 500, 800, 1250, 2000}
+
+// 支持的 AQL 值，即表 2-A 的列
+var aqlValues = []float64{0.065, 0.1, 0.15, 0.25, 0.4, 0.65, 1.0, 1.5, 2.5, 4.0, 6.5}
+
+// 表 2-A 中接收数沿对角线排列：字码序号与 AQL 序号之和相同的格子方案相同。
+// 和为 10 到 20 时依次为下列接收数（拒收数为接收数加一），
+// 和为 11 的格子是向上箭头，和为 12 的是向下箭头；小于 10 向下、大于 20 向上。
+var aqlDiagonalAccept = []int{0, -1, -1, 1, 2, 3, 5, 7, 10, 14, 21}
+
+// NormalizeInspectionLevel 统一检验水平写法，空值按一般检验水平 II
+func NormalizeInspectionLevel(level string) (string, error) {
+	level = strings.ToUpper(strings.TrimSpace(level))
+	if level == "" {
+		return DefaultInspectionLevel, nil
+	}
+	if strings.HasPrefix(level, "S") && !strings.HasPrefix(level, "S-") {
+		level = "S-" + strings.TrimPrefix(level, "S")
+	}
+	if _, ok := aqlCodeLetters[level]; !ok {
+		return "", ErrInvalidInspectionLevel
+	}
+	return level, nil
+}
+
+// aqlIndex AQL 值在表 2-A 中的列序号
+func aqlIndex(aql float64) (int, bool) {
+	for i, v := range aqlValues {
+		if math.Abs(v-aql) < 1e-9 {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// ComputeAQLPlan 按批量、检验水平和 AQL 计算一次正常抽样方案
+// 表中为箭头时沿箭头方向取第一个方案，样本量随之改变；AQL 为 0 表示不允许出现该类缺陷，按字码样本量抽样且接收数为 0。
+func ComputeAQLPlan(lotSize int, level string, aql float64) (*models.AQLPlan, error) {
+	if lotSize < 2 {
+		return nil, ErrInvalidLotSize
+	}
+	level, err := NormalizeInspectionLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	lotRange := len(aqlLotSizeLimits)
+	for i, limit := range aqlLotSizeLimits {
+		if lotSize <= limit {
+			lotRange = i
+			break
+		}
+	}
+	letter := aqlCodeLetters[level][lotRange]
+	row := strings.IndexByte(aqlSampleLetters, letter)
+
+	accept := 0
+	if aql > 0 {
+		col, ok := aqlIndex(aql)
+		if !ok {
+			return nil, ErrUnsupportedAQL
+		}
+		for {
+			d := row + col
+			if d < 10 || d == 12 {
+				row++
+				continue
+			}
+			if d == 11 || d > 20 {
+				row--
+				continue
+			}
+			accept = aqlDiagonalAccept[d-10]
+			break
+		}
+	}
+
+	// 样本量不小于批量时全检
+	sampleSize := aqlSampleSizes[row]
+	if sampleSize > lotSize {
+		sampleSize = lotSize
+	}
+	return &models.AQLPlan{
+		LotSize:         lotSize,
+		InspectionLevel: level,
+		AQL:             aql,
+		CodeLetter:      string(letter),
+		SampleSize:      sampleSize,
+		Accept:          accept,
+		Reject:          accept + 1,
+	}, nil
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+// 期望值取自 ISO 2859-1 表 1 和表 2-A（一次正常抽样）
+func TestComputeAQLPlan(t *testing.T) {
+	cases := []struct {
+		name       string
+		lotSize    int
+		level      string
+		aql        float64
+		letter     string
+		sampleSize int
+		accept     int
+	}{
+		{"J 2.5", 1000, "II", 2.5, "J", 80, 5},
+		{"J 4.0", 1000, "II", 4.0, "J", 80, 7},
+		{"J 1.0", 1000, "II", 1.0, "J", 80, 2},
+		{"J 6.5", 1000, "", 6.5, "J", 80, 10},
+		{"F 0.65", 100, "II", 0.65, "F", 20, 0},
+		{"zero AQL", 1000, "II", 0, "J", 80, 0},
+		{"down arrow into Ac0", 100, "II", 0.4, "F", 32, 0},
+		{"down arrow into Ac1", 100, "II", 1.5, "F", 32, 1},
+		{"up arrow into Ac0", 100, "II", 1.0, "F", 13, 0},
+		{"up arrow past Ac21", 600000, "III", 6.5, "R", 200, 21},
+		{"special level", 1000, "s3", 2.5, "E", 20, 1},
+		{"sample exceeds lot", 5, "II", 0.4, "A", 5, 0},
+		{"sample equals lot", 2, "II", 6.5, "A", 2, 0},
+	}
+	for _, tc := range cases {
+		plan, err := ComputeAQLPlan(tc.lotSize, tc.level, tc.aql)
+		if err != nil {
+			t.Errorf("%s: ComputeAQLPlan: %v", tc.name, err)
+			continue
+		}
+		if plan.CodeLetter != tc.letter || plan.SampleSize != tc.sampleSize ||
+			plan.Accept != tc.accept || plan.Reject != tc.accept+1 {
+			t.Errorf("%s: plan = %s n=%d Ac%d Re%d, want %s n=%d Ac%d Re%d", tc.name,
+				plan.CodeLetter, plan.SampleSize, plan.Accept, plan.Reject,
+				tc.letter, tc.sampleSize, tc.accept, tc.accept+1)
+		}
+	}
+}
+
+func TestComputeAQLPlanRejectsInvalidInput(t *testing.T) {
+	cases := []struct {
+		name    string
+		lotSize int
+		level   string
+		aql     float64
+		want    error
+	}{
+		{"lot too small", 1, "II", 2.5, ErrInvalidLotSize},
+		{"unknown level", 1000, "IV", 2.5, ErrInvalidInspectionLevel},
+		{"unsupported AQL", 1000, "II", 3.0, ErrUnsupportedAQL},
+	}
+	for _, tc := range cases {
+		if _, err := ComputeAQLPlan(tc.lotSize, tc.level, tc.aql); !errors.Is(err, tc.want) {
+			t.Errorf("%s: ComputeAQLPlan = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
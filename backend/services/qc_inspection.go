@@ -0,0 +1,293 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gongChang/models"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrQCInspectionNotFound = errors.New("检验报告不存在")
+	ErrQCNoFactory          = errors.New("订单还没有承接工厂，不能提交检验报告")
+	ErrQCProgressInvalid    = errors.New("关联的进度不是该订单的质检阶段")
+	ErrQCInspectionFailed   = errors.New("最近一次质量检验未通过，复检合格后才能发货")
+)
+
+// 服装行业常用的 AQL：不允许致命缺陷，严重 2.5，轻微 4.0
+const (
+	defaultAQLCritical = 0
+	defaultAQLMajor    = 2.5
+	defaultAQLMinor    = 4.0
+)
+
+// QCInspectionService 按 AQL 抽样标准进行的质量检验
+type QCInspectionService struct {
+	db    *gorm.DB
+	actor models.Actor
+}
+
+func NewQCInspectionService(db *gorm.DB) *QCInspectionService {
+	return &QCInspectionService{db: db}
+}
+
+// WithActor 返回绑定操作人的服务副本
+func (s *QCInspectionService) WithActor(actor models.Actor) *QCInspectionService {
+	c := *s
+	c.actor = actor
+	return &c
+}
+
+// aqlOrDefault 未填写的 AQL 取默认值
+func aqlOrDefault(aql *float64, fallback float64) float64 {
+	if aql == nil {
+		return fallback
+	}
+	return *aql
+}
+
+// CreateInspection 提交检验报告：计算各缺陷等级的抽样方案，汇总缺陷数量并给出结论
+// 任一等级的缺陷数达到拒收数即判定不合格。
+func (s *QCInspectionService) CreateInspection(orderID uint, req *models.CreateQCInspectionRequest) (*models.QCInspection, error) {
+	plans := make(map[models.DefectSeverity]*models.AQLPlan, 3)
+	for severity, aql := range map[models.DefectSeverity]float64{
+		models.DefectCritical: aqlOrDefault(req.AQLCritical, defaultAQLCritical),
+		models.DefectMajor:    aqlOrDefault(req.AQLMajor, defaultAQLMajor),
+		models.DefectMinor:    aqlOrDefault(req.AQLMinor, defaultAQLMinor),
+	} {
+		plan, err := ComputeAQLPlan(req.LotSize, req.InspectionLevel, aql)
+		if err != nil {
+			return nil, err
+		}
+		plans[severity] = plan
+	}
+	major := plans[models.DefectMajor]
+	inspection := &models.QCInspection{
+		OrderID:         orderID,
+		ProgressID:      req.ProgressID,
+		InspectorID:     s.actor.UserID,
+		LotSize:         req.LotSize,
+		InspectionLevel: major.InspectionLevel,
+		CodeLetter:      major.CodeLetter,
+		AQLCritical:     plans[models.DefectCritical].AQL,
+		AQLMajor:        major.AQL,
+		AQLMinor:        plans[models.DefectMinor].AQL,
+		CriticalAccept:  plans[models.DefectCritical].Accept,
+		CriticalReject:  plans[models.DefectCritical].Reject,
+		MajorAccept:     major.Accept,
+		MajorReject:     major.Reject,
+		MinorAccept:     plans[models.DefectMinor].Accept,
+		MinorReject:     plans[models.DefectMinor].Reject,
+		Note:            req.Note,
+		InspectedAt:     time.Now(),
+	}
+	for _, plan := range plans {
+		if plan.SampleSize > inspection.SampleSize {
+			inspection.SampleSize = plan.SampleSize
+		}
+	}
+	if req.InspectedAt != nil {
+		inspection.InspectedAt = *req.InspectedAt
+	}
+
+	for _, d := range req.Defects {
+		inspection.Defects = append(inspection.Defects, models.QCDefect{
+			Severity:    d.Severity,
+			Category:    strings.TrimSpace(d.Category),
+			Quantity:    d.Quantity,
+			Description: d.Description,
+			Photos:      datatypes.NewJSONSlice(append([]string{}, d.Photos...)),
+		})
+		switch d.Severity {
+		case models.DefectCritical:
+			inspection.CriticalFound += d.Quantity
+		case models.DefectMajor:
+			inspection.MajorFound += d.Quantity
+		case models.DefectMinor:
+			inspection.MinorFound += d.Quantity
+		}
+	}
+	inspection.Result = models.QCResultPass
+	if inspection.CriticalFound >= inspection.CriticalReject ||
+		inspection.MajorFound >= inspection.MajorReject ||
+		inspection.MinorFound >= inspection.MinorReject {
+		inspection.Result = models.QCResultFail
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.FactoryID == nil || *order.FactoryID == "" {
+			return ErrQCNoFactory
+		}
+		inspection.FactoryID = *order.FactoryID
+
+		if req.ProgressID != nil {
+			var progress models.OrderProgress
+			err := tx.Where("id = ? AND order_id = ? AND type = ?", *req.ProgressID, orderID, models.ProgressTypeQuality).
+				First(&progress).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrQCProgressInvalid
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(inspection).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, s.actor, auditEntry{
+			EntityType: models.AuditEntityQCInspection,
+			EntityID:   inspection.ID,
+			Action:     models.AuditActionCreate,
+			OrderID:    &order.ID,
+			OwnerID:    inspection.FactoryID,
+			After:      inspection,
+		}); err != nil {
+			return err
+		}
+		if err := publishOrderEvent(tx, orderID, models.RealtimeQCInspected, models.OrderAccessViewer, map[string]interface{}{
+			"inspection_id": inspection.ID,
+			"order_id":      orderID,
+			"result":        inspection.Result,
+			"sample_size":   inspection.SampleSize,
+		}); err != nil {
+			return err
+		}
+		verdict := "合格"
+		if inspection.Result == models.QCResultFail {
+			verdict = "不合格"
+		}
+		return notify(tx, s.actor, notificationEvent{
+			Category: models.NotificationQCInspection,
+			Title:    "质量检验" + verdict,
+			Content: fmt.Sprintf("订单「%s」抽检 %d 件，致命 %d、严重 %d、轻微 %d，结论：%s",
+				order.Title, inspection.SampleSize, inspection.CriticalFound, inspection.MajorFound, inspection.MinorFound, verdict),
+			EntityType: models.AuditEntityQCInspection,
+			EntityID:   inspection.ID,
+			OrderID:    &order.ID,
+		}, order.DesignerID, inspection.FactoryID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inspection, nil
+}
+
+// ListInspections 订单的检验报告，从新到旧排列
+func (s *QCInspectionService) ListInspections(orderID uint) ([]models.QCInspection, error) {
+	if err := s.db.Select("id").First(&models.Order{}, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	inspections := make([]models.QCInspection, 0)
+	err := s.db.Preload("Defects").Where("order_id = ?", orderID).
+		Order("inspected_at DESC, id DESC").Find(&inspections).Error
+	return inspections, err
+}
+
+// GetInspection 订单的一份检验报告
+func (s *QCInspectionService) GetInspection(orderID, inspectionID uint) (*models.QCInspection, error) {
+	var inspection models.QCInspection
+	if err := s.db.Preload("Defects").Where("id = ? AND order_id = ?", inspectionID, orderID).
+		First(&inspection).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrQCInspectionNotFound
+		}
+		return nil, err
+	}
+	return &inspection, nil
+}
+
+// FactoryQualityStats 工厂的检验统计，from/to 为空时不限时间
+func (s *QCInspectionService) FactoryQualityStats(factoryID string, from, to *time.Time) (*models.FactoryQualityStats, error) {
+	scope := func(db *gorm.DB) *gorm.DB {
+		db = db.Where("qc_inspections.factory_id = ?", factoryID)
+		if from != nil {
+			db = db.Where("qc_inspections.inspected_at >= ?", *from)
+		}
+		if to != nil {
+			db = db.Where("qc_inspections.inspected_at < ?", *to)
+		}
+		return db
+	}
+
+	var totals struct {
+		Inspections     int64
+		Passed          int64
+		Failed          int64
+		SampledUnits    int64
+		CriticalDefects int64
+		MajorDefects    int64
+		MinorDefects    int64
+	}
+	if err := s.db.Model(&models.QCInspection{}).Scopes(scope).
+		Select("COUNT(*) AS inspections, "+
+			"COALESCE(SUM(CASE WHEN result = ? THEN 1 ELSE 0 END), 0) AS passed, "+
+			"COALESCE(SUM(CASE WHEN result = ? THEN 1 ELSE 0 END), 0) AS failed, "+
+			"COALESCE(SUM(sample_size), 0) AS sampled_units, "+
+			"COALESCE(SUM(critical_found), 0) AS critical_defects, "+
+			"COALESCE(SUM(major_found), 0) AS major_defects, "+
+			"COALESCE(SUM(minor_found), 0) AS minor_defects", models.QCResultPass, models.QCResultFail).
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+	stats := &models.FactoryQualityStats{
+		FactoryID:       factoryID,
+		Inspections:     totals.Inspections,
+		Passed:          totals.Passed,
+		Failed:          totals.Failed,
+		SampledUnits:    totals.SampledUnits,
+		CriticalDefects: totals.CriticalDefects,
+		MajorDefects:    totals.MajorDefects,
+		MinorDefects:    totals.MinorDefects,
+	}
+	if stats.Inspections > 0 {
+		stats.PassRate = math.Round(float64(stats.Passed)/float64(stats.Inspections)*10000) / 100
+	}
+	if stats.SampledUnits > 0 {
+		defects := stats.CriticalDefects + stats.MajorDefects + stats.MinorDefects
+		stats.DefectRate = math.Round(float64(defects)/float64(stats.SampledUnits)*10000) / 100
+	}
+
+	stats.TopCategories = make([]models.QCDefectCategoryCount, 0)
+	if err := s.db.Model(&models.QCDefect{}).
+		Joins("JOIN qc_inspections ON qc_inspections.id = qc_defects.inspection_id").
+		Scopes(scope).
+		Select("qc_defects.category AS category, SUM(qc_defects.quantity) AS quantity").
+		Group("qc_defects.category").
+		Order("quantity DESC").
+		Limit(10).
+		Scan(&stats.TopCategories).Error; err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// requireQCPassed 订单最近一次检验不合格时不能进入发货阶段；没有检验记录时不限制
+// 按提交顺序取最近一次检验，不使用客户端填写的检验时间，补录的旧报告不能覆盖之后的不合格结论。
+func requireQCPassed(tx *gorm.DB, orderID uint) error {
+	var latest models.QCInspection
+	err := tx.Select("id", "result").Where("order_id = ?", orderID).
+		Order("id DESC").First(&latest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if latest.Result == models.QCResultFail {
+		return ErrQCInspectionFailed
+	}
+	return nil
+}
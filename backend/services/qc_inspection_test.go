@@ -0,0 +1,56 @@
+package services
+
+import (
+	"errors"
+	"gongChang/models"
+	"gongChang/tracking"
+	"testing"
+	"time"
+)
+
+func TestRequireQCPassedUsesLatestSubmission(t *testing.T) {
+	db := newShipmentTestDB(t)
+	order := seedShipmentOrder(t, db)
+	qc := NewQCInspectionService(db).WithActor(testDesigner)
+	inspect := func(majorDefects int, inspectedAt *time.Time) *models.QCInspection {
+		t.Helper()
+		req := &models.CreateQCInspectionRequest{LotSize: 100, InspectedAt: inspectedAt}
+		if majorDefects > 0 {
+			req.Defects = []models.QCDefectRequest{{Severity: models.DefectMajor, Category: "跳线", Quantity: majorDefects}}
+		}
+		inspection, err := qc.CreateInspection(order.ID, req)
+		if err != nil {
+			t.Fatalf("CreateInspection: %v", err)
+		}
+		return inspection
+	}
+
+	// 批量 100、一般检验水平 II：字码 F，抽样 20 件，严重缺陷 AQL 2.5 时 Ac 1 / Re 2
+	future := time.Now().Add(30 * 24 * time.Hour)
+	if got := inspect(0, &future); got.Result != models.QCResultPass || got.CodeLetter != "F" || got.SampleSize != 20 {
+		t.Fatalf("passing inspection = %s letter %s n %d", got.Result, got.CodeLetter, got.SampleSize)
+	}
+	if got := inspect(2, nil); got.Result != models.QCResultFail {
+		t.Fatalf("inspection with 2 major defects = %s, want fail", got.Result)
+	}
+
+	// 检验时间填在未来的合格报告不能盖过之后提交的不合格结论
+	if err := requireQCPassed(db, order.ID); !errors.Is(err, ErrQCInspectionFailed) {
+		t.Fatalf("requireQCPassed after failure = %v, want ErrQCInspectionFailed", err)
+	}
+	shipments := NewShipmentService(db, tracking.NewFakeProvider()).WithActor(testFactory)
+	if _, err := shipments.CreateShipment(order.ID, shipmentRequest("SF300",
+		models.ShipmentItemRequest{Size: "S", Color: "红", Quantity: 10})); !errors.Is(err, ErrQCInspectionFailed) {
+		t.Fatalf("CreateShipment after failed inspection = %v, want ErrQCInspectionFailed", err)
+	}
+
+	past := time.Now().Add(-24 * time.Hour)
+	inspect(1, &past)
+	if err := requireQCPassed(db, order.ID); err != nil {
+		t.Fatalf("requireQCPassed after re-inspection = %v", err)
+	}
+	if _, err := shipments.CreateShipment(order.ID, shipmentRequest("SF300",
+		models.ShipmentItemRequest{Size: "S", Color: "红", Quantity: 10})); err != nil {
+		t.Fatalf("CreateShipment after re-inspection: %v", err)
+	}
+}
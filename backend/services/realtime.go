@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"gongChang/models"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const (
+	realtimePollInterval = 500 * time.Millisecond
+	realtimeBatchSize    = 500
+	realtimeGapTimeout   = 5 * time.Second    // 自增ID缺口超过该时间视为事务已回滚
+	realtimeRetention    = 7 * 24 * time.Hour // 事件保留时长，超过后无法续传
+	realtimeBufferSize   = 64
+)
+
+// publishEvent 在调用方事务内写入实时事件，事务提交后由 RealtimeHub 推送
+func publishEvent(tx *gorm.DB, channel, eventType string, minAccess models.OrderAccess, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.RealtimeEvent{
+		Channel:   channel,
+		Type:      eventType,
+		MinAccess: minAccess,
+		Payload:   datatypes.JSON(data),
+	}).Error
+}
+
+// publishOrderEvent 向订单频道发布事件
+func publishOrderEvent(tx *gorm.DB, orderID uint, eventType string, minAccess models.OrderAccess, payload interface{}) error {
+	return publishEvent(tx, models.OrderChannel(orderID), eventType, minAccess, payload)
+}
+
+// Subscription 一个频道订阅，事件从 C 读取，用完必须调用 Close
+type Subscription struct {
+	C       <-chan models.RealtimeEvent
+	channel string
+	ch      chan models.RealtimeEvent
+	hub     *RealtimeHub
+}
+
+// Close 取消订阅
+func (s *Subscription) Close() {
+	s.hub.unsubscribe(s)
+}
+
+// RealtimeHub 轮询事件表并分发给本进程内的订阅者
+// 事件先随业务事务落库再由轮询推送，保证只推送已提交的数据，多实例部署时各实例独立轮询。
+type RealtimeHub struct {
+	db   *gorm.DB
+	mu   sync.RWMutex
+	subs map[string]map[*Subscription]struct{}
+}
+
+func NewRealtimeHub(db *gorm.DB) *RealtimeHub {
+	return &RealtimeHub{
+		db:   db,
+		subs: make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe 订阅频道
+func (h *RealtimeHub) Subscribe(channel string) *Subscription {
+	ch := make(chan models.RealtimeEvent, realtimeBufferSize)
+	sub := &Subscription{C: ch, channel: channel, ch: ch, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[channel] == nil {
+		h.subs[channel] = make(map[*Subscription]struct{})
+	}
+	h.subs[channel][sub] = struct{}{}
+	return sub
+}
+
+func (h *RealtimeHub) unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if subs, ok := h.subs[sub.channel]; ok {
+		if _, ok := subs[sub]; ok {
+			delete(subs, sub)
+			close(sub.ch)
+		}
+		if len(subs) == 0 {
+			delete(h.subs, sub.channel)
+		}
+	}
+}
+
+// Replay 获取频道中 ID 大于 afterID 的历史事件，用于断线续传
+func (h *RealtimeHub) Replay(channel string, afterID uint, limit int) ([]models.RealtimeEvent, error) {
+	var events []models.RealtimeEvent
+	err := h.db.Where("channel = ? AND id > ?", channel, afterID).
+		Order("id ASC").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+// Run 持续轮询新事件直到 ctx 结束
+func (h *RealtimeHub) Run(ctx context.Context) {
+	var cursor uint
+	if err := h.db.Model(&models.RealtimeEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&cursor).Error; err != nil {
+		log.Printf("Realtime hub failed to load cursor: %v", err)
+	}
+
+	// delivered 记录游标之后已推送的事件，gapSince 记录游标后缺口首次出现的时间
+	delivered := make(map[uint]bool)
+	var gapSince time.Time
+
+	ticker := time.NewTicker(realtimePollInterval)
+	defer ticker.Stop()
+	cleanup := time.NewTicker(time.Hour)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-cleanup.C:
+			if err := h.db.Where("created_at < ?", time.Now().Add(-realtimeRetention)).
+				Delete(&models.RealtimeEvent{}).Error; err != nil {
+				log.Printf("Realtime hub cleanup failed: %v", err)
+			}
+		case <-ticker.C:
+			var events []models.RealtimeEvent
+			if err := h.db.Where("id > ?", cursor).Order("id ASC").Limit(realtimeBatchSize).Find(&events).Error; err != nil {
+				log.Printf("Realtime hub poll failed: %v", err)
+				continue
+			}
+			for _, event := range events {
+				if delivered[event.ID] {
+					continue
+				}
+				delivered[event.ID] = true
+				h.dispatch(event)
+			}
+
+			// 游标只越过连续已推送的ID；并发事务可能乱序提交，缺口等待一段时间后再跳过
+			for {
+				if delivered[cursor+1] {
+					delete(delivered, cursor+1)
+					cursor++
+					gapSince = time.Time{}
+					continue
+				}
+				if len(delivered) == 0 {
+					break
+				}
+				if gapSince.IsZero() {
+					gapSince = time.Now()
+				}
+				if time.Since(gapSince) < realtimeGapTimeout {
+					break
+				}
+				cursor = minDelivered(delivered) - 1
+				gapSince = time.Time{}
+			}
+		}
+	}
+}
+
+// dispatch 推送给频道内的所有订阅者；缓冲区已满的订阅者会被断开，客户端重连后凭 Last-Event-ID 补齐
+func (h *RealtimeHub) dispatch(event models.RealtimeEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs := h.subs[event.Channel]
+	for sub := range subs {
+		select {
+		case sub.ch <- event:
+		default:
+			log.Printf("Realtime subscriber on %s is too slow, disconnecting at event %d", event.Channel, event.ID)
+			delete(subs, sub)
+			close(sub.ch)
+		}
+	}
+	if len(subs) == 0 {
+		delete(h.subs, event.Channel)
+	}
+}
+
+func minDelivered(delivered map[uint]bool) uint {
+	var min uint
+	for id := range delivered {
+		if min == 0 || id < min {
+			min = id
+		}
+	}
+	return min
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gongChang/models"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSampleNotFound        = errors.New("样衣记录不存在")
+	ErrSampleFactoryOnly     = errors.New("只有承接工厂可以提交样衣")
+	ErrSampleOrderClosed     = errors.New("订单已结束，不能再提交样衣")
+	ErrSamplePending         = errors.New("该类型的样衣还在等待审批，请等待审批结果后再提交新一轮")
+	ErrSampleAlreadyReviewed = errors.New("样衣已审批，不能重复审批")
+	ErrSampleCommentRequired = errors.New("驳回样衣时需要填写意见")
+	ErrPPSampleNotApproved   = errors.New("产前样批准后才能开始大货生产")
+)
+
+var sampleTypeLabels = map[models.SampleType]string{
+	models.SampleTypeProto:   "初样",
+	models.SampleTypeFit:     "试身样",
+	models.SampleTypeSizeSet: "齐码样",
+	models.SampleTypePP:      "产前样",
+}
+
+// SampleService 订单打样：工厂分轮提交样衣，设计师逐轮审批
+type SampleService struct {
+	db    *gorm.DB
+	actor models.Actor
+}
+
+func NewSampleService(db *gorm.DB) *SampleService {
+	return &SampleService{db: db}
+}
+
+// WithActor 返回绑定操作人的服务副本
+func (s *SampleService) WithActor(actor models.Actor) *SampleService {
+	c := *s
+	c.actor = actor
+	return &c
+}
+
+// auditSample 记录样衣变更的审计事件，归属于承接工厂
+func (s *SampleService) auditSample(tx *gorm.DB, action string, before, after *models.OrderSample) error {
+	return recordAudit(tx, s.actor, auditEntry{
+		EntityType: models.AuditEntitySample,
+		EntityID:   after.ID,
+		Action:     action,
+		OrderID:    &after.OrderID,
+		OwnerID:    after.FactoryID,
+		Before:     before,
+		After:      after,
+	})
+}
+
+// sampleEventPayload 样衣实时事件内容
+func sampleEventPayload(sample *models.OrderSample) map[string]interface{} {
+	return map[string]interface{}{
+		"sample_id":  sample.ID,
+		"order_id":   sample.OrderID,
+		"type":       sample.Type,
+		"round":      sample.Round,
+		"status":     sample.Status,
+		"factory_id": sample.FactoryID,
+	}
+}
+
+// checkSampleMeasurements 按当前发布的工艺单填写规定值、偏差和是否在公差内；没有发布的工艺单时原样返回
+func checkSampleMeasurements(tx *gorm.DB, orderID uint, measurements []models.SampleMeasurement) ([]models.SampleMeasurement, *int, error) {
+	checked := append([]models.SampleMeasurement{}, measurements...)
+	var pack models.TechPack
+	err := tx.Where("order_id = ? AND status = ?", orderID, models.TechPackStatusReleased).First(&pack).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return checked, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	specs := make(map[string]models.TechPackMeasurement, 2*len(pack.Measurements))
+	for _, m := range pack.Measurements {
+		if m.Code != "" {
+			specs[m.Code] = m
+		}
+		specs[m.Point] = m
+	}
+	for i := range checked {
+		m := &checked[i]
+		m.Spec, m.Deviation, m.WithinTolerance = nil, nil, nil
+		spec, ok := specs[strings.TrimSpace(m.Point)]
+		if !ok {
+			continue
+		}
+		value, ok := spec.Values[strings.TrimSpace(m.Size)]
+		if !ok {
+			continue
+		}
+		deviation := math.Round((m.Actual-value)*100) / 100
+		within := deviation <= spec.TolerancePlus && -deviation <= spec.ToleranceMinus
+		m.Spec, m.Deviation, m.WithinTolerance = &value, &deviation, &within
+	}
+	return checked, &pack.Version, nil
+}
+
+// ListSamples 订单的全部样衣记录，按提交先后排列
+func (s *SampleService) ListSamples(orderID uint) ([]models.OrderSample, error) {
+	if err := s.db.Select("id").First(&models.Order{}, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	samples := make([]models.OrderSample, 0)
+	err := s.db.Where("order_id = ?", orderID).Order("submitted_at, id").Find(&samples).Error
+	return samples, err
+}
+
+// SubmitSample 承接工厂提交新一轮样衣；同一类型上一轮还在审批中时不能再次提交
+func (s *SampleService) SubmitSample(orderID uint, req *models.SubmitSampleRequest) (*models.OrderSample, error) {
+	var sample *models.OrderSample
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.FactoryID == nil || *order.FactoryID == "" || *order.FactoryID != s.actor.UserID {
+			return ErrSampleFactoryOnly
+		}
+		if orderClosed(order.Status) {
+			return ErrSampleOrderClosed
+		}
+
+		var pending int64
+		if err := tx.Model(&models.OrderSample{}).
+			Where("order_id = ? AND type = ? AND status = ?", orderID, req.Type, models.SampleStatusSubmitted).
+			Count(&pending).Error; err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrSamplePending
+		}
+
+		measurements, techPackVersion, err := checkSampleMeasurements(tx, orderID, req.Measurements)
+		if err != nil {
+			return err
+		}
+		sample = &models.OrderSample{
+			OrderID:         orderID,
+			FactoryID:       s.actor.UserID,
+			Type:            req.Type,
+			Status:          models.SampleStatusSubmitted,
+			Description:     req.Description,
+			Photos:          datatypes.NewJSONSlice(append([]string{}, req.Photos...)),
+			Measurements:    datatypes.NewJSONSlice(measurements),
+			TechPackVersion: techPackVersion,
+			SubmittedAt:     time.Now(),
+		}
+		if err := tx.Model(&models.OrderSample{}).Where("order_id = ? AND type = ?", orderID, req.Type).
+			Select("COALESCE(MAX(round), 0) + 1").Scan(&sample.Round).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(sample).Error; err != nil {
+			return err
+		}
+		if err := s.auditSample(tx, models.AuditActionCreate, nil, sample); err != nil {
+			return err
+		}
+		if err := publishOrderEvent(tx, orderID, models.RealtimeSampleSubmitted, models.OrderAccessViewer, sampleEventPayload(sample)); err != nil {
+			return err
+		}
+		return notify(tx, s.actor, notificationEvent{
+			Category:   models.NotificationSampleSubmitted,
+			Title:      "工厂提交了样衣，请审批",
+			Content:    fmt.Sprintf("订单「%s」提交了第 %d 轮%s", order.Title, sample.Round, sampleTypeLabels[sample.Type]),
+			EntityType: models.AuditEntitySample,
+			EntityID:   sample.ID,
+			OrderID:    &order.ID,
+		}, order.DesignerID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sample, nil
+}
+
+// ReviewSample 设计师批准或驳回一轮样衣，批准产前样时已授标的订单进入生产
+func (s *SampleService) ReviewSample(orderID, sampleID uint, req *models.ReviewSampleRequest) (*models.OrderSample, error) {
+	comment := strings.TrimSpace(req.Comment)
+	if req.Status == models.SampleStatusRejected && comment == "" {
+		return nil, ErrSampleCommentRequired
+	}
+
+	var sample models.OrderSample
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("id = ? AND order_id = ?", sampleID, orderID).First(&sample).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrSampleNotFound
+			}
+			return err
+		}
+		if sample.Status != models.SampleStatusSubmitted {
+			return ErrSampleAlreadyReviewed
+		}
+
+		before := sample
+		now := time.Now()
+		if err := tx.Model(&sample).Updates(map[string]interface{}{
+			"status":         req.Status,
+			"reviewed_by":    s.actor.UserID,
+			"reviewed_at":    &now,
+			"review_comment": comment,
+		}).Error; err != nil {
+			return err
+		}
+
+		action, verdict := models.AuditActionAccept, "已批准"
+		if req.Status == models.SampleStatusRejected {
+			action, verdict = models.AuditActionReject, "已驳回"
+		}
+		if err := s.auditSample(tx, action, &before, &sample); err != nil {
+			return err
+		}
+		if err := publishOrderEvent(tx, orderID, models.RealtimeSampleReviewed, models.OrderAccessViewer, sampleEventPayload(&sample)); err != nil {
+			return err
+		}
+		// 产前样批准后，已授标的订单进入大货生产
+		if sample.Type == models.SampleTypePP && req.Status == models.SampleStatusApproved &&
+			order.Status == models.OrderStatusBiddingClosed && order.FactoryID != nil && *order.FactoryID != "" {
+			if err := transitionOrderStatus(tx, s.actor, order, StatusChange{
+				To:     models.OrderStatusInProduction,
+				Reason: fmt.Sprintf("第 %d 轮产前样已批准", sample.Round),
+			}); err != nil {
+				return err
+			}
+		}
+		content := fmt.Sprintf("订单「%s」第 %d 轮%s%s", order.Title, sample.Round, sampleTypeLabels[sample.Type], verdict)
+		if comment != "" {
+			content += "：" + comment
+		}
+		return notify(tx, s.actor, notificationEvent{
+			Category:   models.NotificationSampleReviewed,
+			Title:      "样衣" + verdict,
+			Content:    content,
+			EntityType: models.AuditEntitySample,
+			EntityID:   sample.ID,
+			OrderID:    &order.ID,
+		}, sample.FactoryID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &sample, nil
+}
+
+// requirePPSampleApproved 订单有批准的产前样才能开始大货生产
+func requirePPSampleApproved(tx *gorm.DB, orderID uint) error {
+	var approved int64
+	if err := tx.Model(&models.OrderSample{}).
+		Where("order_id = ? AND type = ? AND status = ?", orderID, models.SampleTypePP, models.SampleStatusApproved).
+		Count(&approved).Error; err != nil {
+		return err
+	}
+	if approved == 0 {
+		return ErrPPSampleNotApproved
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"errors"
+	"gongChang/models"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// seedApprovedPPSample 直接写入一轮已批准的产前样
+func seedApprovedPPSample(t *testing.T, db *gorm.DB, orderID uint) {
+	t.Helper()
+	sample := &models.OrderSample{
+		OrderID:   orderID,
+		FactoryID: testFactoryID,
+		Type:      models.SampleTypePP,
+		Round:     1,
+		Status:    models.SampleStatusApproved,
+	}
+	if err := db.Create(sample).Error; err != nil {
+		t.Fatalf("seed PP sample: %v", err)
+	}
+}
+
+func TestPPSampleApprovalStartsProduction(t *testing.T) {
+	db := newJiedanTestDB(t)
+	order := seedPublishedOrder(t, db)
+	jiedan := seedJiedan(t, db, order.ID, testFactoryID, 48)
+	if _, err := NewJiedanService(db).WithActor(testDesigner).AcceptJiedan(jiedan.ID, &models.AcceptJiedanRequest{}); err != nil {
+		t.Fatalf("AcceptJiedan: %v", err)
+	}
+	if status := reloadOrderStatus(t, db, order.ID); status != models.OrderStatusBiddingClosed {
+		t.Fatalf("order status after award = %s, want bidding_closed", status)
+	}
+
+	designer := NewOrderService(db).WithActor(testDesigner)
+	if _, err := designer.UpdateOrderStatus(order.ID, StatusChange{To: models.OrderStatusInProduction}); !errors.Is(err, ErrPPSampleNotApproved) {
+		t.Fatalf("in_production without PP sample = %v, want ErrPPSampleNotApproved", err)
+	}
+
+	factory := NewSampleService(db).WithActor(testFactory)
+	reviewer := NewSampleService(db).WithActor(testDesigner)
+	submit := func(sampleType models.SampleType) *models.OrderSample {
+		t.Helper()
+		sample, err := factory.SubmitSample(order.ID, &models.SubmitSampleRequest{Type: sampleType, Photos: []string{"/uploads/sample.jpg"}})
+		if err != nil {
+			t.Fatalf("SubmitSample %s: %v", sampleType, err)
+		}
+		return sample
+	}
+
+	// 批准其他类型的样衣或驳回产前样都不会开始生产
+	fit := submit(models.SampleTypeFit)
+	if _, err := reviewer.ReviewSample(order.ID, fit.ID, &models.ReviewSampleRequest{Status: models.SampleStatusApproved}); err != nil {
+		t.Fatalf("approve fit sample: %v", err)
+	}
+	pp := submit(models.SampleTypePP)
+	if _, err := reviewer.ReviewSample(order.ID, pp.ID, &models.ReviewSampleRequest{Status: models.SampleStatusRejected, Comment: "袖长偏短"}); err != nil {
+		t.Fatalf("reject PP sample: %v", err)
+	}
+	if status := reloadOrderStatus(t, db, order.ID); status != models.OrderStatusBiddingClosed {
+		t.Fatalf("order status after rejected PP sample = %s, want bidding_closed", status)
+	}
+
+	pp = submit(models.SampleTypePP)
+	if _, err := reviewer.ReviewSample(order.ID, pp.ID, &models.ReviewSampleRequest{Status: models.SampleStatusApproved}); err != nil {
+		t.Fatalf("approve PP sample: %v", err)
+	}
+	if status := reloadOrderStatus(t, db, order.ID); status != models.OrderStatusInProduction {
+		t.Fatalf("order status after approved PP sample = %s, want in_production", status)
+	}
+}
@@ -0,0 +1,541 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gongChang/models"
+	"gongChang/tracking"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrShipmentNotFound         = errors.New("发货批次不存在")
+	ErrShipmentFactoryOnly      = errors.New("只有承接工厂可以登记发货")
+	ErrShipmentOrderStatus      = errors.New("订单当前状态不能登记发货")
+	ErrShipmentDuplicate        = errors.New("该承运商的运单号已登记")
+	ErrShipmentLineUnknown      = errors.New("装箱单中的尺码和颜色不在订单明细中")
+	ErrShipmentItemDuplicate    = errors.New("装箱单中有重复的尺码和颜色")
+	ErrShipmentQuantityExceeded = errors.New("累计发货数量超过订单数量")
+	ErrShipmentWeightInvalid    = errors.New("净重不能大于毛重")
+	ErrShipmentETAInvalid       = errors.New("预计到达时间不能早于发货时间")
+	ErrShipmentConfirmForbidden = errors.New("只有订单设计师或客户可以确认收货")
+	ErrShipmentAlreadyConfirmed = errors.New("该批次已确认收货")
+)
+
+// trackingStatuses 轨迹节点状态对应的发货批次状态
+var trackingStatuses = map[tracking.Status]models.ShipmentStatus{
+	tracking.StatusInfoReceived:   models.ShipmentStatusShipped,
+	tracking.StatusInTransit:      models.ShipmentStatusInTransit,
+	tracking.StatusOutForDelivery: models.ShipmentStatusOutForDelivery,
+	tracking.StatusDelivered:      models.ShipmentStatusDelivered,
+	tracking.StatusException:      models.ShipmentStatusException,
+}
+
+// ShipmentService 订单发货批次、物流轨迹和收货确认
+type ShipmentService struct {
+	db      *gorm.DB
+	actor   models.Actor
+	tracker tracking.Provider
+}
+
+func NewShipmentService(db *gorm.DB, tracker tracking.Provider) *ShipmentService {
+	return &ShipmentService{db: db, tracker: tracker}
+}
+
+// WithActor 返回绑定操作人的服务副本
+func (s *ShipmentService) WithActor(actor models.Actor) *ShipmentService {
+	c := *s
+	c.actor = actor
+	return &c
+}
+
+// auditShipment 记录发货批次变更的审计事件，归属于承接工厂
+func auditShipment(tx *gorm.DB, actor models.Actor, action string, before, after *models.Shipment) error {
+	return recordAudit(tx, actor, auditEntry{
+		EntityType: models.AuditEntityShipment,
+		EntityID:   after.ID,
+		Action:     action,
+		OrderID:    &after.OrderID,
+		OwnerID:    after.FactoryID,
+		Before:     before,
+		After:      after,
+	})
+}
+
+// shipmentEventPayload 发货批次实时事件内容
+func shipmentEventPayload(shipment *models.Shipment) map[string]interface{} {
+	return map[string]interface{}{
+		"shipment_id":     shipment.ID,
+		"order_id":        shipment.OrderID,
+		"carrier":         shipment.Carrier,
+		"tracking_number": shipment.TrackingNumber,
+		"status":          shipment.Status,
+		"quantity":        shipment.Quantity,
+		"eta":             shipment.ETA,
+	}
+}
+
+// shippedQuantities 订单已登记发货的件数：按明细行汇总，以及全部合计
+func shippedQuantities(tx *gorm.DB, orderID uint) (map[uint]int, int, error) {
+	var rows []struct {
+		OrderLineID *uint
+		Quantity    int
+	}
+	if err := tx.Model(&models.ShipmentItem{}).
+		Joins("JOIN shipments ON shipments.id = shipment_items.shipment_id").
+		Where("shipments.order_id = ?", orderID).
+		Select("shipment_items.order_line_id AS order_line_id, SUM(shipment_items.quantity) AS quantity").
+		Group("shipment_items.order_line_id").
+		Scan(&rows).Error; err != nil {
+		return nil, 0, err
+	}
+	byLine := make(map[uint]int, len(rows))
+	total := 0
+	for _, row := range rows {
+		if row.OrderLineID != nil {
+			byLine[*row.OrderLineID] = row.Quantity
+		}
+		total += row.Quantity
+	}
+	return byLine, total, nil
+}
+
+// buildShipmentItems 校验装箱单：订单有尺码 × 颜色明细时每行必须对应明细行，且各行和全部累计发货数量都不能超过订购数量
+func buildShipmentItems(tx *gorm.DB, order *models.Order, reqs []models.ShipmentItemRequest) ([]models.ShipmentItem, int, error) {
+	lines, err := loadOrderLines(tx, order.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+	shippedByLine, shippedTotal, err := shippedQuantities(tx, order.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+	lineByKey := make(map[string]*models.OrderLine, len(lines))
+	for i := range lines {
+		lineByKey[lines[i].Size+"\x00"+lines[i].Color] = &lines[i]
+	}
+
+	items := make([]models.ShipmentItem, 0, len(reqs))
+	seen := make(map[string]bool, len(reqs))
+	quantity := 0
+	for _, req := range reqs {
+		size, color := strings.TrimSpace(req.Size), strings.TrimSpace(req.Color)
+		key := size + "\x00" + color
+		if seen[key] {
+			return nil, 0, ErrShipmentItemDuplicate
+		}
+		seen[key] = true
+		item := models.ShipmentItem{Size: size, Color: color, Quantity: req.Quantity, Cartons: req.Cartons}
+		if len(lines) > 0 {
+			line, ok := lineByKey[key]
+			if !ok {
+				return nil, 0, ErrShipmentLineUnknown
+			}
+			if shippedByLine[line.ID]+req.Quantity > line.Quantity {
+				return nil, 0, fmt.Errorf("%w：%s / %s 订购 %d 件，已发 %d 件", ErrShipmentQuantityExceeded,
+					line.Size, line.Color, line.Quantity, shippedByLine[line.ID])
+			}
+			item.OrderLineID = &line.ID
+		}
+		items = append(items, item)
+		quantity += req.Quantity
+	}
+	if order.Quantity > 0 && shippedTotal+quantity > order.Quantity {
+		return nil, 0, fmt.Errorf("%w：订购 %d 件，已发 %d 件", ErrShipmentQuantityExceeded, order.Quantity, shippedTotal)
+	}
+	return items, quantity, nil
+}
+
+// ListShipments 订单的发货批次及发货进度，批次按发货时间排列
+func (s *ShipmentService) ListShipments(orderID uint) (*models.OrderShipments, error) {
+	var order models.Order
+	if err := s.db.Select("id", "quantity").First(&order, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	result := &models.OrderShipments{OrderQuantity: order.Quantity, Shipments: make([]models.Shipment, 0)}
+	if err := s.db.Preload("Items").Where("order_id = ?", orderID).
+		Order("ship_date, id").Find(&result.Shipments).Error; err != nil {
+		return nil, err
+	}
+	for _, shipment := range result.Shipments {
+		result.ShippedQuantity += shipment.Quantity
+		if shipment.ConfirmedAt != nil {
+			result.DeliveredQuantity += shipment.Quantity
+		}
+	}
+	return result, nil
+}
+
+// GetShipment 发货批次详情，包括装箱单和物流轨迹
+func (s *ShipmentService) GetShipment(orderID, shipmentID uint) (*models.Shipment, error) {
+	var shipment models.Shipment
+	if err := s.db.Preload("Items").
+		Preload("Events", func(db *gorm.DB) *gorm.DB { return db.Order("time, id") }).
+		Where("id = ? AND order_id = ?", shipmentID, orderID).
+		First(&shipment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrShipmentNotFound
+		}
+		return nil, err
+	}
+	return &shipment, nil
+}
+
+// CreateShipment 承接工厂登记一个发货批次；最近一次质量检验不合格时不能发货，首批发货后订单变为已发货
+func (s *ShipmentService) CreateShipment(orderID uint, req *models.CreateShipmentRequest) (*models.Shipment, error) {
+	if req.GrossWeight > 0 && req.NetWeight > req.GrossWeight {
+		return nil, ErrShipmentWeightInvalid
+	}
+	shipDate := time.Now()
+	if req.ShipDate != nil {
+		shipDate = *req.ShipDate
+	}
+	if req.ETA != nil && req.ETA.Before(shipDate) {
+		return nil, ErrShipmentETAInvalid
+	}
+
+	var shipment *models.Shipment
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.FactoryID == nil || *order.FactoryID == "" || *order.FactoryID != s.actor.UserID {
+			return ErrShipmentFactoryOnly
+		}
+		if order.Status != models.OrderStatusInProduction && order.Status != models.OrderStatusShipped {
+			return ErrShipmentOrderStatus
+		}
+		if err := requireQCPassed(tx, orderID); err != nil {
+			return err
+		}
+
+		carrier, number := strings.TrimSpace(req.Carrier), strings.TrimSpace(req.TrackingNumber)
+		var existing int64
+		if err := tx.Model(&models.Shipment{}).
+			Where("carrier = ? AND tracking_number = ?", carrier, number).
+			Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrShipmentDuplicate
+		}
+
+		items, quantity, err := buildShipmentItems(tx, order, req.Items)
+		if err != nil {
+			return err
+		}
+		shipTo := strings.TrimSpace(req.ShipTo)
+		if shipTo == "" {
+			shipTo = order.ShippingAddress
+		}
+		shipment = &models.Shipment{
+			OrderID:        orderID,
+			FactoryID:      *order.FactoryID,
+			Carrier:        carrier,
+			TrackingNumber: number,
+			Cartons:        req.Cartons,
+			GrossWeight:    req.GrossWeight,
+			NetWeight:      req.NetWeight,
+			Quantity:       quantity,
+			ShipTo:         shipTo,
+			ShipDate:       shipDate,
+			ETA:            req.ETA,
+			Status:         models.ShipmentStatusShipped,
+			Note:           req.Note,
+			CreatedBy:      s.actor.UserID,
+			Items:          items,
+		}
+		if err := tx.Create(shipment).Error; err != nil {
+			return err
+		}
+		if err := auditShipment(tx, s.actor, models.AuditActionCreate, nil, shipment); err != nil {
+			return err
+		}
+		if order.Status == models.OrderStatusInProduction {
+			if err := transitionOrderStatus(tx, s.actor, order, StatusChange{
+				To:     models.OrderStatusShipped,
+				Reason: fmt.Sprintf("登记发货 %s %s", carrier, number),
+			}); err != nil {
+				return err
+			}
+		}
+		if err := publishOrderEvent(tx, orderID, models.RealtimeShipmentCreated, models.OrderAccessViewer, shipmentEventPayload(shipment)); err != nil {
+			return err
+		}
+		return notify(tx, s.actor, notificationEvent{
+			Category:   models.NotificationShipmentUpdate,
+			Title:      "订单已发货",
+			Content:    fmt.Sprintf("订单「%s」发出 %d 件（%d 箱），%s 运单号 %s", order.Title, quantity, req.Cartons, carrier, number),
+			EntityType: models.AuditEntityShipment,
+			EntityID:   shipment.ID,
+			OrderID:    &order.ID,
+		}, order.DesignerID, order.CustomerID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return shipment, nil
+}
+
+// RefreshTracking 立即查询一个发货批次的物流轨迹
+func (s *ShipmentService) RefreshTracking(ctx context.Context, orderID, shipmentID uint) (*models.Shipment, error) {
+	var shipment models.Shipment
+	if err := s.db.Where("id = ? AND order_id = ?", shipmentID, orderID).First(&shipment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrShipmentNotFound
+		}
+		return nil, err
+	}
+	if err := s.syncTracking(ctx, s.actor, &shipment); err != nil {
+		return nil, err
+	}
+	return s.GetShipment(orderID, shipmentID)
+}
+
+// syncTracking 查询承运商轨迹，保存新出现的轨迹并按最新节点更新批次状态；查询失败时记录原因
+func (s *ShipmentService) syncTracking(ctx context.Context, actor models.Actor, shipment *models.Shipment) error {
+	events, trackErr := s.tracker.Track(ctx, shipment.Carrier, shipment.TrackingNumber)
+	now := time.Now()
+	if trackErr != nil {
+		if err := s.db.Model(shipment).Updates(map[string]interface{}{
+			"last_tracked_at": &now,
+			"tracking_error":  trackErr.Error(),
+		}).Error; err != nil {
+			return err
+		}
+		return trackErr
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(shipment, shipment.ID).Error; err != nil {
+			return err
+		}
+		var known []models.ShipmentEvent
+		if err := tx.Where("shipment_id = ?", shipment.ID).Find(&known).Error; err != nil {
+			return err
+		}
+		seen := make(map[string]bool, len(known))
+		eventKey := func(t time.Time, status, description string) string {
+			return fmt.Sprintf("%d|%s|%s", t.Unix(), status, description)
+		}
+		for _, e := range known {
+			seen[eventKey(e.Time, e.Status, e.Description)] = true
+		}
+
+		fresh := make([]models.ShipmentEvent, 0)
+		for _, e := range events {
+			if seen[eventKey(e.Time, string(e.Status), e.Description)] {
+				continue
+			}
+			fresh = append(fresh, models.ShipmentEvent{
+				ShipmentID:  shipment.ID,
+				OrderID:     shipment.OrderID,
+				Time:        e.Time,
+				Status:      string(e.Status),
+				Location:    e.Location,
+				Description: e.Description,
+			})
+		}
+		if len(fresh) > 0 {
+			if err := tx.Create(&fresh).Error; err != nil {
+				return err
+			}
+		}
+
+		before := *shipment
+		updates := map[string]interface{}{"last_tracked_at": &now, "tracking_error": ""}
+		var latest *tracking.Event
+		for i := range events {
+			if latest == nil || !events[i].Time.Before(latest.Time) {
+				latest = &events[i]
+			}
+		}
+		if latest != nil {
+			if status, ok := trackingStatuses[latest.Status]; ok && status != shipment.Status {
+				updates["status"] = status
+				if status == models.ShipmentStatusDelivered && shipment.DeliveredAt == nil {
+					deliveredAt := latest.Time
+					updates["delivered_at"] = &deliveredAt
+				}
+			}
+		}
+		if err := tx.Model(shipment).Updates(updates).Error; err != nil {
+			return err
+		}
+		if len(fresh) == 0 {
+			return nil
+		}
+		for i := range fresh {
+			if err := publishOrderEvent(tx, shipment.OrderID, models.RealtimeShipmentTracking, models.OrderAccessViewer, fresh[i]); err != nil {
+				return err
+			}
+		}
+		if before.Status == shipment.Status {
+			return nil
+		}
+		if err := auditShipment(tx, actor, models.AuditActionStatusChange, &before, shipment); err != nil {
+			return err
+		}
+		return s.notifyTrackingStatus(tx, actor, shipment)
+	})
+}
+
+// notifyTrackingStatus 承运商签收时提醒收货方确认收货，运输异常时提醒设计师和工厂
+func (s *ShipmentService) notifyTrackingStatus(tx *gorm.DB, actor models.Actor, shipment *models.Shipment) error {
+	if shipment.Status != models.ShipmentStatusDelivered && shipment.Status != models.ShipmentStatusException {
+		return nil
+	}
+	var order models.Order
+	if err := tx.Select("id", "title", "designer_id", "customer_id").First(&order, shipment.OrderID).Error; err != nil {
+		return err
+	}
+	event := notificationEvent{
+		Category:   models.NotificationShipmentUpdate,
+		EntityType: models.AuditEntityShipment,
+		EntityID:   shipment.ID,
+		OrderID:    &order.ID,
+	}
+	if shipment.Status == models.ShipmentStatusDelivered {
+		event.Title = "货物已签收，请确认收货"
+		event.Content = fmt.Sprintf("订单「%s」%s 运单 %s 已签收", order.Title, shipment.Carrier, shipment.TrackingNumber)
+		return notify(tx, actor, event, order.DesignerID, order.CustomerID)
+	}
+	event.Title = "物流异常"
+	event.Content = fmt.Sprintf("订单「%s」%s 运单 %s 运输异常，请联系承运商", order.Title, shipment.Carrier, shipment.TrackingNumber)
+	return notify(tx, actor, event, order.DesignerID, shipment.FactoryID)
+}
+
+// PollTracking 查询全部未确认收货批次的物流轨迹，返回有查询失败时的第一个错误
+func (s *ShipmentService) PollTracking(ctx context.Context) (int, error) {
+	var shipments []models.Shipment
+	if err := s.db.Where("confirmed_at IS NULL AND status <> ?", models.ShipmentStatusDelivered).
+		Order("id").Find(&shipments).Error; err != nil {
+		return 0, err
+	}
+	var firstErr error
+	polled := 0
+	for i := range shipments {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := s.syncTracking(ctx, models.SystemActor, &shipments[i]); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("shipment %d: %w", shipments[i].ID, err)
+			}
+			continue
+		}
+		polled++
+	}
+	return polled, firstErr
+}
+
+// RunTrackingPoller 定期轮询物流轨迹直到 ctx 结束
+func (s *ShipmentService) RunTrackingPoller(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			count, err := s.PollTracking(ctx)
+			if err != nil {
+				log.Printf("Shipment tracking poll failed: %v", err)
+			}
+			if count > 0 {
+				log.Printf("Shipment tracking polled %d shipments", count)
+			}
+		}
+	}
+}
+
+// ConfirmDelivery 订单设计师或客户确认收到一个批次；全部批次确认且发货数量达到订单数量时订单变为已送达
+func (s *ShipmentService) ConfirmDelivery(orderID, shipmentID uint, req *models.ConfirmDeliveryRequest) (*models.Shipment, error) {
+	var shipment models.Shipment
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if s.actor.UserID == "" || (s.actor.UserID != order.DesignerID && s.actor.UserID != order.CustomerID) {
+			return ErrShipmentConfirmForbidden
+		}
+		if err := tx.Where("id = ? AND order_id = ?", shipmentID, orderID).First(&shipment).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrShipmentNotFound
+			}
+			return err
+		}
+		if shipment.ConfirmedAt != nil {
+			return ErrShipmentAlreadyConfirmed
+		}
+
+		before := shipment
+		now := time.Now()
+		updates := map[string]interface{}{
+			"status":       models.ShipmentStatusDelivered,
+			"confirmed_at": &now,
+			"confirmed_by": s.actor.UserID,
+		}
+		if shipment.DeliveredAt == nil {
+			updates["delivered_at"] = &now
+		}
+		if note := strings.TrimSpace(req.Note); note != "" {
+			updates["note"] = note
+		}
+		if err := tx.Model(&shipment).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := auditShipment(tx, s.actor, models.AuditActionAccept, &before, &shipment); err != nil {
+			return err
+		}
+		if err := publishOrderEvent(tx, orderID, models.RealtimeShipmentDelivered, models.OrderAccessViewer, shipmentEventPayload(&shipment)); err != nil {
+			return err
+		}
+		if err := notify(tx, s.actor, notificationEvent{
+			Category:   models.NotificationShipmentUpdate,
+			Title:      "收货方已确认收货",
+			Content:    fmt.Sprintf("订单「%s」%s 运单 %s 的 %d 件已确认收货", order.Title, shipment.Carrier, shipment.TrackingNumber, shipment.Quantity),
+			EntityType: models.AuditEntityShipment,
+			EntityID:   shipment.ID,
+			OrderID:    &order.ID,
+		}, shipment.FactoryID); err != nil {
+			return err
+		}
+
+		if order.Status != models.OrderStatusShipped {
+			return nil
+		}
+		var pending int64
+		if err := tx.Model(&models.Shipment{}).
+			Where("order_id = ? AND confirmed_at IS NULL", orderID).
+			Count(&pending).Error; err != nil {
+			return err
+		}
+		_, shipped, err := shippedQuantities(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if pending > 0 || shipped < order.Quantity {
+			return nil
+		}
+		return transitionOrderStatus(tx, s.actor, order, StatusChange{
+			To:     models.OrderStatusDelivered,
+			Reason: "全部发货批次已确认收货",
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &shipment, nil
+}
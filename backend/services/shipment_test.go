@@ -0,0 +1,351 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"gongChang/models"
+	"gongChang/tracking"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	testDesignerID = "designer-1"
+	testCustomerID = "customer-1"
+	testFactoryID  = "factory-1"
+)
+
+var (
+	testDesigner = models.Actor{UserID: testDesignerID, Role: models.RoleDesigner}
+	testCustomer = models.Actor{UserID: testCustomerID, Role: models.RoleDesigner}
+	testFactory  = models.Actor{UserID: testFactoryID, Role: models.RoleFactory}
+)
+
+// newShipmentTestDB 只迁移发货流程和订单时间线用到的表
+func newShipmentTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return openTestDB(t,
+		&models.User{},
+		&models.FactoryProfile{},
+		&models.Order{},
+		&models.OrderLine{},
+		&models.OrderStatusHistory{},
+		&models.OrderProgress{},
+		&models.OrderSample{},
+		&models.TechPack{},
+		&models.QCInspection{},
+		&models.QCDefect{},
+		&models.Shipment{},
+		&models.ShipmentItem{},
+		&models.ShipmentEvent{},
+		&models.AuditEvent{},
+		&models.Notification{},
+		&models.NotificationPreference{},
+		&models.RealtimeEvent{},
+	)
+}
+
+// seedShipmentOrder 创建生产中的订单：S/红 60 件、M/红 40 件
+func seedShipmentOrder(t *testing.T, db *gorm.DB) *models.Order {
+	t.Helper()
+	factoryID := testFactoryID
+	order := &models.Order{
+		Title:           "衬衫",
+		Quantity:        100,
+		FactoryID:       &factoryID,
+		Status:          models.OrderStatusInProduction,
+		DesignerID:      testDesignerID,
+		CustomerID:      testCustomerID,
+		UnitPrice:       50,
+		TotalPrice:      5000,
+		ShippingAddress: "上海市静安区",
+		Lines: []models.OrderLine{
+			{Size: "S", Color: "红", Quantity: 60},
+			{Size: "M", Color: "红", Quantity: 40, SortOrder: 1},
+		},
+	}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatalf("seed order: %v", err)
+	}
+	return order
+}
+
+func reloadOrderStatus(t *testing.T, db *gorm.DB, orderID uint) models.OrderStatus {
+	t.Helper()
+	var order models.Order
+	if err := db.Select("id", "status").First(&order, orderID).Error; err != nil {
+		t.Fatalf("reload order: %v", err)
+	}
+	return order.Status
+}
+
+func shipmentRequest(number string, items ...models.ShipmentItemRequest) *models.CreateShipmentRequest {
+	return &models.CreateShipmentRequest{
+		Carrier:        "SF",
+		TrackingNumber: number,
+		Cartons:        len(items),
+		GrossWeight:    12.5,
+		NetWeight:      11,
+		Items:          items,
+	}
+}
+
+func TestCreateShipmentPartialMovesOrderToShipped(t *testing.T) {
+	db := newShipmentTestDB(t)
+	order := seedShipmentOrder(t, db)
+	svc := NewShipmentService(db, tracking.NewFakeProvider())
+
+	if _, err := svc.WithActor(testDesigner).CreateShipment(order.ID, shipmentRequest("SF001",
+		models.ShipmentItemRequest{Size: "S", Color: "红", Quantity: 30})); !errors.Is(err, ErrShipmentFactoryOnly) {
+		t.Fatalf("designer CreateShipment = %v, want ErrShipmentFactoryOnly", err)
+	}
+
+	shipment, err := svc.WithActor(testFactory).CreateShipment(order.ID, shipmentRequest("SF001",
+		models.ShipmentItemRequest{Size: "S", Color: "红", Quantity: 30, Cartons: 1}))
+	if err != nil {
+		t.Fatalf("CreateShipment: %v", err)
+	}
+	if shipment.Quantity != 30 || shipment.ShipTo != order.ShippingAddress || shipment.Status != models.ShipmentStatusShipped {
+		t.Fatalf("shipment = %+v", shipment)
+	}
+	if len(shipment.Items) != 1 || shipment.Items[0].OrderLineID == nil || *shipment.Items[0].OrderLineID != order.Lines[0].ID {
+		t.Fatalf("shipment items = %+v", shipment.Items)
+	}
+	if status := reloadOrderStatus(t, db, order.ID); status != models.OrderStatusShipped {
+		t.Fatalf("order status = %s, want shipped", status)
+	}
+
+	var history []models.OrderStatusHistory
+	if err := db.Where("order_id = ?", order.ID).Find(&history).Error; err != nil {
+		t.Fatalf("load history: %v", err)
+	}
+	if len(history) != 1 || history[0].ToStatus != models.OrderStatusShipped || history[0].OperatorID != testFactoryID {
+		t.Fatalf("status history = %+v", history)
+	}
+
+	// 订单已发货后仍可继续分批发货
+	if _, err := svc.WithActor(testFactory).CreateShipment(order.ID, shipmentRequest("SF002",
+		models.ShipmentItemRequest{Size: "S", Color: "红", Quantity: 20},
+		models.ShipmentItemRequest{Size: "M", Color: "红", Quantity: 40})); err != nil {
+		t.Fatalf("second CreateShipment: %v", err)
+	}
+
+	result, err := svc.ListShipments(order.ID)
+	if err != nil {
+		t.Fatalf("ListShipments: %v", err)
+	}
+	if len(result.Shipments) != 2 || result.ShippedQuantity != 90 || result.OrderQuantity != 100 || result.DeliveredQuantity != 0 {
+		t.Fatalf("ListShipments = %d shipments, shipped %d of %d, delivered %d",
+			len(result.Shipments), result.ShippedQuantity, result.OrderQuantity, result.DeliveredQuantity)
+	}
+}
+
+func TestCreateShipmentValidatesPackingList(t *testing.T) {
+	db := newShipmentTestDB(t)
+	order := seedShipmentOrder(t, db)
+	factory := NewShipmentService(db, tracking.NewFakeProvider()).WithActor(testFactory)
+
+	if _, err := factory.CreateShipment(order.ID, shipmentRequest("SF010",
+		models.ShipmentItemRequest{Size: "S", Color: "红", Quantity: 50})); err != nil {
+		t.Fatalf("CreateShipment: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		req  *models.CreateShipmentRequest
+		want error
+	}{
+		{"line quantity exceeded", shipmentRequest("SF011", models.ShipmentItemRequest{Size: "S", Color: "红", Quantity: 11}), ErrShipmentQuantityExceeded},
+		{"unknown line", shipmentRequest("SF012", models.ShipmentItemRequest{Size: "L", Color: "红", Quantity: 1}), ErrShipmentLineUnknown},
+		{"duplicate item", shipmentRequest("SF013",
+			models.ShipmentItemRequest{Size: "M", Color: "红", Quantity: 1},
+			models.ShipmentItemRequest{Size: "M", Color: "红", Quantity: 1}), ErrShipmentItemDuplicate},
+		{"duplicate tracking number", shipmentRequest("SF010", models.ShipmentItemRequest{Size: "M", Color: "红", Quantity: 1}), ErrShipmentDuplicate},
+	}
+	for _, tc := range cases {
+		if _, err := factory.CreateShipment(order.ID, tc.req); !errors.Is(err, tc.want) {
+			t.Errorf("%s: CreateShipment = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	var count int64
+	db.Model(&models.Shipment{}).Where("order_id = ?", order.ID).Count(&count)
+	if count != 1 {
+		t.Fatalf("shipments stored = %d, want 1", count)
+	}
+}
+
+func TestPollTrackingStoresEventsOnce(t *testing.T) {
+	db := newShipmentTestDB(t)
+	order := seedShipmentOrder(t, db)
+	provider := tracking.NewFakeProvider()
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	provider.Now = func() time.Time { return now }
+	svc := NewShipmentService(db, provider)
+
+	shipment, err := svc.WithActor(testFactory).CreateShipment(order.ID, shipmentRequest("SF100",
+		models.ShipmentItemRequest{Size: "S", Color: "红", Quantity: 60}))
+	if err != nil {
+		t.Fatalf("CreateShipment: %v", err)
+	}
+
+	countEvents := func() int64 {
+		var count int64
+		if err := db.Model(&models.ShipmentEvent{}).Where("shipment_id = ?", shipment.ID).Count(&count).Error; err != nil {
+			t.Fatalf("count events: %v", err)
+		}
+		return count
+	}
+
+	// 首次查询只有揽收信息，重复轮询不会重复保存
+	for i := 0; i < 2; i++ {
+		if polled, err := svc.PollTracking(context.Background()); err != nil || polled != 1 {
+			t.Fatalf("PollTracking = %d, %v", polled, err)
+		}
+	}
+	if got := countEvents(); got != 1 {
+		t.Fatalf("events after repeated polls = %d, want 1", got)
+	}
+
+	// 一天后新增两条在途轨迹
+	now = now.Add(25 * time.Hour)
+	if _, err := svc.PollTracking(context.Background()); err != nil {
+		t.Fatalf("PollTracking: %v", err)
+	}
+	if _, err := svc.PollTracking(context.Background()); err != nil {
+		t.Fatalf("PollTracking: %v", err)
+	}
+	if got := countEvents(); got != 3 {
+		t.Fatalf("events after transit = %d, want 3", got)
+	}
+	current, err := svc.GetShipment(order.ID, shipment.ID)
+	if err != nil {
+		t.Fatalf("GetShipment: %v", err)
+	}
+	if current.Status != models.ShipmentStatusInTransit || current.LastTrackedAt == nil || len(current.Events) != 3 {
+		t.Fatalf("shipment after transit: status %s, events %d", current.Status, len(current.Events))
+	}
+
+	// 签收后批次标记为已签收，通知收货方确认
+	now = now.Add(48 * time.Hour)
+	current, err = svc.WithActor(testDesigner).RefreshTracking(context.Background(), order.ID, shipment.ID)
+	if err != nil {
+		t.Fatalf("RefreshTracking: %v", err)
+	}
+	if current.Status != models.ShipmentStatusDelivered || current.DeliveredAt == nil || len(current.Events) != 5 {
+		t.Fatalf("shipment after delivery: status %s, delivered %v, events %d", current.Status, current.DeliveredAt, len(current.Events))
+	}
+	var notified int64
+	db.Model(&models.Notification{}).Where("user_id = ? AND title = ?", testCustomerID, "货物已签收，请确认收货").Count(&notified)
+	if notified != 1 {
+		t.Fatalf("delivery notifications to customer = %d, want 1", notified)
+	}
+
+	// 已签收的批次不再轮询
+	if polled, err := svc.PollTracking(context.Background()); err != nil || polled != 0 {
+		t.Fatalf("PollTracking after delivery = %d, %v", polled, err)
+	}
+	if got := countEvents(); got != 5 {
+		t.Fatalf("events after delivery = %d, want 5", got)
+	}
+
+	// 轨迹出现在订单时间线上
+	timeline, err := NewOrderService(db).GetOrderTimeline(order.ID)
+	if err != nil {
+		t.Fatalf("GetOrderTimeline: %v", err)
+	}
+	trackingEntries := 0
+	for _, entry := range timeline {
+		if entry.Kind == models.TimelineTrackingEvent {
+			trackingEntries++
+		}
+	}
+	if trackingEntries != 5 {
+		t.Fatalf("timeline tracking entries = %d, want 5", trackingEntries)
+	}
+}
+
+func TestPollTrackingRecordsCarrierErrors(t *testing.T) {
+	db := newShipmentTestDB(t)
+	order := seedShipmentOrder(t, db)
+	svc := NewShipmentService(db, tracking.NewFakeProvider())
+
+	shipment, err := svc.WithActor(testFactory).CreateShipment(order.ID, shipmentRequest("NOTFOUND-1",
+		models.ShipmentItemRequest{Size: "S", Color: "红", Quantity: 10}))
+	if err != nil {
+		t.Fatalf("CreateShipment: %v", err)
+	}
+	if _, err := svc.PollTracking(context.Background()); !errors.Is(err, tracking.ErrNotFound) {
+		t.Fatalf("PollTracking = %v, want ErrNotFound", err)
+	}
+	current, err := svc.GetShipment(order.ID, shipment.ID)
+	if err != nil {
+		t.Fatalf("GetShipment: %v", err)
+	}
+	if current.TrackingError == "" || current.LastTrackedAt == nil || current.Status != models.ShipmentStatusShipped {
+		t.Fatalf("shipment after failed poll = %+v", current)
+	}
+}
+
+func TestConfirmLastShipmentMovesOrderToDelivered(t *testing.T) {
+	db := newShipmentTestDB(t)
+	order := seedShipmentOrder(t, db)
+	svc := NewShipmentService(db, tracking.NewFakeProvider())
+	factory := svc.WithActor(testFactory)
+
+	first, err := factory.CreateShipment(order.ID, shipmentRequest("SF200",
+		models.ShipmentItemRequest{Size: "S", Color: "红", Quantity: 60}))
+	if err != nil {
+		t.Fatalf("CreateShipment: %v", err)
+	}
+	second, err := factory.CreateShipment(order.ID, shipmentRequest("SF201",
+		models.ShipmentItemRequest{Size: "M", Color: "红", Quantity: 30}))
+	if err != nil {
+		t.Fatalf("CreateShipment: %v", err)
+	}
+
+	if _, err := factory.ConfirmDelivery(order.ID, first.ID, &models.ConfirmDeliveryRequest{}); !errors.Is(err, ErrShipmentConfirmForbidden) {
+		t.Fatalf("factory ConfirmDelivery = %v, want ErrShipmentConfirmForbidden", err)
+	}
+
+	confirmed, err := svc.WithActor(testCustomer).ConfirmDelivery(order.ID, first.ID, &models.ConfirmDeliveryRequest{Note: "外箱完好"})
+	if err != nil {
+		t.Fatalf("ConfirmDelivery: %v", err)
+	}
+	if confirmed.ConfirmedAt == nil || confirmed.ConfirmedBy != testCustomerID || confirmed.Status != models.ShipmentStatusDelivered {
+		t.Fatalf("confirmed shipment = %+v", confirmed)
+	}
+	if _, err := svc.WithActor(testDesigner).ConfirmDelivery(order.ID, first.ID, &models.ConfirmDeliveryRequest{}); !errors.Is(err, ErrShipmentAlreadyConfirmed) {
+		t.Fatalf("repeat ConfirmDelivery = %v, want ErrShipmentAlreadyConfirmed", err)
+	}
+
+	// 全部批次确认但发货数量不足订单数量时，订单仍为已发货
+	if _, err := svc.WithActor(testDesigner).ConfirmDelivery(order.ID, second.ID, &models.ConfirmDeliveryRequest{}); err != nil {
+		t.Fatalf("ConfirmDelivery: %v", err)
+	}
+	if status := reloadOrderStatus(t, db, order.ID); status != models.OrderStatusShipped {
+		t.Fatalf("order status after partial delivery = %s, want shipped", status)
+	}
+
+	last, err := factory.CreateShipment(order.ID, shipmentRequest("SF202",
+		models.ShipmentItemRequest{Size: "M", Color: "红", Quantity: 10}))
+	if err != nil {
+		t.Fatalf("CreateShipment: %v", err)
+	}
+	if _, err := svc.WithActor(testDesigner).ConfirmDelivery(order.ID, last.ID, &models.ConfirmDeliveryRequest{}); err != nil {
+		t.Fatalf("ConfirmDelivery last: %v", err)
+	}
+	if status := reloadOrderStatus(t, db, order.ID); status != models.OrderStatusDelivered {
+		t.Fatalf("order status after last delivery = %s, want delivered", status)
+	}
+
+	result, err := svc.ListShipments(order.ID)
+	if err != nil {
+		t.Fatalf("ListShipments: %v", err)
+	}
+	if result.ShippedQuantity != 100 || result.DeliveredQuantity != 100 {
+		t.Fatalf("ListShipments shipped %d delivered %d, want 100/100", result.ShippedQuantity, result.DeliveredQuantity)
+	}
+}
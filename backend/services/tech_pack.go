@@ -0,0 +1,376 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gongChang/models"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTechPackNotFound        = errors.New("工艺单不存在")
+	ErrTechPackDraftExists     = errors.New("订单已有未发布的工艺单草稿")
+	ErrTechPackNotDraft        = errors.New("只能修改草稿状态的工艺单")
+	ErrTechPackDuplicateSize   = errors.New("尺码列表中有重复的尺码")
+	ErrTechPackSizeUnknown     = errors.New("尺寸表中的尺码不在尺码列表中")
+	ErrTechPackIncomplete      = errors.New("发布前需要填写尺码和尺寸表")
+	ErrTechPackNotCurrent      = errors.New("只能确认当前发布的工艺单版本")
+	ErrTechPackFactoryOnly     = errors.New("只有承接工厂可以确认工艺单")
+	ErrTechPackNotAcknowledged = errors.New("请先确认当前发布的工艺单版本再开始生产")
+)
+
+// TechPackService 订单工艺单：版本管理、发布和工厂确认
+type TechPackService struct {
+	db    *gorm.DB
+	actor models.Actor
+}
+
+func NewTechPackService(db *gorm.DB) *TechPackService {
+	return &TechPackService{db: db}
+}
+
+// WithActor 返回绑定操作人的服务副本
+func (s *TechPackService) WithActor(actor models.Actor) *TechPackService {
+	c := *s
+	c.actor = actor
+	return &c
+}
+
+// auditTechPack 记录工艺单变更的审计事件，归属于订单设计师
+func (s *TechPackService) auditTechPack(tx *gorm.DB, order *models.Order, action string, before, after *models.TechPack) error {
+	target := after
+	if target == nil {
+		target = before
+	}
+	return recordAudit(tx, s.actor, auditEntry{
+		EntityType: models.AuditEntityTechPack,
+		EntityID:   target.ID,
+		Action:     action,
+		OrderID:    &order.ID,
+		OwnerID:    order.DesignerID,
+		Before:     before,
+		After:      after,
+	})
+}
+
+// applyTechPackRequest 校验请求并写入草稿内容：尺码不能重复，尺寸表只能使用列出的尺码，工序未给序号时按顺序编号
+func applyTechPackRequest(pack *models.TechPack, req *models.TechPackRequest) error {
+	sizes := make([]string, 0, len(req.Sizes))
+	known := make(map[string]bool, len(req.Sizes))
+	for _, size := range req.Sizes {
+		size = strings.TrimSpace(size)
+		if known[size] {
+			return ErrTechPackDuplicateSize
+		}
+		known[size] = true
+		sizes = append(sizes, size)
+	}
+	for _, measurement := range req.Measurements {
+		for size := range measurement.Values {
+			if !known[size] {
+				return ErrTechPackSizeUnknown
+			}
+		}
+	}
+	construction := make([]models.TechPackOperation, len(req.Construction))
+	for i, operation := range req.Construction {
+		if operation.Seq == 0 {
+			operation.Seq = i + 1
+		}
+		construction[i] = operation
+	}
+
+	pack.Title = req.Title
+	pack.Sizes = datatypes.NewJSONSlice(sizes)
+	pack.Measurements = datatypes.NewJSONSlice(append([]models.TechPackMeasurement{}, req.Measurements...))
+	pack.Construction = datatypes.NewJSONSlice(construction)
+	pack.Trims = datatypes.NewJSONSlice(append([]models.TechPackTrim{}, req.Trims...))
+	pack.LabelInstructions = req.LabelInstructions
+	pack.PackagingInstructions = req.PackagingInstructions
+	pack.ChangeNote = req.ChangeNote
+	return nil
+}
+
+// lockOrder 锁定订单行，保证同一订单的版本号、轮次等按顺序分配
+func lockOrder(tx *gorm.DB, orderID uint) (*models.Order, error) {
+	var order models.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	return &order, nil
+}
+
+// findTechPack 订单指定版本的工艺单
+func findTechPack(tx *gorm.DB, orderID uint, version int) (*models.TechPack, error) {
+	var pack models.TechPack
+	if err := tx.Preload("Acknowledgements").
+		Where("order_id = ? AND version = ?", orderID, version).
+		First(&pack).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTechPackNotFound
+		}
+		return nil, err
+	}
+	return &pack, nil
+}
+
+// canSeeDrafts 草稿只对订单设计师可见
+func (s *TechPackService) canSeeDrafts(order *models.Order) bool {
+	return s.actor.UserID != "" && s.actor.UserID == order.DesignerID
+}
+
+// ListTechPacks 订单的工艺单版本，从新到旧排列
+func (s *TechPackService) ListTechPacks(orderID uint) ([]models.TechPack, error) {
+	var order models.Order
+	if err := s.db.First(&order, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	query := s.db.Preload("Acknowledgements").Where("order_id = ?", orderID)
+	if !s.canSeeDrafts(&order) {
+		query = query.Where("status <> ?", models.TechPackStatusDraft)
+	}
+	packs := make([]models.TechPack, 0)
+	if err := query.Order("version DESC").Find(&packs).Error; err != nil {
+		return nil, err
+	}
+	return packs, nil
+}
+
+// GetTechPack 订单指定版本的工艺单及所属订单
+func (s *TechPackService) GetTechPack(orderID uint, version int) (*models.TechPack, *models.Order, error) {
+	var order models.Order
+	if err := s.db.First(&order, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrOrderNotFound
+		}
+		return nil, nil, err
+	}
+	pack, err := findTechPack(s.db, orderID, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pack.Status == models.TechPackStatusDraft && !s.canSeeDrafts(&order) {
+		return nil, nil, ErrTechPackNotFound
+	}
+	return pack, &order, nil
+}
+
+// CreateTechPack 创建新版本的工艺单草稿，版本号在订单内递增；同一时间只能有一个草稿
+func (s *TechPackService) CreateTechPack(orderID uint, req *models.TechPackRequest) (*models.TechPack, error) {
+	pack := &models.TechPack{
+		OrderID:   orderID,
+		Status:    models.TechPackStatusDraft,
+		CreatedBy: s.actor.UserID,
+	}
+	if err := applyTechPackRequest(pack, req); err != nil {
+		return nil, err
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		var drafts int64
+		if err := tx.Model(&models.TechPack{}).
+			Where("order_id = ? AND status = ?", orderID, models.TechPackStatusDraft).
+			Count(&drafts).Error; err != nil {
+			return err
+		}
+		if drafts > 0 {
+			return ErrTechPackDraftExists
+		}
+		if err := tx.Model(&models.TechPack{}).Where("order_id = ?", orderID).
+			Select("COALESCE(MAX(version), 0) + 1").Scan(&pack.Version).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(pack).Error; err != nil {
+			return err
+		}
+		return s.auditTechPack(tx, order, models.AuditActionCreate, nil, pack)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pack, nil
+}
+
+// UpdateTechPack 修改工艺单草稿，已发布的版本不能修改
+func (s *TechPackService) UpdateTechPack(orderID uint, version int, req *models.TechPackRequest) (*models.TechPack, error) {
+	var pack *models.TechPack
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if pack, err = findTechPack(tx, orderID, version); err != nil {
+			return err
+		}
+		if pack.Status != models.TechPackStatusDraft {
+			return ErrTechPackNotDraft
+		}
+		before := *pack
+		if err := applyTechPackRequest(pack, req); err != nil {
+			return err
+		}
+		if err := tx.Model(pack).Select("title", "sizes", "measurements", "construction", "trims",
+			"label_instructions", "packaging_instructions", "change_note").Updates(pack).Error; err != nil {
+			return err
+		}
+		return s.auditTechPack(tx, order, models.AuditActionUpdate, &before, pack)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pack, nil
+}
+
+// ReleaseTechPack 发布工艺单草稿，之前发布的版本转为已取代；承接工厂需要重新确认新版本
+func (s *TechPackService) ReleaseTechPack(orderID uint, version int) (*models.TechPack, error) {
+	var pack *models.TechPack
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if pack, err = findTechPack(tx, orderID, version); err != nil {
+			return err
+		}
+		if pack.Status != models.TechPackStatusDraft {
+			return ErrTechPackNotDraft
+		}
+		if len(pack.Sizes) == 0 || len(pack.Measurements) == 0 {
+			return ErrTechPackIncomplete
+		}
+
+		if err := tx.Model(&models.TechPack{}).
+			Where("order_id = ? AND status = ?", orderID, models.TechPackStatusReleased).
+			Update("status", models.TechPackStatusSuperseded).Error; err != nil {
+			return err
+		}
+		before := *pack
+		now := time.Now()
+		if err := tx.Model(pack).Updates(map[string]interface{}{
+			"status":      models.TechPackStatusReleased,
+			"released_by": s.actor.UserID,
+			"released_at": &now,
+		}).Error; err != nil {
+			return err
+		}
+		if err := s.auditTechPack(tx, order, models.AuditActionStatusChange, &before, pack); err != nil {
+			return err
+		}
+		if order.FactoryID == nil {
+			return nil
+		}
+		return notify(tx, s.actor, notificationEvent{
+			Category:   models.NotificationTechPackReleased,
+			Title:      "订单工艺单已更新，请确认",
+			Content:    fmt.Sprintf("订单「%s」发布了第 %d 版工艺单，确认后才能开始生产", order.Title, pack.Version),
+			EntityType: models.AuditEntityTechPack,
+			EntityID:   pack.ID,
+			OrderID:    &order.ID,
+		}, *order.FactoryID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pack, nil
+}
+
+// AcknowledgeTechPack 承接工厂确认当前发布的工艺单版本；重复确认返回已有记录
+func (s *TechPackService) AcknowledgeTechPack(orderID uint, version int, req *models.AcknowledgeTechPackRequest) (*models.TechPackAcknowledgement, error) {
+	var ack models.TechPackAcknowledgement
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.FactoryID == nil || *order.FactoryID == "" || *order.FactoryID != s.actor.UserID {
+			return ErrTechPackFactoryOnly
+		}
+		pack, err := findTechPack(tx, orderID, version)
+		if err != nil {
+			return err
+		}
+		if pack.Status != models.TechPackStatusReleased {
+			if pack.Status == models.TechPackStatusDraft {
+				return ErrTechPackNotFound
+			}
+			return ErrTechPackNotCurrent
+		}
+
+		err = tx.Where("tech_pack_id = ? AND factory_id = ?", pack.ID, s.actor.UserID).First(&ack).Error
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		ack = models.TechPackAcknowledgement{
+			TechPackID:     pack.ID,
+			OrderID:        orderID,
+			Version:        pack.Version,
+			FactoryID:      s.actor.UserID,
+			Note:           req.Note,
+			AcknowledgedAt: time.Now(),
+		}
+		if err := tx.Create(&ack).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, s.actor, auditEntry{
+			EntityType: models.AuditEntityTechPack,
+			EntityID:   pack.ID,
+			Action:     models.AuditActionAccept,
+			OrderID:    &order.ID,
+			OwnerID:    order.DesignerID,
+			After:      &ack,
+		}); err != nil {
+			return err
+		}
+		return notify(tx, s.actor, notificationEvent{
+			Category:   models.NotificationTechPackAcknowledged,
+			Title:      "工厂已确认工艺单",
+			Content:    fmt.Sprintf("订单「%s」的第 %d 版工艺单已由承接工厂确认", order.Title, pack.Version),
+			EntityType: models.AuditEntityTechPack,
+			EntityID:   pack.ID,
+			OrderID:    &order.ID,
+		}, order.DesignerID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ack, nil
+}
+
+// requireTechPackAcknowledged 订单有已发布的工艺单时，工厂必须确认了当前版本才能开始生产
+func requireTechPackAcknowledged(tx *gorm.DB, orderID uint, factoryID string) error {
+	var pack models.TechPack
+	err := tx.Where("order_id = ? AND status = ?", orderID, models.TechPackStatusReleased).First(&pack).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var count int64
+	if err := tx.Model(&models.TechPackAcknowledgement{}).
+		Where("tech_pack_id = ? AND factory_id = ?", pack.ID, factoryID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrTechPackNotAcknowledged
+	}
+	return nil
+}
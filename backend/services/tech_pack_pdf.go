@@ -0,0 +1,273 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"gongChang/models"
+	"gongChang/utils"
+	"strconv"
+	"strings"
+)
+
+const (
+	techPackMargin     = 40.0
+	techPackBottom     = utils.PDFPageHeightA4 - 50
+	techPackFontSize   = 9.0
+	techPackLineHeight = 12.0
+	techPackCellPad    = 3.0
+)
+
+var techPackStatusLabels = map[models.TechPackStatus]string{
+	models.TechPackStatusDraft:      "草稿",
+	models.TechPackStatusReleased:   "已发布",
+	models.TechPackStatusSuperseded: "已取代",
+}
+
+// techPackColumn 表格列
+type techPackColumn struct {
+	title string
+	width float64
+}
+
+// techPackSheet 按从上到下的顺序排版，内容超出页面底部时自动分页
+type techPackSheet struct {
+	pdf    *utils.PDF
+	y      float64
+	footer string
+}
+
+func (s *techPackSheet) contentWidth() float64 {
+	return s.pdf.Width() - 2*techPackMargin
+}
+
+func (s *techPackSheet) newPage() {
+	s.pdf.AddPage()
+	footer := fmt.Sprintf("%s    第 %d 页", s.footer, s.pdf.PageCount())
+	s.pdf.Line(techPackMargin, s.pdf.Height()-38, s.pdf.Width()-techPackMargin, s.pdf.Height()-38, 0.5)
+	s.pdf.Text(techPackMargin, s.pdf.Height()-25, 8, footer)
+	s.y = techPackMargin
+}
+
+// ensure 剩余空间不足 height 时换页，返回是否换了页
+func (s *techPackSheet) ensure(height float64) bool {
+	if s.y+height <= techPackBottom {
+		return false
+	}
+	s.newPage()
+	return true
+}
+
+func (s *techPackSheet) heading(text string) {
+	s.ensure(40)
+	s.y += 8
+	s.pdf.Text(techPackMargin, s.y+13, 13, text)
+	s.y += 18
+	s.pdf.Line(techPackMargin, s.y, s.pdf.Width()-techPackMargin, s.y, 0.8)
+	s.y += 8
+}
+
+func (s *techPackSheet) paragraph(text string) {
+	if strings.TrimSpace(text) == "" {
+		text = "（无）"
+	}
+	for _, line := range utils.PDFWrapText(text, techPackFontSize+1, s.contentWidth()) {
+		s.ensure(techPackLineHeight + 2)
+		s.pdf.Text(techPackMargin, s.y+techPackFontSize+1, techPackFontSize+1, line)
+		s.y += techPackLineHeight + 2
+	}
+}
+
+// table 输出表格，单元格内容按列宽折行；跨页时在新页重复表头
+func (s *techPackSheet) table(columns []techPackColumn, rows [][]string) {
+	drawRow := func(cells []string, header bool) {
+		wrapped := make([][]string, len(columns))
+		lines := 1
+		for i, column := range columns {
+			text := ""
+			if i < len(cells) {
+				text = cells[i]
+			}
+			wrapped[i] = utils.PDFWrapText(text, techPackFontSize, column.width-2*techPackCellPad)
+			if len(wrapped[i]) > lines {
+				lines = len(wrapped[i])
+			}
+		}
+		height := float64(lines)*techPackLineHeight + 2*techPackCellPad
+		x := techPackMargin
+		if header {
+			s.pdf.FillRect(x, s.y, s.contentWidth(), height, 0.9)
+		}
+		for i, column := range columns {
+			s.pdf.Rect(x, s.y, column.width, height, 0.5)
+			for j, line := range wrapped[i] {
+				s.pdf.Text(x+techPackCellPad, s.y+techPackCellPad+float64(j)*techPackLineHeight+techPackFontSize, techPackFontSize, line)
+			}
+			x += column.width
+		}
+		s.y += height
+	}
+
+	titles := make([]string, len(columns))
+	for i, column := range columns {
+		titles[i] = column.title
+	}
+	s.ensure(3 * techPackLineHeight)
+	drawRow(titles, true)
+	for _, row := range rows {
+		// 预估行高，放不下时换页并重画表头
+		lines := 1
+		for i, column := range columns {
+			if i < len(row) {
+				if n := len(utils.PDFWrapText(row[i], techPackFontSize, column.width-2*techPackCellPad)); n > lines {
+					lines = n
+				}
+			}
+		}
+		if s.ensure(float64(lines)*techPackLineHeight + 2*techPackCellPad) {
+			drawRow(titles, true)
+		}
+		drawRow(row, false)
+	}
+	s.y += 6
+}
+
+// formatMeasure 尺寸数值去掉多余的小数位
+func formatMeasure(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// RenderTechPackPDF 生成可打印的工艺单 PDF，返回文件内容和建议的文件名
+func (s *TechPackService) RenderTechPackPDF(orderID uint, version int) ([]byte, string, error) {
+	pack, order, err := s.GetTechPack(orderID, version)
+	if err != nil {
+		return nil, "", err
+	}
+
+	title := pack.Title
+	if title == "" {
+		title = order.Title
+	}
+	pdf := utils.NewPDF(utils.PDFPageWidthA4, utils.PDFPageHeightA4, fmt.Sprintf("工艺单 %s v%d", title, pack.Version))
+	sheet := &techPackSheet{pdf: pdf, footer: fmt.Sprintf("订单 #%d  工艺单第 %d 版", order.ID, pack.Version)}
+	sheet.newPage()
+
+	// 抬头
+	pdf.Text(techPackMargin, sheet.y+18, 18, "工艺单 Tech Pack")
+	sheet.y += 30
+	info := []string{
+		fmt.Sprintf("款式：%s", title),
+		fmt.Sprintf("订单：#%d %s", order.ID, order.Title),
+		fmt.Sprintf("版本：第 %d 版（%s）", pack.Version, techPackStatusLabels[pack.Status]),
+	}
+	if pack.ReleasedAt != nil {
+		info = append(info, "发布时间："+pack.ReleasedAt.Format("2006-01-02 15:04"))
+	}
+	if len(pack.Sizes) > 0 {
+		info = append(info, "尺码："+strings.Join(pack.Sizes, " / "))
+	}
+	if pack.ChangeNote != "" {
+		info = append(info, "修改说明："+pack.ChangeNote)
+	}
+	for _, line := range info {
+		sheet.paragraph(line)
+	}
+
+	// 尺寸表：固定列之外的宽度平均分给各尺码，尺码很多时压缩测量部位列
+	sheet.heading("尺寸表（单位：厘米）")
+	if len(pack.Measurements) == 0 {
+		sheet.paragraph("")
+	} else {
+		const codeWidth, toleranceWidth, minPointWidth = 36.0, 64.0, 90.0
+		sizeWidth := 48.0
+		pointWidth := sheet.contentWidth() - codeWidth - toleranceWidth - float64(len(pack.Sizes))*sizeWidth
+		if pointWidth < minPointWidth && len(pack.Sizes) > 0 {
+			pointWidth = minPointWidth
+			sizeWidth = (sheet.contentWidth() - codeWidth - toleranceWidth - pointWidth) / float64(len(pack.Sizes))
+		}
+		columns := []techPackColumn{{"代码", codeWidth}, {"测量部位", pointWidth}, {"公差 +/-", toleranceWidth}}
+		for _, size := range pack.Sizes {
+			columns = append(columns, techPackColumn{size, sizeWidth})
+		}
+		rows := make([][]string, 0, len(pack.Measurements))
+		for _, m := range pack.Measurements {
+			point := m.Point
+			if m.HowToMeasure != "" {
+				point += "\n" + m.HowToMeasure
+			}
+			row := []string{m.Code, point, fmt.Sprintf("+%s / -%s", formatMeasure(m.TolerancePlus), formatMeasure(m.ToleranceMinus))}
+			for _, size := range pack.Sizes {
+				value, ok := m.Values[size]
+				if !ok {
+					row = append(row, "-")
+					continue
+				}
+				row = append(row, formatMeasure(value))
+			}
+			rows = append(rows, row)
+		}
+		sheet.table(columns, rows)
+	}
+
+	sheet.heading("工序做工说明")
+	if len(pack.Construction) == 0 {
+		sheet.paragraph("")
+	} else {
+		const seqWidth, operationWidth, machineWidth = 36.0, 90.0, 120.0
+		columns := []techPackColumn{
+			{"序号", seqWidth},
+			{"工序", operationWidth},
+			{"做工要求", sheet.contentWidth() - seqWidth - operationWidth - machineWidth},
+			{"机器 / 线迹", machineWidth},
+		}
+		rows := make([][]string, 0, len(pack.Construction))
+		for _, op := range pack.Construction {
+			machine := strings.TrimSpace(op.Machine + "\n" + op.StitchType)
+			if op.SPI > 0 {
+				machine += fmt.Sprintf("\n针距 %d 针/英寸", op.SPI)
+			}
+			rows = append(rows, []string{strconv.Itoa(op.Seq), op.Operation, op.Description, machine})
+		}
+		sheet.table(columns, rows)
+	}
+
+	sheet.heading("辅料清单")
+	if len(pack.Trims) == 0 {
+		sheet.paragraph("")
+	} else {
+		const nameWidth, placementWidth, quantityWidth, supplierWidth = 90.0, 90.0, 56.0, 80.0
+		columns := []techPackColumn{
+			{"名称", nameWidth},
+			{"规格", sheet.contentWidth() - nameWidth - placementWidth - quantityWidth - supplierWidth},
+			{"位置", placementWidth},
+			{"每件用量", quantityWidth},
+			{"供应商", supplierWidth},
+		}
+		rows := make([][]string, 0, len(pack.Trims))
+		for _, trim := range pack.Trims {
+			rows = append(rows, []string{trim.Name, trim.Specification, trim.Placement, formatMeasure(trim.QuantityPerGarment), trim.Supplier})
+		}
+		sheet.table(columns, rows)
+	}
+
+	sheet.heading("标签说明")
+	sheet.paragraph(pack.LabelInstructions)
+	sheet.heading("包装说明")
+	sheet.paragraph(pack.PackagingInstructions)
+
+	if len(pack.Acknowledgements) > 0 {
+		sheet.heading("工厂确认")
+		for _, ack := range pack.Acknowledgements {
+			line := fmt.Sprintf("%s 于 %s 确认", ack.FactoryID, ack.AcknowledgedAt.Format("2006-01-02 15:04"))
+			if ack.Note != "" {
+				line += "：" + ack.Note
+			}
+			sheet.paragraph(line)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := pdf.WriteTo(&buf); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), fmt.Sprintf("tech-pack-order-%d-v%d.pdf", order.ID, pack.Version), nil
+}
@@ -0,0 +1,400 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gongChang/models"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DefaultChunkSize   = 8 * 1024 * 1024         // 默认分片大小 8MB
+	MinChunkSize       = 1 * 1024 * 1024         // 最小分片（最后一片除外）
+	MaxChunkSize       = 32 * 1024 * 1024        // 最大分片，分片在内存中校验
+	MaxChunkedFileSize = 10 * 1024 * 1024 * 1024 // 分片上传的文件上限 10GB
+
+	// uploadSessionTTL 会话在最后一次活动后保留的时间，超时未完成的会话及其分片会被清理
+	uploadSessionTTL = 24 * time.Hour
+
+	// uploadAssembleTimeout 合并状态保持超过该时间视为进程在合并中途退出，会话可以重置后重新合并或取消
+	uploadAssembleTimeout = time.Hour
+
+	// 分片的对象键前缀
+	uploadChunkDir = "chunks"
+)
+
+var (
+	ErrUploadNotFound         = errors.New("上传会话不存在")
+	ErrUploadNotActive        = errors.New("上传会话已结束")
+	ErrUploadTooLarge         = fmt.Errorf("文件大小超过限制 (最大 %d GB)", MaxChunkedFileSize/1024/1024/1024)
+	ErrUploadIncomplete       = errors.New("仍有分片未上传")
+	ErrUploadChecksumMismatch = errors.New("文件校验失败，SHA-256 不一致")
+	ErrChunkIndexInvalid      = errors.New("分片序号无效")
+	ErrChunkSizeInvalid       = errors.New("分片大小不正确")
+	ErrChunkChecksumMissing   = errors.New("缺少分片的 SHA-256 校验值")
+	ErrChunkChecksumMismatch  = errors.New("分片校验失败，SHA-256 不一致")
+)
+
+func uploadChunkKey(sessionID string, index int) string {
+	return fmt.Sprintf("%s/%s/%d", uploadChunkDir, sessionID, index)
+}
+
+// InitiateUpload 创建分片上传会话，关联订单时要求操作人可以操作该订单
+func (s *FileService) InitiateUpload(req *models.InitiateUploadRequest) (*models.UploadSessionStatus, error) {
+	if s.actor.UserID == "" {
+		return nil, forbidden("请先登录")
+	}
+	if _, err := resolveUploadExt(req.Filename, req.Type); err != nil {
+		return nil, err
+	}
+	if req.Size > MaxChunkedFileSize {
+		return nil, ErrUploadTooLarge
+	}
+
+	chunkSize := req.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultChunkSize
+	}
+	if chunkSize < MinChunkSize || chunkSize > MaxChunkSize {
+		return nil, ErrChunkSizeInvalid
+	}
+
+	if req.OrderID != nil {
+		if err := NewPolicyService(s.db).CanOperateOrder(s.actor, *req.OrderID); err != nil {
+			return nil, err
+		}
+	}
+
+	session := &models.UploadSession{
+		ID:          uuid.New().String(),
+		UploaderID:  s.actor.UserID,
+		Filename:    req.Filename,
+		FileType:    req.Type,
+		OrderID:     req.OrderID,
+		TotalSize:   req.Size,
+		ChunkSize:   chunkSize,
+		TotalChunks: int((req.Size + chunkSize - 1) / chunkSize),
+		SHA256:      strings.ToLower(req.SHA256),
+		Status:      models.UploadStatusUploading,
+		ExpiresAt:   time.Now().Add(uploadSessionTTL),
+	}
+	if err := s.db.Create(session).Error; err != nil {
+		return nil, err
+	}
+	return s.uploadStatus(session)
+}
+
+// GetUploadStatus 查询会话状态和缺失的分片，客户端断线后据此续传
+func (s *FileService) GetUploadStatus(sessionID string) (*models.UploadSessionStatus, error) {
+	session, err := s.loadUploadSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return s.uploadStatus(session)
+}
+
+// PutChunk 接收一个分片，校验大小和 SHA-256 后写入存储；重复上传同一分片会覆盖
+func (s *FileService) PutChunk(sessionID string, index int, r io.Reader, checksum string) (*models.UploadChunk, error) {
+	session, err := s.loadUploadSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != models.UploadStatusUploading || time.Now().After(session.ExpiresAt) {
+		return nil, ErrUploadNotActive
+	}
+	if index < 0 || index >= session.TotalChunks {
+		return nil, ErrChunkIndexInvalid
+	}
+	if checksum == "" {
+		return nil, ErrChunkChecksumMissing
+	}
+
+	expected := session.ChunkSize
+	if index == session.TotalChunks-1 {
+		expected = session.TotalSize - session.ChunkSize*int64(session.TotalChunks-1)
+	}
+
+	// 分片不超过 MaxChunkSize，先读入内存校验，避免把损坏的数据写入存储
+	data, err := io.ReadAll(io.LimitReader(r, expected+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != expected {
+		return nil, ErrChunkSizeInvalid
+	}
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	if digest != strings.ToLower(checksum) {
+		return nil, ErrChunkChecksumMismatch
+	}
+
+	if err := s.store.Put(context.Background(), uploadChunkKey(session.ID, index), bytes.NewReader(data), expected, "application/octet-stream"); err != nil {
+		return nil, err
+	}
+
+	chunk := &models.UploadChunk{
+		SessionID: session.ID,
+		Index:     index,
+		Size:      expected,
+		SHA256:    digest,
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "session_id"}, {Name: "chunk_index"}},
+			DoUpdates: clause.AssignmentColumns([]string{"size", "sha256", "created_at"}),
+		}).Create(chunk).Error; err != nil {
+			return err
+		}
+		return tx.Model(session).Update("expires_at", time.Now().Add(uploadSessionTTL)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chunk, nil
+}
+
+// CompleteUpload 合并全部分片，校验整个文件的 SHA-256 后按普通上传的规则保存为 File
+// 已完成的会话再次调用时返回之前生成的文件。
+func (s *FileService) CompleteUpload(sessionID string) (*models.File, *models.UploadSession, error) {
+	session, err := s.loadUploadSession(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if session.Status == models.UploadStatusCompleted {
+		file, err := s.GetFileByID(session.FileID)
+		return file, session, err
+	}
+	if assemblyStale(session, time.Now()) {
+		if _, err := s.resetStaleAssemblies(session.ID, time.Now()); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// 状态从 uploading 切换到 assembling，防止并发重复合并
+	result := s.db.Model(&models.UploadSession{}).
+		Where("id = ? AND status = ?", session.ID, models.UploadStatusUploading).
+		Updates(map[string]interface{}{
+			"status":     models.UploadStatusAssembling,
+			"expires_at": time.Now().Add(uploadSessionTTL),
+		})
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, ErrUploadNotActive
+	}
+
+	file, err := s.assembleUpload(session)
+	if err != nil {
+		status := models.UploadStatusUploading
+		if errors.Is(err, ErrUploadChecksumMismatch) {
+			status = models.UploadStatusFailed
+		}
+		if updateErr := s.db.Model(session).Update("status", status).Error; updateErr != nil {
+			log.Printf("Failed to reset upload session %s: %v", session.ID, updateErr)
+		}
+		return nil, nil, err
+	}
+
+	session.Status = models.UploadStatusCompleted
+	session.FileID = file.ID
+	if err := s.db.Model(session).Updates(map[string]interface{}{
+		"status":  session.Status,
+		"file_id": session.FileID,
+	}).Error; err != nil {
+		return nil, nil, err
+	}
+	s.removeUploadChunks(session)
+	return file, session, nil
+}
+
+// assembleUpload 按序号把分片拼接到本地临时文件，同时计算 SHA-256
+func (s *FileService) assembleUpload(session *models.UploadSession) (*models.File, error) {
+	var count int64
+	if err := s.db.Model(&models.UploadChunk{}).Where("session_id = ?", session.ID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if int(count) != session.TotalChunks {
+		return nil, ErrUploadIncomplete
+	}
+
+	finalExt, err := resolveUploadExt(session.Filename, session.FileType)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := os.CreateTemp("", "upload_*"+finalExt)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		dst.Close()
+		os.Remove(dst.Name())
+	}()
+
+	ctx := context.Background()
+	hash := sha256.New()
+	writer := io.MultiWriter(dst, hash)
+	var written int64
+	for i := 0; i < session.TotalChunks; i++ {
+		chunk, err := s.store.Get(ctx, uploadChunkKey(session.ID, i))
+		if err != nil {
+			return nil, fmt.Errorf("读取分片 %d 失败: %w", i, err)
+		}
+		n, err := io.Copy(writer, chunk)
+		chunk.Close()
+		if err != nil {
+			return nil, fmt.Errorf("读取分片 %d 失败: %w", i, err)
+		}
+		written += n
+	}
+	if written != session.TotalSize || hex.EncodeToString(hash.Sum(nil)) != session.SHA256 {
+		return nil, ErrUploadChecksumMismatch
+	}
+
+	return s.storeFile(dst, written, session.SHA256, finalExt, session.Filename, session.OrderID, session.FileType, session.UploaderID)
+}
+
+// AbortUpload 取消上传并删除已上传的分片
+func (s *FileService) AbortUpload(sessionID string) error {
+	session, err := s.loadUploadSession(sessionID)
+	if err != nil {
+		return err
+	}
+	if session.Status == models.UploadStatusAssembling && !assemblyStale(session, time.Now()) {
+		return ErrUploadNotActive
+	}
+	return s.deleteUploadSession(session)
+}
+
+// assemblyStale 会话是否卡在合并状态超过 uploadAssembleTimeout
+func assemblyStale(session *models.UploadSession, now time.Time) bool {
+	return session.Status == models.UploadStatusAssembling && session.UpdatedAt.Before(now.Add(-uploadAssembleTimeout))
+}
+
+// resetStaleAssemblies 把卡在合并状态的会话恢复为上传中，客户端可以重新完成上传；sessionID 为空时处理全部会话
+func (s *FileService) resetStaleAssemblies(sessionID string, now time.Time) (int64, error) {
+	query := s.db.Model(&models.UploadSession{}).
+		Where("status = ? AND updated_at < ?", models.UploadStatusAssembling, now.Add(-uploadAssembleTimeout))
+	if sessionID != "" {
+		query = query.Where("id = ?", sessionID)
+	}
+	result := query.Updates(map[string]interface{}{
+		"status":     models.UploadStatusUploading,
+		"expires_at": now.Add(uploadSessionTTL),
+	})
+	return result.RowsAffected, result.Error
+}
+
+// CleanupExpiredUploads 删除超时的上传会话及其分片，并恢复卡在合并状态的会话，返回清理的会话数
+func (s *FileService) CleanupExpiredUploads(now time.Time) (int, error) {
+	if reset, err := s.resetStaleAssemblies("", now); err != nil {
+		return 0, err
+	} else if reset > 0 {
+		log.Printf("Reset %d upload sessions stuck in assembling", reset)
+	}
+
+	var sessions []models.UploadSession
+	if err := s.db.Where("expires_at < ?", now).Limit(500).Find(&sessions).Error; err != nil {
+		return 0, err
+	}
+	cleaned := 0
+	for i := range sessions {
+		if err := s.deleteUploadSession(&sessions[i]); err != nil {
+			log.Printf("Failed to clean up upload session %s: %v", sessions[i].ID, err)
+			continue
+		}
+		cleaned++
+	}
+	return cleaned, nil
+}
+
+// RunUploadCleanup 定期清理超时的上传会话，直到 ctx 取消
+func (s *FileService) RunUploadCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			count, err := s.CleanupExpiredUploads(time.Now())
+			if err != nil {
+				log.Printf("Upload session cleanup failed: %v", err)
+			} else if count > 0 {
+				log.Printf("Cleaned up %d expired upload sessions", count)
+			}
+		}
+	}
+}
+
+// loadUploadSession 加载当前操作人的上传会话
+func (s *FileService) loadUploadSession(sessionID string) (*models.UploadSession, error) {
+	var session models.UploadSession
+	if err := s.db.First(&session, "id = ?", sessionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+	if session.UploaderID != s.actor.UserID {
+		return nil, forbidden("只能访问自己的上传会话")
+	}
+	return &session, nil
+}
+
+func (s *FileService) uploadStatus(session *models.UploadSession) (*models.UploadSessionStatus, error) {
+	var received []int
+	if err := s.db.Model(&models.UploadChunk{}).Where("session_id = ?", session.ID).
+		Order("chunk_index").Pluck("chunk_index", &received).Error; err != nil {
+		return nil, err
+	}
+	status := &models.UploadSessionStatus{
+		UploadSession:  session,
+		ReceivedChunks: make([]int, 0, len(received)),
+		MissingChunks:  make([]int, 0),
+	}
+	have := make(map[int]bool, len(received))
+	for _, index := range received {
+		have[index] = true
+		status.ReceivedChunks = append(status.ReceivedChunks, index)
+	}
+	if session.Status == models.UploadStatusUploading {
+		for i := 0; i < session.TotalChunks; i++ {
+			if !have[i] {
+				status.MissingChunks = append(status.MissingChunks, i)
+			}
+		}
+	}
+	return status, nil
+}
+
+// deleteUploadSession 删除会话记录和分片
+func (s *FileService) deleteUploadSession(session *models.UploadSession) error {
+	s.removeUploadChunks(session)
+	return s.db.Delete(session).Error
+}
+
+// removeUploadChunks 删除存储中的分片及分片记录，失败只记录日志
+func (s *FileService) removeUploadChunks(session *models.UploadSession) {
+	ctx := context.Background()
+	for i := 0; i < session.TotalChunks; i++ {
+		if err := s.store.Delete(ctx, uploadChunkKey(session.ID, i)); err != nil {
+			log.Printf("Failed to remove chunk %d of upload %s: %v", i, session.ID, err)
+		}
+	}
+	if err := s.db.Where("session_id = ?", session.ID).Delete(&models.UploadChunk{}).Error; err != nil {
+		log.Printf("Failed to remove chunk records of upload %s: %v", session.ID, err)
+	}
+}
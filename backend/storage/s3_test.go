@@ -0,0 +1,504 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testBucket    = "gongchang-test"
+	testRegion    = "ap-east-1"
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testPageSize  = 2 // 每页对象数，便于覆盖分页
+)
+
+// fakeS3Object 模拟存储中的一个对象
+type fakeS3Object struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+// fakeS3 路径风格的 S3 兼容服务：按 SigV4 独立校验每个请求的签名，只实现驱动用到的接口
+type fakeS3 struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string]fakeS3Object
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	fake := &fakeS3{t: t, objects: make(map[string]fakeS3Object)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rawPath, rawQuery, _ := strings.Cut(r.RequestURI, "?")
+	prefix := "/" + testBucket
+	if rawPath != prefix && !strings.HasPrefix(rawPath, prefix+"/") {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket", "bucket not found")
+		return
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+
+	if query.Get("X-Amz-Signature") != "" {
+		err = verifyPresigned(r, rawPath, query)
+	} else {
+		err = verifyAuthorization(r, rawPath, query)
+	}
+	if err != nil {
+		writeS3Error(w, http.StatusForbidden, "SignatureDoesNotMatch", err.Error())
+		return
+	}
+
+	key, err := url.PathUnescape(strings.TrimPrefix(strings.TrimPrefix(rawPath, prefix), "/"))
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "InvalidURI", err.Error())
+		return
+	}
+	if key == "" {
+		if r.Method == http.MethodGet && query.Get("list-type") == "2" {
+			f.list(w, query)
+			return
+		}
+		writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		if r.ContentLength < 0 {
+			writeS3Error(w, http.StatusLengthRequired, "MissingContentLength", "content length required")
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeS3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		if int64(len(data)) != r.ContentLength {
+			writeS3Error(w, http.StatusBadRequest, "IncompleteBody", "body shorter than content length")
+			return
+		}
+		f.objects[key] = fakeS3Object{data: data, contentType: r.Header.Get("Content-Type"), modTime: time.Now().UTC().Truncate(time.Second)}
+		w.Header().Set("ETag", fakeETag(data))
+	case http.MethodGet, http.MethodHead:
+		object, ok := f.objects[key]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey", key)
+			return
+		}
+		contentType := object.contentType
+		if override := query.Get("response-content-type"); override != "" {
+			contentType = override
+		}
+		if disposition := query.Get("response-content-disposition"); disposition != "" {
+			w.Header().Set("Content-Disposition", disposition)
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+		w.Header().Set("ETag", fakeETag(object.data))
+		w.Header().Set("Last-Modified", object.modTime.Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			w.Write(object.data)
+		}
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+// list ListObjectsV2，每页 testPageSize 个对象，续传令牌为下一页第一个键
+func (f *fakeS3) list(w http.ResponseWriter, query url.Values) {
+	f.mu.Lock()
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		if strings.HasPrefix(key, query.Get("prefix")) && key >= query.Get("continuation-token") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var result s3ListResult
+	if len(keys) > testPageSize {
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[testPageSize]
+		keys = keys[:testPageSize]
+	}
+	for _, key := range keys {
+		object := f.objects[key]
+		result.Contents = append(result.Contents, struct {
+			Key          string    `xml:"Key"`
+			LastModified time.Time `xml:"LastModified"`
+			ETag         string    `xml:"ETag"`
+			Size         int64     `xml:"Size"`
+		}{key, object.modTime, fakeETag(object.data), int64(len(object.data))})
+	}
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"ListBucketResult"`
+		s3ListResult
+	}{s3ListResult: result})
+}
+
+func fakeETag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, message)
+}
+
+// verifyAuthorization 校验 Authorization 头中的 SigV4 签名
+func verifyAuthorization(r *http.Request, rawPath string, query url.Values) error {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+		return errors.New("missing authorization")
+	}
+	fields := make(map[string]string)
+	for _, part := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		fields[name] = value
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	if err := checkCredential(fields["Credential"], amzDate); err != nil {
+		return err
+	}
+	if r.Header.Get("X-Amz-Content-Sha256") == "" {
+		return errors.New("missing x-amz-content-sha256")
+	}
+
+	signedHeaders := strings.Split(fields["SignedHeaders"], ";")
+	var canonicalHeaders strings.Builder
+	for _, name := range signedHeaders {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	for name := range r.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") && !containsString(signedHeaders, lower) {
+			return fmt.Errorf("header %s is not signed", lower)
+		}
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		rawPath,
+		testCanonicalQuery(query, ""),
+		canonicalHeaders.String(),
+		fields["SignedHeaders"],
+		r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	if expected := testSignature(amzDate, canonicalRequest); !hmac.Equal([]byte(expected), []byte(fields["Signature"])) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// verifyPresigned 校验查询参数签名及有效期
+func verifyPresigned(r *http.Request, rawPath string, query url.Values) error {
+	if r.Method != http.MethodGet || query.Get("X-Amz-Algorithm") != "AWS4-HMAC-SHA256" {
+		return errors.New("unsupported presigned request")
+	}
+	amzDate := query.Get("X-Amz-Date")
+	if err := checkCredential(query.Get("X-Amz-Credential"), amzDate); err != nil {
+		return err
+	}
+	signedAt, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil {
+		return err
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expires < 1 || expires > 7*24*3600 {
+		return errors.New("invalid X-Amz-Expires")
+	}
+	if time.Now().After(signedAt.Add(time.Duration(expires) * time.Second)) {
+		return errors.New("request has expired")
+	}
+	if query.Get("X-Amz-SignedHeaders") != "host" {
+		return errors.New("unexpected signed headers")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		rawPath,
+		testCanonicalQuery(query, "X-Amz-Signature"),
+		"host:" + r.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	if expected := testSignature(amzDate, canonicalRequest); !hmac.Equal([]byte(expected), []byte(query.Get("X-Amz-Signature"))) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func checkCredential(credential, amzDate string) error {
+	if len(amzDate) < 8 {
+		return errors.New("missing x-amz-date")
+	}
+	expected := testAccessKey + "/" + amzDate[:8] + "/" + testRegion + "/s3/aws4_request"
+	if credential != expected {
+		return fmt.Errorf("unexpected credential %q", credential)
+	}
+	return nil
+}
+
+// testCanonicalQuery 按 SigV4 规则重新编码查询参数，不依赖驱动中的实现
+func testCanonicalQuery(query url.Values, skip string) string {
+	encode := func(s string) string {
+		return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+	}
+	parts := make([]string, 0, len(query))
+	for key, values := range query {
+		if key == skip {
+			continue
+		}
+		for _, value := range values {
+			parts = append(parts, encode(key)+"="+encode(value))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "&")
+}
+
+func testSignature(amzDate, canonicalRequest string) string {
+	mac := func(key []byte, data string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	scope := amzDate[:8] + "/" + testRegion + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+	key := mac([]byte("AWS4"+testSecretKey), amzDate[:8])
+	key = mac(key, testRegion)
+	key = mac(key, "s3")
+	key = mac(key, "aws4_request")
+	return hex.EncodeToString(mac(key, stringToSign))
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+func newTestS3Storage(t *testing.T, endpoint, secret string) *S3Storage {
+	t.Helper()
+	store, err := NewS3Storage(S3Options{
+		Endpoint:  endpoint,
+		Region:    testRegion,
+		Bucket:    testBucket,
+		AccessKey: testAccessKey,
+		SecretKey: secret,
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Storage: %v", err)
+	}
+	return store
+}
+
+func TestS3StoragePutGetStatDelete(t *testing.T) {
+	_, server := newFakeS3(t)
+	store := newTestS3Storage(t, server.URL, testSecretKey)
+	ctx := context.Background()
+
+	// 键中包含需要编码的字符，覆盖路径的规范化编码
+	key := "blobs/ab/设计 稿+v1.png"
+	content := []byte("fake png content")
+	if err := store.Put(ctx, key, bytes.NewReader(content), int64(len(content)), "image/png"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	info, err := store.Stat(ctx, key)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size != int64(len(content)) || info.ContentType != "image/png" || info.ETag != strings.Trim(fakeETag(content), `"`) {
+		t.Fatalf("Stat = %+v", info)
+	}
+	if info.ModTime.IsZero() {
+		t.Fatalf("Stat did not parse Last-Modified")
+	}
+
+	reader, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Stat(ctx, key); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("Stat after delete = %v, want ErrNotExist", err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("Get after delete = %v, want ErrNotExist", err)
+	}
+	// 删除不存在的对象不是错误
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete missing object: %v", err)
+	}
+}
+
+func TestS3StoragePutUnknownSize(t *testing.T) {
+	_, server := newFakeS3(t)
+	store := newTestS3Storage(t, server.URL, testSecretKey)
+	ctx := context.Background()
+
+	content := strings.Repeat("chunk", 100)
+	if err := store.Put(ctx, "uploads/unknown-size", strings.NewReader(content), -1, ""); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	info, err := store.Stat(ctx, "uploads/unknown-size")
+	if err != nil || info.Size != int64(len(content)) {
+		t.Fatalf("Stat = %+v, %v", info, err)
+	}
+}
+
+func TestS3StorageList(t *testing.T) {
+	_, server := newFakeS3(t)
+	store := newTestS3Storage(t, server.URL, testSecretKey)
+	ctx := context.Background()
+
+	keys := []string{"blobs/aa/1", "blobs/aa/2", "blobs/bb/3", "blobs/cc/4", "blobs/cc/5", "derivatives/6"}
+	for _, key := range keys {
+		if err := store.Put(ctx, key, strings.NewReader(key), int64(len(key)), "text/plain"); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+
+	var listed []string
+	err := store.List(ctx, "blobs/", func(info ObjectInfo) error {
+		if info.Size != int64(len(info.Key)) || info.ETag == "" {
+			t.Errorf("List object %+v", info)
+		}
+		listed = append(listed, info.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if want := strings.Join(keys[:5], ","); strings.Join(listed, ",") != want {
+		t.Fatalf("List = %v, want %s", listed, want)
+	}
+
+	// 回调返回错误时停止遍历
+	stop := errors.New("stop")
+	count := 0
+	err = store.List(ctx, "", func(ObjectInfo) error {
+		count++
+		if count == 3 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || count != 3 {
+		t.Fatalf("List with stop = %v after %d objects", err, count)
+	}
+}
+
+func TestS3StoragePresignGet(t *testing.T) {
+	_, server := newFakeS3(t)
+	store := newTestS3Storage(t, server.URL, testSecretKey)
+	ctx := context.Background()
+
+	key := "blobs/cd/报价单.pdf"
+	content := []byte("%PDF-1.4 fake")
+	if err := store.Put(ctx, key, bytes.NewReader(content), int64(len(content)), "application/pdf"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	signed, err := store.PresignGet(ctx, key, 10*time.Minute, PresignOptions{Filename: "报价单.pdf", Attachment: true})
+	if err != nil {
+		t.Fatalf("PresignGet: %v", err)
+	}
+	resp, err := http.Get(signed)
+	if err != nil {
+		t.Fatalf("GET presigned: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, content) {
+		t.Fatalf("GET presigned = %d %q", resp.StatusCode, body)
+	}
+	if disposition := resp.Header.Get("Content-Disposition"); !strings.HasPrefix(disposition, "attachment; filename*=UTF-8''") {
+		t.Fatalf("Content-Disposition = %q", disposition)
+	}
+
+	// 篡改签名参数后被拒绝
+	parsed, _ := url.Parse(signed)
+	query := parsed.Query()
+	query.Set("response-content-type", "text/html")
+	parsed.RawQuery = query.Encode()
+	resp, err = http.Get(parsed.String())
+	if err != nil {
+		t.Fatalf("GET tampered: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("tampered presigned URL status = %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestS3StorageRejectsBadSignature(t *testing.T) {
+	fake, server := newFakeS3(t)
+	store := newTestS3Storage(t, server.URL, "wrong-secret")
+	ctx := context.Background()
+
+	err := store.Put(ctx, "blobs/ee/bad", strings.NewReader("x"), 1, "text/plain")
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Fatalf("Put with wrong secret = %v, want SignatureDoesNotMatch", err)
+	}
+	if len(fake.objects) != 0 {
+		t.Fatalf("object stored despite bad signature")
+	}
+	if _, err := store.PresignGet(ctx, "../escape", time.Minute, PresignOptions{}); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("PresignGet with invalid key = %v, want ErrInvalidKey", err)
+	}
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gongChang/config"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotExist 对象不存在
+	ErrNotExist = errors.New("storage: object does not exist")
+	// ErrInvalidKey 对象键不合法（为空、绝对路径或包含 ..）
+	ErrInvalidKey = errors.New("storage: invalid object key")
+	// ErrSignatureInvalid 签名链接校验失败
+	ErrSignatureInvalid = errors.New("storage: invalid signature")
+	// ErrSignatureExpired 签名链接已过期
+	ErrSignatureExpired = errors.New("storage: signature expired")
+)
+
+// Storage 文件存储后端
+// 对象键使用以 / 分隔的相对路径（如 "3f2a.jpg"、"derivatives/3f2a_thumbnail.jpg"），与 File.Path 一致。
+type Storage interface {
+	// Put 写入对象，size 为 -1 表示长度未知
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get 读取对象，调用方负责关闭
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete 删除对象，对象不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+	// Stat 获取对象元信息
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// PresignGet 生成带签名、限时有效的下载地址
+	PresignGet(ctx context.Context, key string, expires time.Duration, opts PresignOptions) (string, error)
+	// List 按键的字典序遍历指定前缀下的对象，fn 返回错误时停止遍历
+	List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+}
+
+// ObjectInfo 对象元信息
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ETag        string
+	ModTime     time.Time
+}
+
+// PresignOptions 签名下载地址的响应选项
+type PresignOptions struct {
+	Filename    string // 下载时的文件名，为空时使用对象键的文件名
+	ContentType string // 覆盖响应的 Content-Type
+	Attachment  bool   // true 时以附件形式下载，否则在浏览器内直接打开
+}
+
+// contentDisposition 构造 Content-Disposition，文件名按 RFC 5987 编码以支持中文
+func (o PresignOptions) contentDisposition(key string) string {
+	name := o.Filename
+	if name == "" {
+		name = path.Base(key)
+	}
+	disposition := "inline"
+	if o.Attachment {
+		disposition = "attachment"
+	}
+	return fmt.Sprintf("%s; filename*=UTF-8''%s", disposition, uriEncode(name, true))
+}
+
+// CleanKey 规范化并校验对象键
+func CleanKey(key string) (string, error) {
+	key = strings.TrimPrefix(strings.ReplaceAll(key, "\\", "/"), "/")
+	if key == "" {
+		return "", ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", ErrInvalidKey
+		}
+	}
+	return key, nil
+}
+
+// NewFromConfig 根据配置创建存储后端，默认使用本地磁盘
+func NewFromConfig(cfg *config.Config) (Storage, error) {
+	switch cfg.Storage.Driver {
+	case "", "local":
+		secret := cfg.Storage.Local.Secret
+		if secret == "" {
+			secret = cfg.JWT.Secret
+		}
+		root := cfg.Storage.Local.Root
+		if root == "" {
+			root = "./uploads"
+		}
+		return NewLocalStorage(root, cfg.Storage.Local.BaseURL, []byte(secret))
+	case "s3":
+		s3 := cfg.Storage.S3
+		return NewS3Storage(S3Options{
+			Endpoint:  s3.Endpoint,
+			Region:    s3.Region,
+			Bucket:    s3.Bucket,
+			AccessKey: s3.AccessKey,
+			SecretKey: s3.SecretKey,
+			PathStyle: s3.PathStyle,
+		})
+	}
+	return nil, fmt.Errorf("storage: unknown driver %q", cfg.Storage.Driver)
+}
+
+// uriEncode 按 RFC 3986 编码，只保留非保留字符；encodeSlash 为 false 时保留 /
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,95 @@
+package tracking
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeSchedule 模拟运单从首次查询起各节点出现的时间
+var fakeSchedule = []struct {
+	after       time.Duration
+	status      Status
+	location    string
+	description string
+}{
+	{0, StatusInfoReceived, "发货地", "承运商已收到运单信息"},
+	{6 * time.Hour, StatusInTransit, "发货地分拨中心", "快件已揽收"},
+	{24 * time.Hour, StatusInTransit, "转运中心", "快件已到达转运中心"},
+	{48 * time.Hour, StatusOutForDelivery, "目的地网点", "快件正在派送"},
+	{54 * time.Hour, StatusDelivered, "目的地", "快件已签收"},
+}
+
+// FakeProvider 本地模拟的轨迹服务，不访问外部接口，用于开发和测试
+// 预先设置过轨迹的运单原样返回；其他运单从第一次查询开始按固定节奏推进，约两天后签收。
+// 运单号以 "EXC" 开头的模拟运输异常，以 "NOTFOUND" 开头的返回 ErrNotFound。
+type FakeProvider struct {
+	// Now 当前时间，测试中可替换
+	Now func() time.Time
+
+	mu        sync.Mutex
+	scripted  map[string][]Event
+	firstSeen map[string]time.Time
+}
+
+// NewFakeProvider 创建模拟轨迹服务
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{
+		Now:       time.Now,
+		scripted:  make(map[string][]Event),
+		firstSeen: make(map[string]time.Time),
+	}
+}
+
+// SetEvents 指定运单的轨迹，之后的查询直接返回这些轨迹
+func (p *FakeProvider) SetEvents(carrier, trackingNumber string, events []Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sorted := append([]Event{}, events...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+	p.scripted[fakeKey(carrier, trackingNumber)] = sorted
+}
+
+// Track 查询运单轨迹
+func (p *FakeProvider) Track(ctx context.Context, carrier, trackingNumber string) ([]Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	number := strings.ToUpper(strings.TrimSpace(trackingNumber))
+	if strings.HasPrefix(number, "NOTFOUND") {
+		return nil, ErrNotFound
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := fakeKey(carrier, trackingNumber)
+	if events, ok := p.scripted[key]; ok {
+		return append([]Event{}, events...), nil
+	}
+
+	now := p.Now()
+	start, ok := p.firstSeen[key]
+	if !ok {
+		start = now
+		p.firstSeen[key] = start
+	}
+	events := make([]Event, 0, len(fakeSchedule))
+	for i, step := range fakeSchedule {
+		at := start.Add(step.after)
+		if at.After(now) {
+			break
+		}
+		if strings.HasPrefix(number, "EXC") && i == 2 {
+			events = append(events, Event{Time: at, Status: StatusException, Location: step.location, Description: "快件滞留，等待处理"})
+			break
+		}
+		events = append(events, Event{Time: at, Status: step.status, Location: step.location, Description: step.description})
+	}
+	return events, nil
+}
+
+func fakeKey(carrier, trackingNumber string) string {
+	return normalizeCarrier(carrier) + "|" + strings.ToUpper(strings.TrimSpace(trackingNumber))
+}
@@ -0,0 +1,85 @@
+package tracking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gongChang/config"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnknownCarrier 没有可以查询该承运商的轨迹服务
+	ErrUnknownCarrier = errors.New("tracking: unknown carrier")
+	// ErrNotFound 承运商查不到该运单
+	ErrNotFound = errors.New("tracking: shipment not found")
+)
+
+// Status 物流轨迹节点的状态
+type Status string
+
+const (
+	StatusInfoReceived   Status = "info_received"    // 承运商已收到运单信息
+	StatusInTransit      Status = "in_transit"       // 运输中
+	StatusOutForDelivery Status = "out_for_delivery" // 派送中
+	StatusDelivered      Status = "delivered"        // 已签收
+	StatusException      Status = "exception"        // 异常（退回、滞留、地址错误等）
+)
+
+// Event 一条物流轨迹
+type Event struct {
+	Time        time.Time
+	Status      Status
+	Location    string
+	Description string
+}
+
+// Provider 承运商轨迹查询服务
+// Track 返回运单目前为止的全部轨迹，按时间先后排列；调用方负责去重。
+type Provider interface {
+	Track(ctx context.Context, carrier, trackingNumber string) ([]Event, error)
+}
+
+// Registry 按承运商分派轨迹查询，未注册的承运商交给默认服务
+type Registry struct {
+	providers map[string]Provider
+	fallback  Provider
+}
+
+// NewRegistry 创建分派器，fallback 为空时未注册的承运商返回 ErrUnknownCarrier
+func NewRegistry(fallback Provider) *Registry {
+	return &Registry{providers: make(map[string]Provider), fallback: fallback}
+}
+
+// Register 为承运商指定轨迹服务，承运商代码不区分大小写
+func (r *Registry) Register(carrier string, provider Provider) {
+	r.providers[normalizeCarrier(carrier)] = provider
+}
+
+// Track 查询运单轨迹
+func (r *Registry) Track(ctx context.Context, carrier, trackingNumber string) ([]Event, error) {
+	provider, ok := r.providers[normalizeCarrier(carrier)]
+	if !ok {
+		provider = r.fallback
+	}
+	if provider == nil {
+		return nil, ErrUnknownCarrier
+	}
+	return provider.Track(ctx, carrier, trackingNumber)
+}
+
+func normalizeCarrier(carrier string) string {
+	return strings.ToLower(strings.TrimSpace(carrier))
+}
+
+// NewFromConfig 根据配置创建轨迹查询服务，默认使用本地模拟服务
+func NewFromConfig(cfg *config.Config) (*Registry, error) {
+	switch cfg.Tracking.Driver {
+	case "", "fake":
+		return NewRegistry(NewFakeProvider()), nil
+	case "none":
+		return NewRegistry(nil), nil
+	}
+	return nil, fmt.Errorf("tracking: unknown driver %q", cfg.Tracking.Driver)
+}
@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+
+	// 注册可解码的图片格式
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/webp"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// EXIF 方向值，参见 TIFF/EXIF 规范 Orientation 标签（0x0112）
+const (
+	OrientationNormal     = 1
+	OrientationFlipH      = 2
+	OrientationRotate180  = 3
+	OrientationFlipV      = 4
+	OrientationTranspose  = 5
+	OrientationRotate90   = 6 // 顺时针旋转 90 度后显示
+	OrientationTransverse = 7
+	OrientationRotate270  = 8
+)
+
+// MaxDecodePixels 允许解码的最大像素数，防止超大图片耗尽内存
+const MaxDecodePixels = 50 * 1000 * 1000
+
+// ErrImageTooLarge 图片像素数超出解码限制
+var ErrImageTooLarge = errors.New("图片尺寸过大")
+
+// DecodeImage 解码图片，同时返回格式名和 JPEG 的 EXIF 方向
+func DecodeImage(r io.Reader) (image.Image, string, int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if config.Width*config.Height > MaxDecodePixels {
+		return nil, "", 0, ErrImageTooLarge
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", 0, err
+	}
+	orientation := OrientationNormal
+	if format == "jpeg" {
+		orientation = JPEGOrientation(data)
+	}
+	return img, format, orientation, nil
+}
+
+// JPEGOrientation 从 JPEG 的 APP1 段读取 EXIF 方向，缺失或无法解析时返回 OrientationNormal
+func JPEGOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return OrientationNormal
+	}
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xff {
+			return OrientationNormal
+		}
+		marker := data[pos+1]
+		// 图像数据开始后不会再有 EXIF
+		if marker == 0xda || marker == 0xd9 {
+			return OrientationNormal
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		if length < 2 || pos+2+length > len(data) {
+			return OrientationNormal
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xe1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		pos += 2 + length
+	}
+	return OrientationNormal
+}
+
+// exifOrientation 在 TIFF 结构的 IFD0 中查找方向标签
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return OrientationNormal
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return OrientationNormal
+	}
+	if order.Uint16(tiff[2:4]) != 42 {
+		return OrientationNormal
+	}
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return OrientationNormal
+	}
+	count := int(order.Uint16(tiff[offset : offset+2]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:entry+2]) != 0x0112 {
+			continue
+		}
+		// 类型 3（SHORT），值直接存放在值字段中
+		if order.Uint16(tiff[entry+2:entry+4]) != 3 {
+			break
+		}
+		value := int(order.Uint16(tiff[entry+8 : entry+10]))
+		if value >= OrientationNormal && value <= OrientationRotate270 {
+			return value
+		}
+		break
+	}
+	return OrientationNormal
+}
+
+// FitImage 按比例缩放到不超过 maxSize×maxSize，原图更小时不放大
+func FitImage(img image.Image, maxSize int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSize && height <= maxSize {
+		dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+		return dst
+	}
+
+	if width >= height {
+		height = maxInt(1, height*maxSize/width)
+		width = maxSize
+	} else {
+		width = maxInt(1, width*maxSize/height)
+		height = maxSize
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, xdraw.Src, nil)
+	return dst
+}
+
+// ApplyOrientation 按 EXIF 方向旋转或翻转图片，使其按正常方向显示
+func ApplyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= OrientationNormal || orientation > OrientationRotate270 {
+		return img
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= OrientationTranspose {
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			var sx, sy int
+			switch orientation {
+			case OrientationFlipH:
+				sx, sy = width-1-x, y
+			case OrientationRotate180:
+				sx, sy = width-1-x, height-1-y
+			case OrientationFlipV:
+				sx, sy = x, height-1-y
+			case OrientationTranspose:
+				sx, sy = y, x
+			case OrientationRotate90:
+				sx, sy = y, height-1-x
+			case OrientationTransverse:
+				sx, sy = width-1-y, height-1-x
+			case OrientationRotate270:
+				sx, sy = width-1-y, x
+			}
+			dst.Set(x, y, img.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,245 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// 简易 PDF 生成器
+// 仓库没有引入 PDF 依赖，这里只实现导出工艺单等表格文档需要的部分：文字、直线、矩形和分页。
+// 中文使用 PDF 阅读器内置的 Adobe-GB1 字体 STSong-Light（UniGB-UCS2-H 编码），不嵌入字体文件，
+// 生成的文件很小；基本多文种平面以外的字符输出为 "?"。坐标以页面左上角为原点，单位为点（1/72 英寸）。
+
+const (
+	PDFPageWidthA4  = 595.28
+	PDFPageHeightA4 = 841.89
+
+	// STSong-Light 中 ASCII 字符为半角宽度，其余为全角
+	pdfHalfWidth = 0.5
+	pdfFullWidth = 1.0
+)
+
+// PDF 多页 PDF 文档
+type PDF struct {
+	width  float64
+	height float64
+	title  string
+	pages  []*bytes.Buffer
+}
+
+// NewPDF 创建指定页面尺寸的文档
+func NewPDF(width, height float64, title string) *PDF {
+	return &PDF{width: width, height: height, title: title}
+}
+
+// Width 页面宽度
+func (p *PDF) Width() float64 { return p.width }
+
+// Height 页面高度
+func (p *PDF) Height() float64 { return p.height }
+
+// PageCount 当前页数
+func (p *PDF) PageCount() int { return len(p.pages) }
+
+// AddPage 追加新页，之后的绘制都写入该页
+func (p *PDF) AddPage() {
+	p.pages = append(p.pages, &bytes.Buffer{})
+}
+
+func (p *PDF) page() *bytes.Buffer {
+	if len(p.pages) == 0 {
+		p.AddPage()
+	}
+	return p.pages[len(p.pages)-1]
+}
+
+// Text 在 (x, y) 处输出一行文字，y 为基线位置
+func (p *PDF) Text(x, y, size float64, text string) {
+	if text == "" {
+		return
+	}
+	fmt.Fprintf(p.page(), "BT /F1 %s Tf %s %s Td <%s> Tj ET\n",
+		pdfNum(size), pdfNum(x), pdfNum(p.height-y), pdfEncodeUCS2(text))
+}
+
+// Line 画一条直线
+func (p *PDF) Line(x1, y1, x2, y2, lineWidth float64) {
+	fmt.Fprintf(p.page(), "%s w %s %s m %s %s l S\n",
+		pdfNum(lineWidth), pdfNum(x1), pdfNum(p.height-y1), pdfNum(x2), pdfNum(p.height-y2))
+}
+
+// Rect 画矩形边框
+func (p *PDF) Rect(x, y, w, h, lineWidth float64) {
+	fmt.Fprintf(p.page(), "%s w %s %s %s %s re S\n",
+		pdfNum(lineWidth), pdfNum(x), pdfNum(p.height-y-h), pdfNum(w), pdfNum(h))
+}
+
+// FillRect 用灰度填充矩形，gray 取 0（黑）到 1（白）
+func (p *PDF) FillRect(x, y, w, h, gray float64) {
+	fmt.Fprintf(p.page(), "q %s g %s %s %s %s re f Q\n",
+		pdfNum(gray), pdfNum(x), pdfNum(p.height-y-h), pdfNum(w), pdfNum(h))
+}
+
+// PDFTextWidth 文字在指定字号下的宽度
+func PDFTextWidth(text string, size float64) float64 {
+	width := 0.0
+	for _, r := range text {
+		if r >= 0x20 && r <= 0x7e {
+			width += pdfHalfWidth
+		} else {
+			width += pdfFullWidth
+		}
+	}
+	return width * size
+}
+
+// PDFWrapText 按宽度折行，英文单词尽量不拆开，原有换行保留
+func PDFWrapText(text string, size, width float64) []string {
+	lines := make([]string, 0)
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		current := ""
+		for len(paragraph) > 0 {
+			token := pdfNextToken(paragraph)
+			paragraph = paragraph[len(token):]
+			if PDFTextWidth(current+token, size) <= width {
+				current += token
+				continue
+			}
+			if current != "" {
+				lines = append(lines, strings.TrimRight(current, " "))
+				current = strings.TrimLeft(token, " ")
+			} else {
+				current = token
+			}
+			// 单个词超出宽度时按字符拆开
+			for PDFTextWidth(current, size) > width && utf8.RuneCountInString(current) > 1 {
+				cut := pdfFitPrefix(current, size, width)
+				lines = append(lines, current[:cut])
+				current = current[cut:]
+			}
+		}
+		lines = append(lines, strings.TrimRight(current, " "))
+	}
+	return lines
+}
+
+// pdfNextToken 取出下一个折行单位：连续的 ASCII 非空白字符（含其后的空格）或单个其他字符
+func pdfNextToken(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r > 0x7e || r == ' ' {
+		return s[:size]
+	}
+	end := 0
+	for end < len(s) && s[end] > ' ' && s[end] <= 0x7e {
+		end++
+	}
+	for end < len(s) && s[end] == ' ' {
+		end++
+	}
+	if end == 0 {
+		return s[:size]
+	}
+	return s[:end]
+}
+
+// pdfFitPrefix 能放进宽度的最长前缀的字节长度，至少一个字符
+func pdfFitPrefix(s string, size, width float64) int {
+	used := 0.0
+	for i, r := range s {
+		w := PDFTextWidth(string(r), size)
+		if used+w > width && i > 0 {
+			return i
+		}
+		used += w
+	}
+	return len(s)
+}
+
+// WriteTo 输出完整的 PDF 文件
+func (p *PDF) WriteTo(w io.Writer) (int64, error) {
+	if len(p.pages) == 0 {
+		p.AddPage()
+	}
+
+	var out bytes.Buffer
+	offsets := make([]int, 0, 6+2*len(p.pages))
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1 目录 2 页面树 3-5 字体 6 文档信息，之后每页两个对象：页面和内容流
+	firstPage := 7
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	object("<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light-UniGB-UCS2-H /Encoding /UniGB-UCS2-H /DescendantFonts [4 0 R] >>")
+	object("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light " +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> " +
+		"/FontDescriptor 5 0 R /DW 1000 /W [1 95 500] >>")
+	object("<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] " +
+		"/ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>")
+	object(fmt.Sprintf("<< /Title <%s> /Producer (gongChang) >>", pdfUTF16Title(p.title)))
+
+	for i, content := range p.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] "+
+			"/Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfNum(p.width), pdfNum(p.height), firstPage+2*i+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 6 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	n, err := w.Write(out.Bytes())
+	return int64(n), err
+}
+
+// pdfEncodeUCS2 文字编码为 UCS-2 大端十六进制串
+func pdfEncodeUCS2(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if r > 0xffff || (r >= 0xd800 && r <= 0xdfff) {
+			r = '?'
+		}
+		fmt.Fprintf(&b, "%04X", r)
+	}
+	return b.String()
+}
+
+// pdfUTF16Title 文档信息中的文本使用带 BOM 的 UTF-16
+func pdfUTF16Title(text string) string {
+	var b strings.Builder
+	b.WriteString("FEFF")
+	for _, r := range text {
+		if r > 0xffff {
+			r1, r2 := 0xd800+((r-0x10000)>>10), 0xdc00+((r-0x10000)&0x3ff)
+			fmt.Fprintf(&b, "%04X%04X", r1, r2)
+			continue
+		}
+		fmt.Fprintf(&b, "%04X", r)
+	}
+	return b.String()
+}
+
+// pdfNum 输出两位小数并去掉多余的零
+func pdfNum(v float64) string {
+	s := fmt.Sprintf("%.2f", v)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "" || s == "-0" {
+		return "0"
+	}
+	return s
+}
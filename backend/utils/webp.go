@@ -0,0 +1,496 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+)
+
+// WebP 无损（VP8L）编码器
+// golang.org/x/image 只提供 WebP 解码，这里实现一个纯 Go 的无损编码：
+// 使用减绿变换和按块选择的预测变换，熵编码只使用字面量（不做 LZ77 回溯和颜色缓存），
+// 压缩率不及 libwebp，但输出可被所有 WebP 解码器读取，适合生成预览图。
+
+const (
+	vp8lMaxDimension   = 1 << 14
+	vp8lPredictorBits  = 4 // 预测模式块大小 16x16
+	vp8lMaxCodeLength  = 15
+	vp8lMaxCLCodeLen   = 7
+	vp8lNumLengthCodes = 19
+	vp8lGreenAlphabet  = 256 + 24
+	vp8lDistAlphabet   = 40
+)
+
+// 码长编码的写入顺序
+var vp8lCodeLengthOrder = [vp8lNumLengthCodes]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// 编码时尝试的预测模式：左、上、左上平均、Select、ClampAddSubtractFull
+var vp8lPredictorModes = []int{1, 2, 7, 11, 12}
+
+// ErrWebPImageTooLarge 图片尺寸超出 WebP 限制
+var ErrWebPImageTooLarge = errors.New("图片尺寸超出 WebP 限制")
+
+// EncodeWebPLossless 将图片编码为无损 WebP
+func EncodeWebPLossless(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= 0 || height <= 0 || width > vp8lMaxDimension || height > vp8lMaxDimension {
+		return ErrWebPImageTooLarge
+	}
+
+	argb := make([]uint32, width*height)
+	hasAlpha := false
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			if c.A != 0xff {
+				hasAlpha = true
+			}
+			argb[y*width+x] = uint32(c.A)<<24 | uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+		}
+	}
+
+	bw := &vp8lBitWriter{}
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if hasAlpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3)
+
+	// 减绿变换
+	bw.write(1, 1)
+	bw.write(2, 2)
+	for i, p := range argb {
+		g := (p >> 8) & 0xff
+		r := ((p >> 16) - g) & 0xff
+		b := (p - g) & 0xff
+		argb[i] = p&0xff00ff00 | r<<16 | b
+	}
+
+	// 预测变换
+	bw.write(1, 1)
+	bw.write(0, 2)
+	bw.write(vp8lPredictorBits-2, 3)
+	modes, residuals := vp8lPredict(argb, width, height)
+	bw.write(0, 1)
+	vp8lWriteImageData(bw, modes)
+
+	// 变换结束，主图像不使用颜色缓存和元前缀码
+	bw.write(0, 1)
+	bw.write(0, 1)
+	bw.write(0, 1)
+	vp8lWriteImageData(bw, residuals)
+
+	data := bw.bytes()
+	chunkSize := len(data)
+	padded := chunkSize + chunkSize&1
+
+	header := make([]byte, 20)
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], uint32(4+8+padded))
+	copy(header[8:12], "WEBP")
+	copy(header[12:16], "VP8L")
+	binary.LittleEndian.PutUint32(header[16:20], uint32(chunkSize))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if padded != chunkSize {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+// vp8lPredict 为每个块选择残差最小的预测模式，返回模式图和残差图像
+func vp8lPredict(argb []uint32, width, height int) ([]uint32, []uint32) {
+	blockSize := 1 << vp8lPredictorBits
+	tilesX := (width + blockSize - 1) >> vp8lPredictorBits
+	tilesY := (height + blockSize - 1) >> vp8lPredictorBits
+	modes := make([]uint32, tilesX*tilesY)
+	residuals := make([]uint32, len(argb))
+
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			x0, y0 := tx*blockSize, ty*blockSize
+			x1, y1 := minInt(x0+blockSize, width), minInt(y0+blockSize, height)
+
+			best, bestCost := vp8lPredictorModes[0], -1
+			for _, mode := range vp8lPredictorModes {
+				cost := 0
+				for y := y0; y < y1; y++ {
+					for x := x0; x < x1; x++ {
+						cost += vp8lResidualCost(argb[y*width+x], vp8lPrediction(argb, width, x, y, mode))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+
+			modes[ty*tilesX+tx] = 0xff000000 | uint32(best)<<8
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					i := y*width + x
+					residuals[i] = vp8lSubPixels(argb[i], vp8lPrediction(argb, width, x, y, best))
+				}
+			}
+		}
+	}
+	return modes, residuals
+}
+
+// vp8lPrediction 计算像素的预测值；首行、首列按规范固定使用左或上像素
+func vp8lPrediction(argb []uint32, width, x, y, mode int) uint32 {
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return argb[x-1]
+	case x == 0:
+		return argb[(y-1)*width]
+	}
+
+	i := y*width + x
+	left, top, topLeft := argb[i-1], argb[i-width], argb[i-width-1]
+	switch mode {
+	case 1:
+		return left
+	case 2:
+		return top
+	case 7:
+		return vp8lAverage2(left, top)
+	case 11:
+		return vp8lSelect(left, top, topLeft)
+	case 12:
+		return vp8lClampAddSubtractFull(left, top, topLeft)
+	}
+	return 0xff000000
+}
+
+func vp8lAverage2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+func vp8lSelect(left, top, topLeft uint32) uint32 {
+	predLeft, predTop := 0, 0
+	for shift := uint(0); shift < 32; shift += 8 {
+		l := int(left>>shift) & 0xff
+		t := int(top>>shift) & 0xff
+		tl := int(topLeft>>shift) & 0xff
+		estimate := l + t - tl
+		predLeft += absInt(estimate - l)
+		predTop += absInt(estimate - t)
+	}
+	if predLeft < predTop {
+		return left
+	}
+	return top
+}
+
+func vp8lClampAddSubtractFull(a, b, c uint32) uint32 {
+	var result uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		v := int(a>>shift&0xff) + int(b>>shift&0xff) - int(c>>shift&0xff)
+		if v < 0 {
+			v = 0
+		} else if v > 255 {
+			v = 255
+		}
+		result |= uint32(v) << shift
+	}
+	return result
+}
+
+func vp8lSubPixels(a, b uint32) uint32 {
+	alphaGreen := 0x00ff00ff + (a & 0xff00ff00) - (b & 0xff00ff00)
+	redBlue := 0xff00ff00 + (a & 0x00ff00ff) - (b & 0x00ff00ff)
+	return (alphaGreen & 0xff00ff00) | (redBlue & 0x00ff00ff)
+}
+
+// vp8lResidualCost 残差绝对值之和，按有符号字节计算
+func vp8lResidualCost(pixel, prediction uint32) int {
+	diff := vp8lSubPixels(pixel, prediction)
+	cost := 0
+	for shift := uint(0); shift < 32; shift += 8 {
+		cost += absInt(int(int8(diff >> shift)))
+	}
+	return cost
+}
+
+// vp8lWriteImageData 写入一组前缀码（绿、红、蓝、透明、距离）和按字面量编码的像素
+func vp8lWriteImageData(bw *vp8lBitWriter, pixels []uint32) {
+	green := make([]uint32, vp8lGreenAlphabet)
+	red := make([]uint32, 256)
+	blue := make([]uint32, 256)
+	alpha := make([]uint32, 256)
+	for _, p := range pixels {
+		green[(p>>8)&0xff]++
+		red[(p>>16)&0xff]++
+		blue[p&0xff]++
+		alpha[p>>24]++
+	}
+
+	greenCodes := vp8lWritePrefixCode(bw, green)
+	redCodes := vp8lWritePrefixCode(bw, red)
+	blueCodes := vp8lWritePrefixCode(bw, blue)
+	alphaCodes := vp8lWritePrefixCode(bw, alpha)
+	vp8lWritePrefixCode(bw, make([]uint32, vp8lDistAlphabet))
+
+	for _, p := range pixels {
+		greenCodes.write(bw, int(p>>8)&0xff)
+		redCodes.write(bw, int(p>>16)&0xff)
+		blueCodes.write(bw, int(p)&0xff)
+		alphaCodes.write(bw, int(p>>24))
+	}
+}
+
+// vp8lPrefixCode 已按 LSB 优先位序翻转的前缀码
+type vp8lPrefixCode struct {
+	codes   []uint32
+	lengths []uint8
+}
+
+func (c *vp8lPrefixCode) write(bw *vp8lBitWriter, symbol int) {
+	if n := c.lengths[symbol]; n > 0 {
+		bw.write(c.codes[symbol], uint(n))
+	}
+}
+
+// vp8lWritePrefixCode 写入一个前缀码的定义并返回编码表；不超过两个符号时使用简单编码
+func vp8lWritePrefixCode(bw *vp8lBitWriter, counts []uint32) *vp8lPrefixCode {
+	code := &vp8lPrefixCode{
+		codes:   make([]uint32, len(counts)),
+		lengths: make([]uint8, len(counts)),
+	}
+
+	var used []int
+	for symbol, count := range counts {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+	if len(used) <= 2 && (len(used) == 0 || used[len(used)-1] < 256) {
+		bw.write(1, 1)
+		if len(used) == 0 {
+			used = []int{0}
+		}
+		bw.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(used[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			bw.write(uint32(used[1]), 8)
+			code.lengths[used[0]], code.lengths[used[1]] = 1, 1
+			code.codes[used[1]] = 1
+		}
+		return code
+	}
+
+	code.lengths = vp8lCodeLengths(counts, vp8lMaxCodeLength)
+	code.codes = vp8lCanonicalCodes(code.lengths)
+
+	// 码长序列：连续的 0 用 17/18 游程编码
+	type token struct{ symbol, extra, extraBits int }
+	var tokens []token
+	for i := 0; i < len(code.lengths); {
+		if code.lengths[i] != 0 {
+			tokens = append(tokens, token{symbol: int(code.lengths[i])})
+			i++
+			continue
+		}
+		run := 0
+		for i+run < len(code.lengths) && code.lengths[i+run] == 0 {
+			run++
+		}
+		i += run
+		for run > 0 {
+			switch {
+			case run >= 11:
+				n := minInt(run, 138)
+				tokens = append(tokens, token{symbol: 18, extra: n - 11, extraBits: 7})
+				run -= n
+			case run >= 3:
+				tokens = append(tokens, token{symbol: 17, extra: run - 3, extraBits: 3})
+				run = 0
+			default:
+				tokens = append(tokens, token{symbol: 0})
+				run--
+			}
+		}
+	}
+
+	histogram := make([]uint32, vp8lNumLengthCodes)
+	for _, t := range tokens {
+		histogram[t.symbol]++
+	}
+	clLengths := vp8lCodeLengths(histogram, vp8lMaxCLCodeLen)
+	clCodes := vp8lCanonicalCodes(clLengths)
+
+	numCodes := vp8lNumLengthCodes
+	for numCodes > 4 && clLengths[vp8lCodeLengthOrder[numCodes-1]] == 0 {
+		numCodes--
+	}
+	bw.write(0, 1)
+	bw.write(uint32(numCodes-4), 4)
+	for i := 0; i < numCodes; i++ {
+		bw.write(uint32(clLengths[vp8lCodeLengthOrder[i]]), 3)
+	}
+	bw.write(0, 1) // 码长覆盖整个字母表
+	for _, t := range tokens {
+		bw.write(clCodes[t.symbol], uint(clLengths[t.symbol]))
+		if t.extraBits > 0 {
+			bw.write(uint32(t.extra), uint(t.extraBits))
+		}
+	}
+	return code
+}
+
+// vp8lCodeLengths 根据频次构建长度受限的哈夫曼码长；超长时抬高低频符号的频次后重建
+// 只有一个符号时补一个虚拟符号，保证码表是完整的二叉树。
+func vp8lCodeLengths(counts []uint32, maxLength int) []uint8 {
+	lengths := make([]uint8, len(counts))
+	var used []int
+	for symbol, count := range counts {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+	switch len(used) {
+	case 0:
+		return lengths
+	case 1:
+		lengths[used[0]] = 1
+		if used[0] == 0 {
+			lengths[1] = 1
+		} else {
+			lengths[0] = 1
+		}
+		return lengths
+	}
+
+	type node struct {
+		weight      uint64
+		left, right int
+		symbol      int
+	}
+	for minWeight := uint64(1); ; minWeight *= 2 {
+		nodes := make([]node, 0, 2*len(used))
+		queue := make([]int, 0, len(used))
+		for _, symbol := range used {
+			weight := uint64(counts[symbol])
+			if weight < minWeight {
+				weight = minWeight
+			}
+			nodes = append(nodes, node{weight: weight, left: -1, right: -1, symbol: symbol})
+			queue = append(queue, len(nodes)-1)
+		}
+		for len(queue) > 1 {
+			sort.SliceStable(queue, func(i, j int) bool { return nodes[queue[i]].weight < nodes[queue[j]].weight })
+			a, b := queue[0], queue[1]
+			nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, left: a, right: b, symbol: -1})
+			queue = append(queue[2:], len(nodes)-1)
+		}
+
+		maxDepth := 0
+		var walk func(i, depth int)
+		walk = func(i, depth int) {
+			if nodes[i].symbol >= 0 {
+				lengths[nodes[i].symbol] = uint8(depth)
+				if depth > maxDepth {
+					maxDepth = depth
+				}
+				return
+			}
+			walk(nodes[i].left, depth+1)
+			walk(nodes[i].right, depth+1)
+		}
+		walk(queue[0], 0)
+		if maxDepth <= maxLength {
+			return lengths
+		}
+	}
+}
+
+// vp8lCanonicalCodes 由码长生成规范哈夫曼码，并翻转为 LSB 优先的位序
+func vp8lCanonicalCodes(lengths []uint8) []uint32 {
+	var lengthCount [vp8lMaxCodeLength + 1]uint32
+	for _, n := range lengths {
+		if n > 0 {
+			lengthCount[n]++
+		}
+	}
+	var nextCode [vp8lMaxCodeLength + 2]uint32
+	code := uint32(0)
+	for n := 1; n <= vp8lMaxCodeLength; n++ {
+		code = (code + lengthCount[n-1]) << 1
+		nextCode[n] = code
+	}
+
+	codes := make([]uint32, len(lengths))
+	for symbol, n := range lengths {
+		if n == 0 {
+			continue
+		}
+		c := nextCode[n]
+		nextCode[n]++
+		var reversed uint32
+		for i := uint8(0); i < n; i++ {
+			reversed = reversed<<1 | (c>>i)&1
+		}
+		codes[symbol] = reversed
+	}
+	return codes
+}
+
+// vp8lBitWriter 按 LSB 优先顺序写入位流
+type vp8lBitWriter struct {
+	buf  []byte
+	acc  uint64
+	nbit uint
+}
+
+func (b *vp8lBitWriter) write(value uint32, n uint) {
+	b.acc |= uint64(value&(1<<n-1)) << b.nbit
+	b.nbit += n
+	for b.nbit >= 8 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc >>= 8
+		b.nbit -= 8
+	}
+}
+
+func (b *vp8lBitWriter) bytes() []byte {
+	if b.nbit > 0 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc, b.nbit = 0, 0
+	}
+	return b.buf
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}